@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/codec/yaml"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/core"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/generic"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/migration"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// NewDBCommand returns instance of cobra command for DB maintenance
+func NewDBCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "DB maintenance",
+		Long:  "DB maintenance",
+	}
+
+	cmd.AddCommand(
+		newDBCompactCommand(),
+		newDBDumpCommand(),
+		newDBRestoreCommand(),
+		newDBMigrateCommand(),
+	)
+
+	return cmd
+}
+
+func newDBCompactCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compact",
+		Short: "Compact DB according to retention settings",
+		Long:  "Compact DB according to retention settings. BoltDB can't be shared, so Aptomi server should be stopped first",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			registry := runtime.NewRegistry().Append(store.Objects...)
+			db, err := generic.NewStore(registry, cfg.DB)
+			if err != nil {
+				panic(fmt.Sprintf("Can't open object store: %s", err))
+			}
+			defer db.Close() // nolint: errcheck
+
+			result, err := core.NewStore(db).Compact(cfg.Retention, time.Now())
+			if err != nil {
+				panic(fmt.Sprintf("Error while compacting DB: %s", err))
+			}
+
+			fmt.Printf("Revisions trimmed: %d\n", result.RevisionsTrimmed)
+			fmt.Printf("Revisions removed: %d\n", result.RevisionsRemoved)
+			fmt.Printf("Policy generations removed: %d\n", result.PolicyGenerationsRemoved)
+			fmt.Printf("Object generations removed: %d\n", result.ObjectGenerationsRemoved)
+			fmt.Printf("Encoded data removed: %d bytes\n", result.RemovedDataBytes)
+		},
+	}
+
+	return cmd
+}
+
+func newDBDumpCommand() *cobra.Command {
+	var output, format string
+	var includeSecrets bool
+
+	cmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Dump DB into a backup file",
+		Long:  "Dump all policy generations, revisions and actual state into a backup file, which could be restored into any type of DB. BoltDB can't be shared, so Aptomi server should be stopped first or backup API should be used instead. Generated secrets are not included by default, so they get generated again after restore unless --include-secrets is specified",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			registry := runtime.NewRegistry().Append(store.BackupObjects...)
+			var codec runtime.Codec
+			switch format {
+			case "yaml":
+				codec = yaml.NewCodec(registry)
+			case "json":
+				codec = yaml.NewJSONCodec(registry)
+			default:
+				panic(fmt.Sprintf("Unknown backup format: %s", format))
+			}
+
+			db, err := generic.NewStore(registry, cfg.DB)
+			if err != nil {
+				panic(fmt.Sprintf("Can't open object store: %s", err))
+			}
+			defer db.Close() // nolint: errcheck
+
+			backup, err := core.NewStore(db).Dump(includeSecrets)
+			if err != nil {
+				panic(fmt.Sprintf("Error while dumping DB: %s", err))
+			}
+
+			data, err := codec.EncodeMany(backup)
+			if err != nil {
+				panic(fmt.Sprintf("Error while encoding backup: %s", err))
+			}
+
+			if len(output) > 0 {
+				err = ioutil.WriteFile(output, data, 0600)
+			} else {
+				_, err = os.Stdout.Write(data)
+			}
+			if err != nil {
+				panic(fmt.Sprintf("Error while writing backup: %s", err))
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Backup file to write into (stdout by default)")
+	cmd.Flags().StringVar(&format, "format", "yaml", "Backup format (yaml or json)")
+	cmd.Flags().BoolVar(&includeSecrets, "include-secrets", false, "Include generated secrets into the backup")
+
+	return cmd
+}
+
+func newDBRestoreCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Restore DB from a backup file",
+		Long:  "Restore DB from a backup file, preserving all generations of objects. DB should be empty and Aptomi server should be stopped first",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				panic(fmt.Sprintf("Backup file should be specified"))
+			}
+
+			data, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				panic(fmt.Sprintf("Error while reading backup file %s: %s", args[0], err))
+			}
+
+			// JSON is a subset of YAML, so backup in both formats is decoded by YAML codec
+			registry := runtime.NewRegistry().Append(store.BackupObjects...)
+			backup, err := yaml.NewCodec(registry).DecodeOneOrMany(data)
+			if err != nil {
+				panic(fmt.Sprintf("Error while decoding backup file %s: %s", args[0], err))
+			}
+
+			db, err := generic.NewStore(registry, cfg.DB)
+			if err != nil {
+				panic(fmt.Sprintf("Can't open object store: %s", err))
+			}
+			defer db.Close() // nolint: errcheck
+
+			restored, err := core.NewStore(db).Restore(backup)
+			if err != nil {
+				panic(fmt.Sprintf("Error while restoring DB: %s", err))
+			}
+
+			fmt.Printf("Objects restored: %d\n", restored)
+		},
+	}
+
+	return cmd
+}
+
+func newDBMigrateCommand() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Migrate DB to the latest schema version",
+		Long:  "Migrate DB to the latest schema version, same as it's done on server start. Backup is written into migration backup directory first. BoltDB can't be shared, so Aptomi server should be stopped first",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			db, err := generic.NewStore(runtime.NewRegistry().Append(store.Objects...), cfg.DB)
+			if err != nil {
+				panic(fmt.Sprintf("Can't open object store: %s", err))
+			}
+			defer db.Close() // nolint: errcheck
+
+			result, err := migration.Run(db, migration.All, cfg.Migration.BackupDir, dryRun)
+			if err != nil {
+				panic(fmt.Sprintf("Error while migrating DB: %s", err))
+			}
+
+			fmt.Printf("Schema version: %d -> %d\n", result.FromVersion, result.ToVersion)
+			for _, applied := range result.Applied {
+				fmt.Printf("Migration %d: %s\n", applied.Version, applied.Description)
+			}
+			fmt.Printf("Objects changed: %d\n", result.ObjectsChanged)
+			if dryRun {
+				fmt.Println("Dry run, DB hasn't been changed")
+			} else if len(result.Backup) > 0 {
+				fmt.Printf("Backup: %s\n", result.Backup)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only show migrations to be applied and number of objects to be changed, without changing DB")
+
+	return cmd
+}
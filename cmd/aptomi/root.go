@@ -38,11 +38,26 @@ func init() {
 
 	// add server-specific flags
 	common.AddStringFlag(aptomiCmd, "db.connection", "db", "", "/var/lib/aptomi/db.bolt", envPrefix+"_DB_CONN", "DB connection string")
+	common.AddBoolFlag(aptomiCmd, "db.tls.enabled", "db-tls", "", false, envPrefix+"_DB_TLS", "Connect to etcd over TLS")
+	common.AddStringFlag(aptomiCmd, "db.tls.cafile", "db-tls-ca", "", "", envPrefix+"_DB_TLS_CA", "CA certificate file to verify etcd servers with (system CAs are used by default)")
+	common.AddStringFlag(aptomiCmd, "db.tls.certfile", "db-tls-cert", "", "", envPrefix+"_DB_TLS_CERT", "Client certificate file to authenticate with etcd")
+	common.AddStringFlag(aptomiCmd, "db.tls.keyfile", "db-tls-key", "", "", envPrefix+"_DB_TLS_KEY", "Client key file to authenticate with etcd")
 	common.AddStringFlag(aptomiCmd, "ui.schema", "ui-schema", "", "http", envPrefix+"_SCHEMA", "Server UI schema")
 	common.AddBoolFlag(aptomiCmd, "ui.enable", "ui", "", true, envPrefix+"_UI", "Enable server to serve UI")
 	common.AddDurationFlag(aptomiCmd, "enforcer.interval", "enforcer-interval", "", 60*time.Second, envPrefix+"_ENFORCER_INTERVAL", "Enforcer interval")
+	common.AddDurationFlag(aptomiCmd, "dependencyexpiry.interval", "dependency-expiry-interval", "", 60*time.Second, envPrefix+"_DEPENDENCY_EXPIRY_INTERVAL", "Interval for checking and removing expired dependencies")
+	common.AddDurationFlag(aptomiCmd, "dependencyexpiry.warning", "dependency-expiry-warning", "", 1*time.Hour, envPrefix+"_DEPENDENCY_EXPIRY_WARNING", "How long before dependency expiry to start reporting warnings")
+	common.AddBoolFlag(aptomiCmd, "leaderelection.enabled", "leader-election", "", false, envPrefix+"_LEADER_ELECTION", "Enable leader election, so only one of the servers sharing the same DB runs the enforcer")
+	common.AddStringFlag(aptomiCmd, "leaderelection.id", "leader-election-id", "", "", envPrefix+"_LEADER_ELECTION_ID", "Identifier of the server in leader election (defaults to hostname and process id)")
+	common.AddDurationFlag(aptomiCmd, "leaderelection.ttl", "leader-election-ttl", "", 15*time.Second, envPrefix+"_LEADER_ELECTION_TTL", "How long leadership lasts unless it's renewed")
+	common.AddDurationFlag(aptomiCmd, "retention.interval", "retention-interval", "", 1*time.Hour, envPrefix+"_RETENTION_INTERVAL", "Interval for compacting DB according to retention settings (zero disables it)")
+	common.AddIntFlag(aptomiCmd, "retention.revisions", "retention-revisions", "", 100, envPrefix+"_RETENTION_REVISIONS", "Number of last revisions to keep in full")
+	common.AddDurationFlag(aptomiCmd, "retention.age", "retention-age", "", 30*24*time.Hour, envPrefix+"_RETENTION_AGE", "How long to keep revisions in full")
+	common.AddDurationFlag(aptomiCmd, "retention.removeage", "retention-remove-age", "", 0, envPrefix+"_RETENTION_REMOVE_AGE", "How long to keep revisions before removing them completely (zero keeps them forever)")
+	common.AddStringFlag(aptomiCmd, "migration.backupdir", "migration-backup-dir", "", "/var/lib/aptomi/backup", envPrefix+"_MIGRATION_BACKUP_DIR", "Directory to write DB backup into before migrating it to the latest schema version")
 
 	aptomiCmd.AddCommand(NewVersionCommand())
+	aptomiCmd.AddCommand(NewDBCommand())
 }
 
 func preRun(command *cobra.Command, args []string) {
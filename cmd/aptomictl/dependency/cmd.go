@@ -0,0 +1,21 @@
+package dependency
+
+import (
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+// NewCommand returns cobra command for dependency subcommand
+func NewCommand(cfg *config.Client) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dependency",
+		Short: "dependency subcommand",
+		Long:  "dependency subcommand long",
+	}
+
+	cmd.AddCommand(
+		newExtendCommand(cfg),
+	)
+
+	return cmd
+}
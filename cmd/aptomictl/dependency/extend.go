@@ -0,0 +1,47 @@
+package dependency
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/cmd/common"
+	"github.com/Aptomi/aptomi/pkg/client/rest"
+	"github.com/Aptomi/aptomi/pkg/client/rest/http"
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/spf13/cobra"
+	"strings"
+	"time"
+)
+
+func newExtendCommand(cfg *config.Client) *cobra.Command {
+	var duration time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "extend <namespace>/<name>",
+		Short: "extend dependency expiry",
+		Long:  "extend dependency expiry, only dependencies with expiry or TTL set can be extended",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				panic(fmt.Sprintf("Dependency should be specified as <namespace>/<name>"))
+			}
+			parts := strings.Split(args[0], "/")
+			if len(parts) != 2 || len(parts[0]) <= 0 || len(parts[1]) <= 0 {
+				panic(fmt.Sprintf("Dependency should be specified as <namespace>/<name>, but found: %s", args[0]))
+			}
+
+			result, err := rest.New(cfg, http.NewClient(cfg)).Dependency().Extend(parts[0], parts[1], duration)
+			if err != nil {
+				panic(fmt.Sprintf("Error while extending dependency: %s", err))
+			}
+
+			data, err := common.Format(cfg.Output, false, result)
+			if err != nil {
+				panic(fmt.Sprintf("Error while formating policy update result: %s", err))
+			}
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().DurationVar(&duration, "by", 24*time.Hour, "Duration to extend dependency expiry by")
+
+	return cmd
+}
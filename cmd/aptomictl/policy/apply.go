@@ -7,14 +7,11 @@ import (
 	"github.com/Aptomi/aptomi/pkg/client/rest/http"
 	"github.com/Aptomi/aptomi/pkg/config"
 	"github.com/spf13/cobra"
-	"time"
 )
 
 func newApplyCommand(cfg *config.Client) *cobra.Command {
 	paths := make([]string, 0)
-	var wait bool
-	var waitInterval time.Duration
-	var waitAttempts int
+	var wait *waitFlags
 
 	cmd := &cobra.Command{
 		Use:   "apply",
@@ -39,11 +36,11 @@ func newApplyCommand(cfg *config.Client) *cobra.Command {
 			}
 			fmt.Println(string(data))
 
-			if !wait {
+			if !wait.enabled {
 				return
 			}
 
-			waitForApplyToFinish(waitAttempts, waitInterval, client, result)
+			waitForApplyToFinish(wait.getTimeout(cmd), client, result)
 		},
 	}
 
@@ -51,9 +48,7 @@ func newApplyCommand(cfg *config.Client) *cobra.Command {
 	if err := cmd.MarkFlagRequired("policyPaths"); err != nil {
 		panic(err)
 	}
-	cmd.Flags().BoolVar(&wait, "wait", false, "Wait until first revision with updated policy will be fully applied")
-	cmd.Flags().DurationVar(&waitInterval, "wait-interval", 2*time.Second, "Seconds to sleep between wait attempts")
-	cmd.Flags().IntVar(&waitAttempts, "wait-attempts", 150, "Number of attempts to do before failure while waiting")
+	wait = addWaitFlags(cmd, "Wait until first revision with updated policy will be fully applied")
 
 	return cmd
 }
@@ -17,6 +17,7 @@ func NewCommand(cfg *config.Client) *cobra.Command {
 		newShowCommand(cfg),
 		newApplyCommand(cfg),
 		newDeleteCommand(cfg),
+		newHistoryCommand(cfg),
 	)
 
 	return cmd
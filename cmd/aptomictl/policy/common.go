@@ -10,8 +10,8 @@ import (
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/runtime/codec/yaml"
 	"github.com/Aptomi/aptomi/pkg/util"
-	"github.com/Aptomi/aptomi/pkg/util/retry"
 	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
 	yamlv2 "gopkg.in/yaml.v2"
 	"io/ioutil"
 	"os"
@@ -144,52 +144,81 @@ func findPolicyFiles(policyPaths []string) ([]string, error) {
 	return allFiles, nil
 }
 
-func waitForApplyToFinish(attempts int, interval time.Duration, client client.Core, result *api.PolicyUpdateResult) {
+// waitFlags are flags for waiting until the first revision with updated policy gets applied
+type waitFlags struct {
+	enabled bool
+	timeout time.Duration
+
+	// interval and attempts are deprecated flags, which were used for polling revision status
+	interval time.Duration
+	attempts int
+}
+
+func addWaitFlags(cmd *cobra.Command, usage string) *waitFlags {
+	flags := &waitFlags{}
+	cmd.Flags().BoolVar(&flags.enabled, "wait", false, usage)
+	cmd.Flags().DurationVar(&flags.timeout, "wait-timeout", 5*time.Minute, "Time to wait before failure while waiting")
+	cmd.Flags().DurationVar(&flags.interval, "wait-interval", 2*time.Second, "Seconds to sleep between wait attempts")
+	cmd.Flags().IntVar(&flags.attempts, "wait-attempts", 150, "Number of attempts to do before failure while waiting")
+	for _, name := range []string{"wait-interval", "wait-attempts"} {
+		if err := cmd.Flags().MarkDeprecated(name, "use --wait-timeout instead"); err != nil {
+			panic(err)
+		}
+	}
+	return flags
+}
+
+// getTimeout returns wait timeout, which is calculated from the deprecated flags if any of them is specified
+func (flags *waitFlags) getTimeout(cmd *cobra.Command) time.Duration {
+	if cmd.Flags().Changed("wait-interval") || cmd.Flags().Changed("wait-attempts") {
+		return time.Duration(flags.attempts) * flags.interval
+	}
+	return flags.timeout
+}
+
+func waitForApplyToFinish(timeout time.Duration, client client.Core, result *api.PolicyUpdateResult) {
 	// if policy hasn't changed, then we don't have to wait. let's exit right away
 	if !result.PolicyChanged {
 		return
 	}
 
-	fmt.Print("Waiting for changes to be applied...")
-	var rev *engine.Revision
+	fmt.Println("Waiting for changes to be applied...")
+	var last *api.RevisionUpdate
 
 	var progressBar progress.Indicator
 	var progressLast = 0
 
-	finished := retry.Do2(attempts, interval, func() bool {
-		var revErr error
-		rev, revErr = client.Revision().ShowByPolicy(result.PolicyGeneration)
-		if revErr != nil {
-			fmt.Print(".")
-			return false
-		}
+	// server streams updates of the revision until it's applied
+	err := client.Revision().WatchByPolicy(result.PolicyGeneration, timeout, func(update *api.RevisionUpdate) {
+		last = update
 
 		if progressBar == nil {
-			fmt.Println()
 			progressBar = progress.NewConsole()
-			progressBar.SetTotal(rev.Progress.Total)
+			progressBar.SetTotal(update.Progress.Total)
 		}
-		for progressLast < rev.Progress.Current {
+		for progressLast < update.Progress.Current {
 			progressBar.Advance()
 			progressLast++
 		}
-
-		return rev.Status != engine.RevisionStatusInProgress
 	})
 
-	if !finished {
-		progressBar.Done(false)
-		fmt.Printf("Timeout! Revision %d has not been applied in %d seconds\n", rev.GetGeneration(), 60*5)
+	if last == nil || !last.IsFinished() {
+		if progressBar != nil {
+			progressBar.Done(false)
+		}
+		if err == nil {
+			err = fmt.Errorf("stream has been closed by server")
+		}
+		fmt.Printf("Timeout! Revision for policy %d has not been applied in %s: %s\n", result.PolicyGeneration, timeout, err)
 		panic("timeout")
-	} else if rev.Status == engine.RevisionStatusSuccess {
+	} else if last.Status == engine.RevisionStatusSuccess {
 		progressBar.Done(true)
-		fmt.Printf("Success. Revision %d applied successfully\n", rev.GetGeneration())
-	} else if rev.Status == engine.RevisionStatusError {
+		fmt.Printf("Success. Revision %d applied successfully\n", last.Revision)
+	} else if last.Status == engine.RevisionStatusError {
 		progressBar.Done(false)
-		fmt.Printf("Error! Revision %d failed with an error and has not been fully applied\n", rev.GetGeneration())
+		fmt.Printf("Error! Revision %d failed with an error and has not been fully applied\n", last.Revision)
 		panic("error")
 	}
-
 }
 
 func isK8sObject(data []byte) bool {
@@ -0,0 +1,69 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/cmd/common"
+	"github.com/Aptomi/aptomi/pkg/client/rest"
+	"github.com/Aptomi/aptomi/pkg/client/rest/http"
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+func newHistoryCommand(cfg *config.Client) *cobra.Command {
+	var diff bool
+	var from, to uint64 // == runtime.Generation
+
+	cmd := &cobra.Command{
+		Use:   "history <namespace>/<kind>/<name>",
+		Short: "policy object history",
+		Long:  "show all generations of policy object, or changes between two of them",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				panic(fmt.Sprintf("Policy object should be specified as <namespace>/<kind>/<name>"))
+			}
+			parts := strings.Split(args[0], "/")
+			if len(parts) != 3 || len(parts[0]) <= 0 || len(parts[1]) <= 0 || len(parts[2]) <= 0 {
+				panic(fmt.Sprintf("Policy object should be specified as <namespace>/<kind>/<name>, but found: %s", args[0]))
+			}
+
+			client := rest.New(cfg, http.NewClient(cfg)).Policy()
+			rows := []runtime.Displayable{}
+			if diff || from != 0 || to != 0 {
+				result, err := client.Diff(parts[0], parts[1], parts[2], runtime.Generation(from), runtime.Generation(to))
+				if err != nil {
+					panic(fmt.Sprintf("Error while getting policy object diff: %s", err))
+				}
+				if len(result.Changes) <= 0 {
+					fmt.Printf("No changes between generations %d and %d of %s\n", result.From, result.To, result.Object)
+					return
+				}
+				for _, change := range result.Changes {
+					rows = append(rows, change)
+				}
+			} else {
+				result, err := client.History(parts[0], parts[1], parts[2])
+				if err != nil {
+					panic(fmt.Sprintf("Error while getting policy object history: %s", err))
+				}
+				for _, gen := range result.Generations {
+					rows = append(rows, gen)
+				}
+			}
+
+			data, err := common.Format(cfg.Output, true, rows...)
+			if err != nil {
+				panic(fmt.Sprintf("Error while formating policy object history: %s", err))
+			}
+			fmt.Println(string(data))
+		},
+	}
+
+	cmd.Flags().BoolVarP(&diff, "diff", "d", false, "Show changes between two generations instead of listing all generations")
+	cmd.Flags().Uint64Var(&from, "from", 0, "Generation to show changes from (defaults to the one preceding --to)")
+	cmd.Flags().Uint64Var(&to, "to", 0, "Generation to show changes to (defaults to the last one)")
+
+	return cmd
+}
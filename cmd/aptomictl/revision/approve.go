@@ -0,0 +1,38 @@
+package revision
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/client/rest"
+	"github.com/Aptomi/aptomi/pkg/client/rest/http"
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+func newApproveCommand(cfg *config.Client) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "approve <namespace>/<service>",
+		Short: "approve rollout of a service to continue with the next stage",
+		Long:  "approve rollout of a service to continue with the next stage long",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) != 1 {
+				panic(fmt.Sprintf("Service should be specified as <namespace>/<service>"))
+			}
+			parts := strings.Split(args[0], "/")
+			if len(parts) != 2 || len(parts[0]) <= 0 || len(parts[1]) <= 0 {
+				panic(fmt.Sprintf("Service should be specified as <namespace>/<service>, but found: %s", args[0]))
+			}
+
+			result, err := rest.New(cfg, http.NewClient(cfg)).Revision().ApproveRollout(parts[0], parts[1])
+			if err != nil {
+				panic(fmt.Sprintf("Error while approving rollout: %s", err))
+			}
+
+			// todo(slukjanov): replace with -o yaml / json / etc handler
+			fmt.Println(result)
+		},
+	}
+
+	return cmd
+}
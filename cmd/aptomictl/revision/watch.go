@@ -0,0 +1,65 @@
+package revision
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/api"
+	"github.com/Aptomi/aptomi/pkg/client/rest"
+	"github.com/Aptomi/aptomi/pkg/client/rest/http"
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/spf13/cobra"
+	"time"
+)
+
+func newWatchCommand(cfg *config.Client) *cobra.Command {
+	var gen, policyGen uint64
+	var timeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "watch revision status, progress and apply log until it's applied",
+		Long:  "watch revision status, progress and apply log until it's applied long",
+
+		Run: func(cmd *cobra.Command, args []string) {
+			if gen != 0 && policyGen != 0 {
+				panic(fmt.Sprintf("Only one of generation and policy generation could be used at the same time"))
+			}
+
+			var last *api.RevisionUpdate
+			handler := func(update *api.RevisionUpdate) {
+				if last == nil || last.Status != update.Status || last.Progress != update.Progress {
+					fmt.Printf("Revision %d (policy %d): %s [%d/%d]\n", update.Revision, update.Policy, update.Status, update.Progress.Current, update.Progress.Total)
+				}
+				for _, e := range update.ApplyLog {
+					fmt.Printf("  %s [%s] %s\n", e.Time.Format(time.RFC3339), e.LogLevel, e.Message)
+				}
+				last = update
+			}
+
+			var err error
+			client := rest.New(cfg, http.NewClient(cfg)).Revision()
+			if policyGen != 0 {
+				err = client.WatchByPolicy(runtime.Generation(policyGen), timeout, handler)
+			} else {
+				err = client.Watch(runtime.Generation(gen), timeout, handler)
+			}
+
+			if err != nil {
+				panic(fmt.Sprintf("Error while watching revision: %s", err))
+			}
+			if last == nil || !last.IsFinished() {
+				panic(fmt.Sprintf("Revision watch has been closed by server before revision was applied"))
+			}
+			if last.Status == engine.RevisionStatusError {
+				panic(fmt.Sprintf("Revision %d failed with an error and has not been fully applied", last.Revision))
+			}
+		},
+	}
+
+	cmd.Flags().Uint64VarP(&gen, "generation", "g", 0, "Revision generation")
+	cmd.Flags().Uint64VarP(&policyGen, "policy", "p", 0, "Policy generation")
+	cmd.Flags().DurationVar(&timeout, "timeout", 0, "Time to watch revision before failure (zero means no timeout)")
+
+	return cmd
+}
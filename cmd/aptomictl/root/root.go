@@ -2,6 +2,7 @@ package root
 
 import (
 	"fmt"
+	"github.com/Aptomi/aptomi/cmd/aptomictl/dependency"
 	"github.com/Aptomi/aptomi/cmd/aptomictl/endpoints"
 	"github.com/Aptomi/aptomi/cmd/aptomictl/gen"
 	"github.com/Aptomi/aptomi/cmd/aptomictl/login"
@@ -60,6 +61,7 @@ func init() {
 		login.NewCommand(Config, ConfigFile),
 		endpoints.NewCommand(Config),
 		policy.NewCommand(Config),
+		dependency.NewCommand(Config),
 		revision.NewCommand(Config),
 		state.NewCommand(Config),
 		gen.NewCommand(Config),
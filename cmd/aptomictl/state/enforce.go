@@ -5,17 +5,28 @@ import (
 	"github.com/Aptomi/aptomi/pkg/client/rest"
 	"github.com/Aptomi/aptomi/pkg/client/rest/http"
 	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/engine"
 	"github.com/spf13/cobra"
 )
 
 func newEnforceCommand(cfg *config.Client) *cobra.Command {
+	var dependency, service, namespace string
+
 	cmd := &cobra.Command{
 		Use:   "enforce",
 		Short: "state enforce",
 		Long:  "state enforce long",
 
 		Run: func(cmd *cobra.Command, args []string) {
-			rev, err := rest.New(cfg, http.NewClient(cfg)).State().Reset()
+			var rev *engine.Revision
+			var err error
+
+			if len(dependency) > 0 || len(service) > 0 || len(namespace) > 0 {
+				// enforce only the changes affecting a given dependency, service instance or namespace
+				rev, err = rest.New(cfg, http.NewClient(cfg)).State().Enforce(dependency, service, namespace)
+			} else {
+				rev, err = rest.New(cfg, http.NewClient(cfg)).State().Reset()
+			}
 
 			if err != nil {
 				panic(fmt.Sprintf("Error while state enforcement: %s", err))
@@ -26,5 +37,9 @@ func newEnforceCommand(cfg *config.Client) *cobra.Command {
 		},
 	}
 
+	cmd.Flags().StringVar(&dependency, "dependency", "", "Enforce only the changes affecting a given dependency (<namespace>/<name>)")
+	cmd.Flags().StringVar(&service, "service", "", "Enforce only the changes affecting a given service instance (service instance key)")
+	cmd.Flags().StringVar(&namespace, "namespace", "", "Enforce only the changes affecting a given namespace")
+
 	return cmd
 }
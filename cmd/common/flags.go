@@ -26,6 +26,12 @@ func AddDurationFlag(command *cobra.Command, key, flagName, flagShorthand string
 	bindFlagEnv(command, key, flagName, env)
 }
 
+// AddIntFlag adds int flag to provided cobra command and registers with provided env variable name
+func AddIntFlag(command *cobra.Command, key, flagName, flagShorthand string, defaultValue int, env, usage string) {
+	command.PersistentFlags().IntP(flagName, flagShorthand, defaultValue, usage)
+	bindFlagEnv(command, key, flagName, env)
+}
+
 func bindFlagEnv(command *cobra.Command, key, flagName, env string) {
 	err := viper.BindPFlag(key, command.PersistentFlags().Lookup(flagName))
 	if err != nil {
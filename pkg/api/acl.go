@@ -17,27 +17,30 @@ func (g *userRolesWrapper) GetKind() string {
 }
 
 func (api *coreAPI) handleUserRoles(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
-	policy, _, err := api.store.GetPolicy(runtime.LastGen)
-	if err != nil {
-		panic(fmt.Sprintf("error while getting policy: %s", err))
-	}
-
-	systemNamespace := policy.Namespace[runtime.SystemNS]
-	var aclResolver *lang.ACLResolver
-	if systemNamespace != nil {
-		aclResolver = lang.NewACLResolver(systemNamespace.ACLRules)
-	} else {
-		aclResolver = lang.NewACLResolver(lang.NewGlobalRules())
-	}
+	aclResolver := api.getACLResolver()
 
 	data := make(map[string]map[string]map[string]bool)
 	users := api.externalData.UserLoader.LoadUsersAll().Users
 	for _, user := range users {
 		roleMap, errRoleMap := aclResolver.GetUserRoleMap(user)
 		if errRoleMap != nil {
-			panic(fmt.Sprintf("error while retrieving user role map for '%s': %s", user.Name, err))
+			panic(fmt.Sprintf("error while retrieving user role map for '%s': %s", user.Name, errRoleMap))
 		}
 		data[user.Name] = roleMap
 	}
 	api.contentType.WriteOne(writer, request, &userRolesWrapper{Data: data})
 }
+
+// getACLResolver returns ACL resolver for the ACL rules defined in the system namespace of the last policy
+func (api *coreAPI) getACLResolver() *lang.ACLResolver {
+	policy, _, err := api.store.GetPolicy(runtime.LastGen)
+	if err != nil {
+		panic(fmt.Sprintf("error while getting policy: %s", err))
+	}
+
+	systemNamespace := policy.Namespace[runtime.SystemNS]
+	if systemNamespace != nil {
+		return lang.NewACLResolver(systemNamespace.ACLRules)
+	}
+	return lang.NewACLResolver(lang.NewGlobalRules())
+}
@@ -2,8 +2,12 @@ package api
 
 import (
 	"fmt"
+	"github.com/Aptomi/aptomi/pkg/engine/diff"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"strings"
 )
 
 func (api *coreAPI) handleActualStateReset(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
@@ -17,3 +21,53 @@ func (api *coreAPI) handleActualStateReset(writer http.ResponseWriter, request *
 
 	api.handleRevisionGet(writer, request, params)
 }
+
+func (api *coreAPI) handleActualStateEnforce(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	user := api.getUserRequired(request)
+
+	query := request.URL.Query()
+	selector := &diff.Selector{
+		Service:   query.Get("service"),
+		Namespace: query.Get("namespace"),
+	}
+
+	// dependency is specified as <namespace>/<name> and user must be able to manage it
+	if dependencyName := query.Get("dependency"); len(dependencyName) > 0 {
+		parts := strings.Split(dependencyName, "/")
+		if len(parts) != 2 || len(parts[0]) <= 0 || len(parts[1]) <= 0 {
+			panic(fmt.Sprintf("Dependency should be specified as <namespace>/<name>, but found: %s", dependencyName))
+		}
+
+		policy, _, err := api.store.GetPolicy(runtime.LastGen)
+		if err != nil {
+			panic(fmt.Sprintf("error while getting requested policy: %s", err))
+		}
+
+		obj, err := policy.GetObject(lang.DependencyObject.Kind, parts[1], parts[0])
+		if err != nil {
+			panic(fmt.Sprintf("error while getting dependency %s: %s", dependencyName, err))
+		}
+		if obj == nil {
+			api.contentType.WriteOneWithStatus(writer, request, nil, http.StatusNotFound)
+			return
+		}
+
+		dependency := obj.(*lang.Dependency)
+		errManage := policy.View(user).ManageObject(dependency)
+		if errManage != nil {
+			panic(fmt.Sprintf("Error while enforcing dependency: %s", errManage))
+		}
+		selector.Dependency = runtime.KeyForStorable(dependency)
+	}
+
+	if selector.IsEmpty() {
+		panic(fmt.Sprintf("Dependency, service instance or namespace should be specified for targeted enforcement"))
+	}
+
+	revision, err := api.enforceTargeted(selector)
+	if revision == nil && err != nil {
+		panic(fmt.Sprintf("error while enforcing state: %s", err))
+	}
+
+	api.contentType.WriteOne(writer, request, revision)
+}
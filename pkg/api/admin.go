@@ -0,0 +1,29 @@
+package api
+
+import (
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+)
+
+func (api *coreAPI) handleBackup(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	user := api.getUserRequired(request)
+
+	isDomainAdmin, err := api.getACLResolver().IsDomainAdmin(user)
+	if err != nil {
+		panic(fmt.Sprintf("error while resolving role for user '%s': %s", user.Name, err))
+	}
+	if !isDomainAdmin {
+		serverErr := NewServerError(fmt.Sprintf("User '%s' isn't allowed to back up DB, only domain admins are", user.Name))
+		api.contentType.WriteOneWithStatus(writer, request, serverErr, http.StatusForbidden)
+		return
+	}
+
+	// generated secrets are included only if explicitly requested
+	backup, err := api.store.Dump(request.URL.Query().Get("secrets") == "true")
+	if err != nil {
+		panic(fmt.Sprintf("error while dumping DB: %s", err))
+	}
+
+	api.contentType.WriteMany(writer, request, backup)
+}
@@ -2,32 +2,50 @@ package api
 
 import (
 	"github.com/Aptomi/aptomi/pkg/api/codec"
+	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/engine/diff"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/external"
+	"github.com/Aptomi/aptomi/pkg/external/secrets"
 	"github.com/Aptomi/aptomi/pkg/plugin"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/runtime/store"
 	"github.com/julienschmidt/httprouter"
 )
 
+// TargetedEnforcer applies only the actions, which affect component instances matched by a given selector, in a
+// dedicated revision
+type TargetedEnforcer func(selector *diff.Selector) (*engine.Revision, error)
+
 type coreAPI struct {
 	contentType           *codec.ContentTypeHandler
 	store                 store.Core
 	externalData          *external.Data
+	resolutionCache       *resolve.ResolutionCache
 	pluginRegistryFactory plugin.RegistryFactory
 	secret                string
 	policyChanged         chan bool
+	enforceTargeted       TargetedEnforcer
 }
 
 // Serve initializes everything needed by REST API and registers all API endpoints in the provided http router
-func Serve(router *httprouter.Router, store store.Core, externalData *external.Data, pluginRegistryFactory plugin.RegistryFactory, secret string, policyChanged chan bool) {
+func Serve(router *httprouter.Router, store store.Core, externalData *external.Data, resolutionCache *resolve.ResolutionCache, pluginRegistryFactory plugin.RegistryFactory, secret string, policyChanged chan bool, enforceTargeted TargetedEnforcer) {
 	contentTypeHandler := codec.NewContentTypeHandler(runtime.NewRegistry().Append(Objects...))
+
+	// policy resolutions made by API never get applied, so they should never generate and persist new secrets
+	if externalData.GeneratedSecretStore != nil {
+		externalData = externalData.WithGeneratedSecretStore(secrets.NewGeneratedSecretStoreReadOnly(externalData.GeneratedSecretStore))
+	}
+
 	api := &coreAPI{
 		contentType:           contentTypeHandler,
 		store:                 store,
 		externalData:          externalData,
+		resolutionCache:       resolutionCache,
 		pluginRegistryFactory: pluginRegistryFactory,
 		secret:                secret,
 		policyChanged:         policyChanged,
+		enforceTargeted:       enforceTargeted,
 	}
 	api.serve(router)
 }
@@ -48,6 +66,11 @@ func (api *coreAPI) serve(router *httprouter.Router) {
 	// retrieve specific object from the policy
 	router.GET("/api/v1/policy/gen/:gen/object/:ns/:kind/:name", auth(api.handlePolicyObjectGet))
 
+	// retrieve all generations of specific policy object and diff between two of them (zero means the last generation
+	// and the one before the compared generation respectively)
+	router.GET("/api/v1/policy/history/:ns/:kind/:name", auth(api.handlePolicyObjectHistory))
+	router.GET("/api/v1/policy/history/:ns/:kind/:name/diff/:from/:to", auth(api.handlePolicyObjectDiff))
+
 	// update policy
 	router.POST("/api/v1/policy", auth(api.handlePolicyUpdate))
 	router.DELETE("/api/v1/policy", auth(api.handlePolicyDelete))
@@ -62,6 +85,9 @@ func (api *coreAPI) serve(router *httprouter.Router) {
 	router.GET("/api/v1/policy/dependency/:ns/:name/status", auth(api.handleDependencyStatusGet))
 	router.GET("/api/v1/policy/dependency/:ns/:name/resources", auth(api.handleDependencyResourcesGet))
 
+	// extend dependency expiry
+	router.POST("/api/v1/policy/dependency/:ns/:name/extend/:duration", auth(api.handleDependencyExtend))
+
 	// retrieve endpoints (all + by dependency)
 	router.GET("/api/v1/endpoints", api.handleEndpointsGet)
 	router.GET("/api/v1/endpoints/dependency/:ns/:name", auth(api.handleEndpointsGet))
@@ -74,8 +100,23 @@ func (api *coreAPI) serve(router *httprouter.Router) {
 	router.GET("/api/v1/revision/policy/:policy", auth(api.handleRevisionGetByPolicy))
 	router.GET("/api/v1/revisions/policy/:policy", auth(api.handleRevisionsGetByPolicy))
 
+	// watch revision (latest, by a given generation or the first one for a given policy) as a stream of server-sent
+	// events with its status, progress and apply log, until it's applied
+	router.GET("/api/v1/revision/watch", auth(api.handleRevisionWatch))
+	router.GET("/api/v1/revision/gen/:gen/watch", auth(api.handleRevisionWatch))
+	router.GET("/api/v1/revision/policy/:policy/watch", auth(api.handleRevisionWatch))
+
+	// approve staged rollout of a service to continue with the next stage
+	router.POST("/api/v1/revision/rollout/:ns/:name/approve", auth(api.handleRevisionRolloutApprove))
+
 	router.DELETE("/api/v1/actualstate", auth(api.handleActualStateReset))
 
+	// enforce only the changes affecting a given dependency, service instance or namespace
+	router.POST("/api/v1/actualstate/enforce", auth(api.handleActualStateEnforce))
+
+	// online snapshot of the whole DB (domain admins only)
+	router.GET("/api/v1/admin/backup", auth(api.handleBackup))
+
 	// return aptomi version
 	router.GET("/version", api.handleVersion)
 	router.GET("/api/v1/version", api.handleVersion)
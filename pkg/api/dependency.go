@@ -7,12 +7,52 @@ import (
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/plugin"
 	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/util"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
+	"time"
 )
 
 type dependencyStatusWrapper struct {
-	Data interface{}
+	Data       interface{}
+	Components []*componentStatus
+}
+
+// componentStatus is a status of a single component instance, which is kept instantiated by a dependency
+type componentStatus struct {
+	Key     string
+	Status  string
+	Message string `yaml:",omitempty"`
+}
+
+// Statuses of component instances
+const (
+	componentStatusDeployed  = "Deployed"
+	componentStatusReady     = "Ready"
+	componentStatusNotReady  = "NotReady"
+	componentStatusCompleted = "Completed"
+	componentStatusFailed    = "Failed"
+)
+
+// getComponentStatus returns status of a deployed component instance, based on the outcome of its last readiness
+// check or the last run of its job
+func getComponentStatus(instance *resolve.ComponentInstance) *componentStatus {
+	result := &componentStatus{Key: instance.GetKey(), Status: componentStatusDeployed}
+	if instance.Job != nil {
+		result.Status = componentStatusCompleted
+		if !instance.Job.Succeeded {
+			result.Status = componentStatusFailed
+			result.Message = fmt.Sprintf("job failed with exit code %d", instance.Job.ExitCode)
+		}
+	}
+	if instance.Readiness != nil {
+		result.Status = componentStatusReady
+		if !instance.Readiness.Ready {
+			result.Status = componentStatusNotReady
+			result.Message = instance.Readiness.Message
+		}
+	}
+	return result
 }
 
 func (g *dependencyStatusWrapper) GetKind() string {
@@ -21,7 +61,7 @@ func (g *dependencyStatusWrapper) GetKind() string {
 
 func (api *coreAPI) handleDependencyStatusGet(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
 	gen := runtime.LastGen
-	policy, _, err := api.store.GetPolicy(gen)
+	policy, policyGen, err := api.store.GetPolicy(gen)
 	if err != nil {
 		panic(fmt.Sprintf("error while getting requested policy: %s", err))
 	}
@@ -49,19 +89,29 @@ func (api *coreAPI) handleDependencyStatusGet(writer http.ResponseWriter, reques
 	depKey := runtime.KeyForStorable(dependency)
 
 	foundRefs := false
-	for _, instance := range actualState.ComponentInstanceMap {
+	components := []*componentStatus{}
+	for _, key := range util.GetSortedStringKeys(actualState.ComponentInstanceMap) {
+		instance := actualState.ComponentInstanceMap[key]
 		if _, ok := instance.DependencyKeys[depKey]; ok {
 			foundRefs = true
-			break
+			if instance.Metadata.Key.IsComponent() {
+				components = append(components, getComponentStatus(instance))
+			}
 		}
 	}
-	if foundRefs {
+	if dependency.IsSuspended(time.Now()) {
+		status = "Suspended"
+	} else if foundRefs {
 		status = "Active"
+	} else if desiredState := api.getCachedResolution(policyGen); desiredState != nil && len(desiredState.GetDependencyInstanceMap()[depKey]) > 0 {
+		// dependency has been resolved by the enforcer, but hasn't been deployed yet. Only cached resolution is
+		// used, as resolving policy on every status request is too expensive
+		status = "Pending"
 	} else {
 		status = "Inactive"
 	}
 
-	api.contentType.WriteOne(writer, request, &dependencyStatusWrapper{Data: status})
+	api.contentType.WriteOne(writer, request, &dependencyStatusWrapper{Data: status, Components: components})
 }
 
 type dependencyResourcesWrapper struct {
@@ -151,3 +201,70 @@ func pluginForComponentInstance(instance *resolve.ComponentInstance, policy *lan
 
 	return plugins.ForCodeType(cluster, component.Code.Type)
 }
+
+// populateDependencyCreatedAt sets creation time for the dependency being added or updated in the policy. It gets
+// preserved across updates, so TTL keeps being counted from the moment when dependency was created
+func populateDependencyCreatedAt(policy *lang.Policy, dependency *lang.Dependency) {
+	obj, err := policy.GetObject(lang.DependencyObject.Kind, dependency.Name, dependency.Namespace)
+	if err != nil {
+		panic(fmt.Sprintf("error while getting dependency %s/%s from policy: %s", dependency.Namespace, dependency.Name, err))
+	}
+
+	if existing, ok := obj.(*lang.Dependency); ok && !existing.CreatedAt.IsZero() {
+		dependency.CreatedAt = existing.CreatedAt
+	} else if dependency.CreatedAt.IsZero() {
+		dependency.CreatedAt = time.Now()
+	}
+}
+
+func (api *coreAPI) handleDependencyExtend(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	user := api.getUserRequired(request)
+
+	duration, err := time.ParseDuration(params.ByName("duration"))
+	if err != nil || duration <= 0 {
+		panic(fmt.Sprintf("invalid duration to extend dependency by: %s", params.ByName("duration")))
+	}
+
+	policy, _, err := api.store.GetPolicy(runtime.LastGen)
+	if err != nil {
+		panic(fmt.Sprintf("error while getting requested policy: %s", err))
+	}
+
+	ns := params.ByName("ns")
+	name := params.ByName("name")
+
+	obj, err := policy.GetObject(lang.DependencyObject.Kind, name, ns)
+	if err != nil {
+		panic(fmt.Sprintf("error while getting dependency %s/%s: %s", ns, name, err))
+	}
+	if obj == nil {
+		api.contentType.WriteOneWithStatus(writer, request, nil, http.StatusNotFound)
+		return
+	}
+
+	// dependency is copied, as objects of the policy returned by the store are shared and can't be modified
+	dependency := obj.(*lang.Dependency).MakeCopy()
+	errManage := policy.View(user).ManageObject(dependency)
+	if errManage != nil {
+		panic(fmt.Sprintf("Error while extending dependency: %s", errManage))
+	}
+
+	errExtend := dependency.Extend(duration, time.Now())
+	if errExtend != nil {
+		serverErr := NewServerError(fmt.Sprintf("Error while extending dependency: %s", errExtend))
+		api.contentType.WriteOneWithStatus(writer, request, serverErr, http.StatusBadRequest)
+		return
+	}
+
+	changed, policyData, err := api.store.UpdatePolicy([]lang.Base{dependency}, user.Name)
+	if err != nil {
+		panic(fmt.Sprintf("Error while updating policy: %s", err))
+	}
+
+	api.getPolicyUpdateResult(writer, request, changed, policyData)
+
+	if changed {
+		// signal to the channel that policy has changed, that will trigger the enforcement right away
+		api.policyChanged <- true
+	}
+}
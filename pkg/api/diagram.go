@@ -29,7 +29,7 @@ func (api *coreAPI) handlePolicyDiagram(writer http.ResponseWriter, request *htt
 		gen = strconv.Itoa(int(runtime.LastGen))
 	}
 
-	policy, _, err := api.store.GetPolicy(runtime.ParseGeneration(gen))
+	policy, policyGen, err := api.store.GetPolicy(runtime.ParseGeneration(gen))
 	if err != nil {
 		panic(fmt.Sprintf("error while getting requested policy: %s", err))
 	}
@@ -43,8 +43,7 @@ func (api *coreAPI) handlePolicyDiagram(writer http.ResponseWriter, request *htt
 	case "desired":
 		// show instances in desired state
 		// todo: add request id to the event log scope
-		resolver := resolve.NewPolicyResolver(policy, api.externalData, event.NewLog("api-policy-diagram", true))
-		state, _ := resolver.ResolveAllDependencies()
+		state, _ := api.resolvePolicy(policy, policyGen, event.NewLog("api-policy-diagram", true))
 		graphBuilder := visualization.NewGraphBuilder(policy, state, api.externalData)
 		graph = graphBuilder.DependencyResolution(visualization.DependencyResolutionCfgDefault)
 	case "actual":
@@ -52,8 +51,7 @@ func (api *coreAPI) handlePolicyDiagram(writer http.ResponseWriter, request *htt
 		state, _ := api.store.GetActualState()
 		{
 			// since we are not storing dependency keys, calculate them on the fly for actual state
-			resolver := resolve.NewPolicyResolver(policy, api.externalData, event.NewLog("api-policy-diagram", true))
-			desiredState, _ := resolver.ResolveAllDependencies()
+			desiredState, _ := api.resolvePolicy(policy, policyGen, event.NewLog("api-policy-diagram", true))
 			state.SetDependencyInstanceMap(desiredState.GetDependencyInstanceMap())
 		}
 
@@ -78,11 +76,11 @@ func (api *coreAPI) handlePolicyDiagramCompare(writer http.ResponseWriter, reque
 		genBase = strconv.Itoa(int(runtime.LastGen))
 	}
 
-	policy, _, err := api.store.GetPolicy(runtime.ParseGeneration(gen))
+	policy, policyGen, err := api.store.GetPolicy(runtime.ParseGeneration(gen))
 	if err != nil {
 		panic(fmt.Sprintf("error while getting requested policy: %s", err))
 	}
-	policyBase, _, err := api.store.GetPolicy(runtime.ParseGeneration(genBase))
+	policyBase, policyBaseGen, err := api.store.GetPolicy(runtime.ParseGeneration(genBase))
 	if err != nil {
 		panic(fmt.Sprintf("error while getting requested policy: %s", err))
 	}
@@ -97,14 +95,12 @@ func (api *coreAPI) handlePolicyDiagramCompare(writer http.ResponseWriter, reque
 	case "desired":
 		// show instances in desired state (diff)
 		// todo: add request id to the event log scope
-		resolver := resolve.NewPolicyResolver(policy, api.externalData, event.NewLog("api-policy-diagram", true))
-		state, _ := resolver.ResolveAllDependencies()
+		state, _ := api.resolvePolicy(policy, policyGen, event.NewLog("api-policy-diagram", true))
 		graphBuilder := visualization.NewGraphBuilder(policy, state, api.externalData)
 		graph = graphBuilder.DependencyResolution(visualization.DependencyResolutionCfgDefault)
 
 		// todo: add request id to the event log scope
-		resolverBase := resolve.NewPolicyResolver(policyBase, api.externalData, event.NewLog("api-policy-diagram", true))
-		stateBase, _ := resolverBase.ResolveAllDependencies()
+		stateBase, _ := api.resolvePolicy(policyBase, policyBaseGen, event.NewLog("api-policy-diagram", true))
 		graphBuilderBase := visualization.NewGraphBuilder(policyBase, stateBase, api.externalData)
 		graphBase := graphBuilderBase.DependencyResolution(visualization.DependencyResolutionCfgDefault)
 
@@ -114,8 +110,7 @@ func (api *coreAPI) handlePolicyDiagramCompare(writer http.ResponseWriter, reque
 		state, _ := api.store.GetActualState()
 		{
 			// since we are not storing dependency keys, calculate them on the fly for actual state
-			resolver := resolve.NewPolicyResolver(policy, api.externalData, event.NewLog("api-policy-diagram", true))
-			desiredState, _ := resolver.ResolveAllDependencies()
+			desiredState, _ := api.resolvePolicy(policy, policyGen, event.NewLog("api-policy-diagram", true))
 			state.SetDependencyInstanceMap(desiredState.GetDependencyInstanceMap())
 		}
 
@@ -139,7 +134,7 @@ func (api *coreAPI) handleObjectDiagram(writer http.ResponseWriter, request *htt
 	kind := params.ByName("kind")
 	name := params.ByName("name")
 
-	policy, _, err := api.store.GetPolicy(runtime.LastGen)
+	policy, policyGen, err := api.store.GetPolicy(runtime.LastGen)
 	if err != nil {
 		panic(fmt.Sprintf("error while getting policy: %s", err))
 	}
@@ -151,8 +146,7 @@ func (api *coreAPI) handleObjectDiagram(writer http.ResponseWriter, request *htt
 
 	var resolution *resolve.PolicyResolution
 	if kind == lang.DependencyObject.Kind {
-		resolver := resolve.NewPolicyResolver(policy, api.externalData, event.NewLog("api-object-diagram", true))
-		resolution, _ = resolver.ResolveAllDependencies()
+		resolution, _ = api.resolvePolicy(policy, policyGen, event.NewLog("api-object-diagram", true))
 	}
 
 	var graph *visualization.Graph
@@ -0,0 +1,372 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/julienschmidt/httprouter"
+	"gopkg.in/yaml.v2"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// PolicyObjectChangeAdded is a type of change, when value has been added into the object
+	PolicyObjectChangeAdded = "added"
+
+	// PolicyObjectChangeRemoved is a type of change, when value has been removed from the object
+	PolicyObjectChangeRemoved = "removed"
+
+	// PolicyObjectChangeModified is a type of change, when value has been changed in the object
+	PolicyObjectChangeModified = "modified"
+)
+
+// PolicyObjectHistoryObject contains Info for the PolicyObjectHistory type
+var PolicyObjectHistoryObject = &runtime.Info{
+	Kind:        "policy-object-history",
+	Constructor: func() runtime.Object { return &PolicyObjectHistory{} },
+}
+
+// PolicyObjectHistory lists all stored generations of a policy object, along with the time and the author of the policy
+// update, which has introduced every generation
+type PolicyObjectHistory struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	// Object is a key of the policy object (namespace/kind/name)
+	Object      string
+	Generations []*PolicyObjectGeneration
+}
+
+// PolicyObjectGeneration describes a single generation of policy object
+type PolicyObjectGeneration struct {
+	Generation runtime.Generation
+	Deleted    bool
+
+	// Policy is a generation of policy, in which object has been changed, or zero if it isn't known (e.g. when it has
+	// been compacted)
+	Policy    runtime.Generation
+	UpdatedAt time.Time
+	UpdatedBy string
+}
+
+// GetDefaultColumns returns default set of columns to be displayed
+func (gen *PolicyObjectGeneration) GetDefaultColumns() []string {
+	return []string{"Generation", "Policy", "Updated At", "Updated By", "Deleted"}
+}
+
+// AsColumns returns PolicyObjectGeneration representation as columns
+func (gen *PolicyObjectGeneration) AsColumns() map[string]string {
+	result := map[string]string{
+		"Generation": gen.Generation.String(),
+		"Policy":     "unknown",
+		"Updated At": "unknown",
+		"Updated By": gen.UpdatedBy,
+		"Deleted":    strconv.FormatBool(gen.Deleted),
+	}
+	if gen.Policy != runtime.LastGen {
+		result["Policy"] = gen.Policy.String()
+		result["Updated At"] = gen.UpdatedAt.Format(time.RFC3339)
+	}
+
+	return result
+}
+
+// PolicyObjectDiffObject contains Info for the PolicyObjectDiff type
+var PolicyObjectDiffObject = &runtime.Info{
+	Kind:        "policy-object-diff",
+	Constructor: func() runtime.Object { return &PolicyObjectDiff{} },
+}
+
+// PolicyObjectDiff is a structural diff between two generations of a policy object
+type PolicyObjectDiff struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	// Object is a key of the policy object (namespace/kind/name)
+	Object  string
+	From    runtime.Generation
+	To      runtime.Generation
+	Changes []*PolicyObjectChange
+}
+
+// PolicyObjectChange is a single change of value in the policy object. Path consists of field names and list indexes
+// (e.g. "contexts[0].allocation.service"), From and To are the values before and after the change
+type PolicyObjectChange struct {
+	Path string
+	Type string
+	From interface{}
+	To   interface{}
+}
+
+// GetDefaultColumns returns default set of columns to be displayed
+func (change *PolicyObjectChange) GetDefaultColumns() []string {
+	return []string{"Path", "Change", "From", "To"}
+}
+
+// AsColumns returns PolicyObjectChange representation as columns
+func (change *PolicyObjectChange) AsColumns() map[string]string {
+	result := map[string]string{
+		"Path":   change.Path,
+		"Change": change.Type,
+	}
+	if change.Type != PolicyObjectChangeAdded {
+		result["From"] = formatChangeValue(change.From)
+	}
+	if change.Type != PolicyObjectChangeRemoved {
+		result["To"] = formatChangeValue(change.To)
+	}
+
+	return result
+}
+
+func formatChangeValue(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+func (api *coreAPI) handlePolicyObjectHistory(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	versions := api.getPolicyObjectHistory(request, params)
+	if len(versions) <= 0 {
+		api.contentType.WriteOneWithStatus(writer, request, nil, http.StatusNotFound)
+		return
+	}
+
+	result := &PolicyObjectHistory{
+		TypeKind: PolicyObjectHistoryObject.GetTypeKind(),
+		Object:   runtime.KeyForStorable(versions[0].Object),
+	}
+	for _, version := range versions {
+		result.Generations = append(result.Generations, &PolicyObjectGeneration{
+			Generation: version.Object.GetGeneration(),
+			Deleted:    version.Object.IsDeleted(),
+			Policy:     version.Policy,
+			UpdatedAt:  version.UpdatedAt,
+			UpdatedBy:  version.UpdatedBy,
+		})
+	}
+
+	api.contentType.WriteOne(writer, request, result)
+}
+
+func (api *coreAPI) handlePolicyObjectDiff(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	versions := api.getPolicyObjectHistory(request, params)
+	if len(versions) <= 0 {
+		api.contentType.WriteOneWithStatus(writer, request, nil, http.StatusNotFound)
+		return
+	}
+
+	// generation to compare with is the last one by default, and it's compared with the previous one by default
+	toIdx := findVersion(versions, runtime.ParseGeneration(params.ByName("to")), len(versions)-1)
+	fromIdx := findVersion(versions, runtime.ParseGeneration(params.ByName("from")), toIdx-1)
+	if fromIdx < 0 || toIdx < 0 {
+		api.contentType.WriteOneWithStatus(writer, request, nil, http.StatusNotFound)
+		return
+	}
+
+	from, to := versions[fromIdx].Object, versions[toIdx].Object
+	changes, err := diffPolicyObjects(from, to)
+	if err != nil {
+		panic(fmt.Sprintf("error while calculating diff of %s: %s", runtime.KeyForStorable(to), err))
+	}
+
+	api.contentType.WriteOne(writer, request, &PolicyObjectDiff{
+		TypeKind: PolicyObjectDiffObject.GetTypeKind(),
+		Object:   runtime.KeyForStorable(to),
+		From:     from.GetGeneration(),
+		To:       to.GetGeneration(),
+		Changes:  changes,
+	})
+}
+
+// getPolicyObjectHistory returns all generations of the requested policy object, if user is allowed to view it.
+// Cluster config is hidden from the users, who can't manage the cluster
+func (api *coreAPI) getPolicyObjectHistory(request *http.Request, params httprouter.Params) []*engine.PolicyObjectVersion {
+	user := api.getUserRequired(request)
+
+	ns := params.ByName("ns")
+	kind := params.ByName("kind")
+	name := params.ByName("name")
+	if !isPolicyObjectKind(kind) {
+		panic(fmt.Sprintf("kind %s isn't a policy object kind", kind))
+	}
+
+	versions, err := api.store.GetPolicyObjectHistory(ns, kind, name)
+	if err != nil {
+		panic(fmt.Sprintf("error while getting history of %s/%s/%s: %s", ns, kind, name, err))
+	}
+	if len(versions) <= 0 {
+		return versions
+	}
+
+	policy, _, err := api.store.GetPolicy(runtime.LastGen)
+	if err != nil {
+		panic(fmt.Sprintf("error while getting policy: %s", err))
+	}
+	if policy == nil {
+		return nil
+	}
+
+	view := policy.View(user)
+	last := versions[len(versions)-1].Object
+	errView := view.ViewObject(last)
+	if errView != nil {
+		panic(fmt.Sprintf("error while getting history of %s/%s/%s: %s", ns, kind, name, errView))
+	}
+
+	if kind == lang.ClusterObject.Kind && view.ManageObject(last) != nil {
+		for _, version := range versions {
+			if cluster, ok := version.Object.(*lang.Cluster); ok {
+				cluster = cluster.MakeCopy()
+				cluster.Config = "hidden"
+				version.Object = cluster
+			}
+		}
+	}
+
+	return versions
+}
+
+func isPolicyObjectKind(kind string) bool {
+	for _, info := range lang.PolicyObjects {
+		if info.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// findVersion returns an index of the version with a given generation, or default index if generation isn't specified
+func findVersion(versions []*engine.PolicyObjectVersion, gen runtime.Generation, defaultIdx int) int {
+	if gen == runtime.LastGen {
+		return defaultIdx
+	}
+	for idx, version := range versions {
+		if version.Object.GetGeneration() == gen {
+			return idx
+		}
+	}
+	return -1
+}
+
+// diffPolicyObjects returns changes between two generations of policy object. Objects are compared field by field in
+// their serialized form, so the paths of changes match the fields of policy files. Generation is excluded from
+// comparison, as it's always different
+func diffPolicyObjects(from lang.Base, to lang.Base) ([]*PolicyObjectChange, error) {
+	fromValue, err := toGenericValue(from)
+	if err != nil {
+		return nil, err
+	}
+	toValue, err := toGenericValue(to)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffValues("", fromValue, toValue, []*PolicyObjectChange{}), nil
+}
+
+// toGenericValue converts object into the tree of maps, lists and scalar values
+func toGenericValue(obj lang.Base) (interface{}, error) {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("error while marshaling %s: %s", runtime.KeyForStorable(obj), err)
+	}
+
+	var value interface{}
+	err = yaml.Unmarshal(data, &value)
+	if err != nil {
+		return nil, fmt.Errorf("error while unmarshaling %s: %s", runtime.KeyForStorable(obj), err)
+	}
+
+	result := normalizeValue(value)
+	if fields, ok := result.(map[string]interface{}); ok {
+		if metadata, ok := fields["metadata"].(map[string]interface{}); ok {
+			delete(metadata, "generation")
+		}
+	}
+
+	return result, nil
+}
+
+// normalizeValue converts maps with arbitrary keys produced by yaml into maps with string keys, so they could be
+// encoded into JSON
+func normalizeValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			result[fmt.Sprintf("%v", key)] = normalizeValue(item)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(typed))
+		for idx, item := range typed {
+			result[idx] = normalizeValue(item)
+		}
+		return result
+	}
+	return value
+}
+
+// diffValues appends changes between two generic values to the list. Maps are compared key by key and lists are
+// compared item by item, all other values are compared as a whole
+func diffValues(path string, from interface{}, to interface{}, changes []*PolicyObjectChange) []*PolicyObjectChange {
+	fromMap, fromIsMap := from.(map[string]interface{})
+	toMap, toIsMap := to.(map[string]interface{})
+	if fromIsMap && toIsMap {
+		keys := []string{}
+		for key := range fromMap {
+			keys = append(keys, key)
+		}
+		for key := range toMap {
+			if _, exists := fromMap[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			keyPath := key
+			if len(path) > 0 {
+				keyPath = path + "." + key
+			}
+			fromItem, inFrom := fromMap[key]
+			toItem, inTo := toMap[key]
+			if !inFrom {
+				changes = append(changes, &PolicyObjectChange{Path: keyPath, Type: PolicyObjectChangeAdded, To: toItem})
+			} else if !inTo {
+				changes = append(changes, &PolicyObjectChange{Path: keyPath, Type: PolicyObjectChangeRemoved, From: fromItem})
+			} else {
+				changes = diffValues(keyPath, fromItem, toItem, changes)
+			}
+		}
+		return changes
+	}
+
+	fromList, fromIsList := from.([]interface{})
+	toList, toIsList := to.([]interface{})
+	if fromIsList && toIsList {
+		for idx := 0; idx < len(fromList) || idx < len(toList); idx++ {
+			idxPath := path + "[" + strconv.Itoa(idx) + "]"
+			if idx >= len(fromList) {
+				changes = append(changes, &PolicyObjectChange{Path: idxPath, Type: PolicyObjectChangeAdded, To: toList[idx]})
+			} else if idx >= len(toList) {
+				changes = append(changes, &PolicyObjectChange{Path: idxPath, Type: PolicyObjectChangeRemoved, From: fromList[idx]})
+			} else {
+				changes = diffValues(idxPath, fromList[idx], toList[idx], changes)
+			}
+		}
+		return changes
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		changes = append(changes, &PolicyObjectChange{Path: path, Type: PolicyObjectChangeModified, From: from, To: to})
+	}
+	return changes
+}
@@ -1,9 +1,8 @@
 package api
 
 import (
-	"github.com/Aptomi/aptomi/pkg/engine"
-	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
 	"github.com/Aptomi/aptomi/pkg/version"
 )
 
@@ -12,9 +11,12 @@ var (
 	Objects = runtime.AppendAll([]*runtime.Info{
 		EndpointsObject,
 		PolicyUpdateResultObject,
+		PolicyObjectHistoryObject,
+		PolicyObjectDiffObject,
 		AuthSuccessObject,
 		AuthRequestObject,
 		ServerErrorObject,
+		RevisionUpdateObject,
 		version.BuildInfoObject,
-	}, lang.PolicyObjects, engine.Objects)
+	}, store.BackupObjects)
 )
@@ -5,7 +5,6 @@ import (
 	"github.com/Aptomi/aptomi/pkg/engine"
 	"github.com/Aptomi/aptomi/pkg/engine/apply/action/component"
 	"github.com/Aptomi/aptomi/pkg/engine/diff"
-	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/runtime"
@@ -185,7 +184,12 @@ func (api *coreAPI) handlePolicyUpdate(writer http.ResponseWriter, request *http
 	if err != nil {
 		panic(fmt.Sprintf("Error while loading current policy: %s", err))
 	}
+	currentPolicy = currentPolicy.MakeCopy()
 	for _, obj := range objects {
+		if dependency, ok := obj.(*lang.Dependency); ok {
+			populateDependencyCreatedAt(currentPolicy, dependency)
+		}
+
 		errAdd := currentPolicy.AddObject(obj)
 		if errAdd != nil {
 			panic(fmt.Sprintf("Error while adding updated object to policy: %s", errAdd))
@@ -240,6 +244,7 @@ func (api *coreAPI) handlePolicyDelete(writer http.ResponseWriter, request *http
 	if err != nil {
 		panic(fmt.Sprintf("Error while loading current policy: %s", err))
 	}
+	currentPolicy = currentPolicy.MakeCopy()
 	for _, obj := range objects {
 		errManage := currentPolicy.View(user).ManageObject(obj)
 		if errManage != nil {
@@ -294,8 +299,7 @@ func (api *coreAPI) getPolicyUpdateResult(writer http.ResponseWriter, request *h
 	// todo we should resolve before saving policy => add Mutex for this method to make sure it's safe
 	// todo: add request id to the event log scope
 	eventLog := event.NewLog("api-policy-update", true)
-	resolver := resolve.NewPolicyResolver(desiredPolicy, api.externalData, eventLog)
-	desiredState, err := resolver.ResolveAllDependencies()
+	desiredState, err := api.resolvePolicy(desiredPolicy, desiredPolicyGen, eventLog)
 	if err != nil {
 		panic(fmt.Sprintf("Cannot resolve desiredPolicy: %s", err))
 	}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"time"
+)
+
+// getCachedResolution returns PolicyResolution for a given policy generation, if the enforcer has already resolved
+// this generation with the current external data. Otherwise nil is returned, policy doesn't get resolved
+func (api *coreAPI) getCachedResolution(policyGen runtime.Generation) *resolve.PolicyResolution {
+	return api.resolutionCache.Get(resolve.NewResolutionCacheKey(policyGen, api.externalData, time.Now()))
+}
+
+// resolvePolicy returns PolicyResolution for a given policy generation. It's taken from the resolution cache if the
+// enforcer has already resolved this generation with the current external data. Otherwise policy gets resolved
+// against the current actual state. API never puts results into the cache, as only the enforcer knows when outputs
+// of component instances change and cached results have to be invalidated
+func (api *coreAPI) resolvePolicy(policy *lang.Policy, policyGen runtime.Generation, eventLog *event.Log) (*resolve.PolicyResolution, error) {
+	if resolution := api.getCachedResolution(policyGen); resolution != nil {
+		return resolution, nil
+	}
+
+	actualState, err := api.store.GetActualState()
+	if err != nil {
+		return nil, fmt.Errorf("error while getting actual state: %s", err)
+	}
+
+	return resolve.NewPolicyResolver(policy, api.externalData, actualState, eventLog).ResolveAllDependencies()
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"fmt"
+	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
@@ -72,3 +73,45 @@ func (api *coreAPI) handleRevisionsGetByPolicy(writer http.ResponseWriter, reque
 		api.contentType.WriteOne(writer, request, &revisionsWrapper{Data: revisions})
 	}
 }
+
+func (api *coreAPI) handleRevisionRolloutApprove(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	user := api.getUserRequired(request)
+
+	policy, _, err := api.store.GetPolicy(runtime.LastGen)
+	if err != nil {
+		panic(fmt.Sprintf("error while getting requested policy: %s", err))
+	}
+
+	ns := params.ByName("ns")
+	name := params.ByName("name")
+
+	obj, err := policy.GetObject(lang.ServiceObject.Kind, name, ns)
+	if err != nil {
+		panic(fmt.Sprintf("error while getting service %s/%s: %s", ns, name, err))
+	}
+	if obj == nil {
+		api.contentType.WriteOneWithStatus(writer, request, nil, http.StatusNotFound)
+		return
+	}
+
+	service := obj.(*lang.Service)
+	errManage := policy.View(user).ManageObject(service)
+	if errManage != nil {
+		panic(fmt.Sprintf("Error while approving rollout: %s", errManage))
+	}
+
+	// approval gets recorded in the last revision atomically, so it doesn't get lost if enforcer updates it meanwhile
+	revision, err := api.store.ApproveRollout(runtime.KeyForStorable(service))
+	if err != nil {
+		panic(fmt.Sprintf("Error while approving rollout: %s", err))
+	}
+	if revision == nil {
+		api.contentType.WriteOneWithStatus(writer, request, nil, http.StatusNotFound)
+		return
+	}
+
+	api.contentType.WriteOne(writer, request, revision)
+
+	// signal to the channel that rollout has been approved, that will trigger the enforcement right away
+	api.policyChanged <- true
+}
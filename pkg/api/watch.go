@@ -0,0 +1,243 @@
+package api
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/api/codec"
+	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	log "github.com/Sirupsen/logrus"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EventStreamContentType is the content type of server-sent event streams
+const EventStreamContentType = "text/event-stream"
+
+// watchKeepAliveInterval is an interval for sending comments into idle event streams, so connections don't get closed
+// by proxies
+const watchKeepAliveInterval = 15 * time.Second
+
+// RevisionUpdateObject contains Info for the RevisionUpdate type
+var RevisionUpdateObject = &runtime.Info{
+	Kind:        "revision-update",
+	Constructor: func() runtime.Object { return &RevisionUpdate{} },
+}
+
+// RevisionUpdate is sent to the clients watching revision every time it changes. It contains revision status and
+// progress, as well as apply log events, which haven't been sent to the client yet
+type RevisionUpdate struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	// Revision and Policy are generations of the revision and of the corresponding policy
+	Revision runtime.Generation
+	Policy   runtime.Generation
+
+	Status   string
+	Progress engine.RevisionProgress
+
+	// ApplyLog contains only new apply log events
+	ApplyLog []*event.APIEvent
+}
+
+// IsFinished returns true if revision isn't being applied anymore
+func (update *RevisionUpdate) IsFinished() bool {
+	return update.Status != engine.RevisionStatusInProgress
+}
+
+// revisionWatch is a revision being watched, which is identified either by its generation or by the generation of
+// policy, which it has been created for
+type revisionWatch struct {
+	gen       runtime.Generation
+	policyGen runtime.Generation
+
+	// sentLog is the number of apply log events already sent to the client
+	sentLog int
+}
+
+func (api *coreAPI) handleRevisionWatch(writer http.ResponseWriter, request *http.Request, params httprouter.Params) {
+	watch := &revisionWatch{gen: runtime.LastGen, policyGen: runtime.LastGen}
+	if gen := params.ByName("gen"); len(gen) > 0 {
+		watch.gen = runtime.ParseGeneration(gen)
+	}
+	if policyGen := params.ByName("policy"); len(policyGen) > 0 {
+		watch.policyGen = runtime.ParseGeneration(policyGen)
+	}
+
+	// start watching before loading revision, so no changes are missed
+	revisions, stopWatch := api.store.WatchRevisions()
+	defer func() {
+		stopWatch()
+	}()
+
+	revision, err := api.loadWatchedRevision(watch)
+	if err != nil {
+		panic(fmt.Sprintf("error while getting requested revision: %s", err))
+	}
+	if revision == nil && watch.policyGen == runtime.LastGen {
+		api.contentType.WriteOneWithStatus(writer, request, nil, http.StatusNotFound)
+		return
+	}
+	if revision == nil {
+		// revision for the policy could be not created yet, but only if the policy itself exists
+		policyData, policyErr := api.store.GetPolicyData(watch.policyGen)
+		if policyErr != nil {
+			panic(fmt.Sprintf("error while getting requested policy: %s", policyErr))
+		}
+		if policyData == nil {
+			api.contentType.WriteOneWithStatus(writer, request, nil, http.StatusNotFound)
+			return
+		}
+	}
+
+	stream, err := api.newEventStream(writer)
+	if err != nil {
+		panic(fmt.Sprintf("error while starting event stream: %s", err))
+	}
+
+	keepAlive := time.NewTicker(watchKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		if revision != nil {
+			applyLog, logErr := api.store.GetRevisionApplyLog(revision.GetGeneration())
+			if logErr != nil {
+				log.Warnf("Error while getting apply log of revision %s: %s", revision.GetGeneration(), logErr)
+				return
+			}
+			update := watch.update(revision, applyLog)
+			err = stream.send(update)
+			if err != nil {
+				log.Warnf("Error while sending update of revision %s: %s", revision.GetGeneration(), err)
+				return
+			}
+			if update.IsFinished() {
+				return
+			}
+		}
+
+		revision = nil
+		select {
+		case changed, ok := <-revisions:
+			if !ok {
+				// watch has been stopped by the store, so it's started again and revision gets reloaded
+				revisions, stopWatch = api.store.WatchRevisions()
+				revision, err = api.loadWatchedRevision(watch)
+				if err != nil {
+					log.Warnf("Error while reloading watched revision: %s", err)
+					return
+				}
+			} else if watch.matches(changed) {
+				revision = changed
+			}
+		case <-keepAlive.C:
+			err = stream.keepAlive()
+			if err != nil {
+				return
+			}
+		case <-request.Context().Done():
+			return
+		}
+	}
+}
+
+// loadWatchedRevision returns the current state of the watched revision, or nil if it hasn't been created yet
+func (api *coreAPI) loadWatchedRevision(watch *revisionWatch) (*engine.Revision, error) {
+	var revision *engine.Revision
+	var err error
+	if watch.gen == runtime.LastGen && watch.policyGen != runtime.LastGen {
+		revision, err = api.store.GetFirstRevisionForPolicy(watch.policyGen)
+	} else {
+		revision, err = api.store.GetRevision(watch.gen)
+	}
+	if err != nil || revision == nil {
+		return nil, err
+	}
+
+	// once revision is found, it's watched by its generation
+	watch.gen = revision.GetGeneration()
+
+	return revision, nil
+}
+
+// matches returns true if a given revision is the watched one
+func (watch *revisionWatch) matches(revision *engine.Revision) bool {
+	if watch.gen != runtime.LastGen {
+		return revision.GetGeneration() == watch.gen
+	}
+	if revision.Policy != watch.policyGen {
+		return false
+	}
+	watch.gen = revision.GetGeneration()
+	return true
+}
+
+// update returns update of a given revision with apply log events, which haven't been sent yet
+func (watch *revisionWatch) update(revision *engine.Revision, applyLog []*event.APIEvent) *RevisionUpdate {
+	if watch.sentLog > len(applyLog) {
+		watch.sentLog = len(applyLog)
+	}
+	update := &RevisionUpdate{
+		TypeKind: RevisionUpdateObject.GetTypeKind(),
+		Revision: revision.GetGeneration(),
+		Policy:   revision.Policy,
+		Status:   revision.Status,
+		Progress: revision.Progress,
+		ApplyLog: applyLog[watch.sentLog:],
+	}
+	watch.sentLog = len(applyLog)
+
+	return update
+}
+
+// eventStream writes objects into the response as server-sent events. Every object is sent as a single event, which
+// type is the object kind and data is the object encoded into JSON
+type eventStream struct {
+	writer  http.ResponseWriter
+	flusher http.Flusher
+	codec   runtime.Codec
+}
+
+func (api *coreAPI) newEventStream(writer http.ResponseWriter) (*eventStream, error) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming isn't supported by response writer")
+	}
+
+	writer.Header().Set("Content-Type", EventStreamContentType)
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	return &eventStream{writer, flusher, api.contentType.GetCodecByContentType(codec.JSON)}, nil
+}
+
+func (stream *eventStream) send(obj runtime.Object) error {
+	data, err := stream.codec.EncodeOne(obj)
+	if err != nil {
+		return fmt.Errorf("error while encoding %s: %s", obj.GetKind(), err)
+	}
+
+	message := "event: " + obj.GetKind() + "\n"
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		message += "data: " + line + "\n"
+	}
+
+	return stream.write(message + "\n")
+}
+
+func (stream *eventStream) keepAlive() error {
+	return stream.write(": keep-alive\n\n")
+}
+
+func (stream *eventStream) write(message string) error {
+	_, err := fmt.Fprint(stream.writer, message)
+	if err != nil {
+		return err
+	}
+	stream.flusher.Flush()
+
+	return nil
+}
@@ -5,11 +5,13 @@ import (
 	"github.com/Aptomi/aptomi/pkg/engine"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/version"
+	"time"
 )
 
 // Core is the Core API client interface
 type Core interface {
 	Policy() Policy
+	Dependency() Dependency
 	Endpoints() Endpoints
 	Revision() Revision
 	State() State
@@ -22,6 +24,16 @@ type Policy interface {
 	Show(gen runtime.Generation) (*engine.PolicyData, error)
 	Apply([]runtime.Object) (*api.PolicyUpdateResult, error)
 	Delete([]runtime.Object) (*api.PolicyUpdateResult, error)
+
+	// History returns all generations of a given policy object and Diff returns changes between two of its generations
+	// (LastGen means the last generation for "to" and the one preceding "to" for "from")
+	History(namespace string, kind string, name string) (*api.PolicyObjectHistory, error)
+	Diff(namespace string, kind string, name string, from runtime.Generation, to runtime.Generation) (*api.PolicyObjectDiff, error)
+}
+
+// Dependency is the interface for managing Dependencies
+type Dependency interface {
+	Extend(namespace string, name string, duration time.Duration) (*api.PolicyUpdateResult, error)
 }
 
 // Endpoints is the interface for getting info about endpoints
@@ -33,11 +45,18 @@ type Endpoints interface {
 type Revision interface {
 	Show(gen runtime.Generation) (*engine.Revision, error)
 	ShowByPolicy(policyGen runtime.Generation) (*engine.Revision, error)
+	ApproveRollout(namespace string, service string) (*engine.Revision, error)
+
+	// Watch and WatchByPolicy call handler for every update of revision until it's applied or timeout passes (zero
+	// means no timeout). Revision with LastGen generation is the latest one
+	Watch(gen runtime.Generation, timeout time.Duration, handler func(update *api.RevisionUpdate)) error
+	WatchByPolicy(policyGen runtime.Generation, timeout time.Duration, handler func(update *api.RevisionUpdate)) error
 }
 
-// State is the interface for resetting Actual State
+// State is the interface for resetting Actual State and enforcing it
 type State interface {
 	Reset() (*engine.Revision, error)
+	Enforce(dependency string, service string, namespace string) (*engine.Revision, error)
 }
 
 // User is the interface for auth and user management
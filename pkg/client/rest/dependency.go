@@ -0,0 +1,27 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/api"
+	"github.com/Aptomi/aptomi/pkg/client/rest/http"
+	"github.com/Aptomi/aptomi/pkg/config"
+	"time"
+)
+
+type dependencyClient struct {
+	cfg        *config.Client
+	httpClient http.Client
+}
+
+func (client *dependencyClient) Extend(namespace string, name string, duration time.Duration) (*api.PolicyUpdateResult, error) {
+	response, err := client.httpClient.POST(fmt.Sprintf("/policy/dependency/%s/%s/extend/%s", namespace, name, duration), api.PolicyUpdateResultObject, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*api.PolicyUpdateResult), nil
+}
@@ -1,6 +1,7 @@
 package http
 
 import (
+	"bufio"
 	"bytes"
 	"fmt"
 	"github.com/Aptomi/aptomi/pkg/api"
@@ -10,6 +11,8 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"time"
 )
 
 // Client is the interface for doing HTTP requests that operates using runtime objects
@@ -19,6 +22,10 @@ type Client interface {
 	POSTSlice(path string, expected *runtime.Info, body []runtime.Object) (runtime.Object, error)
 	DELETE(path string, expected *runtime.Info) (runtime.Object, error)
 	DELETESlice(path string, expected *runtime.Info, body []runtime.Object) (runtime.Object, error)
+
+	// GETStream reads a stream of server-sent events and calls handler for every object received until server closes
+	// the stream or a given timeout passes (zero means no timeout)
+	GETStream(path string, expected *runtime.Info, timeout time.Duration, handler func(obj runtime.Object)) error
 }
 
 type httpClient struct {
@@ -27,6 +34,9 @@ type httpClient struct {
 	cfg         *config.Client
 }
 
+// maxEventSize is the max size of a single server-sent event read from the stream
+const maxEventSize = 16 * 1024 * 1024
+
 // NewClient returns implementation of
 func NewClient(cfg *config.Client) Client {
 	client := &http.Client{
@@ -87,7 +97,85 @@ func (client *httpClient) DELETESlice(path string, expected *runtime.Info, body
 	return client.request(http.MethodDelete, path, expected, bodyData)
 }
 
+func (client *httpClient) GETStream(path string, expected *runtime.Info, timeout time.Duration, handler func(obj runtime.Object)) error {
+	req, err := client.newRequest(http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", api.EventStreamContentType)
+
+	// separate http client is used, as the default one has timeout for the whole request, which is too short for stream
+	streamClient := &http.Client{Timeout: timeout}
+	resp, err := streamClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("not found: %s", path)
+	}
+	if resp.Header.Get("Content-Type") != api.EventStreamContentType {
+		_, err = client.readResponse(resp, expected)
+		if err == nil {
+			err = fmt.Errorf("server hasn't started event stream")
+		}
+		return err
+	}
+
+	// every event is a set of lines terminated by an empty line, only data lines are used to decode objects
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxEventSize)
+	data := []string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) > 0 {
+			if strings.HasPrefix(line, "data:") {
+				data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			}
+			continue
+		}
+		if len(data) <= 0 {
+			continue
+		}
+
+		obj, decodeErr := client.contentType.GetCodecByContentType(codec.JSON).DecodeOne([]byte(strings.Join(data, "\n")))
+		if decodeErr != nil {
+			return fmt.Errorf("error while unmarshalling event: %s", decodeErr)
+		}
+		data = data[:0]
+
+		obj, err = checkResponseObject(obj, expected)
+		if err != nil {
+			return err
+		}
+		handler(obj)
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return fmt.Errorf("error while reading event stream: %s", err)
+	}
+
+	return nil
+}
+
 func (client *httpClient) request(method string, path string, expected *runtime.Info, body io.Reader) (runtime.Object, error) {
+	req, err := client.newRequest(method, path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	return client.readResponse(resp, expected)
+}
+
+func (client *httpClient) newRequest(method string, path string, body io.Reader) (*http.Request, error) {
 	req, err := http.NewRequest(method, client.cfg.API.URL()+path, body)
 	if err != nil {
 		return nil, err
@@ -99,18 +187,19 @@ func (client *httpClient) request(method string, path string, expected *runtime.
 	req.Header.Set("Content-Type", codec.Default)
 	req.Header.Set("User-Agent", "aptomictl")
 
-	resp, err := client.http.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close() // nolint: errcheck
+	return req, nil
+}
 
+func (client *httpClient) readResponse(resp *http.Response, expected *runtime.Info) (runtime.Object, error) {
 	respData, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("error while reading bytes from response Body: %s", err)
 	}
 
 	if len(respData) == 0 {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("not found: %s", resp.Request.URL.Path)
+		}
 		return nil, fmt.Errorf("empty response")
 	}
 
@@ -119,6 +208,12 @@ func (client *httpClient) request(method string, path string, expected *runtime.
 		return nil, fmt.Errorf("error while unmarshalling response: %s", err)
 	}
 
+	return checkResponseObject(obj, expected)
+}
+
+// checkResponseObject returns error if a given object is server error or if it isn't of expected kind
+func checkResponseObject(obj runtime.Object, expected *runtime.Info) (runtime.Object, error) {
+
 	if obj.GetKind() == api.ServerErrorObject.Kind {
 		serverErr, ok := obj.(*api.ServerError)
 		if !ok {
@@ -52,3 +52,29 @@ func (client *policyClient) Delete(updated []runtime.Object) (*api.PolicyUpdateR
 
 	return response.(*api.PolicyUpdateResult), nil
 }
+
+func (client *policyClient) History(namespace string, kind string, name string) (*api.PolicyObjectHistory, error) {
+	response, err := client.httpClient.GET(fmt.Sprintf("/policy/history/%s/%s/%s", namespace, kind, name), api.PolicyObjectHistoryObject)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*api.PolicyObjectHistory), nil
+}
+
+func (client *policyClient) Diff(namespace string, kind string, name string, from runtime.Generation, to runtime.Generation) (*api.PolicyObjectDiff, error) {
+	response, err := client.httpClient.GET(fmt.Sprintf("/policy/history/%s/%s/%s/diff/%d/%d", namespace, kind, name, from, to), api.PolicyObjectDiffObject)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*api.PolicyObjectDiff), nil
+}
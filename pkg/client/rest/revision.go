@@ -6,6 +6,7 @@ import (
 	"github.com/Aptomi/aptomi/pkg/client/rest/http"
 	"github.com/Aptomi/aptomi/pkg/engine"
 	"github.com/Aptomi/aptomi/pkg/runtime"
+	"time"
 
 	"github.com/Aptomi/aptomi/pkg/config"
 )
@@ -40,3 +41,30 @@ func (client *revisionClient) ShowByPolicy(policyGen runtime.Generation) (*engin
 
 	return response.(*engine.Revision), nil
 }
+
+func (client *revisionClient) ApproveRollout(namespace string, service string) (*engine.Revision, error) {
+	response, err := client.httpClient.POST(fmt.Sprintf("/revision/rollout/%s/%s/approve", namespace, service), engine.RevisionObject, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*engine.Revision), nil
+}
+
+func (client *revisionClient) Watch(gen runtime.Generation, timeout time.Duration, handler func(update *api.RevisionUpdate)) error {
+	return client.watch(fmt.Sprintf("/revision/gen/%d/watch", gen), timeout, handler)
+}
+
+func (client *revisionClient) WatchByPolicy(policyGen runtime.Generation, timeout time.Duration, handler func(update *api.RevisionUpdate)) error {
+	return client.watch(fmt.Sprintf("/revision/policy/%d/watch", policyGen), timeout, handler)
+}
+
+func (client *revisionClient) watch(path string, timeout time.Duration, handler func(update *api.RevisionUpdate)) error {
+	return client.httpClient.GETStream(path, api.RevisionUpdateObject, timeout, func(obj runtime.Object) {
+		handler(obj.(*api.RevisionUpdate))
+	})
+}
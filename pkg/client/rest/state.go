@@ -1,9 +1,12 @@
 package rest
 
 import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/api"
 	"github.com/Aptomi/aptomi/pkg/client/rest/http"
 	"github.com/Aptomi/aptomi/pkg/config"
 	"github.com/Aptomi/aptomi/pkg/engine"
+	"net/url"
 )
 
 type stateClient struct {
@@ -19,3 +22,27 @@ func (client *stateClient) Reset() (*engine.Revision, error) {
 
 	return revision.(*engine.Revision), nil
 }
+
+func (client *stateClient) Enforce(dependency string, service string, namespace string) (*engine.Revision, error) {
+	query := url.Values{}
+	if len(dependency) > 0 {
+		query.Set("dependency", dependency)
+	}
+	if len(service) > 0 {
+		query.Set("service", service)
+	}
+	if len(namespace) > 0 {
+		query.Set("namespace", namespace)
+	}
+
+	response, err := client.httpClient.POST("/actualstate/enforce?"+query.Encode(), engine.RevisionObject, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if serverError, ok := response.(*api.ServerError); ok {
+		return nil, fmt.Errorf("server error: %s", serverError.Error)
+	}
+
+	return response.(*engine.Revision), nil
+}
@@ -17,6 +17,7 @@ type K8s struct {
 // K8sRaw represents config for Kubernetes Raw code plugin
 type K8sRaw struct {
 	DataNamespace string
+	JobTimeout    time.Duration
 }
 
 // Helm represents configs for Helm code plugin
@@ -4,16 +4,20 @@ import "time"
 
 // Server represents configs for the server
 type Server struct {
-	Debug                bool            `validate:"-"`
-	API                  API             `validate:"required"`
-	UI                   UI              `validate:"omitempty"` // if UI is not defined, then UI will not be started
-	DB                   DB              `validate:"required"`
-	Plugins              Plugins         `validate:"required"`
-	Users                UserSources     `validate:"required"`
-	SecretsDir           string          `validate:"omitempty,dir"` // secrets is not a first-class citizen yet, so it's not required
-	Enforcer             Enforcer        `validate:"required"`
-	DomainAdminOverrides map[string]bool `validate:"-"`
-	Auth                 ServerAuth      `validate:"-"`
+	Debug                bool             `validate:"-"`
+	API                  API              `validate:"required"`
+	UI                   UI               `validate:"omitempty"` // if UI is not defined, then UI will not be started
+	DB                   DB               `validate:"required"`
+	Plugins              Plugins          `validate:"required"`
+	Users                UserSources      `validate:"required"`
+	SecretsDir           string           `validate:"omitempty,dir"` // secrets is not a first-class citizen yet, so it's not required
+	Enforcer             Enforcer         `validate:"required"`
+	DependencyExpiry     DependencyExpiry `validate:"-"`
+	LeaderElection       LeaderElection   `validate:"-"`
+	Retention            Retention        `validate:"-"`
+	Migration            Migration        `validate:"-"`
+	DomainAdminOverrides map[string]bool  `validate:"-"`
+	Auth                 ServerAuth       `validate:"-"`
 }
 
 // UserSources represents configs for the user loaders that could be file and LDAP loaders
@@ -27,9 +31,22 @@ func (s Server) IsDebug() bool {
 	return s.Debug
 }
 
-// DB represents configs for DB
+// DB represents configs for DB. Connection is either a path to BoltDB file (optionally prefixed with bolt://) or
+// a list of etcd endpoints in the form of etcd://host1:2379,host2:2379/prefix or mem:// for in-memory store (useful for
+// testing only, as all data is lost on restart). TLS is only used for etcd
 type DB struct {
 	Connection string `validate:"required"`
+	TLS        DBTLS  `validate:"-"`
+}
+
+// DBTLS represents configs for connecting to etcd over TLS. Once enabled, etcd endpoints are accessed over https and
+// server certificates are verified using CAFile (or system CAs, if it's not specified). CertFile and KeyFile are
+// optional client certificate and key to authenticate with.
+type DBTLS struct {
+	Enabled  bool   `validate:"-"`
+	CAFile   string `validate:"-"`
+	CertFile string `validate:"-"`
+	KeyFile  string `validate:"-"`
 }
 
 // Enforcer represents configs for Enforcer background process that periodically gets latest policy, calculating
@@ -41,6 +58,42 @@ type Enforcer struct {
 	NoopSleep time.Duration `validate:"-"`
 }
 
+// DependencyExpiry represents configs for the background process that periodically removes expired dependencies
+// from the policy. Interval defines how often it runs (zero disables it), Warning defines how long before expiry
+// warnings should start being reported.
+type DependencyExpiry struct {
+	Interval time.Duration `validate:"-"`
+	Warning  time.Duration `validate:"-"`
+}
+
+// LeaderElection represents configs for leader election between multiple servers sharing the same DB. Only the leader
+// runs the enforcer and the dependency expiry, while all servers serve the API. ID identifies the server (defaults to
+// hostname and process id), TTL defines how long leadership lasts unless it's renewed.
+type LeaderElection struct {
+	Enabled bool          `validate:"-"`
+	ID      string        `validate:"-"`
+	TTL     time.Duration `validate:"-"`
+}
+
+// Retention represents configs for the background process that periodically compacts DB. Revisions are kept in full
+// for as long as they are among the last Revisions ones or younger than Age. Logs of older revisions get trimmed down
+// to warnings and errors, while their status is kept. Policy generations older than the ones used by retained revisions
+// get removed along with generations of policy objects, which aren't referenced by retained policy generations anymore.
+// Revisions older than RemoveAge get removed completely, except for the last one (zero keeps them forever).
+// Interval defines how often compaction runs (zero disables it).
+type Retention struct {
+	Interval  time.Duration `validate:"-"`
+	Revisions int           `validate:"-"`
+	Age       time.Duration `validate:"-"`
+	RemoveAge time.Duration `validate:"-"`
+}
+
+// Migration represents configs for migration of the stored objects to the latest schema version, which happens on
+// server start. Backup of all stored objects is written into BackupDir before they get migrated.
+type Migration struct {
+	BackupDir string `validate:"-"`
+}
+
 // ServerAuth represents server auth config
 type ServerAuth struct {
 	Secret string `validate:"-"`
@@ -0,0 +1,3 @@
+// Package election implements leader election between multiple Aptomi servers sharing the same object store. Only
+// the leader runs background jobs which change the state (e.g. policy enforcement), while all servers serve the API.
+package election
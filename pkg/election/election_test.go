@@ -0,0 +1,130 @@
+package election
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+const ttl = 15 * time.Second
+
+// fakeClock is a clock shared by the lock and the electors, which is advanced manually
+type fakeClock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	return clock.now
+}
+
+func (clock *fakeClock) Advance(d time.Duration) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+	clock.now = clock.now.Add(d)
+}
+
+// newCluster creates electors competing for the same in-memory lock, which all use the same fake clock
+func newCluster(lock Lock, clock *fakeClock, count int) []*Elector {
+	if memLock, ok := lock.(*memoryLock); ok {
+		memLock.now = clock.Now
+	}
+	result := []*Elector{}
+	for i := 0; i < count; i++ {
+		elector := NewElector(lock, fmt.Sprintf("server-%d", i), ttl)
+		elector.now = clock.Now
+		result = append(result, elector)
+	}
+	return result
+}
+
+func elect(t *testing.T, elector *Elector) bool {
+	t.Helper()
+	leader, err := elector.Elect()
+	assert.NoError(t, err, "Election should succeed for %s", elector.ID())
+	return leader
+}
+
+func TestElectionFailover(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	lock := NewMemoryLock()
+	electors := newCluster(lock, clock, 2)
+	first, second := electors[0], electors[1]
+
+	// only one server becomes the leader
+	assert.True(t, elect(t, first), "First server should become the leader")
+	assert.False(t, elect(t, second), "Second server should not become the leader")
+	assert.True(t, first.IsLeader(), "First server should be the leader")
+	assert.False(t, second.IsLeader(), "Second server should not be the leader")
+
+	leader, err := second.Leader()
+	assert.NoError(t, err, "Leader should be retrieved")
+	assert.Equal(t, first.ID(), leader, "Second server should see the first one as the leader")
+
+	// leader keeps leadership for as long as it renews it
+	for i := 0; i < 5; i++ {
+		clock.Advance(ttl / 3)
+		assert.True(t, elect(t, first), "First server should renew leadership")
+		assert.False(t, elect(t, second), "Second server should not become the leader while leadership is renewed")
+	}
+
+	// leader dies and stops renewing leadership, it expires and the second server takes over
+	clock.Advance(ttl / 2)
+	assert.False(t, elect(t, second), "Second server should not become the leader before leadership expires")
+	clock.Advance(ttl / 2)
+	assert.False(t, first.IsLeader(), "First server should consider itself not the leader once leadership expired")
+	assert.True(t, elect(t, second), "Second server should become the leader once leadership expired")
+
+	// first server comes back and doesn't become the leader
+	assert.False(t, elect(t, first), "First server should not become the leader again")
+	assert.True(t, second.IsLeader(), "Second server should stay the leader")
+
+	// leader resigns, so the first server takes over right away
+	assert.NoError(t, second.Resign(), "Second server should resign")
+	assert.False(t, second.IsLeader(), "Second server should not be the leader after resigning")
+	assert.True(t, elect(t, first), "First server should become the leader after the second one resigned")
+}
+
+// failingLock fails to acquire the lock, while failing is set
+type failingLock struct {
+	Lock
+	failing bool
+}
+
+func (lock *failingLock) Acquire(holder string, ttl time.Duration) (bool, error) {
+	if lock.failing {
+		return false, fmt.Errorf("store isn't reachable")
+	}
+	return lock.Lock.Acquire(holder, ttl)
+}
+
+func TestElectionLockErrors(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	memLock := NewMemoryLock()
+	memLock.(*memoryLock).now = clock.Now
+	lock := &failingLock{Lock: memLock}
+	electors := newCluster(lock, clock, 1)
+	elector := electors[0]
+
+	assert.True(t, elect(t, elector), "Server should become the leader")
+
+	// leader keeps leadership until it expires, even if it can't be renewed
+	lock.failing = true
+	clock.Advance(ttl / 2)
+	leader, err := elector.Elect()
+	assert.Error(t, err, "Election should fail while lock can't be acquired")
+	assert.True(t, leader, "Server should stay the leader until leadership expires")
+
+	clock.Advance(ttl / 2)
+	leader, err = elector.Elect()
+	assert.Error(t, err, "Election should fail while lock can't be acquired")
+	assert.False(t, leader, "Server should step down once leadership expired")
+	assert.False(t, elector.IsLeader(), "Server should not be the leader once leadership expired")
+
+	lock.failing = false
+	assert.True(t, elect(t, elector), "Server should become the leader again once lock can be acquired")
+}
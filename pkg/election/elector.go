@@ -0,0 +1,127 @@
+package election
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"os"
+	"sync"
+	"time"
+)
+
+// Elector takes part in leader election on behalf of a single server. Leadership is acquired by holding a shared lock
+// and has to be renewed periodically. Elector considers itself the leader only until the lock it acquired expires, so
+// if it can't renew the lock (e.g. store isn't reachable), it steps down before someone else could become the leader
+type Elector struct {
+	lock Lock
+	id   string
+	ttl  time.Duration
+	now  func() time.Time
+
+	mutex       sync.RWMutex
+	leaderUntil time.Time
+}
+
+// NewElector creates a new elector with a given identifier, which competes for a given lock. Leadership lasts for a
+// given period of time (TTL), unless it's renewed
+func NewElector(lock Lock, id string, ttl time.Duration) *Elector {
+	return &Elector{
+		lock: lock,
+		id:   id,
+		ttl:  ttl,
+		now:  time.Now,
+	}
+}
+
+// DefaultID returns an identifier of the current process, which is unique across the servers
+func DefaultID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// ID returns identifier of the elector
+func (elector *Elector) ID() string {
+	return elector.id
+}
+
+// IsLeader returns true if elector is the leader at the moment
+func (elector *Elector) IsLeader() bool {
+	elector.mutex.RLock()
+	defer elector.mutex.RUnlock()
+
+	return elector.now().Before(elector.leaderUntil)
+}
+
+// Leader returns identifier of the current leader, or an empty string if there is no leader at the moment
+func (elector *Elector) Leader() (string, error) {
+	if elector.IsLeader() {
+		return elector.id, nil
+	}
+	return elector.lock.Holder()
+}
+
+// Elect tries to acquire leadership or renew it, if elector is already the leader. It returns true if elector is the
+// leader. It should be called more often than TTL, otherwise leadership expires
+func (elector *Elector) Elect() (bool, error) {
+	// leadership is counted from the moment before the lock got acquired, so it expires not later than the lock itself
+	start := elector.now()
+	acquired, err := elector.lock.Acquire(elector.id, elector.ttl)
+
+	elector.mutex.Lock()
+	defer elector.mutex.Unlock()
+
+	wasLeader := elector.now().Before(elector.leaderUntil)
+	if err != nil {
+		// keep leadership until it expires, lock may be renewed on the next attempt
+		return wasLeader, fmt.Errorf("error while acquiring leader lock: %s", err)
+	}
+
+	if !acquired {
+		if wasLeader {
+			log.Warnf("Server %s lost leadership", elector.id)
+		}
+		elector.leaderUntil = time.Time{}
+		return false, nil
+	}
+
+	if !wasLeader {
+		log.Infof("Server %s became the leader", elector.id)
+	}
+	elector.leaderUntil = start.Add(elector.ttl)
+	return true, nil
+}
+
+// Resign gives up leadership and releases the lock, so someone else could become the leader right away
+func (elector *Elector) Resign() error {
+	elector.mutex.Lock()
+	elector.leaderUntil = time.Time{}
+	elector.mutex.Unlock()
+
+	return elector.lock.Release(elector.id)
+}
+
+// Run takes part in leader election until a given channel is closed, renewing leadership three times per TTL. Once
+// stopped, elector resigns
+func (elector *Elector) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(elector.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		_, err := elector.Elect()
+		if err != nil {
+			log.Errorf("Error during leader election: %s", err)
+		}
+
+		select {
+		case <-stop:
+			err = elector.Resign()
+			if err != nil {
+				log.Errorf("Error while resigning leadership: %s", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package election
+
+import (
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"sync"
+	"time"
+)
+
+// Lock is an interface for a shared lock with expiration, which is used to elect the leader. Lock is held by a single
+// holder at a time, and it's released automatically if the holder doesn't renew it in time
+type Lock interface {
+	// Acquire should acquire the lock for a given holder for a given period of time or renew it, if the lock is
+	// already held by the same holder. It should return false if the lock is held by someone else
+	Acquire(holder string, ttl time.Duration) (bool, error)
+
+	// Release should release the lock, if it's held by a given holder
+	Release(holder string) error
+
+	// Holder should return the current holder of the lock, or an empty string if the lock isn't held by anyone
+	Holder() (string, error)
+}
+
+// LeaseObject is an informational data structure with Kind and Constructor for Lease
+var LeaseObject = &runtime.Info{
+	Kind:        "lease",
+	Storable:    true,
+	Versioned:   false,
+	Constructor: func() runtime.Object { return &Lease{} },
+}
+
+// Lease represents a lock persisted in the object store. Expiration time is absolute, so clocks of the servers
+// sharing the lock should be synchronized
+type Lease struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	// Name is a name of the lock
+	Name string
+
+	// Holder is an identifier of the lock holder
+	Holder string
+
+	// ExpiresAt is the time when the lock gets released, unless it's renewed by the holder
+	ExpiresAt time.Time
+}
+
+// NewLease creates a new lease of a given lock for a given holder
+func NewLease(name string, holder string, expiresAt time.Time) *Lease {
+	return &Lease{
+		TypeKind:  LeaseObject.GetTypeKind(),
+		Name:      name,
+		Holder:    holder,
+		ExpiresAt: expiresAt,
+	}
+}
+
+// GetNamespace returns an object namespace. It's a system namespace for all leases
+func (lease *Lease) GetNamespace() string {
+	return runtime.SystemNS
+}
+
+// GetName returns object name
+func (lease *Lease) GetName() string {
+	return lease.Name
+}
+
+// IsHeld returns true if lease hasn't expired yet at a given time
+func (lease *Lease) IsHeld(now time.Time) bool {
+	return len(lease.Holder) > 0 && now.Before(lease.ExpiresAt)
+}
+
+// NewMemoryLock creates a new lock, which is kept in memory. It can only be shared between electors within the same
+// process, so it's useful for testing
+func NewMemoryLock() Lock {
+	return &memoryLock{now: time.Now}
+}
+
+type memoryLock struct {
+	mutex sync.Mutex
+	lease Lease
+	now   func() time.Time
+}
+
+func (lock *memoryLock) Acquire(holder string, ttl time.Duration) (bool, error) {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	now := lock.now()
+	if lock.lease.IsHeld(now) && lock.lease.Holder != holder {
+		return false, nil
+	}
+	lock.lease.Holder = holder
+	lock.lease.ExpiresAt = now.Add(ttl)
+
+	return true, nil
+}
+
+func (lock *memoryLock) Release(holder string) error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	if lock.lease.Holder == holder {
+		lock.lease = Lease{}
+	}
+
+	return nil
+}
+
+func (lock *memoryLock) Holder() (string, error) {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	if !lock.lease.IsHeld(lock.now()) {
+		return "", nil
+	}
+
+	return lock.lease.Holder, nil
+}
@@ -12,4 +12,8 @@ type StateUpdater interface {
 
 	// Delete will get called when an existing object (ComponentInstance) is deleted from  the actual state
 	Delete(string) error
+
+	// Flush will get called at the action boundaries, when changes made so far have to be persisted. State updater may
+	// buffer changes passed to Save and Delete and write them all at once when Flush is called
+	Flush() error
 }
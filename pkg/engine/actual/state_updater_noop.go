@@ -19,3 +19,7 @@ func (*noOpActualStateUpdater) Save(obj runtime.Storable) error {
 func (*noOpActualStateUpdater) Delete(string) error {
 	return nil
 }
+
+func (*noOpActualStateUpdater) Flush() error {
+	return nil
+}
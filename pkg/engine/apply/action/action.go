@@ -9,3 +9,10 @@ type Base interface {
 	runtime.Storable
 	Apply(*Context) error
 }
+
+// Grouped is an interface for actions, which belong to a group of actions done on the same object (e.g. all actions
+// for a single component instance). Changes of actual state made by consecutive actions of the same group get
+// persisted together, once all of them are done
+type Grouped interface {
+	GetGroup() string
+}
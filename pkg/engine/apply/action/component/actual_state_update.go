@@ -34,6 +34,19 @@ func updateActualStateFromDesired(componentKey string, context *action.Context,
 		panic(fmt.Sprintf("component instance not found in desired state: %s", componentKey))
 	}
 
+	// preserve status of a one-shot job and readiness status, unless they have just been updated
+	if instance.Job == nil && instanceActual != nil {
+		instance.Job = instanceActual.Job
+	}
+	if instance.Readiness == nil && instanceActual != nil {
+		instance.Readiness = instanceActual.Readiness
+	}
+
+	// preserve previous deployment left after blue/green switchover, unless switchover has just happened
+	if len(instance.PreviousDeployName) <= 0 && instanceActual != nil {
+		instance.PreviousDeployName = instanceActual.PreviousDeployName
+	}
+
 	// modify create/update times, copy it over to the actual state
 	instance.UpdateTimes(timeCreated, timeUpdated)
 	context.ActualState.ComponentInstanceMap[componentKey] = instance
@@ -55,6 +68,16 @@ func updateComponentInActualState(componentKey string, context *action.Context)
 	return nil
 }
 
+// flushActualState persists changes of actual state buffered so far. It's called before changing deployments, so the
+// stored actual state is up to date if apply gets interrupted afterwards, and doesn't depend on action boundaries
+func flushActualState(context *action.Context) error {
+	err := context.ActualStateUpdater.Flush()
+	if err != nil {
+		return fmt.Errorf("error while saving actual state: %s", err)
+	}
+	return nil
+}
+
 func deleteComponentFromActualState(componentKey string, context *action.Context) error {
 	// delete component from the actual state
 	delete(context.ActualState.ComponentInstanceMap, componentKey)
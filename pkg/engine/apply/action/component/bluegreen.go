@@ -0,0 +1,158 @@
+package component
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+)
+
+// isBlueGreen returns true if component instance has to be updated via blue/green strategy
+func isBlueGreen(component *lang.ServiceComponent) bool {
+	return component != nil && component.Code != nil && !component.Code.Job && component.Code.UpdateStrategy == lang.UpdateStrategyBlueGreen
+}
+
+// updateBlueGreen creates a new deployment of component instance under the next versioned deploy name, next to
+// the current one, and waits for it to become ready. If the new deployment fails, it gets destroyed and the current
+// one is left untouched. Otherwise component instance gets switched to the new deployment, while the current one is
+// recorded as previous and gets destroyed later, once components which depend on it get updated
+func updateBlueGreen(instance *resolve.ComponentInstance, component *lang.ServiceComponent, codePlugin plugin.CodePlugin, context *action.Context) error {
+	instanceActual := context.ActualState.ComponentInstanceMap[instance.GetKey()]
+	if instanceActual == nil {
+		return fmt.Errorf("component instance not found in actual state: %s", instance.GetKey())
+	}
+
+	// clean up a deployment, which might have been left behind by an interrupted switchover
+	if instanceActual.NextDeployVersion > 0 {
+		destroyDeployment(instanceActual, instanceActual.GetDeployNameForVersion(instanceActual.NextDeployVersion), codePlugin, context)
+		instanceActual.NextDeployVersion = 0
+	}
+
+	// previous deployment is about to be superseded by the new one, so dependent components will be switched to it.
+	// Changes made so far get persisted before it's destroyed
+	if len(instanceActual.PreviousDeployName) > 0 {
+		err := flushActualState(context)
+		if err != nil {
+			return err
+		}
+		destroyDeployment(instanceActual, instanceActual.PreviousDeployName, codePlugin, context)
+		instanceActual.PreviousDeployName = ""
+	}
+
+	// record that the next deployment is being created, so it can be cleaned up if apply gets interrupted. Record has
+	// to be persisted before the deployment gets created, as buffered changes are otherwise written on action boundary
+	version := instanceActual.DeployVersion
+	instanceActual.NextDeployVersion = version + 1
+	err := updateComponentInActualState(instance.GetKey(), context)
+	if err != nil {
+		return err
+	}
+	err = flushActualState(context)
+	if err != nil {
+		return err
+	}
+
+	context.EventLog.WithFields(event.Fields{
+		"componentKey": instance.Metadata.Key,
+		"deployName":   instance.GetDeployNameForVersion(version + 1),
+	}).Info("Creating a new deployment of component instance for blue/green update: " + instance.GetKey())
+
+	// new deployment gets created with code params and readiness probe, which have been calculated for its deploy name
+	codeParams, probe := instance.CalculatedCodeParams, instance.CalculatedReadinessProbe
+	instance.DeployVersion = version + 1
+	instance.CalculatedCodeParams = instance.NextCodeParams
+	instance.CalculatedReadinessProbe = instance.NextReadinessProbe
+
+	err = codePlugin.Create(instance.GetDeployName(), instance.CalculatedCodeParams, context.EventLog)
+	if err == nil {
+		err = waitForReadiness(instance, component, context)
+	}
+	if err == nil {
+		err = processOutputs(instance, codePlugin, context)
+	}
+	if err != nil {
+		// leave the current deployment untouched and get rid of the new one
+		destroyDeployment(instance, instance.GetDeployName(), codePlugin, context)
+		instance.DeployVersion = version
+		instance.CalculatedCodeParams = codeParams
+		instance.CalculatedReadinessProbe = probe
+		instanceActual.NextDeployVersion = 0
+		errSave := updateComponentInActualState(instance.GetKey(), context)
+		if errSave != nil {
+			context.EventLog.LogWarning(errSave)
+		}
+		return fmt.Errorf("new deployment failed, keeping the current one: %s", err)
+	}
+
+	// current deployment is still used by components which depend on this component instance, until they get
+	// re-resolved and updated to discover the new deployment
+	instance.PreviousDeployName = instanceActual.GetDeployName()
+	context.OutputsChanged = true
+	return nil
+}
+
+// destroyDeployment destroys a given deployment of component instance. It's called for deployments which are not the
+// current ones anymore, so errors get logged as warnings instead of failing the action
+func destroyDeployment(instance *resolve.ComponentInstance, deployName string, codePlugin plugin.CodePlugin, context *action.Context) {
+	context.EventLog.WithFields(event.Fields{
+		"componentKey": instance.Metadata.Key,
+		"deployName":   deployName,
+	}).Info("Destroying deployment of component instance: " + instance.GetKey())
+
+	err := codePlugin.Destroy(deployName, instance.CalculatedCodeParams, context.EventLog)
+	if err != nil {
+		context.EventLog.LogWarning(fmt.Errorf("unable to destroy deployment '%s' of component instance '%s': %s", deployName, instance.GetKey(), err))
+	}
+}
+
+// getOutdatedDependent returns a key of component instance, which may discover a given component instance and hasn't
+// been updated to match desired state yet. Those are other components of the same service instance, as well as
+// components of service instances which depend on it (recursively). It returns an empty string if all of them are
+// up to date
+func getOutdatedDependent(componentKey string, context *action.Context) string {
+	visited := map[string]bool{componentKey: true}
+	queue := []string{componentKey}
+	for len(queue) > 0 {
+		instance := context.DesiredState.ComponentInstanceMap[queue[0]]
+		queue = queue[1:]
+		if instance == nil {
+			continue
+		}
+
+		// go up to the parent (service instance, or component instance with a contract), as well as to its children
+		for parentKey := range instance.EdgesIn {
+			keys := []string{parentKey}
+			if parent := context.DesiredState.ComponentInstanceMap[parentKey]; parent != nil && parent.Metadata.Key.IsService() {
+				for childKey := range parent.EdgesOut {
+					keys = append(keys, childKey)
+				}
+			}
+			for _, key := range keys {
+				if visited[key] {
+					continue
+				}
+				visited[key] = true
+				queue = append(queue, key)
+				if isOutdated(key, context) {
+					return key
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// isOutdated returns true if component instance in actual state doesn't match desired state
+func isOutdated(componentKey string, context *action.Context) bool {
+	instance := context.DesiredState.ComponentInstanceMap[componentKey]
+	instanceActual := context.ActualState.ComponentInstanceMap[componentKey]
+	if instanceActual == nil {
+		return instance != nil
+	}
+	if instance == nil {
+		return false
+	}
+	return !instance.CalculatedCodeParams.DeepEqual(instanceActual.CalculatedCodeParams)
+}
@@ -3,8 +3,10 @@ package component
 import (
 	"fmt"
 	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 )
 
@@ -30,59 +32,97 @@ func NewCreateAction(componentKey string) *CreateAction {
 	}
 }
 
+// GetGroup returns a key of component instance, so all consecutive actions for the same instance are grouped
+func (a *CreateAction) GetGroup() string {
+	return a.ComponentKey
+}
+
 // Apply applies the action
 func (a *CreateAction) Apply(context *action.Context) error {
+	instance := context.DesiredState.ComponentInstanceMap[a.ComponentKey]
+	component, err := getComponent(instance, context)
+	if err != nil {
+		return fmt.Errorf("unable to deploy component instance '%s': %s", a.ComponentKey, err)
+	}
+
 	// deploy to cloud
-	err := a.processDeployment(context)
+	codePlugin, err := a.processDeployment(instance, component, context)
 	if err != nil {
 		return fmt.Errorf("unable to deploy component instance '%s': %s", a.ComponentKey, err)
 	}
 
-	// update actual state
-	return updateActualStateFromDesired(a.ComponentKey, context, true, true, true)
-}
+	// retrieve outputs and wait for component instance to become ready, before components which depend on it get
+	// processed. Component instance exists in the cloud at this point, so it gets recorded into actual state first
+	errOutputs := processOutputs(instance, codePlugin, context)
+	errReady := waitForReadiness(instance, component, context)
 
-func (a *CreateAction) processDeployment(context *action.Context) error {
-	instance := context.DesiredState.ComponentInstanceMap[a.ComponentKey]
-	serviceObj, err := context.DesiredPolicy.GetObject(lang.ServiceObject.Kind, instance.Metadata.Key.ServiceName, instance.Metadata.Key.Namespace)
+	// update actual state
+	err = updateActualStateFromDesired(a.ComponentKey, context, true, true, true)
 	if err != nil {
 		return err
 	}
-	component := serviceObj.(*lang.Service).GetComponentsMap()[instance.Metadata.Key.ComponentName]
+	if errOutputs != nil {
+		return fmt.Errorf("component instance '%s' has been deployed, but %s", a.ComponentKey, errOutputs)
+	}
+	if errReady != nil {
+		return fmt.Errorf("component instance '%s' has been deployed, but %s", a.ComponentKey, errReady)
+	}
 
+	// run post-create hooks
+	err = runHooks(instance, component, lang.HookPostCreate, context)
+	if err != nil {
+		return fmt.Errorf("component instance '%s' has been deployed, but %s", a.ComponentKey, err)
+	}
+	return nil
+}
+
+// processDeployment deploys code of component instance and returns code plugin it has been deployed with, or nil if
+// component instance has no code
+func (a *CreateAction) processDeployment(instance *resolve.ComponentInstance, component *lang.ServiceComponent, context *action.Context) (plugin.CodePlugin, error) {
 	if component == nil {
 		// This is a service instance. Do nothing
-		return nil
+		return nil, nil
+	}
+
+	err := checkBlockingDependency(instance, component.Dependencies, context)
+	if err != nil {
+		return nil, err
 	}
 
 	if component.Code == nil {
-		return nil
+		return nil, nil
 	}
 
 	context.EventLog.WithFields(event.Fields{
 		"componentKey": instance.Metadata.Key,
 		"component":    component.Name,
-		"code":         instance.CalculatedCodeParams,
+		"code":         instance.GetRedactedCodeParams(),
 	}).Info("Deploying new component instance: " + instance.GetKey())
 
-	clusterName := instance.GetCluster()
-	if len(clusterName) <= 0 {
-		return fmt.Errorf("policy doesn't specify deployment target for component instance")
+	cluster, err := getCluster(instance, context)
+	if err != nil {
+		return nil, err
 	}
 
-	clusterObj, err := context.DesiredPolicy.GetObject(lang.ClusterObject.Kind, clusterName, runtime.SystemNS)
+	codePlugin, err := context.Plugins.ForCodeType(cluster, component.Code.Type)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if clusterObj == nil {
-		return fmt.Errorf("cluster '%s' in not present in policy", clusterName)
+
+	// run pre-create hooks
+	err = runHooks(instance, component, lang.HookPreCreate, context)
+	if err != nil {
+		return nil, err
 	}
-	cluster := clusterObj.(*lang.Cluster)
 
-	plugin, err := context.Plugins.ForCodeType(cluster, component.Code.Type)
+	if component.Code.Job {
+		err = processJob(instance, codePlugin, context)
+	} else {
+		err = codePlugin.Create(instance.GetDeployName(), instance.CalculatedCodeParams, context.EventLog)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return plugin.Create(instance.GetDeployName(), instance.CalculatedCodeParams, context.EventLog)
+	return codePlugin, nil
 }
@@ -3,6 +3,7 @@ package component
 import (
 	"fmt"
 	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/runtime"
@@ -30,26 +31,48 @@ func NewDeleteAction(componentKey string) *DeleteAction {
 	}
 }
 
+// GetGroup returns a key of component instance, so all consecutive actions for the same instance are grouped
+func (a *DeleteAction) GetGroup() string {
+	return a.ComponentKey
+}
+
 // Apply applies the action
 func (a *DeleteAction) Apply(context *action.Context) error {
+	instance := context.ActualState.ComponentInstanceMap[a.ComponentKey]
+	component, err := getComponent(instance, context)
+	if err != nil {
+		return fmt.Errorf("unable to delete component instance '%s': %s", a.ComponentKey, err)
+	}
+
 	// delete from cloud
-	err := a.processDeployment(context)
+	err = a.processDeployment(instance, component, context)
 	if err != nil {
 		return fmt.Errorf("unable to delete component instance '%s': %s", a.ComponentKey, err)
 	}
 
-	// update actual state
-	return deleteComponentFromActualState(a.ComponentKey, context)
-}
+	// delete secrets generated for component instance, so they get generated again if it gets re-created
+	if context.ExternalData.GeneratedSecretStore != nil {
+		err = context.ExternalData.GeneratedSecretStore.DeleteByInstance(a.ComponentKey)
+		if err != nil {
+			return fmt.Errorf("unable to delete generated secrets for component instance '%s': %s", a.ComponentKey, err)
+		}
+	}
 
-func (a *DeleteAction) processDeployment(context *action.Context) error {
-	instance := context.ActualState.ComponentInstanceMap[a.ComponentKey]
-	serviceObj, err := context.DesiredPolicy.GetObject(lang.ServiceObject.Kind, instance.Metadata.Key.ServiceName, instance.Metadata.Key.Namespace)
+	// update actual state
+	err = deleteComponentFromActualState(a.ComponentKey, context)
 	if err != nil {
 		return err
 	}
-	component := serviceObj.(*lang.Service).GetComponentsMap()[instance.Metadata.Key.ComponentName]
 
+	// run post-destroy hooks
+	err = runHooks(instance, component, lang.HookPostDestroy, context)
+	if err != nil {
+		return fmt.Errorf("component instance '%s' has been deleted, but %s", a.ComponentKey, err)
+	}
+	return nil
+}
+
+func (a *DeleteAction) processDeployment(instance *resolve.ComponentInstance, component *lang.ServiceComponent, context *action.Context) error {
 	if component == nil {
 		// This is a service instance. Do nothing
 		return nil
@@ -62,27 +85,33 @@ func (a *DeleteAction) processDeployment(context *action.Context) error {
 	context.EventLog.WithFields(event.Fields{
 		"componentKey": instance.Metadata.Key,
 		"component":    component.Name,
-		"code":         instance.CalculatedCodeParams,
+		"code":         instance.GetRedactedCodeParams(),
 	}).Info("Destructing a running component instance: " + instance.GetKey())
 
-	clusterName := instance.GetCluster()
-	if len(clusterName) <= 0 {
-		return fmt.Errorf("policy doesn't specify deployment target for component instance")
+	cluster, err := getCluster(instance, context)
+	if err != nil {
+		return err
 	}
 
-	clusterObj, err := context.DesiredPolicy.GetObject(lang.ClusterObject.Kind, clusterName, runtime.SystemNS)
+	plugin, err := context.Plugins.ForCodeType(cluster, component.Code.Type)
 	if err != nil {
 		return err
 	}
-	if clusterObj == nil {
-		return fmt.Errorf("cluster '%s' in not present in policy", clusterName)
-	}
-	cluster := clusterObj.(*lang.Cluster)
 
-	plugin, err := context.Plugins.ForCodeType(cluster, component.Code.Type)
+	// run pre-destroy hooks
+	err = runHooks(instance, component, lang.HookPreDestroy, context)
 	if err != nil {
 		return err
 	}
 
+	// destroy deployments, which might have been left behind by an interrupted blue/green switchover, or which have
+	// not been destroyed after it yet
+	if instance.NextDeployVersion > 0 {
+		destroyDeployment(instance, instance.GetDeployNameForVersion(instance.NextDeployVersion), plugin, context)
+	}
+	if len(instance.PreviousDeployName) > 0 {
+		destroyDeployment(instance, instance.PreviousDeployName, plugin, context)
+	}
+
 	return plugin.Destroy(instance.GetDeployName(), instance.CalculatedCodeParams, context.EventLog)
 }
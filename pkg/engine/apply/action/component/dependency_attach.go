@@ -29,6 +29,11 @@ func NewAttachDependencyAction(componentKey string, dependencyID string) *Attach
 	}
 }
 
+// GetGroup returns a key of component instance, so all consecutive actions for the same instance are grouped
+func (a *AttachDependencyAction) GetGroup() string {
+	return a.ComponentKey
+}
+
 // Apply applies the action
 func (a *AttachDependencyAction) Apply(context *action.Context) error {
 	return updateActualStateFromDesired(a.ComponentKey, context, false, false, false)
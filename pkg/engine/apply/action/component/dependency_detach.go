@@ -28,6 +28,11 @@ func NewDetachDependencyAction(componentKey string, dependencyID string) *Detach
 	}
 }
 
+// GetGroup returns a key of component instance, so all consecutive actions for the same instance are grouped
+func (a *DetachDependencyAction) GetGroup() string {
+	return a.ComponentKey
+}
+
 // Apply applies the action
 func (a *DetachDependencyAction) Apply(context *action.Context) error {
 	return updateActualStateFromDesired(a.ComponentKey, context, false, false, false)
@@ -0,0 +1,83 @@
+package component
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+)
+
+// DestroyPreviousActionObject is an informational data structure with Kind and Constructor for the action
+var DestroyPreviousActionObject = &runtime.Info{
+	Kind:        "action-component-destroy-previous",
+	Constructor: func() runtime.Object { return &DestroyPreviousAction{} },
+}
+
+// DestroyPreviousAction is a action which gets called to destroy the previous deployment of component instance, which
+// has been left running after blue/green switchover, so components which depend on it could be switched over as well
+type DestroyPreviousAction struct {
+	runtime.TypeKind `yaml:",inline"`
+	*action.Metadata
+	ComponentKey string
+}
+
+// NewDestroyPreviousAction creates new DestroyPreviousAction
+func NewDestroyPreviousAction(componentKey string) *DestroyPreviousAction {
+	return &DestroyPreviousAction{
+		TypeKind:     DestroyPreviousActionObject.GetTypeKind(),
+		Metadata:     action.NewMetadata(DestroyPreviousActionObject.Kind, componentKey),
+		ComponentKey: componentKey,
+	}
+}
+
+// GetGroup returns a key of component instance, so all consecutive actions for the same instance are grouped
+func (a *DestroyPreviousAction) GetGroup() string {
+	return a.ComponentKey
+}
+
+// Apply applies the action
+func (a *DestroyPreviousAction) Apply(context *action.Context) error {
+	instance := context.ActualState.ComponentInstanceMap[a.ComponentKey]
+	if instance == nil || len(instance.PreviousDeployName) <= 0 {
+		return nil
+	}
+
+	// previous deployment may still be used by components, which failed to get updated to discover the new one
+	if key := getOutdatedDependent(a.ComponentKey, context); len(key) > 0 {
+		context.EventLog.WithFields(event.Fields{
+			"componentKey": instance.Metadata.Key,
+			"deployName":   instance.PreviousDeployName,
+		}).Infof("Keeping previous deployment of component instance %s, as component instance %s hasn't been updated yet", a.ComponentKey, key)
+		return nil
+	}
+
+	component, err := getComponent(instance, context)
+	if err != nil {
+		return fmt.Errorf("unable to destroy previous deployment of component instance '%s': %s", a.ComponentKey, err)
+	}
+	if component == nil || component.Code == nil {
+		return nil
+	}
+
+	cluster, err := getCluster(instance, context)
+	if err != nil {
+		return fmt.Errorf("unable to destroy previous deployment of component instance '%s': %s", a.ComponentKey, err)
+	}
+
+	codePlugin, err := context.Plugins.ForCodeType(cluster, component.Code.Type)
+	if err != nil {
+		return fmt.Errorf("unable to destroy previous deployment of component instance '%s': %s", a.ComponentKey, err)
+	}
+
+	// updates of dependent components get persisted before the deployment they have been switched from is destroyed
+	err = flushActualState(context)
+	if err != nil {
+		return fmt.Errorf("unable to destroy previous deployment of component instance '%s': %s", a.ComponentKey, err)
+	}
+
+	destroyDeployment(instance, instance.PreviousDeployName, codePlugin, context)
+	instance.PreviousDeployName = ""
+
+	// update actual state
+	return updateComponentInActualState(a.ComponentKey, context)
+}
@@ -30,6 +30,11 @@ func NewEndpointsAction(componentKey string) *EndpointsAction {
 	}
 }
 
+// GetGroup returns a key of component instance, so all consecutive actions for the same instance are grouped
+func (a *EndpointsAction) GetGroup() string {
+	return a.ComponentKey
+}
+
 // Apply applies the action
 func (a *EndpointsAction) Apply(context *action.Context) error {
 	// skip component for some reason doesn't exist in actual state
@@ -68,7 +73,7 @@ func (a *EndpointsAction) processEndpoints(context *action.Context) error {
 	context.EventLog.WithFields(event.Fields{
 		"componentKey": instance.Metadata.Key,
 		"component":    component.Name,
-		"code":         instance.CalculatedCodeParams,
+		"code":         instance.GetRedactedCodeParams(),
 	}).Info("Getting endpoints for component instance: " + instance.GetKey())
 
 	clusterName := instance.GetCluster()
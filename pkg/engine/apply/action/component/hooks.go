@@ -0,0 +1,140 @@
+package component
+
+import (
+	"context"
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// runHooks executes hooks of a component instance for a given phase in order, recording their results in the event
+// log. If a hook with "abort" failure policy fails, remaining hooks don't get executed and an error gets returned
+func runHooks(instance *resolve.ComponentInstance, component *lang.ServiceComponent, phase string, context *action.Context) error {
+	if component == nil {
+		return nil
+	}
+
+	for _, hook := range component.GetHooks(phase) {
+		output, err := runHook(instance, hook, phase, context)
+		fields := event.Fields{
+			"componentKey": instance.Metadata.Key,
+			"hook":         hook.Name,
+			"phase":        phase,
+			"output":       output,
+		}
+		if err == nil {
+			context.EventLog.WithFields(fields).Infof("Hook '%s' (%s) succeeded for component instance: %s", hook.Name, phase, instance.GetKey())
+			continue
+		}
+
+		fields["error"] = err.Error()
+		if hook.OnFailure == lang.HookFailureIgnore {
+			context.EventLog.WithFields(fields).Warningf("Hook '%s' (%s) failed for component instance, ignoring: %s", hook.Name, phase, instance.GetKey())
+			continue
+		}
+		context.EventLog.WithFields(fields).Warningf("Hook '%s' (%s) failed for component instance, aborting: %s", hook.Name, phase, instance.GetKey())
+		return fmt.Errorf("%s hook '%s' failed: %s", phase, hook.Name, err)
+	}
+
+	return nil
+}
+
+// runHook executes a single hook and returns its output
+func runHook(instance *resolve.ComponentInstance, hook *lang.Hook, phase string, context *action.Context) (string, error) {
+	if hook.Code != nil {
+		return runCodeHook(instance, hook, context)
+	}
+	return runExecHook(instance, hook, phase)
+}
+
+// runCodeHook runs hook code to completion via a code plugin, which must support one-shot jobs. Hooks are ephemeral,
+// so everything the code plugin has deployed for a hook gets destroyed once it completes
+func runCodeHook(instance *resolve.ComponentInstance, hook *lang.Hook, context *action.Context) (string, error) {
+	cluster, err := getCluster(instance, context)
+	if err != nil {
+		return "", err
+	}
+
+	codePlugin, err := context.Plugins.ForCodeType(cluster, hook.Code.Type)
+	if err != nil {
+		return "", err
+	}
+
+	jobPlugin, ok := codePlugin.(plugin.JobPlugin)
+	if !ok {
+		return "", fmt.Errorf("code plugin %T doesn't support one-shot jobs", codePlugin)
+	}
+
+	deployName := instance.GetDeployName() + "-" + strings.ToLower(util.EscapeName(hook.Name))
+	params := instance.CalculatedHookParams[hook.Name]
+	status, err := jobPlugin.RunJob(deployName, params, context.EventLog)
+	if err != nil {
+		return "", err
+	}
+
+	err = codePlugin.Destroy(deployName, params, context.EventLog)
+	if err != nil {
+		context.EventLog.LogWarning(fmt.Errorf("unable to clean up after hook '%s' for component instance '%s': %s", hook.Name, instance.GetKey(), err))
+	}
+
+	if !status.Succeeded {
+		return status.Log, fmt.Errorf("exited with code %d", status.ExitCode)
+	}
+	return status.Log, nil
+}
+
+// execHookTimeout is how long hook command is allowed to run, before it gets killed
+const execHookTimeout = 5 * time.Minute
+
+// runExecHook executes hook command locally. Command gets killed if it doesn't complete within execHookTimeout
+func runExecHook(instance *resolve.ComponentInstance, hook *lang.Hook, phase string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), execHookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, hook.Exec[0], hook.Exec[1:]...) // nolint: gas
+	cmd.Env = append(os.Environ(),
+		"APTOMI_COMPONENT_KEY="+instance.GetKey(),
+		"APTOMI_DEPLOY_NAME="+instance.GetDeployName(),
+		"APTOMI_HOOK_PHASE="+phase,
+	)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return string(output), fmt.Errorf("timed out after %s", execHookTimeout)
+	}
+	return string(output), err
+}
+
+// getComponent returns service component for a given component instance, or nil if it's a service instance
+func getComponent(instance *resolve.ComponentInstance, context *action.Context) (*lang.ServiceComponent, error) {
+	serviceObj, err := context.DesiredPolicy.GetObject(lang.ServiceObject.Kind, instance.Metadata.Key.ServiceName, instance.Metadata.Key.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	return serviceObj.(*lang.Service).GetComponentsMap()[instance.Metadata.Key.ComponentName], nil
+}
+
+// getCluster returns cluster, which a given component instance gets deployed to
+func getCluster(instance *resolve.ComponentInstance, context *action.Context) (*lang.Cluster, error) {
+	clusterName := instance.GetCluster()
+	if len(clusterName) <= 0 {
+		return nil, fmt.Errorf("policy doesn't specify deployment target for component instance")
+	}
+
+	clusterObj, err := context.DesiredPolicy.GetObject(lang.ClusterObject.Kind, clusterName, runtime.SystemNS)
+	if err != nil {
+		return nil, err
+	}
+	if clusterObj == nil {
+		return nil, fmt.Errorf("cluster '%s' in not present in policy", clusterName)
+	}
+	return clusterObj.(*lang.Cluster), nil
+}
@@ -0,0 +1,59 @@
+package component
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+)
+
+// processJob runs a one-shot job for component instance, waits for its completion and records job status in the
+// component instance. If the job can't be run or has failed, component instance gets blocked, so that components
+// which depend on it don't get deployed
+func processJob(instance *resolve.ComponentInstance, codePlugin plugin.CodePlugin, context *action.Context) error {
+	err := runJob(instance, codePlugin, context)
+	if err != nil {
+		context.Block(instance.Metadata.Key)
+	}
+	return err
+}
+
+func runJob(instance *resolve.ComponentInstance, codePlugin plugin.CodePlugin, context *action.Context) error {
+	jobPlugin, ok := codePlugin.(plugin.JobPlugin)
+	if !ok {
+		return fmt.Errorf("code plugin %T doesn't support one-shot jobs", codePlugin)
+	}
+
+	status, err := jobPlugin.RunJob(instance.GetDeployName(), instance.CalculatedCodeParams, context.EventLog)
+	if err != nil {
+		return err
+	}
+	instance.Job = status
+
+	fields := event.Fields{
+		"componentKey": instance.Metadata.Key,
+		"exitCode":     status.ExitCode,
+		"log":          status.Log,
+	}
+	if !status.Succeeded {
+		context.EventLog.WithFields(fields).Warning("Job failed for component instance: " + instance.GetKey())
+		return fmt.Errorf("job failed with exit code %d", status.ExitCode)
+	}
+	context.EventLog.WithFields(fields).Info("Job completed for component instance: " + instance.GetKey())
+
+	return nil
+}
+
+// checkBlockingDependency returns an error and blocks component instance, if it depends on a blocked component
+// (e.g. a one-shot job which has failed, or a component which hasn't become ready)
+func checkBlockingDependency(instance *resolve.ComponentInstance, dependencies []string, context *action.Context) error {
+	waitForDependencies(instance, dependencies, context)
+
+	blocking := context.GetBlockingDependency(instance.Metadata.Key, dependencies)
+	if len(blocking) > 0 {
+		context.Block(instance.Metadata.Key)
+		return fmt.Errorf("component '%s' it depends on has failed to complete or is not ready", blocking)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package component
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/util"
+)
+
+// OutputsActionObject is an informational data structure with Kind and Constructor for the action
+var OutputsActionObject = &runtime.Info{
+	Kind:        "action-component-outputs",
+	Constructor: func() runtime.Object { return &OutputsAction{} },
+}
+
+// OutputsAction is a action which gets called to retrieve outputs of a deployed component instance again, when some
+// of them were not available when it got created or updated (e.g. load balancer address provisioned asynchronously)
+type OutputsAction struct {
+	runtime.TypeKind `yaml:",inline"`
+	*action.Metadata
+	ComponentKey string
+}
+
+// NewOutputsAction creates new OutputsAction
+func NewOutputsAction(componentKey string) *OutputsAction {
+	return &OutputsAction{
+		TypeKind:     OutputsActionObject.GetTypeKind(),
+		Metadata:     action.NewMetadata(OutputsActionObject.Kind, componentKey),
+		ComponentKey: componentKey,
+	}
+}
+
+// GetGroup returns a key of component instance, so all consecutive actions for the same instance are grouped
+func (a *OutputsAction) GetGroup() string {
+	return a.ComponentKey
+}
+
+// Apply applies the action
+func (a *OutputsAction) Apply(context *action.Context) error {
+	// skip component, if it doesn't exist in actual state anymore
+	instance := context.ActualState.ComponentInstanceMap[a.ComponentKey]
+	if instance == nil {
+		return nil
+	}
+
+	component, err := getComponent(instance, context)
+	if err != nil {
+		return fmt.Errorf("unable to get outputs for component instance '%s': %s", a.ComponentKey, err)
+	}
+	if component == nil || component.Code == nil {
+		return nil
+	}
+
+	cluster, err := getCluster(instance, context)
+	if err != nil {
+		return fmt.Errorf("unable to get outputs for component instance '%s': %s", a.ComponentKey, err)
+	}
+
+	codePlugin, err := context.Plugins.ForCodeType(cluster, component.Code.Type)
+	if err != nil {
+		return fmt.Errorf("unable to get outputs for component instance '%s': %s", a.ComponentKey, err)
+	}
+
+	errOutputs := processOutputs(instance, codePlugin, context)
+
+	// update actual state
+	err = updateComponentInActualState(a.ComponentKey, context)
+	if err != nil {
+		return err
+	}
+	if errOutputs != nil {
+		return fmt.Errorf("component instance '%s' is deployed, but %s", a.ComponentKey, errOutputs)
+	}
+	return nil
+}
+
+// processOutputs retrieves outputs from the code plugin after component instance got created or updated, and
+// stores them in the component instance. If outputs changed, it flags the context, so that consumers get re-resolved.
+// If outputs can't be retrieved, they are marked as pending and get retrieved again on the next run. Nothing is done
+// if code plugin is nil
+func processOutputs(instance *resolve.ComponentInstance, codePlugin plugin.CodePlugin, context *action.Context) error {
+	if codePlugin == nil {
+		return nil
+	}
+
+	outputs, err := codePlugin.Outputs(instance.GetDeployName(), instance.CalculatedCodeParams, context.EventLog)
+	if err != nil {
+		instance.OutputsPending = true
+		return fmt.Errorf("unable to retrieve outputs: %s", err)
+	}
+
+	if instance.UpdateOutputs(outputs) {
+		context.EventLog.WithFields(event.Fields{
+			"componentKey": instance.Metadata.Key,
+			"outputs":      util.GetSortedStringKeys(instance.Outputs),
+		}).Info("Outputs changed for component instance: " + instance.GetKey())
+		context.OutputsChanged = true
+	}
+	if instance.OutputsPending {
+		context.EventLog.WithFields(event.Fields{
+			"componentKey": instance.Metadata.Key,
+		}).Info("Some outputs are not available yet for component instance, they will be retrieved again later: " + instance.GetKey())
+	}
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package component
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultReadinessTimeout is how long to wait for component instance to become ready, if component doesn't specify it
+	defaultReadinessTimeout = 5 * time.Minute
+
+	// defaultReadinessInterval is how often readiness gets checked, if component doesn't specify it
+	defaultReadinessInterval = 2 * time.Second
+)
+
+// waitForReadiness polls readiness of component instance until it becomes ready or timeout passes, and records
+// readiness status in the component instance. If component instance doesn't become ready in time, it gets blocked,
+// so that components which depend on it don't get created or updated
+func waitForReadiness(instance *resolve.ComponentInstance, component *lang.ServiceComponent, context *action.Context) error {
+	if component == nil || component.Readiness == nil {
+		return nil
+	}
+
+	timeout := component.Readiness.Timeout
+	if timeout <= 0 {
+		timeout = defaultReadinessTimeout
+	}
+	interval := component.Readiness.Interval
+	if interval <= 0 {
+		interval = defaultReadinessInterval
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		ready, message := checkReadiness(instance, component, interval, context)
+		instance.Readiness = &resolve.ReadinessStatus{
+			Ready:     ready,
+			Message:   message,
+			CheckedAt: time.Now(),
+		}
+
+		if ready {
+			context.EventLog.WithFields(event.Fields{
+				"componentKey": instance.Metadata.Key,
+			}).Info("Component instance is ready: " + instance.GetKey())
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			context.Block(instance.Metadata.Key)
+			return fmt.Errorf("component instance is not ready after %s: %s", timeout, message)
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// waitForDependencies waits for components within the same service instance, which component instance depends on,
+// if they have been deployed before, but weren't ready during their last readiness check
+func waitForDependencies(instance *resolve.ComponentInstance, dependencies []string, context *action.Context) {
+	for _, dependency := range dependencies {
+		if len(context.GetBlockingDependency(instance.Metadata.Key, []string{dependency})) > 0 {
+			continue
+		}
+
+		for _, dependencyInstance := range getActualInstances(instance.Metadata.Key.GetSiblingKey(dependency), context) {
+			if dependencyInstance.Readiness == nil || dependencyInstance.Readiness.Ready {
+				continue
+			}
+
+			component, err := getComponent(dependencyInstance, context)
+			if err != nil {
+				context.EventLog.LogWarning(err)
+				continue
+			}
+
+			err = waitForReadiness(dependencyInstance, component, context)
+			if err != nil {
+				context.EventLog.LogWarning(fmt.Errorf("component instance '%s' %s", dependencyInstance.GetKey(), err))
+			}
+			err = updateComponentInActualState(dependencyInstance.GetKey(), context)
+			if err != nil {
+				context.EventLog.LogWarning(err)
+			}
+		}
+	}
+}
+
+// getActualInstances returns component instance with a given key from actual state, or all of its shards if it's
+// a replicated component
+func getActualInstances(key *resolve.ComponentInstanceKey, context *action.Context) []*resolve.ComponentInstance {
+	if instance, ok := context.ActualState.ComponentInstanceMap[key.GetKey()]; ok {
+		return []*resolve.ComponentInstance{instance}
+	}
+	result := []*resolve.ComponentInstance{}
+	for i := 0; ; i++ {
+		instance, ok := context.ActualState.ComponentInstanceMap[key.WithShard(i).GetKey()]
+		if !ok {
+			return result
+		}
+		result = append(result, instance)
+	}
+}
+
+// checkReadiness checks readiness of component instance once and returns whether it's ready, as well as a message
+// describing why it's not
+func checkReadiness(instance *resolve.ComponentInstance, component *lang.ServiceComponent, timeout time.Duration, context *action.Context) (bool, string) {
+	readiness := component.Readiness
+	switch {
+	case len(readiness.HTTP) > 0:
+		client := &http.Client{Timeout: timeout}
+		resp, err := client.Get(instance.CalculatedReadinessProbe)
+		if err != nil {
+			return false, err.Error()
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+			return false, fmt.Sprintf("%s responded with %s", instance.CalculatedReadinessProbe, resp.Status)
+		}
+		return true, ""
+	case len(readiness.TCP) > 0:
+		conn, err := net.DialTimeout("tcp", instance.CalculatedReadinessProbe, timeout)
+		if err != nil {
+			return false, err.Error()
+		}
+		_ = conn.Close()
+		return true, ""
+	}
+
+	cluster, err := getCluster(instance, context)
+	if err != nil {
+		return false, err.Error()
+	}
+	codePlugin, err := context.Plugins.ForCodeType(cluster, component.Code.Type)
+	if err != nil {
+		return false, err.Error()
+	}
+	readinessPlugin, ok := codePlugin.(plugin.ReadinessPlugin)
+	if !ok {
+		return false, fmt.Sprintf("code plugin %T doesn't support readiness checks", codePlugin)
+	}
+	ready, message, err := readinessPlugin.Ready(instance.GetDeployName(), instance.CalculatedCodeParams, context.EventLog)
+	if err != nil {
+		return false, err.Error()
+	}
+	return ready, message
+}
@@ -3,8 +3,10 @@ package component
 import (
 	"fmt"
 	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/plugin"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 )
 
@@ -30,59 +32,103 @@ func NewUpdateAction(componentKey string) *UpdateAction {
 	}
 }
 
+// GetGroup returns a key of component instance, so all consecutive actions for the same instance are grouped
+func (a *UpdateAction) GetGroup() string {
+	return a.ComponentKey
+}
+
 // Apply applies the action
 func (a *UpdateAction) Apply(context *action.Context) error {
+	instance := context.DesiredState.ComponentInstanceMap[a.ComponentKey]
+	component, err := getComponent(instance, context)
+	if err != nil {
+		return fmt.Errorf("unable to update component instance '%s': %s", a.ComponentKey, err)
+	}
+
 	// update in the cloud
-	err := a.processDeployment(context)
+	codePlugin, err := a.processDeployment(instance, component, context)
 	if err != nil {
 		return fmt.Errorf("unable to update component instance '%s': %s", a.ComponentKey, err)
 	}
 
-	// update actual state
-	return updateActualStateFromDesired(a.ComponentKey, context, false, true, false)
-}
+	// retrieve outputs and wait for component instance to become ready, before components which depend on it get
+	// processed. With blue/green strategy the new deployment has been processed already, before switching to it
+	errOutputs := processOutputs(instance, codePlugin, context)
+	var errReady error
+	if !isBlueGreen(component) {
+		errReady = waitForReadiness(instance, component, context)
+	}
 
-func (a *UpdateAction) processDeployment(context *action.Context) error {
-	instance := context.DesiredState.ComponentInstanceMap[a.ComponentKey]
-	serviceObj, err := context.DesiredPolicy.GetObject(lang.ServiceObject.Kind, instance.Metadata.Key.ServiceName, instance.Metadata.Key.Namespace)
+	// update actual state
+	err = updateActualStateFromDesired(a.ComponentKey, context, false, true, false)
 	if err != nil {
 		return err
 	}
-	component := serviceObj.(*lang.Service).GetComponentsMap()[instance.Metadata.Key.ComponentName]
 
+	if errOutputs != nil {
+		return fmt.Errorf("component instance '%s' has been updated, but %s", a.ComponentKey, errOutputs)
+	}
+	if errReady != nil {
+		return fmt.Errorf("component instance '%s' has been updated, but %s", a.ComponentKey, errReady)
+	}
+
+	// run post-update hooks
+	err = runHooks(instance, component, lang.HookPostUpdate, context)
+	if err != nil {
+		return fmt.Errorf("component instance '%s' has been updated, but %s", a.ComponentKey, err)
+	}
+	return nil
+}
+
+// processDeployment updates code of component instance and returns code plugin it has been updated with, or nil if
+// component instance has no code or outputs have been retrieved already (blue/green update)
+func (a *UpdateAction) processDeployment(instance *resolve.ComponentInstance, component *lang.ServiceComponent, context *action.Context) (plugin.CodePlugin, error) {
 	if component == nil {
 		// This is a service instance. Do nothing
-		return nil
+		return nil, nil
+	}
+
+	err := checkBlockingDependency(instance, component.Dependencies, context)
+	if err != nil {
+		return nil, err
 	}
 
 	if component.Code == nil {
-		return nil
+		return nil, nil
 	}
 
 	context.EventLog.WithFields(event.Fields{
 		"componentKey": instance.Metadata.Key,
 		"component":    component.Name,
-		"code":         instance.CalculatedCodeParams,
+		"code":         instance.GetRedactedCodeParams(),
 	}).Info("Updating a running component instance: " + instance.GetKey())
 
-	clusterName := instance.GetCluster()
-	if len(clusterName) <= 0 {
-		return fmt.Errorf("policy doesn't specify deployment target for component instance")
+	cluster, err := getCluster(instance, context)
+	if err != nil {
+		return nil, err
 	}
 
-	clusterObj, err := context.DesiredPolicy.GetObject(lang.ClusterObject.Kind, clusterName, runtime.SystemNS)
+	codePlugin, err := context.Plugins.ForCodeType(cluster, component.Code.Type)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if clusterObj == nil {
-		return fmt.Errorf("cluster '%s' in not present in policy", clusterName)
+
+	// run pre-update hooks
+	err = runHooks(instance, component, lang.HookPreUpdate, context)
+	if err != nil {
+		return nil, err
 	}
-	cluster := clusterObj.(*lang.Cluster)
 
-	plugin, err := context.Plugins.ForCodeType(cluster, component.Code.Type)
+	if component.Code.Job {
+		err = processJob(instance, codePlugin, context)
+	} else if isBlueGreen(component) {
+		return nil, updateBlueGreen(instance, component, codePlugin, context)
+	} else {
+		err = codePlugin.Update(instance.GetDeployName(), instance.CalculatedCodeParams, context.EventLog)
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return plugin.Update(instance.GetDeployName(), instance.CalculatedCodeParams, context.EventLog)
+	return codePlugin, nil
 }
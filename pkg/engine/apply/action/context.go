@@ -7,6 +7,7 @@ import (
 	"github.com/Aptomi/aptomi/pkg/external"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/plugin"
+	"github.com/Aptomi/aptomi/pkg/util"
 )
 
 // Context is a data struct that will be passed into all state update actions, giving actions access to desired
@@ -19,6 +20,16 @@ type Context struct {
 	ExternalData       *external.Data
 	Plugins            plugin.Registry
 	EventLog           *event.Log
+
+	// OutputsChanged gets set by actions when outputs of at least one component instance have changed (or when it has
+	// been switched to a new deployment), meaning that policy has to be resolved again in order to propagate new
+	// outputs and discovery information to dependent component instances
+	OutputsChanged bool
+
+	// blocked components (parent service key -> component name -> true), which either are one-shot jobs which
+	// failed, or depend on such jobs, or consume service instances with such jobs. Components which depend on them
+	// don't get deployed
+	blocked map[string]map[string]bool
 }
 
 // NewContext creates a new instance of Context
@@ -34,5 +45,46 @@ func NewContext(desiredPolicy *lang.Policy, desiredState *resolve.PolicyResoluti
 		ExternalData:       externalData,
 		Plugins:            plugins,
 		EventLog:           eventLog,
+		blocked:            make(map[string]map[string]bool),
+	}
+}
+
+// Block marks component instance as blocked, so that components which depend on it within the same service instance
+// don't get deployed (e.g. when a one-shot job has failed). Components of other service instances, which consume the
+// service instance via edges out into it, get blocked as well, so components which depend on them don't get deployed
+func (context *Context) Block(key *resolve.ComponentInstanceKey) {
+	serviceKey := key.GetParentServiceKey().GetKey()
+	if context.blocked[serviceKey][key.ComponentName] {
+		return
+	}
+	if context.blocked[serviceKey] == nil {
+		context.blocked[serviceKey] = make(map[string]bool)
+	}
+	context.blocked[serviceKey][key.ComponentName] = true
+
+	if context.DesiredState == nil {
+		return
+	}
+	service, ok := context.DesiredState.ComponentInstanceMap[serviceKey]
+	if !ok {
+		return
+	}
+	for _, consumerKey := range util.GetSortedStringKeys(service.EdgesIn) {
+		consumer, found := context.DesiredState.ComponentInstanceMap[consumerKey]
+		if found && consumer.Metadata.Key.IsComponent() && consumer.EdgesOut[serviceKey] {
+			context.Block(consumer.Metadata.Key)
+		}
+	}
+}
+
+// GetBlockingDependency returns the name of a blocked component within the same service instance, which a given
+// component instance depends on. If there is no such component, empty string is returned
+func (context *Context) GetBlockingDependency(key *resolve.ComponentInstanceKey, dependencies []string) string {
+	blocked := context.blocked[key.GetParentServiceKey().GetKey()]
+	for _, dependency := range dependencies {
+		if blocked[dependency] {
+			return dependency
+		}
 	}
+	return ""
 }
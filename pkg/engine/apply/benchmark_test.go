@@ -8,6 +8,7 @@ import (
 	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/external"
+	"github.com/Aptomi/aptomi/pkg/external/secrets"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/util"
 	"github.com/stretchr/testify/assert"
@@ -121,6 +122,7 @@ func (gen *PolicyGenerator) makePolicyAndExternalData() (*lang.Policy, *external
 	gen.externalData = external.NewData(
 		NewUserLoaderImpl(gen.users, gen.generatedUserLabels),
 		NewSecretLoaderImpl(),
+		secrets.NewGeneratedSecretStoreMock(),
 	)
 
 	fmt.Printf("Generated policy. Services = %d (max chain %d), Contexts = %d, Dependencies = %d, Users = %d\n",
@@ -425,7 +427,7 @@ func RunEngine(t *testing.T, testName string, desiredPolicy *lang.Policy, extern
 func resolvePolicyBenchmark(t *testing.T, policy *lang.Policy, externalData *external.Data, expectedNonEmpty bool) *resolve.PolicyResolution {
 	t.Helper()
 	eventLog := event.NewLog("test-resolve", false)
-	resolver := resolve.NewPolicyResolver(policy, externalData, eventLog)
+	resolver := resolve.NewPolicyResolver(policy, externalData, nil, eventLog)
 	result, err := resolver.ResolveAllDependencies()
 	if !assert.NoError(t, err, "Policy should be resolved without errors") {
 		hook := &event.HookConsole{}
@@ -31,6 +31,9 @@ type EngineApply struct {
 
 	// Progress indicator
 	progress progress.Indicator
+
+	// Whether outputs of component instances have changed while applying actions
+	outputsChanged bool
 }
 
 // NewEngineApply creates an instance of EngineApply
@@ -72,7 +75,17 @@ func (apply *EngineApply) Apply() (*resolve.PolicyResolution, error) {
 		apply.plugins,
 		apply.eventLog,
 	)
+	group := ""
 	for _, act := range apply.actions {
+		// changes of actual state get persisted once all consecutive actions of the same group are done
+		nextGroup := getGroup(act)
+		if len(nextGroup) <= 0 || nextGroup != group {
+			if !apply.flushActualState() {
+				foundErrors = true
+			}
+		}
+		group = nextGroup
+
 		apply.progress.Advance()
 		err := apply.executeAction(act, context)
 		if err != nil {
@@ -82,13 +95,27 @@ func (apply *EngineApply) Apply() (*resolve.PolicyResolution, error) {
 		}
 	}
 
+	// persist changes made by the last group of actions
+	if !apply.flushActualState() {
+		foundErrors = true
+	}
+
+	// Remember whether consumers of component outputs have to be updated
+	apply.outputsChanged = context.OutputsChanged
+
+	// Log error if there's been at least one error before finalizing progress indicator, so it gets into event log
+	// saved along with the final progress
+	var err error
+	if foundErrors {
+		err = fmt.Errorf("one or more errors occurred while running actions")
+		apply.eventLog.LogError(err)
+	}
+
 	// Finalize progress indicator
 	apply.progress.Done(!foundErrors)
 
 	// Return error if there's been at least one error
-	if foundErrors {
-		err := fmt.Errorf("one or more errors occurred while running actions")
-		apply.eventLog.LogError(err)
+	if err != nil {
 		return apply.actualState, err
 	}
 
@@ -96,6 +123,12 @@ func (apply *EngineApply) Apply() (*resolve.PolicyResolution, error) {
 	return apply.actualState, nil
 }
 
+// OutputsChanged returns true if outputs of at least one component instance have changed during Apply(). In this case,
+// policy has to be resolved again, so that component instances which depend on those outputs get updated
+func (apply *EngineApply) OutputsChanged() bool {
+	return apply.outputsChanged
+}
+
 func (apply *EngineApply) executeAction(action action.Base, context *action.Context) (errResult error) {
 	// make sure we are converting panics into errors
 	defer func() {
@@ -106,3 +139,22 @@ func (apply *EngineApply) executeAction(action action.Base, context *action.Cont
 
 	return action.Apply(context)
 }
+
+// flushActualState persists changes of actual state buffered by the actual state updater. It returns false if they
+// couldn't be persisted, in which case they stay buffered until the next flush
+func (apply *EngineApply) flushActualState() bool {
+	err := apply.actualStateUpdater.Flush()
+	if err != nil {
+		apply.eventLog.LogError(fmt.Errorf("error while saving actual state: %s", err))
+		return false
+	}
+	return true
+}
+
+// getGroup returns a group of a given action, or an empty string if action doesn't belong to any group
+func getGroup(act action.Base) string {
+	if grouped, ok := act.(action.Grouped); ok {
+		return grouped.GetGroup()
+	}
+	return ""
+}
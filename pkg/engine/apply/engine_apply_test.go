@@ -1,8 +1,11 @@
 package apply
 
 import (
+	"fmt"
 	"github.com/Aptomi/aptomi/pkg/config"
 	"github.com/Aptomi/aptomi/pkg/engine/actual"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action/component"
 	"github.com/Aptomi/aptomi/pkg/engine/diff"
 	"github.com/Aptomi/aptomi/pkg/engine/progress"
 	"github.com/Aptomi/aptomi/pkg/engine/resolve"
@@ -15,6 +18,9 @@ import (
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/util"
 	"github.com/stretchr/testify/assert"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -93,6 +99,374 @@ func checkApplyComponentCreateFail(t *testing.T, failAsPanic bool) {
 	assert.Equal(t, 1, len(actualState.ComponentInstanceMap), "Actual state should be correctly updated by apply()")
 }
 
+func TestApplyFlushesActualStateByGroups(t *testing.T) {
+	for _, failFlush := range []bool{false, true} {
+		empty := newTestData(t, builder.NewPolicyBuilder())
+		actualState := empty.resolution()
+		desired := newTestData(t, makePolicyBuilder())
+
+		updater := &recordingStateUpdater{failFlush: failFlush}
+		applier := NewEngineApply(
+			desired.policy(),
+			desired.resolution(),
+			actualState,
+			updater,
+			desired.external(),
+			mockRegistry(true, false),
+			diff.NewPolicyResolutionDiff(desired.resolution(), actualState).Actions,
+			event.NewLog("test-apply", false),
+			progress.NewNoop(),
+		)
+
+		if failFlush {
+			// changes which haven't been written are kept buffered and retried on the next flush
+			_, err := applier.Apply()
+			assert.Error(t, err, "Apply should fail if actual state can't be saved")
+			assert.Len(t, updater.pending, len(desired.resolution().ComponentInstanceMap), "Changes of all component instances should stay buffered")
+			continue
+		}
+		actualState = applyAndCheck(t, applier, ResSuccess, 0, "Successfully resolved")
+
+		// every component instance is changed by several actions, but gets written once per group of its actions
+		assert.Empty(t, updater.pending, "All actual state changes should be flushed")
+		assert.True(t, updater.changes > len(updater.flushed), "Actual state changes should be batched")
+		for _, flushed := range updater.flushed {
+			assert.Len(t, flushed, 1, "Every flush should write changes of a single component instance")
+		}
+		for key := range actualState.ComponentInstanceMap {
+			assert.Contains(t, updater.flushedKeys(), resolve.KeyForComponentKey(key), "Component instance should be flushed: %s", key)
+		}
+	}
+}
+
+func TestApplyComponentJob(t *testing.T) {
+	// job succeeds, status gets recorded in actual state
+	{
+		actualState := newTestData(t, builder.NewPolicyBuilder()).resolution()
+		desired := newTestData(t, makePolicyBuilderWithJob())
+		applier := NewEngineApply(
+			desired.policy(),
+			desired.resolution(),
+			actualState,
+			actual.NewNoOpActionStateUpdater(),
+			desired.external(),
+			mockRegistry(true, false),
+			diff.NewPolicyResolutionDiff(desired.resolution(), actualState).Actions,
+			event.NewLog("test-apply", false),
+			progress.NewNoop(),
+		)
+		actualState = applyAndCheck(t, applier, ResSuccess, 0, "Successfully resolved")
+		assert.Equal(t, 3, len(actualState.ComponentInstanceMap), "Job and its dependent component should be deployed")
+
+		job := getJobInstance(t, actualState)
+		if assert.NotNil(t, job.Job, "Job status should be recorded in actual state") {
+			assert.True(t, job.Job.Succeeded, "Job should succeed")
+		}
+	}
+
+	// job fails, dependent component doesn't get deployed
+	{
+		actualState := newTestData(t, builder.NewPolicyBuilder()).resolution()
+		desired := newTestData(t, makePolicyBuilderWithJob())
+		applier := NewEngineApply(
+			desired.policy(),
+			desired.resolution(),
+			actualState,
+			actual.NewNoOpActionStateUpdater(),
+			desired.external(),
+			mockRegistry(false, false),
+			diff.NewPolicyResolutionDiff(desired.resolution(), actualState).Actions,
+			event.NewLog("test-apply", false),
+			progress.NewNoop(),
+		)
+		actualState = applyAndCheck(t, applier, ResError, 1, "job failed with exit code 1")
+		assert.Equal(t, 1, len(actualState.ComponentInstanceMap), "Neither job, nor its dependent component should be deployed")
+
+		verifier := event.NewLogVerifier("it depends on has failed to complete", true)
+		applier.eventLog.Save(verifier)
+		assert.Equal(t, 1, verifier.MatchedErrorsCount(), "Dependent component should be blocked by failed job")
+	}
+}
+
+func TestApplyComponentJobBlocksConsumers(t *testing.T) {
+	b := makePolicyBuilderWithJob()
+
+	// create a service which consumes the service with a job and has a component which depends on it
+	contract := b.Policy().GetObjectsByKind(lang.ContractObject.Kind)[0].(*lang.Contract)
+	service := b.AddService()
+	consumed := b.AddServiceComponent(service, b.ContractComponent(contract))
+	component := b.AddServiceComponent(service, b.CodeComponent(util.NestedParameterMap{"param": "app"}, nil))
+	b.AddComponentDependency(component, consumed)
+	b.AddDependency(b.AddUser(), b.AddContract(service, b.CriteriaTrue()))
+
+	// job fails, components which depend on it in both services don't get deployed
+	actualState := newTestData(t, builder.NewPolicyBuilder()).resolution()
+	desired := newTestData(t, b)
+	applier := NewEngineApply(
+		desired.policy(),
+		desired.resolution(),
+		actualState,
+		actual.NewNoOpActionStateUpdater(),
+		desired.external(),
+		mockRegistry(false, false),
+		diff.NewPolicyResolutionDiff(desired.resolution(), actualState).Actions,
+		event.NewLog("test-apply", false),
+		progress.NewNoop(),
+	)
+	actualState = applyAndCheck(t, applier, ResError, 1, "job failed with exit code 1")
+	for _, instance := range actualState.ComponentInstanceMap {
+		assert.NotEqual(t, "app", instance.CalculatedCodeParams["param"], "Component of consumer service should not be deployed")
+	}
+
+	verifier := event.NewLogVerifier("it depends on has failed to complete", true)
+	applier.eventLog.Save(verifier)
+	assert.Equal(t, 2, verifier.MatchedErrorsCount(), "Dependent components of both services should be blocked by failed job")
+}
+
+func TestApplyComponentHooks(t *testing.T) {
+	// all hooks succeed
+	{
+		b := makePolicyBuilderWithHooks(&lang.Hooks{
+			PreCreate:  []*lang.Hook{{Name: "dns", Exec: []string{"true"}}},
+			PostCreate: []*lang.Hook{{Name: "webhook", Code: &lang.Code{Type: "helm", Params: util.NestedParameterMap{"url": "{{ .Labels.cluster }}"}}}},
+		})
+		applier, actualState := newApplierFromEmptyState(t, b)
+		actualState = applyAndCheck(t, applier, ResSuccess, 0, "")
+		assert.Equal(t, 2, len(actualState.ComponentInstanceMap), "Component should be deployed")
+
+		verifier := event.NewLogVerifier("succeeded for component instance", false)
+		applier.eventLog.Save(verifier)
+		assert.Equal(t, 2, verifier.MatchedErrorsCount(), "Results of both hooks should be recorded in event log")
+	}
+
+	// pre-create hook fails, component doesn't get deployed
+	{
+		b := makePolicyBuilderWithHooks(&lang.Hooks{
+			PreCreate: []*lang.Hook{{Name: "dns", Exec: []string{"false"}}},
+		})
+		applier, actualState := newApplierFromEmptyState(t, b)
+		actualState = applyAndCheck(t, applier, ResError, 1, "pre-create hook 'dns' failed")
+		assert.Equal(t, 1, len(actualState.ComponentInstanceMap), "Component should not be deployed")
+	}
+
+	// pre-create hook fails, but its failure gets ignored
+	{
+		b := makePolicyBuilderWithHooks(&lang.Hooks{
+			PreCreate: []*lang.Hook{{Name: "dns", Exec: []string{"false"}, OnFailure: lang.HookFailureIgnore}},
+		})
+		applier, actualState := newApplierFromEmptyState(t, b)
+		actualState = applyAndCheck(t, applier, ResSuccess, 0, "")
+		assert.Equal(t, 2, len(actualState.ComponentInstanceMap), "Component should be deployed")
+	}
+
+	// post-create hook fails, component stays deployed, but action fails
+	{
+		b := makePolicyBuilderWithHooks(&lang.Hooks{
+			PostCreate: []*lang.Hook{{Name: "webhook", Exec: []string{"false"}}},
+		})
+		applier, actualState := newApplierFromEmptyState(t, b)
+		actualState = applyAndCheck(t, applier, ResError, 1, "post-create hook 'webhook' failed")
+		assert.Equal(t, 2, len(actualState.ComponentInstanceMap), "Component should be deployed")
+	}
+}
+
+func TestApplyComponentReadiness(t *testing.T) {
+	// component becomes ready via HTTP probe, dependent component gets deployed
+	{
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		defer server.Close()
+
+		b := makePolicyBuilderWithReadiness(&lang.Readiness{HTTP: "{{ .Labels.probe }}", Timeout: time.Second}, server.URL)
+		applier, actualState := newApplierFromEmptyState(t, b)
+		actualState = applyAndCheck(t, applier, ResSuccess, 0, "")
+		assert.Equal(t, 3, len(actualState.ComponentInstanceMap), "Component and its dependent component should be deployed")
+
+		instance := getInstanceByParam(t, actualState, "db")
+		if assert.NotNil(t, instance.Readiness, "Readiness status should be recorded in actual state") {
+			assert.True(t, instance.Readiness.Ready, "Component should be ready")
+		}
+	}
+
+	// component doesn't become ready via TCP probe, dependent component doesn't get deployed until it does
+	{
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(t, err, "Should be able to listen on TCP port") {
+			return
+		}
+		address := listener.Addr().String()
+		_ = listener.Close()
+
+		b := makePolicyBuilderWithReadiness(&lang.Readiness{TCP: "{{ .Labels.probe }}", Timeout: 50 * time.Millisecond, Interval: 10 * time.Millisecond}, address)
+		applier, actualState := newApplierFromEmptyState(t, b)
+		actualState = applyAndCheck(t, applier, ResError, 1, "is not ready after")
+		assert.Equal(t, 2, len(actualState.ComponentInstanceMap), "Dependent component should not be deployed")
+
+		instance := getInstanceByParam(t, actualState, "db")
+		if assert.NotNil(t, instance.Readiness, "Readiness status should be recorded in actual state") {
+			assert.False(t, instance.Readiness.Ready, "Component should not be ready")
+		}
+
+		// once component becomes ready, dependent component gets deployed
+		listener, err = net.Listen("tcp", address)
+		if !assert.NoError(t, err, "Should be able to listen on TCP port") {
+			return
+		}
+		defer listener.Close() // nolint: errcheck
+
+		desired := newTestData(t, b)
+		applier = NewEngineApply(
+			desired.policy(),
+			desired.resolution(),
+			actualState,
+			actual.NewNoOpActionStateUpdater(),
+			desired.external(),
+			mockRegistry(true, false),
+			diff.NewPolicyResolutionDiff(desired.resolution(), actualState).Actions,
+			event.NewLog("test-apply", false),
+			progress.NewNoop(),
+		)
+		actualState = applyAndCheck(t, applier, ResSuccess, 0, "")
+		assert.Equal(t, 3, len(actualState.ComponentInstanceMap), "Dependent component should be deployed")
+		assert.True(t, getInstanceByParam(t, actualState, "db").Readiness.Ready, "Component should be ready")
+	}
+}
+
+func TestApplyComponentBlueGreenUpdate(t *testing.T) {
+	b := makePolicyBuilder()
+	for _, service := range b.Policy().GetObjectsByKind(lang.ServiceObject.Kind) {
+		service.(*lang.Service).Components[0].Code.UpdateStrategy = lang.UpdateStrategyBlueGreen
+	}
+	setParam := func(value string) {
+		for _, dependency := range b.Policy().GetObjectsByKind(lang.DependencyObject.Kind) {
+			dependency.(*lang.Dependency).Labels["param"] = value
+		}
+	}
+
+	// initial deployment doesn't have a version
+	applier, actualState := newApplierFromEmptyState(t, b)
+	actualState = applyAndCheck(t, applier, ResSuccess, 0, "")
+	instance := getInstanceByParam(t, actualState, "value1")
+	assert.Equal(t, 0, instance.DeployVersion, "Initial deployment should not have a version")
+	deployName := instance.GetDeployName()
+
+	// update creates a new versioned deployment and switches to it
+	setParam("value2")
+	applier = newApplierWithActualState(t, b, actualState, mockRegistry(true, false))
+	actualState = applyAndCheck(t, applier, ResSuccess, 0, "")
+	instance = getInstanceByParam(t, actualState, "value2")
+	assert.Equal(t, 1, instance.DeployVersion, "Deploy version should be incremented")
+	assert.Equal(t, 0, instance.NextDeployVersion, "Switchover should be completed")
+	assert.Equal(t, deployName+"-v1", instance.GetDeployName(), "Deploy name should include deploy version")
+	assert.True(t, applier.OutputsChanged(), "Policy should be re-resolved after switchover")
+
+	// resolver picks up the current deploy version from actual state
+	resolution := resolve.NewPolicyResolver(b.Policy(), b.External(), actualState, event.NewLog("test-resolve", false))
+	desiredState, err := resolution.ResolveAllDependencies()
+	if assert.NoError(t, err, "Policy should be resolved without errors") {
+		assert.Equal(t, 1, getInstanceByParam(t, desiredState, "value2").DeployVersion, "Deploy version should be carried over from actual state")
+	}
+
+	// failed update leaves the current deployment untouched
+	setParam("value3")
+	applier = newApplierWithActualState(t, b, actualState, mockRegistry(false, false))
+	actualState = applyAndCheck(t, applier, ResError, 1, "new deployment failed")
+	instance = getInstanceByParam(t, actualState, "value2")
+	assert.Equal(t, 1, instance.DeployVersion, "Deploy version should remain the same")
+	assert.Equal(t, 0, instance.NextDeployVersion, "Failed deployment should be cleaned up")
+}
+
+func TestApplyComponentBlueGreenSwitchover(t *testing.T) {
+	b := builder.NewPolicyBuilder()
+
+	// create a service with a blue/green component and a component which discovers it
+	service := b.AddService()
+	db := b.AddServiceComponent(service, b.CodeComponent(util.NestedParameterMap{"name": "{{ .Discovery.instance }}", "param": "{{ .Labels.param }}"}, nil))
+	db.Code.UpdateStrategy = lang.UpdateStrategyBlueGreen
+	consumer := b.AddServiceComponent(service, b.CodeComponent(util.NestedParameterMap{"db": "{{ .Discovery." + db.Name + ".instance }}"}, nil))
+	b.AddComponentDependency(consumer, db)
+	contract := b.AddContract(service, b.CriteriaTrue())
+
+	clusterObj := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, clusterObj.Name)))
+	dependency := b.AddDependency(b.AddUser(), contract)
+	dependency.Labels["param"] = "value1"
+
+	updater := &recordingStateUpdater{}
+	codePlugin := &recordingCodePlugin{CodePlugin: fake.NewNoOpCodePlugin(0), updater: updater}
+	plugins := mockRegistryWithCodePlugin(codePlugin)
+
+	// initial deployment
+	actualState := applyAndCheck(t, newApplierWithActualState(t, b, newTestData(t, builder.NewPolicyBuilder()).resolution(), plugins), ResSuccess, 0, "")
+	deployName := getInstanceByParam(t, actualState, "value1").GetDeployName()
+
+	// new deployment gets created with code params calculated for its own deploy name, previous one is kept
+	dependency.Labels["param"] = "value2"
+	codePlugin.reset()
+	applier := newApplierWithActualState(t, b, actualState, plugins)
+	applier.actualStateUpdater = updater
+	actualState = applyAndCheck(t, applier, ResSuccess, 0, "")
+	assert.True(t, applier.OutputsChanged(), "Policy should be re-resolved after switchover")
+	if assert.Len(t, codePlugin.created, 1, "New deployment should be created") {
+		assert.Equal(t, deployName+"-v1", codePlugin.created[0], "New deployment should have the next deploy name")
+		assert.Equal(t, util.EscapeName(deployName+"-v1"), codePlugin.params[deployName+"-v1"]["name"], "New deployment should refer to its own deploy name")
+	}
+	assert.Empty(t, codePlugin.destroyed, "Previous deployment should not be destroyed, until dependent components get updated")
+	assert.Equal(t, []int{0}, codePlugin.unflushed, "Next deploy version should be saved before new deployment is created")
+	instance := getInstanceByParam(t, actualState, "value2")
+	assert.Equal(t, deployName, instance.PreviousDeployName, "Previous deployment should be recorded")
+
+	// dependent component gets switched to the new deployment, then previous deployment gets destroyed
+	codePlugin.reset()
+	applier = newApplierWithActualState(t, b, actualState, plugins)
+	applier.actualStateUpdater = updater
+	actualState = applyAndCheck(t, applier, ResSuccess, 0, "")
+	assert.Empty(t, codePlugin.created, "No deployments should be created")
+	if assert.Len(t, codePlugin.updated, 1, "Dependent component should be updated") {
+		assert.Equal(t, util.EscapeName(deployName+"-v1"), codePlugin.params[codePlugin.updated[0]]["db"], "Dependent component should discover the new deployment")
+	}
+	assert.Equal(t, []string{deployName}, codePlugin.destroyed, "Previous deployment should be destroyed")
+	assert.Equal(t, []int{0}, codePlugin.unflushed, "Dependent component should be saved before previous deployment is destroyed")
+	assert.Empty(t, getInstanceByParam(t, actualState, "value2").PreviousDeployName, "Previous deployment should not be recorded anymore")
+
+	// everything is up to date
+	assert.Empty(t, newApplierWithActualState(t, b, actualState, plugins).actions, "No actions should be generated after switchover")
+}
+
+func TestApplyComponentOutputs(t *testing.T) {
+	codePlugin := &outputsCodePlugin{CodePlugin: fake.NewNoOpCodePlugin(0), err: fmt.Errorf("service not found")}
+	plugins := mockRegistryWithCodePlugin(codePlugin)
+
+	// component instance gets recorded in actual state, even if its outputs can't be retrieved
+	b := makePolicyBuilder()
+	applier := newApplierWithActualState(t, b, newTestData(t, builder.NewPolicyBuilder()).resolution(), plugins)
+	actualState := applyAndCheck(t, applier, ResError, 1, "unable to retrieve outputs")
+	instance := getInstanceByParam(t, actualState, "value1")
+	assert.True(t, instance.OutputsPending, "Outputs should be pending, when they can't be retrieved")
+
+	// nothing changes in the cloud, so outputs don't get retrieved by regular actions
+	applier = newApplierWithActualState(t, b, actualState, plugins)
+	assert.Empty(t, applier.actions, "No actions should be generated, when policy is unchanged")
+
+	// outputs are still not available (e.g. load balancer is still being provisioned)
+	codePlugin.err = nil
+	codePlugin.outputs = map[string]string{"lb": ""}
+	applier = newOutputsApplier(b, actualState, plugins)
+	actualState = applyAndCheck(t, applier, ResSuccess, 0, "")
+	instance = getInstanceByParam(t, actualState, "value1")
+	assert.True(t, instance.OutputsPending, "Outputs with empty values should be pending")
+	assert.Empty(t, instance.Outputs, "Outputs with empty values should not be recorded")
+	assert.False(t, applier.OutputsChanged(), "Outputs should not be changed")
+
+	// outputs become available
+	codePlugin.outputs = map[string]string{"lb": "10.0.0.1"}
+	applier = newOutputsApplier(b, actualState, plugins)
+	actualState = applyAndCheck(t, applier, ResSuccess, 0, "")
+	instance = getInstanceByParam(t, actualState, "value1")
+	assert.False(t, instance.OutputsPending, "Outputs should not be pending anymore")
+	assert.Equal(t, "10.0.0.1", instance.Outputs["lb"], "Outputs should be recorded")
+	assert.True(t, applier.OutputsChanged(), "Outputs should be changed")
+}
+
 func TestDiffHasUpdatedComponentsAndCheckTimes(t *testing.T) {
 	/*
 		Step 1: actual = empty, desired = test policy, check = kafka update/create times
@@ -316,10 +690,136 @@ func makePolicyBuilder() *builder.PolicyBuilder {
 	return b
 }
 
+func makePolicyBuilderWithJob() *builder.PolicyBuilder {
+	b := builder.NewPolicyBuilder()
+
+	// create a service with a job and a component which depends on it
+	service := b.AddService()
+	job := b.AddServiceComponent(service, b.CodeComponent(util.NestedParameterMap{"param": "migrate"}, nil))
+	job.Code.Job = true
+	component := b.AddServiceComponent(service, b.CodeComponent(util.NestedParameterMap{"param": "run"}, nil))
+	b.AddComponentDependency(component, job)
+	contract := b.AddContract(service, b.CriteriaTrue())
+
+	// add rule to set cluster
+	clusterObj := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, clusterObj.Name)))
+
+	// add dependency
+	b.AddDependency(b.AddUser(), contract)
+
+	return b
+}
+
+func makePolicyBuilderWithHooks(hooks *lang.Hooks) *builder.PolicyBuilder {
+	b := makePolicyBuilder()
+	for _, service := range b.Policy().GetObjectsByKind(lang.ServiceObject.Kind) {
+		service.(*lang.Service).Components[0].Hooks = hooks
+	}
+	return b
+}
+
+func newApplierFromEmptyState(t *testing.T, b *builder.PolicyBuilder) (*EngineApply, *resolve.PolicyResolution) {
+	t.Helper()
+	actualState := newTestData(t, builder.NewPolicyBuilder()).resolution()
+	desired := newTestData(t, b)
+	applier := NewEngineApply(
+		desired.policy(),
+		desired.resolution(),
+		actualState,
+		actual.NewNoOpActionStateUpdater(),
+		desired.external(),
+		mockRegistry(true, false),
+		diff.NewPolicyResolutionDiff(desired.resolution(), actualState).Actions,
+		event.NewLog("test-apply", false),
+		progress.NewNoop(),
+	)
+	return applier, actualState
+}
+
+func newApplierWithActualState(t *testing.T, b *builder.PolicyBuilder, actualState *resolve.PolicyResolution, plugins plugin.Registry) *EngineApply {
+	t.Helper()
+	eventLog := event.NewLog("test-resolve", false)
+	desiredState, err := resolve.NewPolicyResolver(b.Policy(), b.External(), actualState, eventLog).ResolveAllDependencies()
+	if !assert.NoError(t, err, "Policy should be resolved without errors") {
+		t.FailNow()
+	}
+	return NewEngineApply(
+		b.Policy(),
+		desiredState,
+		actualState,
+		actual.NewNoOpActionStateUpdater(),
+		b.External(),
+		plugins,
+		diff.NewPolicyResolutionDiff(desiredState, actualState).Actions,
+		event.NewLog("test-apply", false),
+		progress.NewNoop(),
+	)
+}
+
+// newOutputsApplier creates an applier, which retrieves outputs for all component instances with pending outputs
+func newOutputsApplier(b *builder.PolicyBuilder, actualState *resolve.PolicyResolution, plugins plugin.Registry) *EngineApply {
+	actions := []action.Base{}
+	for _, key := range util.GetSortedStringKeys(actualState.ComponentInstanceMap) {
+		if actualState.ComponentInstanceMap[key].OutputsPending {
+			actions = append(actions, component.NewOutputsAction(key))
+		}
+	}
+	return NewEngineApply(
+		b.Policy(),
+		actualState,
+		actualState,
+		actual.NewNoOpActionStateUpdater(),
+		b.External(),
+		plugins,
+		actions,
+		event.NewLog("test-apply", false),
+		progress.NewNoop(),
+	)
+}
+
+func makePolicyBuilderWithReadiness(readiness *lang.Readiness, probe string) *builder.PolicyBuilder {
+	b := builder.NewPolicyBuilder()
+
+	// create a service with a component which has readiness check and a component which depends on it
+	service := b.AddService()
+	db := b.AddServiceComponent(service, b.CodeComponent(util.NestedParameterMap{"param": "db"}, nil))
+	db.Readiness = readiness
+	component := b.AddServiceComponent(service, b.CodeComponent(util.NestedParameterMap{"param": "run"}, nil))
+	b.AddComponentDependency(component, db)
+	contract := b.AddContract(service, b.CriteriaTrue())
+
+	// add rule to set cluster
+	clusterObj := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, clusterObj.Name)))
+
+	// add dependency
+	dependency := b.AddDependency(b.AddUser(), contract)
+	dependency.Labels["probe"] = probe
+
+	return b
+}
+
+func getJobInstance(t *testing.T, resolution *resolve.PolicyResolution) *resolve.ComponentInstance {
+	t.Helper()
+	return getInstanceByParam(t, resolution, "migrate")
+}
+
+func getInstanceByParam(t *testing.T, resolution *resolve.PolicyResolution, param string) *resolve.ComponentInstance {
+	t.Helper()
+	for _, instance := range resolution.ComponentInstanceMap {
+		if instance.CalculatedCodeParams["param"] == param {
+			return instance
+		}
+	}
+	t.Fatalf("Component instance with param '%s' not found", param)
+	return nil
+}
+
 func resolvePolicy(t *testing.T, b *builder.PolicyBuilder) *resolve.PolicyResolution {
 	t.Helper()
 	eventLog := event.NewLog("test-resolve", false)
-	resolver := resolve.NewPolicyResolver(b.Policy(), b.External(), eventLog)
+	resolver := resolve.NewPolicyResolver(b.Policy(), b.External(), nil, eventLog)
 	result, err := resolver.ResolveAllDependencies()
 	if !assert.NoError(t, err, "Policy should be resolved without errors") {
 		hook := &event.HookConsole{}
@@ -395,3 +895,132 @@ func mockRegistry(applySuccess, failAsPanic bool) plugin.Registry {
 
 	return plugin.NewRegistry(config.Plugins{}, clusterTypes, codeTypes, postProcessPlugins)
 }
+
+func mockRegistryWithCodePlugin(codePlugin plugin.CodePlugin) plugin.Registry {
+	clusterTypes := make(map[string]plugin.ClusterPluginConstructor)
+	codeTypes := make(map[string]map[string]plugin.CodePluginConstructor)
+
+	clusterTypes["kubernetes"] = func(cluster *lang.Cluster, cfg config.Plugins) (plugin.ClusterPlugin, error) {
+		return fake.NewNoOpClusterPlugin(0), nil
+	}
+
+	codeTypes["kubernetes"] = make(map[string]plugin.CodePluginConstructor)
+	codeTypes["kubernetes"]["helm"] = func(cluster plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
+		return codePlugin, nil
+	}
+
+	return plugin.NewRegistry(config.Plugins{}, clusterTypes, codeTypes, make([]plugin.PostProcessPlugin, 0))
+}
+
+// outputsCodePlugin is a code plugin, which returns a given set of outputs or fails to retrieve them
+type outputsCodePlugin struct {
+	plugin.CodePlugin
+	outputs map[string]string
+	err     error
+}
+
+func (p *outputsCodePlugin) Outputs(deployName string, params util.NestedParameterMap, eventLog *event.Log) (map[string]string, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	result := make(map[string]string)
+	for k, v := range p.outputs {
+		result[k] = v
+	}
+	return result, nil
+}
+
+// recordingCodePlugin records deploy names of created, updated and destroyed deployments, together with code params.
+// If state updater is set, it also records the number of actual state changes not flushed on create and destroy
+type recordingCodePlugin struct {
+	plugin.CodePlugin
+	created   []string
+	updated   []string
+	destroyed []string
+	params    map[string]util.NestedParameterMap
+	updater   *recordingStateUpdater
+	unflushed []int
+}
+
+func (p *recordingCodePlugin) reset() {
+	p.created, p.updated, p.destroyed, p.params, p.unflushed = nil, nil, nil, nil, nil
+}
+
+func (p *recordingCodePlugin) recordUnflushed() {
+	if p.updater != nil {
+		p.unflushed = append(p.unflushed, len(p.updater.pending))
+	}
+}
+
+func (p *recordingCodePlugin) record(deployName string, params util.NestedParameterMap) {
+	if p.params == nil {
+		p.params = make(map[string]util.NestedParameterMap)
+	}
+	p.params[deployName] = params
+}
+
+func (p *recordingCodePlugin) Create(deployName string, params util.NestedParameterMap, eventLog *event.Log) error {
+	p.created = append(p.created, deployName)
+	p.record(deployName, params)
+	p.recordUnflushed()
+	return nil
+}
+
+func (p *recordingCodePlugin) Update(deployName string, params util.NestedParameterMap, eventLog *event.Log) error {
+	p.updated = append(p.updated, deployName)
+	p.record(deployName, params)
+	return nil
+}
+
+func (p *recordingCodePlugin) Destroy(deployName string, params util.NestedParameterMap, eventLog *event.Log) error {
+	p.destroyed = append(p.destroyed, deployName)
+	p.recordUnflushed()
+	return nil
+}
+
+// recordingStateUpdater records groups of changes flushed by engine apply
+type recordingStateUpdater struct {
+	failFlush bool
+	changes   int
+	pending   map[string]bool
+	flushed   [][]string
+}
+
+func (updater *recordingStateUpdater) Save(obj runtime.Storable) error {
+	return updater.Delete(runtime.KeyForStorable(obj))
+}
+
+func (updater *recordingStateUpdater) Delete(key string) error {
+	if updater.pending == nil {
+		updater.pending = make(map[string]bool)
+	}
+	updater.pending[key] = true
+	updater.changes++
+	return nil
+}
+
+func (updater *recordingStateUpdater) Flush() error {
+	if len(updater.pending) <= 0 {
+		return nil
+	}
+	if updater.failFlush {
+		return fmt.Errorf("flush failed")
+	}
+
+	keys := []string{}
+	for key := range updater.pending {
+		keys = append(keys, key)
+	}
+	updater.flushed = append(updater.flushed, keys)
+	updater.pending = nil
+
+	return nil
+}
+
+func (updater *recordingStateUpdater) flushedKeys() []string {
+	result := []string{}
+	for _, keys := range updater.flushed {
+		result = append(result, keys...)
+	}
+	return result
+}
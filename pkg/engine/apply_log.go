@@ -0,0 +1,54 @@
+package engine
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+)
+
+// ApplyLogChunkObject is an informational data structure with Kind and Constructor for ApplyLogChunk
+var ApplyLogChunkObject = &runtime.Info{
+	Kind:        "apply-log-chunk",
+	Storable:    true,
+	Versioned:   false,
+	Constructor: func() runtime.Object { return &ApplyLogChunk{} },
+}
+
+// ApplyLogChunk contains apply log events of a revision being applied, which have been logged since the previous chunk.
+// Chunks are saved as revision progress changes, so clients could follow apply log without the whole log being saved
+// into the revision every time. Once revision is applied, its apply log is saved into the revision and chunks get
+// removed
+type ApplyLogChunk struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	// Revision is a generation of the revision being applied and Index is an index of the chunk within its apply log
+	Revision runtime.Generation
+	Index    int
+
+	Events []*event.APIEvent
+}
+
+// ApplyLogChunkPrefix returns key prefix of all apply log chunks of a given revision
+func ApplyLogChunkPrefix(revision runtime.Generation) string {
+	return runtime.KeyFromParts(runtime.SystemNS, ApplyLogChunkObject.Kind, revision.String()+"-")
+}
+
+// NewApplyLogChunk creates a new chunk of apply log of a given revision
+func NewApplyLogChunk(revision runtime.Generation, index int, events []*event.APIEvent) *ApplyLogChunk {
+	return &ApplyLogChunk{
+		TypeKind: ApplyLogChunkObject.GetTypeKind(),
+		Revision: revision,
+		Index:    index,
+		Events:   events,
+	}
+}
+
+// GetNamespace returns an object namespace. It's a system namespace for apply log chunks
+func (chunk *ApplyLogChunk) GetNamespace() string {
+	return runtime.SystemNS
+}
+
+// GetName returns object name, which is made of revision generation and chunk index, so chunks are listed in order
+func (chunk *ApplyLogChunk) GetName() string {
+	return fmt.Sprintf("%s-%08d", chunk.Revision, chunk.Index)
+}
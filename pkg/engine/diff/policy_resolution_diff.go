@@ -48,6 +48,7 @@ func (diff *PolicyResolutionDiff) compareAndProduceActions() { // nolint: gocycl
 	actions := make(map[string][]action.Base)
 
 	updateActions := make(map[string]bool)
+	destroyPreviousActions := make([]action.Base, 0)
 	endpointsActions := make([]action.Base, 0)
 
 	// merge all instance keys from prev and next
@@ -121,6 +122,11 @@ func (diff *PolicyResolutionDiff) compareAndProduceActions() { // nolint: gocycl
 			}
 		}
 
+		// see if a previous deployment left after blue/green switchover needs to be destroyed
+		if prevInstance != nil && len(prevInstance.PreviousDeployName) > 0 && len(depKeysNext) > 0 {
+			destroyPreviousActions = append(destroyPreviousActions, component.NewDestroyPreviousAction(instanceKey))
+		}
+
 		if componentChanged {
 			endpointsActions = append(endpointsActions, component.NewEndpointsAction(instanceKey))
 		}
@@ -141,6 +147,9 @@ func (diff *PolicyResolutionDiff) compareAndProduceActions() { // nolint: gocycl
 		delete(actions, key)
 	}
 
+	// previous deployments get destroyed once all components which depend on them have been updated
+	diff.Actions = append(diff.Actions, destroyPreviousActions...)
+
 	// explicitly add all endpoint actions to the end of the list
 	diff.Actions = append(diff.Actions, endpointsActions...)
 
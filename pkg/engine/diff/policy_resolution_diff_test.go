@@ -8,6 +8,7 @@ import (
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/lang/builder"
+	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/util"
 	"github.com/stretchr/testify/assert"
 	"testing"
@@ -89,6 +90,73 @@ func TestDiffComponentDelete(t *testing.T) {
 	verifyDiff(t, diffAgain, 0, 2, 0, 0, 2, 2, 1)
 }
 
+func TestDiffReplicatedComponentScaling(t *testing.T) {
+	b := builder.NewPolicyBuilder()
+
+	// create a service with replicated component
+	service := b.AddService()
+	shard := b.CodeComponent(
+		util.NestedParameterMap{"shard": "{{ .Shard.Index }}"},
+		nil,
+	)
+	shard.Count = "{{ .Labels.shards }}"
+	b.AddServiceComponent(service, shard)
+	contract := b.AddContract(service, b.CriteriaTrue())
+	clusterObj := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, clusterObj.Name)))
+
+	d1 := b.AddDependency(b.AddUser(), contract)
+	d1.Labels["shards"] = "2"
+	resolvedPrev := resolvePolicy(t, b)
+
+	// scale up, only a new shard should be instantiated
+	d1.Labels["shards"] = "3"
+	resolvedNext := resolvePolicy(t, b)
+	diff := NewPolicyResolutionDiff(resolvedNext, resolvedPrev)
+	verifyDiff(t, diff, 1, 0, 0, 1, 0, 1, 1)
+
+	// scale down, only removed shards should be destructed
+	d1.Labels["shards"] = "1"
+	resolvedNextAgain := resolvePolicy(t, b)
+	diffAgain := NewPolicyResolutionDiff(resolvedNextAgain, resolvedNext)
+	verifyDiff(t, diffAgain, 0, 2, 0, 0, 2, 2, 1)
+}
+
+func TestDiffFilterBySelector(t *testing.T) {
+	b := makePolicyBuilder()
+	resolvedPrev := resolvePolicy(t, b)
+
+	// add another service, and dependencies on both services
+	service := b.AddService()
+	b.AddServiceComponent(service, b.CodeComponent(util.NestedParameterMap{"param": "{{ .Labels.param }}"}, nil))
+	contract := b.AddContract(service, b.CriteriaTrue())
+	d1 := b.AddDependency(b.AddUser(), b.Policy().GetObjectsByKind(lang.ContractObject.Kind)[0].(*lang.Contract))
+	d1.Labels["param"] = "value1"
+	d2 := b.AddDependency(b.AddUser(), contract)
+	d2.Labels["param"] = "value2"
+	resolvedNext := resolvePolicy(t, b)
+
+	diff := NewPolicyResolutionDiff(resolvedNext, resolvedPrev)
+	verifyDiff(t, diff, 4, 0, 0, 4, 0, 4, 1)
+
+	// empty selector keeps all actions
+	verifyDiff(t, &PolicyResolutionDiff{Actions: diff.FilterActions(&Selector{})}, 4, 0, 0, 4, 0, 4, 1)
+
+	// only actions for component instances used by a dependency are kept
+	verifyDiff(t, &PolicyResolutionDiff{Actions: diff.FilterActions(&Selector{Dependency: runtime.KeyForStorable(d1)})}, 2, 0, 0, 2, 0, 2, 1)
+
+	// only actions for component instances within a service instance are kept
+	serviceKey := resolvedNext.GetDependencyInstanceMap()[runtime.KeyForStorable(d2)]
+	verifyDiff(t, &PolicyResolutionDiff{Actions: diff.FilterActions(&Selector{Service: serviceKey})}, 2, 0, 0, 2, 0, 2, 1)
+
+	// no actions are kept for a namespace without component instances
+	verifyDiff(t, &PolicyResolutionDiff{Actions: diff.FilterActions(&Selector{Namespace: "unknown"})}, 0, 0, 0, 0, 0, 0, 0)
+
+	// actions for destroyed component instances are kept as well
+	diffDelete := NewPolicyResolutionDiff(resolvedPrev, resolvedNext)
+	verifyDiff(t, &PolicyResolutionDiff{Actions: diffDelete.FilterActions(&Selector{Dependency: runtime.KeyForStorable(d1)})}, 0, 2, 0, 0, 2, 2, 1)
+}
+
 /*
 	Helpers
 */
@@ -116,7 +184,7 @@ func makePolicyBuilder() *builder.PolicyBuilder {
 func resolvePolicy(t *testing.T, builder *builder.PolicyBuilder) *resolve.PolicyResolution {
 	t.Helper()
 	eventLog := event.NewLog("test-resolve", false)
-	resolver := resolve.NewPolicyResolver(builder.Policy(), builder.External(), eventLog)
+	resolver := resolve.NewPolicyResolver(builder.Policy(), builder.External(), nil, eventLog)
 	result, err := resolver.ResolveAllDependencies()
 	if !assert.NoError(t, err, "Policy should be resolved without errors") {
 		hook := &event.HookConsole{}
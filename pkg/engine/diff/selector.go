@@ -0,0 +1,98 @@
+package diff
+
+import (
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action/component"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action/global"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+)
+
+// Selector selects component instances, which actions should be kept when filtering the diff. All specified fields
+// must match. Empty selector matches all component instances
+type Selector struct {
+	// Dependency is a key of dependency (namespace/dependency/name), which component instances must be used by
+	Dependency string
+
+	// Service is a key of service instance, which component instances must belong to
+	Service string
+
+	// Namespace is a namespace, which component instances must belong to
+	Namespace string
+}
+
+// IsEmpty returns true if selector matches all component instances
+func (selector *Selector) IsEmpty() bool {
+	return selector == nil || len(selector.Dependency) <= 0 && len(selector.Service) <= 0 && len(selector.Namespace) <= 0
+}
+
+// matches returns true if component instance matches selector
+func (selector *Selector) matches(instance *resolve.ComponentInstance) bool {
+	if len(selector.Dependency) > 0 && !instance.DependencyKeys[selector.Dependency] {
+		return false
+	}
+	if len(selector.Service) > 0 && instance.Metadata.Key.GetParentServiceKey().GetKey() != selector.Service {
+		return false
+	}
+	if len(selector.Namespace) > 0 && instance.Metadata.Key.Namespace != selector.Namespace {
+		return false
+	}
+	return true
+}
+
+// FilterActions returns actions from the diff, which affect component instances matched by a given selector. Component
+// instance is considered to be matched if it matches selector either in actual or in desired state, so that actions
+// for destroyed component instances are kept as well. Actions are returned in the same order as in the diff
+func (diff *PolicyResolutionDiff) FilterActions(selector *Selector) []action.Base {
+	if selector.IsEmpty() {
+		return diff.Actions
+	}
+
+	result := []action.Base{}
+	for _, act := range diff.Actions {
+		key, ok := getComponentKey(act)
+		if !ok {
+			continue
+		}
+		if diff.matches(selector, key) {
+			result = append(result, act)
+		}
+	}
+
+	// explicitly add global post-processing action
+	if len(result) > 0 {
+		result = append(result, global.NewPostProcessAction())
+	}
+	return result
+}
+
+// matches returns true if component instance with a given key matches selector in actual or in desired state
+func (diff *PolicyResolutionDiff) matches(selector *Selector, key string) bool {
+	if instance, ok := diff.Next.ComponentInstanceMap[key]; ok && selector.matches(instance) {
+		return true
+	}
+	if instance, ok := diff.Prev.ComponentInstanceMap[key]; ok && selector.matches(instance) {
+		return true
+	}
+	return false
+}
+
+// getComponentKey returns a key of component instance, which a given action is performed on
+func getComponentKey(act action.Base) (string, bool) {
+	switch a := act.(type) {
+	case *component.CreateAction:
+		return a.ComponentKey, true
+	case *component.UpdateAction:
+		return a.ComponentKey, true
+	case *component.DeleteAction:
+		return a.ComponentKey, true
+	case *component.AttachDependencyAction:
+		return a.ComponentKey, true
+	case *component.DetachDependencyAction:
+		return a.ComponentKey, true
+	case *component.EndpointsAction:
+		return a.ComponentKey, true
+	case *component.DestroyPreviousAction:
+		return a.ComponentKey, true
+	}
+	return "", false
+}
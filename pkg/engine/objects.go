@@ -16,6 +16,8 @@ var (
 		component.AttachDependencyActionObject,
 		component.DetachDependencyActionObject,
 		component.EndpointsActionObject,
+		component.OutputsActionObject,
+		component.DestroyPreviousActionObject,
 		global.PostProcessActionObject,
 	}
 
@@ -23,6 +25,7 @@ var (
 	Objects = runtime.AppendAll([]*runtime.Info{
 		PolicyDataObject,
 		RevisionObject,
+		ApplyLogChunkObject,
 		resolve.ComponentInstanceObject,
 	}, ActionObjects)
 )
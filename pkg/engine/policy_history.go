@@ -0,0 +1,19 @@
+package engine
+
+import (
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"time"
+)
+
+// PolicyObjectVersion is a single stored generation of policy object along with the information about policy update,
+// which has introduced it
+type PolicyObjectVersion struct {
+	Object lang.Base
+
+	// Policy is a generation of policy, in which this generation of object has been added, updated or deleted. It's
+	// LastGen if policy generation isn't known (e.g. when it has been removed by compaction)
+	Policy    runtime.Generation
+	UpdatedAt time.Time
+	UpdatedBy string
+}
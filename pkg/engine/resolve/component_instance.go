@@ -26,6 +26,9 @@ type ComponentInstanceMetadata struct {
 // AllowIngres is an special key, which is used in DataForPlugins to indicate whether ingress traffic should be allowed for a given component instance
 const AllowIngres = "allow_ingress"
 
+// RedactedValue is what values of code and discovery parameters containing generated secrets get replaced with in logs
+const RedactedValue = "******"
+
 // ComponentInstance is an instance of a particular code component within a service, which indicate that this component
 // has to be instantiated and configured in a certain cluster. Policy resolver produces a map of component instances
 // and their parameters in desired state (PolicyResolution) as result of policy resolution.
@@ -60,6 +63,35 @@ type ComponentInstance struct {
 	// CalculatedCodeParams is a set of calculated code parameters for the component (non-conflicting over all uses of this component)
 	CalculatedCodeParams util.NestedParameterMap
 
+	// CodeParamsSources holds keys of dependencies, which contributed values for code parameters with merge strategies (param path -> dependency keys)
+	CodeParamsSources map[string][]string
+
+	// NextCodeParams is a set of code parameters calculated for the next deployment of the component (with the next
+	// versioned deploy name), if it gets updated via blue/green strategy
+	NextCodeParams util.NestedParameterMap
+
+	// sources of next code parameters with merge strategies (param path -> dependency keys)
+	nextCodeParamsSources map[string][]string
+
+	// SecretCodeParams is a list of paths to code parameters, which contain generated secrets. It's calculated once policy resolution is complete
+	SecretCodeParams []string
+
+	// SecretDiscoveryParams is a list of paths to discovery parameters, which contain generated secrets. It's calculated once policy resolution is complete
+	SecretDiscoveryParams []string
+
+	// merge strategies for code parameters, as defined in the component
+	codeParamsMerge map[string]string
+
+	// CalculatedHookParams is a set of calculated code parameters for component hooks, which run code (hook name -> code params)
+	CalculatedHookParams map[string]util.NestedParameterMap
+
+	// CalculatedReadinessProbe is a calculated URL or address for checking readiness of the component (if it's checked via HTTP or TCP)
+	CalculatedReadinessProbe string
+
+	// NextReadinessProbe is a URL or address for checking readiness of the next deployment of the component, if it
+	// gets updated via blue/green strategy
+	NextReadinessProbe string
+
 	// EdgesIn is a set of incoming graph edges ('key' -> true) into this component instance. Storing for observability and reporting, so we can reconstruct the graph
 	EdgesIn map[string]bool
 
@@ -81,6 +113,59 @@ type ComponentInstance struct {
 
 	// Endpoints represents all URLs that could be used to access deployed service
 	Endpoints map[string]string
+
+	// Outputs represents named values produced by the code plugin after component instance got created or updated
+	// (e.g. generated password, load balancer address). They get exposed to dependent components via discovery
+	Outputs map[string]string
+
+	// OutputsPending is true if outputs couldn't be retrieved from the code plugin, or some of them are not available
+	// yet (e.g. load balancer address is still being provisioned). Such outputs get polled again on the next runs
+	OutputsPending bool
+
+	// Job represents the outcome of the last run, if component instance is a one-shot job
+	Job *JobStatus
+
+	// DeployVersion is a version of the deployment, which gets incremented on every blue/green update. Component
+	// instance gets deployed under a versioned deploy name, so old and new deployments can co-exist during switchover
+	DeployVersion int
+
+	// NextDeployVersion is set while blue/green switchover is in progress, indicating that a deployment with this
+	// version may exist in the cloud in addition to the current one
+	NextDeployVersion int
+
+	// PreviousDeployName is set after blue/green switchover, while the previous deployment still exists because
+	// components which depend on this component instance may still use it. It gets destroyed once they get updated
+	PreviousDeployName string
+
+	// Readiness represents the outcome of the last readiness check, if component defines it
+	Readiness *ReadinessStatus
+}
+
+// ReadinessStatus represents the outcome of a readiness check of component instance
+type ReadinessStatus struct {
+	// Ready is true if component instance has become ready
+	Ready bool
+
+	// Message describes readiness status (e.g. reason why component instance is not ready)
+	Message string
+
+	// CheckedAt is when readiness has been checked
+	CheckedAt time.Time
+}
+
+// JobStatus represents the outcome of a one-shot job run, as reported by the code plugin
+type JobStatus struct {
+	// Succeeded is true if job has completed successfully
+	Succeeded bool
+
+	// ExitCode is an exit code of the job
+	ExitCode int
+
+	// Log is an output of the job (possibly truncated by the code plugin)
+	Log string
+
+	// CompletedAt is when job has completed
+	CompletedAt time.Time
 }
 
 // Creates a new component instance
@@ -92,6 +177,7 @@ func newComponentInstance(cik *ComponentInstanceKey) *ComponentInstance {
 		CalculatedLabels:     lang.NewLabelSet(make(map[string]string)),
 		CalculatedDiscovery:  util.NestedParameterMap{},
 		CalculatedCodeParams: util.NestedParameterMap{},
+		CalculatedHookParams: make(map[string]util.NestedParameterMap),
 		EdgesIn:              make(map[string]bool),
 		EdgesOut:             make(map[string]bool),
 		DataForPlugins:       make(map[string]string),
@@ -112,9 +198,113 @@ func (instance *ComponentInstance) GetKey() string {
 	return instance.Metadata.Key.GetKey()
 }
 
-// GetDeployName returns a string that could be used as name for deployment inside the cluster
+// GetDeployName returns a string that could be used as name for deployment inside the cluster. For component
+// instances which have been updated via blue/green strategy, it includes deploy version
 func (instance *ComponentInstance) GetDeployName() string {
-	return instance.Metadata.Key.GetDeployName()
+	return instance.GetDeployNameForVersion(instance.DeployVersion)
+}
+
+// GetDeployNameForVersion returns a string that could be used as name for a given version of deployment inside the cluster
+func (instance *ComponentInstance) GetDeployNameForVersion(version int) string {
+	return getVersionedDeployName(instance.Metadata.Key, version)
+}
+
+func getVersionedDeployName(cik *ComponentInstanceKey, version int) string {
+	if version <= 0 {
+		return cik.GetDeployName()
+	}
+	return cik.GetDeployName() + "-v" + strconv.Itoa(version)
+}
+
+// makeCopy returns a deep copy of component instance, so it can be modified without affecting the original
+func (instance *ComponentInstance) makeCopy() *ComponentInstance {
+	result := *instance
+	if instance.Metadata != nil && instance.Metadata.Key != nil {
+		result.Metadata = &ComponentInstanceMetadata{Key: instance.Metadata.Key.MakeCopy()}
+	}
+	result.DependencyKeys = copyBoolMap(instance.DependencyKeys)
+	if instance.CalculatedLabels != nil {
+		result.CalculatedLabels = lang.NewLabelSet(instance.CalculatedLabels.Labels)
+	}
+	result.CalculatedDiscovery = instance.CalculatedDiscovery.MakeDeepCopy()
+	result.CalculatedCodeParams = instance.CalculatedCodeParams.MakeDeepCopy()
+	result.CodeParamsSources = copySources(instance.CodeParamsSources)
+	result.NextCodeParams = instance.NextCodeParams.MakeDeepCopy()
+	result.nextCodeParamsSources = copySources(instance.nextCodeParamsSources)
+	result.SecretCodeParams = copyStrings(instance.SecretCodeParams)
+	result.SecretDiscoveryParams = copyStrings(instance.SecretDiscoveryParams)
+	if instance.CalculatedHookParams != nil {
+		result.CalculatedHookParams = make(map[string]util.NestedParameterMap)
+		for hookName, hookParams := range instance.CalculatedHookParams {
+			result.CalculatedHookParams[hookName] = hookParams.MakeDeepCopy()
+		}
+	}
+	result.EdgesIn = copyBoolMap(instance.EdgesIn)
+	result.EdgesOut = copyBoolMap(instance.EdgesOut)
+	result.DataForPlugins = copyStringMap(instance.DataForPlugins)
+	result.Endpoints = copyStringMap(instance.Endpoints)
+	result.Outputs = copyStringMap(instance.Outputs)
+	if instance.Job != nil {
+		job := *instance.Job
+		result.Job = &job
+	}
+	if instance.Readiness != nil {
+		readiness := *instance.Readiness
+		result.Readiness = &readiness
+	}
+	return &result
+}
+
+func copyStrings(src []string) []string {
+	if src == nil {
+		return nil
+	}
+	return append([]string{}, src...)
+}
+
+func copySources(src map[string][]string) map[string][]string {
+	if src == nil {
+		return nil
+	}
+	result := make(map[string][]string)
+	for path, keys := range src {
+		result[path] = copyStrings(keys)
+	}
+	return result
+}
+
+func copyBoolMap(src map[string]bool) map[string]bool {
+	if src == nil {
+		return nil
+	}
+	result := make(map[string]bool)
+	for k, v := range src {
+		result[k] = v
+	}
+	return result
+}
+
+func copyStringMap(src map[string]string) map[string]string {
+	if src == nil {
+		return nil
+	}
+	result := make(map[string]string)
+	for k, v := range src {
+		result[k] = v
+	}
+	return result
+}
+
+// GetRedactedCodeParams returns a copy of code parameters, where values containing generated secrets are redacted. It
+// should be used every time code parameters get logged
+func (instance *ComponentInstance) GetRedactedCodeParams() util.NestedParameterMap {
+	return instance.CalculatedCodeParams.Redact(instance.SecretCodeParams, RedactedValue)
+}
+
+// GetRedactedDiscoveryParams returns a copy of discovery parameters, where values containing generated secrets are
+// redacted. It should be used every time discovery parameters get logged
+func (instance *ComponentInstance) GetRedactedDiscoveryParams() util.NestedParameterMap {
+	return instance.CalculatedDiscovery.Redact(instance.SecretDiscoveryParams, RedactedValue)
 }
 
 // GetNamespace returns an object namespace. It's a system namespace for all component instances
@@ -140,25 +330,73 @@ func (instance *ComponentInstance) addRuleInformation(result *lang.RuleActionRes
 	instance.DataForPlugins[AllowIngres] = strconv.FormatBool(!result.RejectIngress)
 }
 
-func (instance *ComponentInstance) addCodeParams(codeParams util.NestedParameterMap) error {
-	if len(instance.CalculatedCodeParams) == 0 {
+func (instance *ComponentInstance) addCodeParams(codeParams util.NestedParameterMap, merge map[string]string, sources map[string][]string) error {
+	if len(merge) > 0 {
+		instance.codeParamsMerge = merge
+	}
+	return instance.combineCodeParams(&instance.CalculatedCodeParams, &instance.CodeParamsSources, codeParams, sources)
+}
+
+func (instance *ComponentInstance) addNextCodeParams(codeParams util.NestedParameterMap, merge map[string]string, sources map[string][]string) error {
+	if len(merge) > 0 {
+		instance.codeParamsMerge = merge
+	}
+	return instance.combineCodeParams(&instance.NextCodeParams, &instance.nextCodeParamsSources, codeParams, sources)
+}
+
+// combineCodeParams combines existing code parameters with new ones, merging them according to merge strategies
+func (instance *ComponentInstance) combineCodeParams(existing *util.NestedParameterMap, existingSources *map[string][]string, codeParams util.NestedParameterMap, sources map[string][]string) error {
+	if len(*existing) == 0 {
 		// Record code parameters
-		instance.CalculatedCodeParams = codeParams
-	} else if !instance.CalculatedCodeParams.DeepEqual(codeParams) {
-		// Same component instance, different code parameters
-		return errors.NewErrorWithDetails(
-			fmt.Sprintf("Invalid policy. Conflicting code parameters for component instance: %s", instance.GetKey()),
-			errors.Details{
-				"instance":             instance.Metadata.Key,
-				"code_params_existing": instance.CalculatedCodeParams,
-				"code_params_new":      codeParams,
-				"diff":                 instance.CalculatedCodeParams.Diff(codeParams),
-			},
-		)
+		*existing = codeParams
+		addCodeParamsSources(existingSources, sources)
+		return nil
 	}
+
+	if len(instance.codeParamsMerge) == 0 {
+		if !existing.DeepEqual(codeParams) {
+			// Same component instance, different code parameters
+			return instance.errorConflictingCodeParams(*existing, codeParams, nil)
+		}
+		return nil
+	}
+
+	// Merge code parameters according to merge strategies
+	merged, mergedSources, err := mergeCodeParams(*existing, *existingSources, codeParams, sources, instance.codeParamsMerge)
+	if err != nil {
+		return instance.errorConflictingCodeParams(*existing, codeParams, err)
+	}
+	*existing = merged
+	*existingSources = nil
+	addCodeParamsSources(existingSources, mergedSources)
 	return nil
 }
 
+func addCodeParamsSources(dst *map[string][]string, sources map[string][]string) {
+	for path, keys := range sources {
+		if *dst == nil {
+			*dst = make(map[string][]string)
+		}
+		(*dst)[path] = unionSortedStrings((*dst)[path], keys)
+	}
+}
+
+func (instance *ComponentInstance) errorConflictingCodeParams(existing util.NestedParameterMap, codeParams util.NestedParameterMap, cause error) error {
+	details := errors.Details{
+		"instance":             instance.Metadata.Key,
+		"code_params_existing": existing,
+		"code_params_new":      codeParams,
+		"diff":                 existing.Diff(codeParams),
+	}
+	if cause != nil {
+		details["merge_error"] = cause.Error()
+	}
+	return errors.NewErrorWithDetails(
+		fmt.Sprintf("Invalid policy. Conflicting code parameters for component instance: %s", instance.GetKey()),
+		details,
+	)
+}
+
 func (instance *ComponentInstance) addDiscoveryParams(discoveryParams util.NestedParameterMap) error {
 	if len(instance.CalculatedDiscovery) == 0 {
 		// Record discovery parameters
@@ -178,6 +416,61 @@ func (instance *ComponentInstance) addDiscoveryParams(discoveryParams util.Neste
 	return nil
 }
 
+func (instance *ComponentInstance) addHookParams(hookName string, hookParams util.NestedParameterMap) error {
+	existing, ok := instance.CalculatedHookParams[hookName]
+	if !ok {
+		// Record hook parameters
+		instance.CalculatedHookParams[hookName] = hookParams
+	} else if !existing.DeepEqual(hookParams) {
+		// Same component instance, different hook parameters
+		return errors.NewErrorWithDetails(
+			fmt.Sprintf("Invalid policy. Conflicting parameters of hook '%s' for component instance: %s", hookName, instance.GetKey()),
+			errors.Details{
+				"instance":             instance.Metadata.Key,
+				"hook_params_existing": existing,
+				"hook_params_new":      hookParams,
+				"diff":                 existing.Diff(hookParams),
+			},
+		)
+	}
+	return nil
+}
+
+func (instance *ComponentInstance) addReadinessProbe(probe string) error {
+	return instance.combineReadinessProbe(&instance.CalculatedReadinessProbe, probe)
+}
+
+func (instance *ComponentInstance) addNextReadinessProbe(probe string) error {
+	return instance.combineReadinessProbe(&instance.NextReadinessProbe, probe)
+}
+
+func (instance *ComponentInstance) combineReadinessProbe(existing *string, probe string) error {
+	if len(*existing) == 0 {
+		// Record readiness probe
+		*existing = probe
+	} else if len(probe) > 0 && *existing != probe {
+		// Same component instance, different readiness probes
+		return errors.NewErrorWithDetails(
+			fmt.Sprintf("Invalid policy. Conflicting readiness probes for component instance: %s", instance.GetKey()),
+			errors.Details{
+				"instance":                 instance.Metadata.Key,
+				"readiness_probe_existing": *existing,
+				"readiness_probe_new":      probe,
+			},
+		)
+	}
+	return nil
+}
+
+func (instance *ComponentInstance) addOutputs(outputs map[string]string) {
+	if len(outputs) > 0 && instance.Outputs == nil {
+		instance.Outputs = make(map[string]string)
+	}
+	for k, v := range outputs {
+		instance.Outputs[k] = v
+	}
+}
+
 func (instance *ComponentInstance) addLabels(labels *lang.LabelSet) {
 	// it's pretty typical for us to come with different labels to a component instance, let's combine them all
 	instance.CalculatedLabels.AddLabels(labels.Labels)
@@ -191,6 +484,29 @@ func (instance *ComponentInstance) addEdgeOut(dstKey string) {
 	instance.EdgesOut[dstKey] = true
 }
 
+// UpdateOutputs replaces component outputs with a given set of outputs and returns true if they changed. Outputs with
+// empty values are not available yet, so they don't get recorded and component outputs are marked as pending
+func (instance *ComponentInstance) UpdateOutputs(outputs map[string]string) bool {
+	available := make(map[string]string)
+	instance.OutputsPending = false
+	for k, v := range outputs {
+		if len(v) > 0 {
+			available[k] = v
+		} else {
+			instance.OutputsPending = true
+		}
+	}
+
+	changed := len(available) != len(instance.Outputs)
+	for k, v := range available {
+		if prev, ok := instance.Outputs[k]; !ok || prev != v {
+			changed = true
+		}
+	}
+	instance.Outputs = available
+	return changed
+}
+
 // UpdateTimes updates component creation and update times
 func (instance *ComponentInstance) UpdateTimes(createdAt time.Time, updatedAt time.Time) {
 	if time.Time.IsZero(instance.CreatedAt) || (!time.Time.IsZero(createdAt) && createdAt.Before(instance.CreatedAt)) {
@@ -216,7 +532,29 @@ func (instance *ComponentInstance) appendData(ops *ComponentInstance) error {
 		return err
 	}
 
-	err = instance.addCodeParams(ops.CalculatedCodeParams)
+	err = instance.addCodeParams(ops.CalculatedCodeParams, ops.codeParamsMerge, ops.CodeParamsSources)
+	if err != nil {
+		return err
+	}
+
+	err = instance.addNextCodeParams(ops.NextCodeParams, ops.codeParamsMerge, ops.nextCodeParamsSources)
+	if err != nil {
+		return err
+	}
+
+	for hookName, hookParams := range ops.CalculatedHookParams {
+		err = instance.addHookParams(hookName, hookParams)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = instance.addReadinessProbe(ops.CalculatedReadinessProbe)
+	if err != nil {
+		return err
+	}
+
+	err = instance.addNextReadinessProbe(ops.NextReadinessProbe)
 	if err != nil {
 		return err
 	}
@@ -234,6 +572,25 @@ func (instance *ComponentInstance) appendData(ops *ComponentInstance) error {
 		instance.DataForPlugins[k] = v
 	}
 
+	// Outputs recorded during the last apply
+	instance.addOutputs(ops.Outputs)
+	if ops.OutputsPending {
+		instance.OutputsPending = true
+	}
+
+	// Deploy version of the current deployment
+	if ops.DeployVersion > instance.DeployVersion {
+		instance.DeployVersion = ops.DeployVersion
+	}
+
+	// Job and readiness status recorded during the last apply
+	if ops.Job != nil {
+		instance.Job = ops.Job
+	}
+	if ops.Readiness != nil {
+		instance.Readiness = ops.Readiness
+	}
+
 	return nil
 }
 
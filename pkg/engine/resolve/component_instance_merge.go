@@ -0,0 +1,234 @@
+package resolve
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// codeParamsMerger merges two sets of code parameters, calculated for the same component instance by different
+// dependencies. Parameters with merge strategies get merged according to them, all other parameters must be equal.
+// The result doesn't depend on the order in which dependencies get merged
+type codeParamsMerger struct {
+	// merge strategies: parameter path -> strategy
+	merge map[string]string
+
+	// keys of dependencies which contributed values for parameters with merge strategies: parameter path -> keys
+	sourcesA map[string][]string
+	sourcesB map[string][]string
+	sources  map[string][]string
+}
+
+// mergeCodeParams merges two sets of code parameters according to a given set of merge strategies. It returns merged
+// code parameters, as well as keys of dependencies which contributed values for parameters with merge strategies
+func mergeCodeParams(a util.NestedParameterMap, sourcesA map[string][]string, b util.NestedParameterMap, sourcesB map[string][]string, merge map[string]string) (util.NestedParameterMap, map[string][]string, error) {
+	merger := &codeParamsMerger{
+		merge:    merge,
+		sourcesA: sourcesA,
+		sourcesB: sourcesB,
+		sources:  make(map[string][]string),
+	}
+	result, err := merger.mergeMaps("", a, b)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result, merger.sources, nil
+}
+
+func (merger *codeParamsMerger) mergeMaps(path string, a, b util.NestedParameterMap) (util.NestedParameterMap, error) {
+	keys := make(map[string]bool)
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+
+	result := util.NestedParameterMap{}
+	for _, key := range util.GetSortedStringKeys(keys) {
+		valueA, okA := a[key]
+		valueB, okB := b[key]
+		value, err := merger.mergeValues(joinParamPath(path, key), valueA, okA, valueB, okB)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+	}
+	return result, nil
+}
+
+func (merger *codeParamsMerger) mergeValues(path string, a interface{}, okA bool, b interface{}, okB bool) (interface{}, error) {
+	strategy, ok := merger.merge[path]
+	if !ok {
+		if !okA || !okB {
+			return nil, fmt.Errorf("parameter '%s' is not defined for all dependencies and has no merge strategy", path)
+		}
+		mapA, isMapA := a.(util.NestedParameterMap)
+		mapB, isMapB := b.(util.NestedParameterMap)
+		if isMapA && isMapB {
+			return merger.mergeMaps(path, mapA, mapB)
+		}
+		if !reflect.DeepEqual(a, b) {
+			return nil, fmt.Errorf("parameter '%s' has conflicting values '%v' and '%v' and no merge strategy", path, a, b)
+		}
+		return a, nil
+	}
+
+	// if a value is missing on one side, take it from the other side
+	if !okA {
+		merger.sources[path] = merger.sourcesB[path]
+		return b, nil
+	}
+	if !okB {
+		merger.sources[path] = merger.sourcesA[path]
+		return a, nil
+	}
+
+	switch strategy {
+	case lang.MergeStrategyFirst:
+		return merger.mergeFirst(path, a, b), nil
+	case lang.MergeStrategyMax:
+		return merger.mergeMax(path, a, b)
+	case lang.MergeStrategyUnion:
+		return merger.mergeUnion(path, a, b)
+	}
+	return nil, fmt.Errorf("parameter '%s' has unknown merge strategy '%s'", path, strategy)
+}
+
+// takes the value from the dependency with the smallest key. If values are equal, both sides get recorded as sources
+func (merger *codeParamsMerger) mergeFirst(path string, a, b interface{}) interface{} {
+	if reflect.DeepEqual(a, b) {
+		merger.sources[path] = unionSortedStrings(merger.sourcesA[path], merger.sourcesB[path])
+		return a
+	}
+	if merger.isFirst(path) {
+		merger.sources[path] = merger.sourcesA[path]
+		return a
+	}
+	merger.sources[path] = merger.sourcesB[path]
+	return b
+}
+
+// takes the largest numeric value. If values are equal, both sides get recorded as sources
+func (merger *codeParamsMerger) mergeMax(path string, a, b interface{}) (interface{}, error) {
+	numA, err := paramToNumber(path, a)
+	if err != nil {
+		return nil, err
+	}
+	numB, err := paramToNumber(path, b)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case numA > numB:
+		merger.sources[path] = merger.sourcesA[path]
+		return a, nil
+	case numA < numB:
+		merger.sources[path] = merger.sourcesB[path]
+		return b, nil
+	}
+	merger.sources[path] = unionSortedStrings(merger.sourcesA[path], merger.sourcesB[path])
+	if merger.isFirst(path) {
+		return a, nil
+	}
+	return b, nil
+}
+
+// treats values as comma-separated lists and takes a sorted union of them
+func (merger *codeParamsMerger) mergeUnion(path string, a, b interface{}) (interface{}, error) {
+	listA, err := paramToList(path, a)
+	if err != nil {
+		return nil, err
+	}
+	listB, err := paramToList(path, b)
+	if err != nil {
+		return nil, err
+	}
+	merger.sources[path] = unionSortedStrings(merger.sourcesA[path], merger.sourcesB[path])
+	return strings.Join(unionSortedStrings(listA, listB), ","), nil
+}
+
+// returns true if the first set of parameters was calculated by a dependency with the smallest key
+func (merger *codeParamsMerger) isFirst(path string) bool {
+	return firstString(merger.sourcesA[path]) <= firstString(merger.sourcesB[path])
+}
+
+// hasCodeParam returns true if a parameter with a given path (e.g. "auth.users") is defined in code parameters
+func hasCodeParam(params util.NestedParameterMap, path string) bool {
+	var value interface{} = params
+	for _, key := range strings.Split(path, ".") {
+		nested, ok := value.(util.NestedParameterMap)
+		if !ok {
+			return false
+		}
+		if value, ok = nested[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func joinParamPath(path string, key string) string {
+	if len(path) == 0 {
+		return key
+	}
+	return path + "." + key
+}
+
+func paramToNumber(path string, value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case string:
+		result, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err == nil {
+			return result, nil
+		}
+	}
+	return 0, fmt.Errorf("parameter '%s' has merge strategy '%s', but its value '%v' is not a number", path, lang.MergeStrategyMax, value)
+}
+
+func paramToList(path string, value interface{}) ([]string, error) {
+	str, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("parameter '%s' has merge strategy '%s', but its value '%v' is not a comma-separated list", path, lang.MergeStrategyUnion, value)
+	}
+	result := []string{}
+	for _, item := range strings.Split(str, ",") {
+		item = strings.TrimSpace(item)
+		if len(item) > 0 {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// returns a sorted list of unique strings from both lists
+func unionSortedStrings(a []string, b []string) []string {
+	unique := make(map[string]bool)
+	for _, s := range a {
+		unique[s] = true
+	}
+	for _, s := range b {
+		unique[s] = true
+	}
+	result := make([]string, 0, len(unique))
+	for s := range unique {
+		result = append(result, s)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// returns the first string from a sorted list, or empty string if the list is empty
+func firstString(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	return list[0]
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/base32"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"hash/fnv"
+	"strconv"
 	"strings"
 )
 
@@ -26,6 +27,7 @@ const componentRootName = "root"
 // Contract, Context (with allocation keys), Service get included as a part of the key (Service must be within the same namespace as Contract).
 // ComponentName gets included as a part of the key. For service-level component instances, ComponentName is
 // set to componentRootName, while for all component instances within a service an actual Component.Name is used.
+// Shard gets included as a part of the key for replicated components (every shard is a separate component instance).
 type ComponentInstanceKey struct {
 	// cached version of component key
 	key string
@@ -39,6 +41,7 @@ type ComponentInstanceKey struct {
 	ContextNameWithKeys string // calculated
 	ServiceName         string // determined from the context (included into key for readability)
 	ComponentName       string // component name
+	Shard               string // shard index for replicated components, empty otherwise
 }
 
 // NewComponentInstanceKey creates a new ComponentInstanceKey
@@ -70,10 +73,19 @@ func (cik *ComponentInstanceKey) MakeCopy() *ComponentInstanceKey {
 		ContextName:         cik.ContextName,
 		KeysResolved:        cik.KeysResolved,
 		ContextNameWithKeys: cik.ContextNameWithKeys,
+		ServiceName:         cik.ServiceName,
 		ComponentName:       cik.ComponentName,
+		Shard:               cik.Shard,
 	}
 }
 
+// WithShard returns a copy of ComponentInstanceKey for a given shard of a replicated component
+func (cik *ComponentInstanceKey) WithShard(index int) *ComponentInstanceKey {
+	shardCik := cik.MakeCopy()
+	shardCik.Shard = strconv.Itoa(index)
+	return shardCik
+}
+
 // IsService returns 'true' if it's a contract instance key and we can't go up anymore. And it will return 'false' if it's a component instance key
 func (cik *ComponentInstanceKey) IsService() bool {
 	return cik.ComponentName == componentRootName
@@ -91,20 +103,32 @@ func (cik *ComponentInstanceKey) GetParentServiceKey() *ComponentInstanceKey {
 	}
 	serviceCik := cik.MakeCopy()
 	serviceCik.ComponentName = componentRootName
+	serviceCik.Shard = ""
 	return serviceCik
 }
 
+// GetSiblingKey returns a key for another component within the same service instance
+func (cik *ComponentInstanceKey) GetSiblingKey(componentName string) *ComponentInstanceKey {
+	siblingCik := cik.MakeCopy()
+	siblingCik.ComponentName = componentName
+	siblingCik.Shard = ""
+	return siblingCik
+}
+
 // GetKey returns a string key
 func (cik ComponentInstanceKey) GetKey() string {
 	if cik.key == "" {
-		cik.key = strings.Join(
-			[]string{
-				cik.ClusterName,
-				cik.Namespace,
-				cik.ContractName,
-				cik.ContextNameWithKeys,
-				cik.ComponentName,
-			}, componentInstanceKeySeparator)
+		parts := []string{
+			cik.ClusterName,
+			cik.Namespace,
+			cik.ContractName,
+			cik.ContextNameWithKeys,
+			cik.ComponentName,
+		}
+		if len(cik.Shard) > 0 {
+			parts = append(parts, cik.Shard)
+		}
+		cik.key = strings.Join(parts, componentInstanceKeySeparator)
 	}
 	return cik.key
 }
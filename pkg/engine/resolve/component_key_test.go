@@ -42,6 +42,25 @@ func TestComponentKeyParent(t *testing.T) {
 	}
 }
 
+func TestComponentKeyShard(t *testing.T) {
+	key := makeKey(false)
+	shard0 := key.WithShard(0)
+	shard1 := key.WithShard(1)
+	assert.Equal(t, key.GetKey()+componentInstanceKeySeparator+"0", shard0.GetKey(), "Shard key should have shard index appended")
+	assert.NotEqual(t, shard0.GetKey(), shard1.GetKey(), "Different shards should have different keys")
+	assert.NotEqual(t, shard0.GetDeployName(), shard1.GetDeployName(), "Different shards should have different deploy names")
+	assert.Equal(t, shard0.GetKey(), shard0.MakeCopy().GetKey(), "Shard key should be copied successfully")
+	assert.Equal(t, key.GetParentServiceKey().GetKey(), shard1.GetParentServiceKey().GetKey(), "Shards should have the same parent service key")
+}
+
+func TestComponentKeySibling(t *testing.T) {
+	key := makeKey(false)
+	sibling := key.WithShard(1).GetSiblingKey("sibling")
+	assert.Equal(t, "sibling", sibling.ComponentName, "Sibling key should point to another component")
+	assert.Empty(t, sibling.Shard, "Sibling key should not point to a shard")
+	assert.Equal(t, key.GetParentServiceKey().GetKey(), sibling.GetParentServiceKey().GetKey(), "Sibling key should have the same parent service key")
+}
+
 func TestComponentKeyUnsafe(t *testing.T) {
 	key := makeKeyUnsafe()
 	k := strings.Split(key.GetKey(), componentInstanceKeySeparator)
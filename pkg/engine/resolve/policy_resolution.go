@@ -39,6 +39,22 @@ func NewPolicyResolution(isDesired bool) *PolicyResolution {
 	}
 }
 
+// makeCopy returns a deep copy of PolicyResolution, so it can be modified without affecting the original
+func (resolution *PolicyResolution) makeCopy() *PolicyResolution {
+	result := NewPolicyResolution(resolution.isDesired)
+	for key, instance := range resolution.ComponentInstanceMap {
+		result.ComponentInstanceMap[key] = instance.makeCopy()
+	}
+	for dependencyID, serviceKey := range resolution.dependencyInstanceMap {
+		result.dependencyInstanceMap[dependencyID] = serviceKey
+	}
+	for key, has := range resolution.componentProcessingOrderHas {
+		result.componentProcessingOrderHas[key] = has
+	}
+	result.componentProcessingOrder = append(result.componentProcessingOrder, resolution.componentProcessingOrder...)
+	return result
+}
+
 // GetComponentInstanceEntry retrieves a component instance entry by key, or creates an new entry if it doesn't exist
 func (resolution *PolicyResolution) GetComponentInstanceEntry(cik *ComponentInstanceKey) *ComponentInstance {
 	key := cik.GetKey()
@@ -65,9 +81,51 @@ func (resolution *PolicyResolution) recordProcessingOrder(cik *ComponentInstance
 	}
 }
 
-// RecordCodeParams stores calculated code params for component instance
-func (resolution *PolicyResolution) RecordCodeParams(cik *ComponentInstanceKey, codeParams util.NestedParameterMap) error {
-	return resolution.GetComponentInstanceEntry(cik).addCodeParams(codeParams)
+// RecordHookParams stores code params calculated for a hook of component instance
+func (resolution *PolicyResolution) RecordHookParams(cik *ComponentInstanceKey, hookName string, hookParams util.NestedParameterMap) error {
+	return resolution.GetComponentInstanceEntry(cik).addHookParams(hookName, hookParams)
+}
+
+// RecordDeployVersion stores version of the current deployment of component instance, as recorded during the last apply
+func (resolution *PolicyResolution) RecordDeployVersion(cik *ComponentInstanceKey, version int) {
+	instance := resolution.GetComponentInstanceEntry(cik)
+	if version > instance.DeployVersion {
+		instance.DeployVersion = version
+	}
+}
+
+// RecordReadinessProbe stores URL or address calculated for checking readiness of component instance
+func (resolution *PolicyResolution) RecordReadinessProbe(cik *ComponentInstanceKey, probe string) error {
+	return resolution.GetComponentInstanceEntry(cik).addReadinessProbe(probe)
+}
+
+// RecordNextReadinessProbe stores URL or address calculated for checking readiness of the next deployment of component
+// instance, which gets updated via blue/green strategy
+func (resolution *PolicyResolution) RecordNextReadinessProbe(cik *ComponentInstanceKey, probe string) error {
+	return resolution.GetComponentInstanceEntry(cik).addNextReadinessProbe(probe)
+}
+
+// RecordCodeParams stores code params calculated for component instance by a given dependency. If code params have
+// been calculated by another dependency already, they get merged according to a given set of merge strategies
+func (resolution *PolicyResolution) RecordCodeParams(cik *ComponentInstanceKey, dependency *lang.Dependency, codeParams util.NestedParameterMap, merge map[string]string) error {
+	return resolution.GetComponentInstanceEntry(cik).addCodeParams(codeParams, merge, getCodeParamsSources(dependency, codeParams, merge))
+}
+
+// RecordNextCodeParams stores code params calculated by a given dependency for the next deployment of component
+// instance, which gets updated via blue/green strategy. They get merged the same way as code params
+func (resolution *PolicyResolution) RecordNextCodeParams(cik *ComponentInstanceKey, dependency *lang.Dependency, codeParams util.NestedParameterMap, merge map[string]string) error {
+	return resolution.GetComponentInstanceEntry(cik).addNextCodeParams(codeParams, merge, getCodeParamsSources(dependency, codeParams, merge))
+}
+
+// getCodeParamsSources returns code params with merge strategies, which have been contributed by a given dependency
+func getCodeParamsSources(dependency *lang.Dependency, codeParams util.NestedParameterMap, merge map[string]string) map[string][]string {
+	sources := make(map[string][]string)
+	for path := range merge {
+		if hasCodeParam(codeParams, path) {
+			sources[path] = []string{runtime.KeyForStorable(dependency)}
+		}
+	}
+	return sources
 }
 
 // RecordDiscoveryParams stores calculated discovery params for component instance
@@ -75,6 +133,16 @@ func (resolution *PolicyResolution) RecordDiscoveryParams(cik *ComponentInstance
 	return resolution.GetComponentInstanceEntry(cik).addDiscoveryParams(discoveryParams)
 }
 
+// RecordOutputs stores outputs for component instance, which were produced by the code plugin during the last apply,
+// and whether some of them are still pending
+func (resolution *PolicyResolution) RecordOutputs(cik *ComponentInstanceKey, outputs map[string]string, pending bool) {
+	instance := resolution.GetComponentInstanceEntry(cik)
+	instance.addOutputs(outputs)
+	if pending {
+		instance.OutputsPending = true
+	}
+}
+
 // RecordLabels stores calculated labels for component instance
 func (resolution *PolicyResolution) RecordLabels(cik *ComponentInstanceKey, labels *lang.LabelSet) {
 	resolution.GetComponentInstanceEntry(cik).addLabels(labels)
@@ -97,7 +165,13 @@ func (resolution *PolicyResolution) AppendData(ops *PolicyResolution) error {
 			return err
 		}
 	}
-	for key := range ops.ComponentInstanceMap {
+	// preserve processing order, so components still get processed after the components they depend on
+	for _, key := range ops.componentProcessingOrder {
+		if instance, ok := ops.ComponentInstanceMap[key]; ok {
+			resolution.recordProcessingOrder(instance.Metadata.Key)
+		}
+	}
+	for _, key := range util.GetSortedStringKeys(ops.ComponentInstanceMap) {
 		resolution.recordProcessingOrder(ops.ComponentInstanceMap[key].Metadata.Key)
 	}
 	return nil
@@ -181,5 +255,67 @@ func (resolution *PolicyResolution) Validate(policy *lang.Policy) error {
 			return fmt.Errorf("cluster '%s/%s' can only be deleted after it's no longer in use. still used by: %s", componentKey.Namespace, componentKey.ClusterName, componentKey.GetKey())
 		}
 	}
+
+	// placement constraints only have to hold for desired state, as actual state reflects what's currently running
+	if resolution.isDesired {
+		return resolution.validateAffinity(policy)
+	}
+	return nil
+}
+
+// validateAffinity verifies that component instances satisfy affinity and anti-affinity constraints defined in the
+// policy
+func (resolution *PolicyResolution) validateAffinity(policy *lang.Policy) error {
+	// context -> cluster -> service instance key, to detect service instances with different allocation keys in the
+	// same cluster
+	antiAffinityMap := make(map[string]map[string]*ComponentInstanceKey)
+
+	// iterate over sorted keys, so that reported errors are deterministic
+	for _, key := range util.GetSortedStringKeys(resolution.ComponentInstanceMap) {
+		instance := resolution.ComponentInstanceMap[key]
+		componentKey := instance.Metadata.Key
+
+		if componentKey.IsService() {
+			// verify that service instances allocated for different keys within the same context are in different clusters
+			contractObj, err := policy.GetObject(lang.ContractObject.Kind, componentKey.ContractName, componentKey.Namespace)
+			if contractObj == nil || err != nil {
+				continue
+			}
+			for _, context := range contractObj.(*lang.Contract).Contexts {
+				if context.Name != componentKey.ContextName || !context.AntiAffinity {
+					continue
+				}
+				contextKey := getContextKey(componentKey)
+				if antiAffinityMap[contextKey] == nil {
+					antiAffinityMap[contextKey] = make(map[string]*ComponentInstanceKey)
+				}
+				if existingKey, found := antiAffinityMap[contextKey][componentKey.ClusterName]; found && existingKey.KeysResolved != componentKey.KeysResolved {
+					return fmt.Errorf("anti-affinity violated for context '%s/%s/%s': service instances '%s' and '%s' are both placed into cluster '%s'", componentKey.Namespace, componentKey.ContractName, componentKey.ContextName, existingKey.GetKey(), componentKey.GetKey(), componentKey.ClusterName)
+				}
+				antiAffinityMap[contextKey][componentKey.ClusterName] = componentKey
+			}
+			continue
+		}
+
+		// verify that consumed service instances are in the same cluster as the consumer, if service affinity requires so
+		serviceObj, err := policy.GetObject(lang.ServiceObject.Kind, componentKey.ServiceName, componentKey.Namespace)
+		if serviceObj == nil || err != nil {
+			continue
+		}
+		service := serviceObj.(*lang.Service)
+		component := service.GetComponentsMap()[componentKey.ComponentName]
+		if component == nil || !service.Affinity.RequiresSameCluster(component.Contract) {
+			continue
+		}
+		for _, dstKey := range util.GetSortedStringKeys(instance.EdgesOut) {
+			dstInstance := resolution.ComponentInstanceMap[dstKey]
+			if dstInstance == nil {
+				continue
+			}
+			if dstInstance.Metadata.Key.ClusterName != componentKey.ClusterName {
+				return fmt.Errorf("affinity violated for service '%s/%s': component instance '%s' and service instance '%s' are placed into different clusters", componentKey.Namespace, componentKey.ServiceName, componentKey.GetKey(), dstKey)
+			}
+		}
+	}
 	return nil
 }
@@ -11,7 +11,10 @@ import (
 	"github.com/Aptomi/aptomi/pkg/util"
 	sysruntime "runtime"
 	"runtime/debug"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
 // MaxConcurrentGoRoutines is the number of concurrently running goroutines for policy evaluation and processing.
@@ -32,6 +35,9 @@ type PolicyResolver struct {
 	// External data
 	externalData *external.Data
 
+	// Actual state (optional), used to expose outputs of already deployed component instances
+	actualState *PolicyResolution
+
 	/*
 		Cache
 	*/
@@ -46,23 +52,29 @@ type PolicyResolver struct {
 		Calculated objects (aggregated over all dependencies)
 	*/
 
-	combineMutex sync.Mutex
-
 	// Reference to the calculated PolicyResolution
 	resolution *PolicyResolution
 
+	// Clusters occupied by service instances of contexts with anti-affinity: context key -> cluster -> service instance
+	// key. It gets populated while results are combined, and dependencies which have to be resolved again due to
+	// anti-affinity are placed into the remaining clusters
+	antiAffinity map[string]map[string]*ComponentInstanceKey
+
 	// Buffered event log - gets populated during policy resolution
 	eventLog *event.Log
 }
 
-// NewPolicyResolver creates a new policy resolver
-func NewPolicyResolver(policy *lang.Policy, externalData *external.Data, eventLog *event.Log) *PolicyResolver {
+// NewPolicyResolver creates a new policy resolver. Actual state is optional and can be nil. If it's given, outputs of
+// already deployed component instances will be available to dependent components
+func NewPolicyResolver(policy *lang.Policy, externalData *external.Data, actualState *PolicyResolution, eventLog *event.Log) *PolicyResolver {
 	return &PolicyResolver{
 		policy:          policy,
 		externalData:    externalData,
+		actualState:     actualState,
 		expressionCache: expression.NewCache(),
 		templateCache:   template.NewCache(),
 		resolution:      NewPolicyResolution(true),
+		antiAffinity:    make(map[string]map[string]*ComponentInstanceKey),
 		eventLog:        eventLog,
 	}
 }
@@ -79,32 +91,63 @@ func (resolver *PolicyResolver) ResolveAllDependencies() (*PolicyResolution, err
 		return nil, err
 	}
 
+	// Resolve every declared dependency and combine results together
+	dependencies := make([]*lang.Dependency, 0)
+	for _, d := range resolver.policy.GetObjectsByKind(lang.DependencyObject.Kind) {
+		dependencies = append(dependencies, d.(*lang.Dependency))
+	}
+	sortDependencies(dependencies)
+	return resolver.combineResults(resolver.resolveDependencies(dependencies))
+}
+
+// Resolves given dependencies concurrently and returns resolution results for every one of them
+func (resolver *PolicyResolver) resolveDependencies(dependencies []*lang.Dependency) []*dependencyResult {
 	// Allocate semaphore
 	var semaphore = make(chan int, MaxConcurrentGoRoutines)
-	dependencies := resolver.policy.GetObjectsByKind(lang.DependencyObject.Kind)
-	var errs = make(chan error, len(dependencies))
+	var results = make([]*dependencyResult, len(dependencies))
+	var wg sync.WaitGroup
 
 	// Run every declared dependency via policy and resolve it
-	for _, d := range dependencies {
+	for idx, d := range dependencies {
 		// resolve dependency via applying policy
 		semaphore <- 1
-		go func(d *lang.Dependency) {
+		wg.Add(1)
+		go func(idx int, d *lang.Dependency) {
+			defer wg.Done()
 			node, resolveErr := resolver.resolveDependency(d)
-			errs <- resolver.combineData(node, resolveErr)
+			results[idx] = newDependencyResult(d, node, resolveErr)
 			<-semaphore
-		}(d.(*lang.Dependency))
+		}(idx, d)
 	}
 
+	// Wait for all go routines to end
+	wg.Wait()
+
+	return results
+}
+
+// Combines resolution results for all dependencies into PolicyResolution
+func (resolver *PolicyResolver) combineResults(results []*dependencyResult) (*PolicyResolution, error) {
 	errMsg := ""
 
-	// Wait for all go routines to end
 	errFound := 0
-	for i := 0; i < len(dependencies); i++ {
-		resolveErr := <-errs
+	for idx, result := range results {
+		// dependency gets resolved again, if its service instances ended up in clusters which are already occupied
+		// by instances allocated for other keys of the same context with anti-affinity
+		if resolver.violatesAntiAffinity(result) {
+			node, resolveErr := resolver.resolveDependency(result.dependency)
+			results[idx] = newDependencyResult(result.dependency, node, resolveErr)
+			results[idx].constrained = true
+			result = results[idx]
+		}
+
+		resolveErr := resolver.combineData(result)
 		if resolveErr != nil {
 			errFound++
 			errMsg += "\n - " + resolveErr.Error()
+			continue
 		}
+		resolver.recordAntiAffinity(result)
 	}
 
 	// See if there were any errors
@@ -112,6 +155,13 @@ func (resolver *PolicyResolver) ResolveAllDependencies() (*PolicyResolution, err
 		return nil, fmt.Errorf("%d errors occurred during policy resolution: %s", errFound, errMsg)
 	}
 
+	// Find out which parameters contain generated secrets, so they don't get logged
+	errSecrets := resolver.findGeneratedSecrets()
+	if errSecrets != nil {
+		resolver.eventLog.LogError(errSecrets)
+		return nil, errSecrets
+	}
+
 	// Once all components are resolved, print information about them into event log
 	for _, instance := range resolver.resolution.ComponentInstanceMap {
 		if instance.Metadata.Key.IsComponent() {
@@ -123,12 +173,55 @@ func (resolver *PolicyResolver) ResolveAllDependencies() (*PolicyResolution, err
 	// Validate resolution, just in case
 	errValidate := resolver.resolution.Validate(resolver.policy)
 	if errValidate != nil {
+		resolver.eventLog.LogError(errValidate)
 		return nil, errValidate
 	}
 
 	return resolver.resolution, nil
 }
 
+// Finds code and discovery parameters, which contain secrets generated for component instances. Secrets of all
+// instances are checked for every instance, as they could have been passed between instances via discovery
+func (resolver *PolicyResolver) findGeneratedSecrets() error {
+	store := resolver.externalData.GeneratedSecretStore
+	if store == nil {
+		return nil
+	}
+
+	values := make(map[string]bool)
+	for key, instance := range resolver.resolution.ComponentInstanceMap {
+		if !instance.Metadata.Key.IsComponent() {
+			continue
+		}
+		instanceSecrets, err := store.LoadByInstance(key)
+		if err != nil {
+			return fmt.Errorf("error while loading generated secrets: %s", err)
+		}
+		for _, value := range instanceSecrets {
+			if len(value) > 0 {
+				values[value] = true
+			}
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	containsSecret := func(str string) bool {
+		for value := range values {
+			if strings.Contains(str, value) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, instance := range resolver.resolution.ComponentInstanceMap {
+		instance.SecretCodeParams = instance.CalculatedCodeParams.FindStringPaths(containsSecret)
+		instance.SecretDiscoveryParams = instance.CalculatedDiscovery.FindStringPaths(containsSecret)
+	}
+	return nil
+}
+
 // Resolves a single dependency
 func (resolver *PolicyResolver) resolveDependency(d *lang.Dependency) (node *resolutionNode, resolveErr error) {
 	// create new resolution node
@@ -150,43 +243,96 @@ func (resolver *PolicyResolver) resolveDependency(d *lang.Dependency) (node *res
 	return node, resolveErr
 }
 
-// Combines resolution data into the overall state of the world
-func (resolver *PolicyResolver) combineData(node *resolutionNode, resolutionErr error) error {
-	// put a lock
-	resolver.combineMutex.Lock()
+// Returns true if service instances of a successfully resolved dependency are placed into clusters, which are already
+// occupied by instances allocated for other keys of the same context with anti-affinity
+func (resolver *PolicyResolver) violatesAntiAffinity(result *dependencyResult) bool {
+	if result.err != nil || !result.resolved {
+		return false
+	}
+	for _, instance := range result.resolution.ComponentInstanceMap {
+		key := instance.Metadata.Key
+		if !key.IsService() || !resolver.hasAntiAffinity(key) {
+			continue
+		}
+		if existing, found := resolver.antiAffinity[getContextKey(key)][key.ClusterName]; found && existing.KeysResolved != key.KeysResolved {
+			return true
+		}
+	}
+	return false
+}
+
+// Records clusters occupied by service instances of a successfully resolved dependency, which belong to contexts
+// with anti-affinity
+func (resolver *PolicyResolver) recordAntiAffinity(result *dependencyResult) {
+	if !result.resolved {
+		return
+	}
+	for _, instance := range result.resolution.ComponentInstanceMap {
+		key := instance.Metadata.Key
+		if !key.IsService() || !resolver.hasAntiAffinity(key) {
+			continue
+		}
+		contextKey := getContextKey(key)
+		if resolver.antiAffinity[contextKey] == nil {
+			resolver.antiAffinity[contextKey] = make(map[string]*ComponentInstanceKey)
+		}
+		resolver.antiAffinity[contextKey][key.ClusterName] = key
+	}
+}
 
-	// aggregate logs in the end, especially if resolutionErr occurred
+// Returns true if a given service instance is allocated by the context with anti-affinity
+func (resolver *PolicyResolver) hasAntiAffinity(key *ComponentInstanceKey) bool {
+	contractObj, err := resolver.policy.GetObject(lang.ContractObject.Kind, key.ContractName, key.Namespace)
+	if contractObj == nil || err != nil {
+		return false
+	}
+	for _, context := range contractObj.(*lang.Contract).Contexts {
+		if context.Name == key.ContextName {
+			return context.AntiAffinity
+		}
+	}
+	return false
+}
+
+// Returns key of the context (namespace/contract/context), which allocated a given component instance
+func getContextKey(key *ComponentInstanceKey) string {
+	return runtime.KeyFromParts(key.Namespace, key.ContractName, key.ContextName)
+}
+
+// Sorts dependencies by their keys, so results get combined in the same order and placement of service instances
+// with anti-affinity is deterministic
+func sortDependencies(dependencies []*lang.Dependency) {
+	sort.Slice(dependencies, func(i, j int) bool {
+		return runtime.KeyForStorable(dependencies[i]) < runtime.KeyForStorable(dependencies[j])
+	})
+}
+
+// Combines resolution data for a single dependency into the overall state of the world
+func (resolver *PolicyResolver) combineData(result *dependencyResult) error {
+	// aggregate logs in the end, especially if resolution error occurred
 	defer func() {
-		if node != nil {
-			for _, eventLog := range node.eventLogsCombined {
-				resolver.eventLog.Append(eventLog)
-			}
+		for _, eventLog := range result.eventLogs {
+			resolver.eventLog.Append(eventLog)
 		}
-		resolver.combineMutex.Unlock()
 	}()
 
 	// if there was a resolution error, return it
-	if resolutionErr != nil {
-		return resolutionErr
-	}
-
-	// if node is nil (likely, panic happened), return
-	if node == nil {
-		return resolutionErr
+	if result.err != nil {
+		return result.err
 	}
 
 	// exit if dependency has not been fulfilled. otherwise, proceed to data aggregation
-	if !node.resolved || node.serviceKey == nil {
+	if !result.resolved {
 		return nil
 	}
 
 	// add a record for dependency resolution
-	resolver.resolution.dependencyInstanceMap[runtime.KeyForStorable(node.dependency)] = node.serviceKey.GetKey()
+	resolver.resolution.dependencyInstanceMap[runtime.KeyForStorable(result.dependency)] = result.serviceKey
 
 	// append component instance data
-	err := resolver.resolution.AppendData(node.resolution)
+	err := resolver.resolution.AppendData(result.resolution)
 	if err != nil {
-		node.eventLog.LogError(err)
+		result.eventLogs[0].LogError(err)
 		return err
 	}
 
@@ -205,6 +351,12 @@ func (resolver *PolicyResolver) resolveNode(node *resolutionNode) error {
 	node.objectResolved(node.dependency)
 	node.logStartResolvingDependency()
 
+	// Suspended dependency is not resolved, so its instances get detached from it
+	if node.depth == 0 && node.dependency.IsSuspended(time.Now()) {
+		node.logDependencySuspended()
+		return nil
+	}
+
 	// Locate the user
 	err = node.checkUserExists()
 	if err != nil {
@@ -254,11 +406,21 @@ func (resolver *PolicyResolver) resolveNode(node *resolutionNode) error {
 	}
 
 	// Process global rules before processing service key and dependent component keys
+	labelsBeforeRules := lang.NewLabelSet(node.labels.Labels)
 	ruleResult, err := node.processRules()
 	if err != nil {
 		// Return an error in case of rule processing error
 		return node.cannotResolveInstance(err)
 	}
+
+	// Select cluster, which satisfies placement constraints of the service instance. If it's not the cluster chosen
+	// by rules, rules get processed again for the selected cluster
+	ruleResult, err = node.selectCluster(labelsBeforeRules, ruleResult)
+	if err != nil {
+		// Return an error, if there is no such cluster
+		return node.cannotResolveInstance(err)
+	}
+
 	// Create service key
 	node.serviceKey, err = node.createComponentKey(nil)
 	if err != nil {
@@ -303,61 +465,44 @@ func (resolver *PolicyResolver) resolveNode(node *resolutionNode) error {
 			continue
 		}
 
-		// Create key
-		node.componentKey, err = node.createComponentKey(node.component)
+		// Evaluate how many instances of the component have to be created
+		count, err := node.calculateComponentCount()
 		if err != nil {
-			// Return an error in case of malformed policy or policy processing error
 			return node.cannotResolveInstance(err)
 		}
 
-		// Store edge (service instance -> component instance)
-		node.resolution.StoreEdge(node.serviceKey, node.componentKey)
-
-		// Calculate and store labels for component
-		node.resolution.RecordLabels(node.componentKey, node.labels)
-
-		// Create new map with resolution keys for component
-		node.discoveryTreeNode[node.component.Name] = util.NestedParameterMap{}
-
-		// Calculate and store discovery params
-		err := node.calculateAndStoreDiscoveryParams()
+		// Create key
+		componentKey, err := node.createComponentKey(node.component)
 		if err != nil {
+			// Return an error in case of malformed policy or policy processing error
 			return node.cannotResolveInstance(err)
 		}
 
-		// Print information that we are starting to resolve dependency (on code, or on service)
-		node.logResolvingDependencyOnComponent()
-
-		if node.component.Code != nil {
-			// Evaluate code params
-			err := node.calculateAndStoreCodeParams()
-			if err != nil {
-				return node.cannotResolveInstance(err)
+		if len(node.component.Count) > 0 {
+			// Replicated component gets resolved into a separate component instance for every shard, and announces
+			// all shards in the discovery tree
+			shards := make([]interface{}, count)
+			node.discoveryTreeNode[node.component.Name] = util.NestedParameterMap{
+				"count":  count,
+				"shards": shards,
 			}
-		} else if node.component.Contract != "" {
-			// Create a child node for dependency resolution
-			nodeNext := node.createChildNode()
-
-			// Resolve dependency on another contract recursively
-			err := resolver.resolveNode(nodeNext)
-
-			// Combine event logs
-			node.eventLogsCombined = append(node.eventLogsCombined, nodeNext.eventLogsCombined...)
-
-			if err != nil {
-				return node.cannotResolveInstance(err)
+			for idx := 0; idx < count; idx++ {
+				shards[idx] = util.NestedParameterMap{}
+				node.componentKey, node.shardIndex, node.shardCount = componentKey.WithShard(idx), idx, count
+				resolved, resolveErr := resolver.resolveComponentInstance(node, shards[idx].(util.NestedParameterMap), ruleResult)
+				if !resolved {
+					return node.cannotResolveInstance(resolveErr)
+				}
 			}
-
-			// If a sub-dependency has not been fulfilled, then exit
-			if !nodeNext.resolved {
-				// This is considered a normal scenario (sub-dependency not fulfilled), so no error is returned
-				return node.cannotResolveInstance(nil)
+		} else {
+			// Create new map with resolution keys for component
+			node.discoveryTreeNode[node.component.Name] = util.NestedParameterMap{}
+			node.componentKey, node.shardIndex, node.shardCount = componentKey, 0, 1
+			resolved, resolveErr := resolver.resolveComponentInstance(node, node.discoveryTreeNode.GetNestedMap(node.component.Name), ruleResult)
+			if !resolved {
+				return node.cannotResolveInstance(resolveErr)
 			}
 		}
-
-		// Record usage of a given component instance
-		node.logInstanceSuccessfullyResolved(node.componentKey)
-		node.resolution.RecordResolved(node.componentKey, node.dependency, ruleResult)
 	}
 
 	// Mark note as resolved and record usage of a given service instance
@@ -367,3 +512,56 @@ func (resolver *PolicyResolver) resolveNode(node *resolutionNode) error {
 
 	return nil
 }
+
+// resolveComponentInstance resolves the current component instance of a node, announcing its discovery properties
+// in a given node of the discovery tree. It returns true if the instance has been resolved. Otherwise it returns false
+// and an error, if there was an error (dependency on another contract may not be fulfilled, which is not an error)
+func (resolver *PolicyResolver) resolveComponentInstance(node *resolutionNode, discovery util.NestedParameterMap, ruleResult *lang.RuleActionResult) (bool, error) {
+	// Store edge (service instance -> component instance)
+	node.resolution.StoreEdge(node.serviceKey, node.componentKey)
+
+	// Calculate and store labels for component
+	node.resolution.RecordLabels(node.componentKey, node.labels)
+
+	// Calculate and store discovery params
+	err := node.calculateAndStoreDiscoveryParams(discovery)
+	if err != nil {
+		return false, err
+	}
+
+	// Print information that we are starting to resolve dependency (on code, or on service)
+	node.logResolvingDependencyOnComponent()
+
+	if node.component.Code != nil {
+		// Evaluate code params
+		err := node.calculateAndStoreCodeParams()
+		if err != nil {
+			return false, err
+		}
+	} else if node.component.Contract != "" {
+		// Create a child node for dependency resolution
+		nodeNext := node.createChildNode()
+
+		// Resolve dependency on another contract recursively
+		err := resolver.resolveNode(nodeNext)
+
+		// Combine event logs
+		node.eventLogsCombined = append(node.eventLogsCombined, nodeNext.eventLogsCombined...)
+
+		if err != nil {
+			return false, err
+		}
+
+		// If a sub-dependency has not been fulfilled, then exit
+		if !nodeNext.resolved {
+			// This is considered a normal scenario (sub-dependency not fulfilled), so no error is returned
+			return false, nil
+		}
+	}
+
+	// Record usage of a given component instance
+	node.logInstanceSuccessfullyResolved(node.componentKey)
+	node.resolution.RecordResolved(node.componentKey, node.dependency, ruleResult)
+
+	return true, nil
+}
@@ -0,0 +1,374 @@
+package resolve
+
+import (
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/external"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"sync"
+	"time"
+)
+
+// resolutionTrace holds information about policy objects and namespaces, which were used while resolving a dependency.
+// It allows to figure out which dependencies can be affected when policy objects change
+type resolutionTrace struct {
+	// keys of policy objects (contracts, services, clusters) used during resolution
+	objects map[string]bool
+
+	// namespaces, in which rules were processed during resolution
+	namespaces map[string]bool
+
+	// whether cluster had to be selected among all clusters to satisfy placement constraints, so adding, removing or
+	// changing any cluster can affect resolution
+	clusters bool
+}
+
+// Creates a new empty resolution trace
+func newResolutionTrace() *resolutionTrace {
+	return &resolutionTrace{
+		objects:    make(map[string]bool),
+		namespaces: make(map[string]bool),
+	}
+}
+
+func (trace *resolutionTrace) addObject(obj lang.Base) {
+	trace.objects[runtime.KeyForStorable(obj)] = true
+}
+
+func (trace *resolutionTrace) addNamespace(namespace string) {
+	trace.namespaces[namespace] = true
+}
+
+func (trace *resolutionTrace) addClusters() {
+	trace.clusters = true
+}
+
+// dependencyResult holds resolution results for a single dependency
+type dependencyResult struct {
+	// dependency which was resolved
+	dependency *lang.Dependency
+
+	// resolution error, if any
+	err error
+
+	// whether dependency was successfully resolved and the resulting service key
+	resolved   bool
+	serviceKey string
+
+	// resolution data calculated for the dependency
+	resolution *PolicyResolution
+
+	// combined event logs from all resolution nodes
+	eventLogs []*event.Log
+
+	// whether dependency had to be resolved again to satisfy anti-affinity, so its placement depends on other dependencies
+	constrained bool
+
+	// policy objects and namespaces used during resolution
+	trace *resolutionTrace
+
+	// snapshot of external data and state which dependency was resolved with (only populated by incremental resolver)
+	userFound        bool
+	userLabels       map[string]string
+	secrets          map[string]string
+	suspended        bool
+	generatedSecrets map[string]map[string]string
+}
+
+// Creates a new dependency result out of the resolution node
+func newDependencyResult(dependency *lang.Dependency, node *resolutionNode, err error) *dependencyResult {
+	result := &dependencyResult{
+		dependency: dependency,
+		err:        err,
+		resolved:   node.resolved && node.serviceKey != nil,
+		resolution: node.resolution,
+		eventLogs:  node.eventLogsCombined,
+		trace:      node.trace,
+	}
+	if result.resolved {
+		result.serviceKey = node.serviceKey.GetKey()
+	}
+	return result
+}
+
+// Records external data, which the dependency has been resolved with
+func (result *dependencyResult) recordExternalData(externalData *external.Data, now time.Time) {
+	user := externalData.UserLoader.LoadUserByName(result.dependency.User)
+	result.userFound = user != nil
+	result.userLabels = make(map[string]string)
+	if user != nil {
+		for k, v := range user.Labels {
+			result.userLabels[k] = v
+		}
+	}
+	result.secrets = make(map[string]string)
+	for k, v := range externalData.SecretLoader.LoadSecretsByUserName(result.dependency.User) {
+		result.secrets[k] = v
+	}
+	result.suspended = result.dependency.IsSuspended(now)
+	result.generatedSecrets = result.loadGeneratedSecrets(externalData)
+}
+
+// Loads secrets generated for component instances of the dependency (component instance key -> secret name -> value).
+// Nil is returned if they can't be loaded, so the dependency gets resolved again
+func (result *dependencyResult) loadGeneratedSecrets(externalData *external.Data) map[string]map[string]string {
+	generated := make(map[string]map[string]string)
+	if externalData.GeneratedSecretStore == nil {
+		return generated
+	}
+	for key, instance := range result.resolution.ComponentInstanceMap {
+		if !instance.Metadata.Key.IsComponent() {
+			continue
+		}
+		secrets, err := externalData.GeneratedSecretStore.LoadByInstance(key)
+		if err != nil {
+			return nil
+		}
+		if len(secrets) > 0 {
+			generated[key] = secrets
+		}
+	}
+	return generated
+}
+
+// Returns true if external data or actual state changed since the dependency has been resolved, so it has to be
+// resolved again even if none of the policy objects it depends on have changed
+func (result *dependencyResult) isOutdated(externalData *external.Data, actualState *PolicyResolution, now time.Time) bool {
+	if result.suspended != result.dependency.IsSuspended(now) {
+		return true
+	}
+
+	// user labels and secrets
+	user := externalData.UserLoader.LoadUserByName(result.dependency.User)
+	if result.userFound != (user != nil) {
+		return true
+	}
+	if user != nil && !stringMapsEqual(result.userLabels, user.Labels) {
+		return true
+	}
+	if !stringMapsEqual(result.secrets, externalData.SecretLoader.LoadSecretsByUserName(result.dependency.User)) {
+		return true
+	}
+
+	// secrets generated for component instances, which get generated again once deleted
+	if result.generatedSecrets == nil {
+		return true
+	}
+	generated := result.loadGeneratedSecrets(externalData)
+	if generated == nil || len(generated) != len(result.generatedSecrets) {
+		return true
+	}
+	for key, secrets := range generated {
+		if !stringMapsEqual(result.generatedSecrets[key], secrets) {
+			return true
+		}
+	}
+
+	// outputs and deploy versions of deployed component instances
+	for key, instance := range result.resolution.ComponentInstanceMap {
+		var outputs map[string]string
+		var outputsPending bool
+		var deployVersion int
+		if actualState != nil {
+			if actualInstance, ok := actualState.ComponentInstanceMap[key]; ok {
+				outputs = actualInstance.Outputs
+				outputsPending = actualInstance.OutputsPending
+				deployVersion = actualInstance.DeployVersion
+			}
+		}
+		if !stringMapsEqual(instance.Outputs, outputs) || instance.OutputsPending != outputsPending || instance.DeployVersion != deployVersion {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IncrementalPolicyResolver resolves policy incrementally over multiple runs. It keeps resolution results for every
+// dependency from the previous run, uses generations of policy objects to find out which objects have changed
+// since then, and re-resolves only those dependencies which can be affected by the changes. Results for all
+// dependencies then get combined into PolicyResolution, the same way as it's done by a full policy resolution.
+//
+// When resolution fails, previous results are discarded and the next run will resolve all dependencies.
+type IncrementalPolicyResolver struct {
+	mutex sync.Mutex
+
+	// Generations of policy objects from the previous run: namespace -> kind -> name -> generation
+	objects map[string]map[string]map[string]runtime.Generation
+
+	// Resolution results from the previous run: dependency key -> result
+	results map[string]*dependencyResult
+}
+
+// NewIncrementalPolicyResolver creates a new incremental policy resolver with no previous results
+func NewIncrementalPolicyResolver() *IncrementalPolicyResolver {
+	return &IncrementalPolicyResolver{}
+}
+
+// ResolveAllDependencies calculates PolicyResolution (desired state) for a given policy. Objects is a map with
+// generations of all objects in the policy (namespace -> kind -> name -> generation), as recorded in PolicyData.
+// Actual state is optional and can be nil, see NewPolicyResolver for details
+func (incremental *IncrementalPolicyResolver) ResolveAllDependencies(policy *lang.Policy, objects map[string]map[string]map[string]runtime.Generation, externalData *external.Data, actualState *PolicyResolution, eventLog *event.Log) (*PolicyResolution, error) {
+	incremental.mutex.Lock()
+	defer incremental.mutex.Unlock()
+
+	resolver := NewPolicyResolver(policy, externalData, actualState, eventLog)
+
+	// Run policy validation before resolution, just in case
+	err := policy.Validate()
+	if err != nil {
+		incremental.reset()
+		return nil, err
+	}
+
+	// Figure out which dependencies have to be resolved again and which results can be reused
+	now := time.Now()
+	affected, affectedAll := incremental.getAffectedDependencies(objects)
+	dependencies := make([]*lang.Dependency, 0)
+	for _, d := range policy.GetObjectsByKind(lang.DependencyObject.Kind) {
+		dependencies = append(dependencies, d.(*lang.Dependency))
+	}
+	sortDependencies(dependencies)
+	results := make([]*dependencyResult, len(dependencies))
+	resolveList := make([]*lang.Dependency, 0)
+	resolveIdx := make([]int, 0)
+	reused := make(map[*dependencyResult]bool)
+	for idx, d := range dependencies {
+		key := runtime.KeyForStorable(d)
+		prev, found := incremental.results[key]
+		if !found || affectedAll || affected[key] || prev.constrained || prev.isOutdated(externalData, actualState, now) {
+			resolveList = append(resolveList, d)
+			resolveIdx = append(resolveIdx, idx)
+		} else {
+			results[idx] = prev
+			reused[prev] = true
+		}
+	}
+
+	// Resolve dependencies, which have to be resolved again. Results are combined in the same order as they are by
+	// full resolution, as merged code params and placement of instances with anti-affinity depend on it
+	for idx, result := range resolver.resolveDependencies(resolveList) {
+		results[resolveIdx[idx]] = result
+	}
+
+	eventLog.WithFields(event.Fields{}).Infof("Resolving %d out of %d dependencies, reusing results for the rest", len(resolveList), len(dependencies))
+
+	// Combine results for all dependencies
+	resolution, err := resolver.combineResults(results)
+	if err != nil {
+		incremental.reset()
+		return nil, err
+	}
+
+	// Remember results for the next run. Results can be replaced while combining them, so external data gets
+	// recorded only after that
+	incremental.objects = copyObjectGenerations(objects)
+	incremental.results = make(map[string]*dependencyResult)
+	for _, result := range results {
+		if !reused[result] {
+			result.recordExternalData(externalData, now)
+		}
+		incremental.results[runtime.KeyForStorable(result.dependency)] = result
+	}
+
+	return resolution, nil
+}
+
+// Discards results from the previous run, so the next run will resolve all dependencies
+func (incremental *IncrementalPolicyResolver) reset() {
+	incremental.objects = nil
+	incremental.results = nil
+}
+
+// Returns keys of dependencies, which can be affected by changes in the policy since the previous run. If all
+// dependencies have to be resolved again, true is returned as the second value
+func (incremental *IncrementalPolicyResolver) getAffectedDependencies(objects map[string]map[string]map[string]runtime.Generation) (map[string]bool, bool) {
+	if incremental.objects == nil || incremental.results == nil {
+		return nil, true
+	}
+
+	affected := make(map[string]bool)
+	affectedAll := false
+	forEachChangedObject(incremental.objects, objects, func(ns, kind, name string) {
+		key := runtime.KeyFromParts(ns, kind, name)
+		switch {
+		case kind == lang.DependencyObject.Kind:
+			// dependency itself has changed
+			affected[key] = true
+		case ns == runtime.SystemNS && kind != lang.ClusterObject.Kind:
+			// global rules and ACL rules are processed for every dependency
+			affectedAll = true
+		case kind == lang.RuleObject.Kind:
+			// rules are processed for every dependency which went through their namespace
+			for depKey, result := range incremental.results {
+				if result.trace.namespaces[ns] {
+					affected[depKey] = true
+				}
+			}
+		case kind == lang.ClusterObject.Kind:
+			// clusters affect dependencies which used them, as well as dependencies which had placement constraints
+			for depKey, result := range incremental.results {
+				if result.trace.objects[key] || result.trace.clusters {
+					affected[depKey] = true
+				}
+			}
+		default:
+			// contracts and services only affect dependencies which used them
+			for depKey, result := range incremental.results {
+				if result.trace.objects[key] {
+					affected[depKey] = true
+				}
+			}
+		}
+	})
+
+	return affected, affectedAll
+}
+
+// Calls a given function for every object, which was added, removed or changed its generation
+func forEachChangedObject(prev, curr map[string]map[string]map[string]runtime.Generation, f func(ns, kind, name string)) {
+	for ns, kindNameGen := range curr {
+		for kind, nameGen := range kindNameGen {
+			for name, gen := range nameGen {
+				if prevGen, ok := prev[ns][kind][name]; !ok || prevGen != gen {
+					f(ns, kind, name)
+				}
+			}
+		}
+	}
+	for ns, kindNameGen := range prev {
+		for kind, nameGen := range kindNameGen {
+			for name := range nameGen {
+				if _, ok := curr[ns][kind][name]; !ok {
+					f(ns, kind, name)
+				}
+			}
+		}
+	}
+}
+
+func copyObjectGenerations(objects map[string]map[string]map[string]runtime.Generation) map[string]map[string]map[string]runtime.Generation {
+	result := make(map[string]map[string]map[string]runtime.Generation)
+	for ns, kindNameGen := range objects {
+		result[ns] = make(map[string]map[string]runtime.Generation)
+		for kind, nameGen := range kindNameGen {
+			result[ns][kind] = make(map[string]runtime.Generation)
+			for name, gen := range nameGen {
+				result[ns][kind][name] = gen
+			}
+		}
+	}
+	return result
+}
+
+func stringMapsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,383 @@
+package resolve
+
+import (
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/lang/builder"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestIncrementalPolicyResolverMatchesFullResolution(t *testing.T) {
+	for _, withActualState := range []bool{false, true} {
+		for seed := int64(1); seed <= 5; seed++ {
+			gen := newRandomPolicyChanger(seed)
+			if withActualState {
+				gen.actualState = NewPolicyResolution(false)
+			}
+			incremental := NewIncrementalPolicyResolver()
+			for step := 0; step < 40; step++ {
+				if step > 0 {
+					gen.makeRandomChange()
+				}
+
+				policy := gen.b.Policy()
+				externalData := gen.b.External()
+
+				full, errFull := NewPolicyResolver(policy, externalData, gen.actualState, event.NewLog("test-resolve-full", false)).ResolveAllDependencies()
+				result, err := incremental.ResolveAllDependencies(policy, gen.objectGenerations(policy), externalData, gen.actualState, event.NewLog("test-resolve-incremental", false))
+
+				// placement constraints can't always be satisfied (e.g. anti-affinity with clusters removed), then
+				// both resolutions should fail
+				if errFull != nil {
+					if !assert.Error(t, err, "Incremental policy resolution should fail same as full one (seed %d, step %d, last change: %s): %s", seed, step, gen.lastChange, errFull) {
+						t.FailNow()
+					}
+					continue
+				}
+				if !assert.NoError(t, err, "Incremental policy resolution should succeed (seed %d, step %d, last change: %s)", seed, step, gen.lastChange) {
+					t.FailNow()
+				}
+
+				if !assertResolutionsEqual(t, full, result) {
+					t.Fatalf("Incremental resolution doesn't match full resolution (actual state %t, seed %d, step %d, last change: %s)", withActualState, seed, step, gen.lastChange)
+				}
+
+				gen.apply(full)
+			}
+		}
+	}
+}
+
+func TestIncrementalPolicyResolverReusesResults(t *testing.T) {
+	gen := newRandomPolicyChanger(1)
+	incremental := NewIncrementalPolicyResolver()
+
+	// first run resolves all dependencies
+	eventLog := event.NewLog("test-resolve-incremental", false)
+	_, err := incremental.ResolveAllDependencies(gen.b.Policy(), gen.objectGenerations(gen.b.Policy()), gen.b.External(), nil, eventLog)
+	assert.NoError(t, err, "Incremental policy resolution should succeed")
+	verifier := event.NewLogVerifier("Resolving "+strconv.Itoa(len(gen.dependencies))+" out of", false)
+	eventLog.Save(verifier)
+	assert.True(t, verifier.MatchedErrorsCount() > 0, "All dependencies should be resolved on the first run")
+
+	// change a single dependency, only it should be resolved again
+	gen.dependencies[0].Labels["tier"] = "y"
+	gen.bump(gen.dependencies[0])
+
+	eventLog = event.NewLog("test-resolve-incremental", false)
+	_, err = incremental.ResolveAllDependencies(gen.b.Policy(), gen.objectGenerations(gen.b.Policy()), gen.b.External(), nil, eventLog)
+	assert.NoError(t, err, "Incremental policy resolution should succeed")
+	verifier = event.NewLogVerifier("Resolving 1 out of", false)
+	eventLog.Save(verifier)
+	assert.True(t, verifier.MatchedErrorsCount() > 0, "Only changed dependency should be resolved again")
+}
+
+func TestIncrementalPolicyResolverClustersAdded(t *testing.T) {
+	b := builder.NewPolicyBuilder()
+
+	// service with anti-affinity, which gets consumed twice with different allocation keys by the same dependency
+	serviceC := b.AddService()
+	b.AddServiceComponent(serviceC, b.CodeComponent(util.NestedParameterMap{"key": "{{ .Labels.key }}"}, nil))
+	contractC := b.AddContract(serviceC, b.CriteriaTrue())
+	contractC.Contexts[0].Allocation.Keys = []string{"{{ .Labels.key }}"}
+	contractC.Contexts[0].AntiAffinity = true
+
+	serviceA := b.AddService()
+	for _, key := range []string{"1", "2"} {
+		serviceB := b.AddService()
+		b.AddServiceComponent(serviceB, b.ContractComponent(contractC))
+		contractB := b.AddContract(serviceB, b.CriteriaTrue())
+		contractB.Contexts[0].ChangeLabels = lang.NewLabelOperationsSetSingleLabel("key", key)
+		b.AddServiceComponent(serviceA, b.ContractComponent(contractB))
+	}
+	contractA := b.AddContract(serviceA, b.CriteriaTrue())
+
+	// rules put all instances into the first cluster, so one of them gets moved into another cluster
+	cluster := b.AddCluster()
+	b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster.Name)))
+	b.AddDependency(b.AddUser(), contractA)
+
+	// cluster selected for the moved instance depends on which clusters exist, so it changes as clusters get added
+	gen := &randomPolicyChanger{b: b, generations: make(map[string]runtime.Generation)}
+	incremental := NewIncrementalPolicyResolver()
+	for i := 0; i < 10; i++ {
+		full, err := NewPolicyResolver(b.Policy(), b.External(), nil, event.NewLog("test-resolve-full", false)).ResolveAllDependencies()
+		if !assert.NoError(t, err, "Full policy resolution should succeed") {
+			t.FailNow()
+		}
+		result, err := incremental.ResolveAllDependencies(b.Policy(), gen.objectGenerations(b.Policy()), b.External(), nil, event.NewLog("test-resolve-incremental", false))
+		if !assert.NoError(t, err, "Incremental policy resolution should succeed") {
+			t.FailNow()
+		}
+		if !assertResolutionsEqual(t, full, result) {
+			t.Fatalf("Incremental resolution doesn't match full resolution after adding %d clusters", i)
+		}
+		b.AddCluster()
+	}
+}
+
+// randomPolicyChanger generates a random policy and then applies random changes to it, tracking generations of objects
+type randomPolicyChanger struct {
+	random *rand.Rand
+	b      *builder.PolicyBuilder
+
+	generations  map[string]runtime.Generation
+	users        []*lang.User
+	services     []*lang.Service
+	shards       []*lang.ServiceComponent
+	contracts    []*lang.Contract
+	dependencies []*lang.Dependency
+	rule         *lang.Rule
+	lastChange   string
+
+	// clusters, which can be added and removed. Rules never place service instances there, so they are only used
+	// when placement constraints require so
+	clusters []*lang.Cluster
+
+	// the last full resolution, which generated secrets get deleted for
+	resolution *PolicyResolution
+
+	// actual state, which gets updated every time desired state is applied. If it's nil, policy is always
+	// resolved without actual state
+	actualState *PolicyResolution
+}
+
+func newRandomPolicyChanger(seed int64) *randomPolicyChanger {
+	gen := &randomPolicyChanger{
+		random:      rand.New(rand.NewSource(seed)),
+		b:           builder.NewPolicyBuilder(),
+		generations: make(map[string]runtime.Generation),
+	}
+
+	// team 'b' goes to the second cluster, everyone else goes to the first one
+	cluster1 := gen.b.AddCluster()
+	cluster2 := gen.b.AddCluster()
+	gen.b.AddRule(gen.b.CriteriaTrue(), gen.b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster1.Name)))
+	gen.rule = gen.b.AddRule(&lang.Criteria{RequireAll: []string{"team == 'b'"}}, gen.b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster2.Name)))
+	gen.clusters = append(gen.clusters, gen.b.AddCluster())
+
+	// services with code components, some of them depend on other services. The second component of every service
+	// consumes outputs of the first one, the third one is replicated and uses generated secrets. Dependencies sharing
+	// the same instance calculate different replicas, which get merged
+	for i := 0; i < 4; i++ {
+		service := gen.b.AddService()
+		component := gen.b.AddServiceComponent(service, gen.b.CodeComponent(util.NestedParameterMap{"team": "{{ .Labels.team }}", "version": "1", "replicas": "{{ .Labels.replicas }}"}, nil))
+		component.Code.Merge = map[string]string{"replicas": lang.MergeStrategyMax}
+		consumer := gen.b.AddServiceComponent(service, gen.b.CodeComponent(util.NestedParameterMap{"address": "{{ index .Discovery." + component.Name + ".outputs \"address\" }}"}, nil))
+		gen.b.AddComponentDependency(consumer, component)
+		shard := gen.b.AddServiceComponent(service, gen.b.CodeComponent(util.NestedParameterMap{"shard": "{{ .Shard.Index }}-of-{{ .Shard.Count }}", "password": "{{ generatedSecret \"password\" 8 }}"}, nil))
+		shard.Count = "1"
+		contract := gen.b.AddContractMultipleContexts(service, &lang.Criteria{RequireAll: []string{"tier == 'x'"}}, gen.b.CriteriaTrue())
+		contract.Contexts[0].Allocation.Keys = []string{"{{ .Labels.team }}"}
+		gen.services = append(gen.services, service)
+		gen.shards = append(gen.shards, shard)
+		gen.contracts = append(gen.contracts, contract)
+	}
+	gen.b.AddServiceComponent(gen.services[0], gen.b.ContractComponent(gen.contracts[2]))
+	gen.b.AddServiceComponent(gen.services[1], gen.b.ContractComponent(gen.contracts[3]))
+
+	for i := 0; i < 5; i++ {
+		user := gen.b.AddUser()
+		user.Labels["team"] = gen.randomValue("a", "b", "c")
+		gen.users = append(gen.users, user)
+	}
+
+	for i := 0; i < 15; i++ {
+		gen.addDependency()
+	}
+
+	return gen
+}
+
+func (gen *randomPolicyChanger) randomValue(values ...string) string {
+	return values[gen.random.Intn(len(values))]
+}
+
+func (gen *randomPolicyChanger) bump(obj lang.Base) {
+	gen.generations[runtime.KeyForStorable(obj)]++
+}
+
+func (gen *randomPolicyChanger) addDependency() {
+	dependency := gen.b.AddDependency(gen.users[gen.random.Intn(len(gen.users))], gen.contracts[gen.random.Intn(len(gen.contracts))])
+	dependency.Labels["tier"] = gen.randomValue("x", "y")
+	dependency.Labels["replicas"] = strconv.Itoa(1 + gen.random.Intn(3))
+	gen.dependencies = append(gen.dependencies, dependency)
+}
+
+func (gen *randomPolicyChanger) makeRandomChange() {
+	changes := 15
+	if gen.actualState != nil && len(gen.actualState.ComponentInstanceMap) > 0 {
+		// outputs and deploy versions of component instances in actual state can change as well
+		changes = 18
+	}
+	switch gen.random.Intn(changes) {
+	case 0:
+		gen.lastChange = "dependency labels"
+		dependency := gen.dependencies[gen.random.Intn(len(gen.dependencies))]
+		dependency.Labels["tier"] = gen.randomValue("x", "y")
+		dependency.Labels["replicas"] = strconv.Itoa(1 + gen.random.Intn(3))
+		gen.bump(dependency)
+	case 1:
+		gen.lastChange = "dependency added"
+		gen.addDependency()
+	case 2:
+		gen.lastChange = "dependency deleted"
+		idx := gen.random.Intn(len(gen.dependencies))
+		gen.b.Policy().RemoveObject(gen.dependencies[idx])
+		gen.dependencies = append(gen.dependencies[:idx], gen.dependencies[idx+1:]...)
+	case 3:
+		gen.lastChange = "service code params"
+		service := gen.services[gen.random.Intn(len(gen.services))]
+		service.Components[0].Code.Params["version"] = strconv.Itoa(gen.random.Intn(100))
+		gen.bump(service)
+	case 4:
+		gen.lastChange = "rule criteria"
+		gen.rule.Criteria.RequireAll = []string{"team == '" + gen.randomValue("a", "b") + "'"}
+		gen.bump(gen.rule)
+	case 5:
+		gen.lastChange = "dependency suspended"
+		dependency := gen.dependencies[gen.random.Intn(len(gen.dependencies))]
+		dependency.Suspended = !dependency.Suspended
+		gen.bump(dependency)
+	case 6:
+		gen.lastChange = "user labels"
+		user := gen.users[gen.random.Intn(len(gen.users))]
+		user.Labels["team"] = gen.randomValue("a", "b", "c")
+	case 7:
+		gen.lastChange = "contract context criteria"
+		contract := gen.contracts[gen.random.Intn(len(gen.contracts))]
+		contract.Contexts[0].Criteria.RequireAll = []string{"tier == '" + gen.randomValue("x", "y") + "'"}
+		gen.bump(contract)
+	case 8:
+		gen.lastChange = "cluster added"
+		gen.clusters = append(gen.clusters, gen.b.AddCluster())
+	case 9:
+		gen.lastChange = "cluster removed"
+		if len(gen.clusters) > 0 {
+			idx := gen.random.Intn(len(gen.clusters))
+			gen.b.Policy().RemoveObject(gen.clusters[idx])
+			gen.clusters = append(gen.clusters[:idx], gen.clusters[idx+1:]...)
+		}
+	case 10:
+		gen.lastChange = "contract context anti-affinity"
+		contract := gen.contracts[gen.random.Intn(len(gen.contracts))]
+		contract.Contexts[0].AntiAffinity = !contract.Contexts[0].AntiAffinity
+		gen.bump(contract)
+	case 11:
+		gen.lastChange = "component count"
+		idx := gen.random.Intn(len(gen.services))
+		gen.shards[idx].Count = strconv.Itoa(gen.random.Intn(4))
+		gen.bump(gen.services[idx])
+	case 12:
+		gen.lastChange = "code params merge strategy"
+		service := gen.services[gen.random.Intn(len(gen.services))]
+		service.Components[0].Code.Merge["replicas"] = gen.randomValue(lang.MergeStrategyMax, lang.MergeStrategyUnion, lang.MergeStrategyFirst)
+		gen.bump(service)
+	case 13:
+		gen.lastChange = "generated secrets deleted"
+		if gen.resolution != nil {
+			err := gen.b.External().GeneratedSecretStore.DeleteByInstance(gen.randomInstance(gen.resolution).GetKey())
+			if err != nil {
+				panic(err)
+			}
+		}
+	case 14:
+		gen.lastChange = "dependency replicas"
+		dependency := gen.dependencies[gen.random.Intn(len(gen.dependencies))]
+		dependency.Labels["replicas"] = strconv.Itoa(1 + gen.random.Intn(3))
+		gen.bump(dependency)
+	case 15:
+		gen.lastChange = "component outputs"
+		gen.randomInstance(gen.actualState).UpdateOutputs(map[string]string{"address": "address-" + strconv.Itoa(gen.random.Intn(100))})
+	case 16:
+		gen.lastChange = "component outputs pending"
+		gen.randomInstance(gen.actualState).UpdateOutputs(map[string]string{"address": ""})
+	case 17:
+		gen.lastChange = "component deploy version"
+		gen.randomInstance(gen.actualState).DeployVersion++
+	}
+}
+
+// randomInstance returns a random component instance from a given resolution
+func (gen *randomPolicyChanger) randomInstance(resolution *PolicyResolution) *ComponentInstance {
+	keys := make([]string, 0, len(resolution.ComponentInstanceMap))
+	for key := range resolution.ComponentInstanceMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return resolution.ComponentInstanceMap[keys[gen.random.Intn(len(keys))]]
+}
+
+// apply emulates that desired state got applied, so component instances get created in actual state with their
+// outputs, or deleted from actual state
+func (gen *randomPolicyChanger) apply(desiredState *PolicyResolution) {
+	gen.resolution = desiredState
+	if gen.actualState == nil {
+		return
+	}
+	for key := range gen.actualState.ComponentInstanceMap {
+		if _, ok := desiredState.ComponentInstanceMap[key]; !ok {
+			delete(gen.actualState.ComponentInstanceMap, key)
+		}
+	}
+	keys := make([]string, 0, len(desiredState.ComponentInstanceMap))
+	for key, instance := range desiredState.ComponentInstanceMap {
+		if instance.Metadata.Key.IsComponent() {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, ok := gen.actualState.ComponentInstanceMap[key]; !ok {
+			instance := newComponentInstance(desiredState.ComponentInstanceMap[key].Metadata.Key)
+			instance.UpdateOutputs(map[string]string{"address": "address-" + strconv.Itoa(gen.random.Intn(100))})
+			gen.actualState.ComponentInstanceMap[key] = instance
+		}
+	}
+}
+
+// objectGenerations returns generations of all policy objects in the same form as they are stored in PolicyData
+func (gen *randomPolicyChanger) objectGenerations(policy *lang.Policy) map[string]map[string]map[string]runtime.Generation {
+	result := make(map[string]map[string]map[string]runtime.Generation)
+	for _, info := range lang.PolicyObjects {
+		for _, obj := range policy.GetObjectsByKind(info.Kind) {
+			if result[obj.GetNamespace()] == nil {
+				result[obj.GetNamespace()] = make(map[string]map[string]runtime.Generation)
+			}
+			if result[obj.GetNamespace()][obj.GetKind()] == nil {
+				result[obj.GetNamespace()][obj.GetKind()] = make(map[string]runtime.Generation)
+			}
+			result[obj.GetNamespace()][obj.GetKind()][obj.GetName()] = gen.generations[runtime.KeyForStorable(obj)]
+		}
+	}
+	return result
+}
+
+func assertResolutionsEqual(t *testing.T, expected *PolicyResolution, actual *PolicyResolution) bool {
+	t.Helper()
+	ok := assert.Equal(t, expected.GetDependencyInstanceMap(), actual.GetDependencyInstanceMap(), "Dependency instance maps should be equal")
+	ok = assert.Equal(t, len(expected.ComponentInstanceMap), len(actual.ComponentInstanceMap), "Number of component instances should be equal") && ok
+	for key, instance := range expected.ComponentInstanceMap {
+		actualInstance, found := actual.ComponentInstanceMap[key]
+		if !assert.True(t, found, "Component instance %s should be present", key) {
+			ok = false
+			continue
+		}
+		ok = assert.Equal(t, instance.DependencyKeys, actualInstance.DependencyKeys, "Dependency keys should be equal for %s", key) && ok
+		ok = assert.Equal(t, instance.CalculatedLabels.Labels, actualInstance.CalculatedLabels.Labels, "Labels should be equal for %s", key) && ok
+		ok = assert.Equal(t, instance.CalculatedCodeParams, actualInstance.CalculatedCodeParams, "Code params should be equal for %s", key) && ok
+		ok = assert.Equal(t, instance.Outputs, actualInstance.Outputs, "Outputs should be equal for %s", key) && ok
+		ok = assert.Equal(t, instance.OutputsPending, actualInstance.OutputsPending, "Outputs pending flag should be equal for %s", key) && ok
+		ok = assert.Equal(t, instance.DeployVersion, actualInstance.DeployVersion, "Deploy versions should be equal for %s", key) && ok
+		ok = assert.Equal(t, instance.EdgesIn, actualInstance.EdgesIn, "Incoming edges should be equal for %s", key) && ok
+		ok = assert.Equal(t, instance.EdgesOut, actualInstance.EdgesOut, "Outgoing edges should be equal for %s", key) && ok
+	}
+	return ok
+}
@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/lang/template"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/util"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // This is a special internal structure that gets used by the engine, while we traverse the policy graph for a given dependency
@@ -60,14 +64,28 @@ type resolutionNode struct {
 	// reference to the current component key
 	componentKey *ComponentInstanceKey
 
+	// shard index and the total number of shards for the current component instance (0 and 1 for non-replicated
+	// components)
+	shardIndex int
+	shardCount int
+
 	// reference to the current service key
 	serviceKey *ComponentInstanceKey
 
 	// reference to the last key we arrived with, so we can reconstruct graph edges between keys
 	arrivalKey *ComponentInstanceKey
 
+	// reference to the consuming service key, if its affinity requires service instance to be in the same cluster
+	affinityKey *ComponentInstanceKey
+
+	// cluster selected by placement constraints, which rules can't change while being processed for it
+	pinnedCluster string
+
 	// path that we traveled so far (to detect cycles)
 	path []string
+
+	// policy objects and namespaces used while resolving the dependency (shared by all nodes in the tree)
+	trace *resolutionTrace
 }
 
 // Creates a new empty resolution node
@@ -89,6 +107,9 @@ func (resolver *PolicyResolver) newResolutionNode() *resolutionNode {
 
 		// empty path
 		path: []string{},
+
+		// empty trace
+		trace: newResolutionTrace(),
 	}
 }
 
@@ -140,8 +161,14 @@ func (node *resolutionNode) createChildNode() *resolutionNode {
 		// remember the last arrival key
 		arrivalKey: node.componentKey,
 
+		// remember the consuming service key, if service must be co-located with it
+		affinityKey: node.getAffinityKey(),
+
 		// copy path
 		path: util.CopySliceOfStrings(node.path),
+
+		// share trace
+		trace: node.trace,
 	}
 }
 
@@ -207,6 +234,7 @@ func (node *resolutionNode) getContract(policy *lang.Policy) *lang.Contract {
 		panic(fmt.Sprintf("Can't get contract '%s/%s': %s", node.namespace, node.contractName, err))
 	}
 	contract := contractObj.(*lang.Contract)
+	node.trace.addObject(contract)
 	node.logContractFound(contract)
 	return contract
 }
@@ -250,6 +278,7 @@ func (node *resolutionNode) getMatchedService(policy *lang.Policy) (*lang.Servic
 	}
 
 	service := serviceObj.(*lang.Service)
+	node.trace.addObject(service)
 
 	// Service should be located in the same namespace as contract
 	if service.Namespace != node.contract.Namespace {
@@ -300,6 +329,7 @@ func (node *resolutionNode) createComponentKey(component *lang.ServiceComponent)
 	if err != nil || clusterObj == nil {
 		return nil, node.errorClusterDoesNotExist(clusterName)
 	}
+	node.trace.addObject(clusterObj.(*lang.Cluster))
 
 	return NewComponentInstanceKey(
 		clusterObj.(*lang.Cluster),
@@ -311,6 +341,106 @@ func (node *resolutionNode) createComponentKey(component *lang.ServiceComponent)
 	), nil
 }
 
+// selectCluster selects a cluster for the current service instance and returns the result of rule processing for it.
+// Cluster chosen by rules is preferred, followed by all other clusters sorted by name. If the service instance has
+// placement constraints, clusters which don't satisfy them are filtered out:
+// - affinity only allows the cluster of the consuming service instance
+// - anti-affinity doesn't allow clusters occupied by instances allocated for other keys of the same context
+// If the cluster chosen by rules gets replaced, rules are processed again starting from a given set of labels with
+// the cluster pinned, so their criteria get evaluated against it. Clusters rejected by rules are skipped
+func (node *resolutionNode) selectCluster(labelsBeforeRules *lang.LabelSet, ruleResult *lang.RuleActionResult) (*lang.RuleActionResult, error) {
+	excluded := node.getAntiAffinityExcludedClusters()
+	if node.affinityKey == nil && len(excluded) == 0 {
+		return ruleResult, nil
+	}
+
+	// placement depends on which clusters exist, so any change in clusters affects it
+	node.trace.addClusters()
+
+	clusterName := node.labels.Labels[lang.LabelCluster]
+	if node.allowsCluster(clusterName, excluded) {
+		return ruleResult, nil
+	}
+
+	clusterNames := []string{}
+	for _, clusterObj := range node.resolver.policy.GetObjectsByKind(lang.ClusterObject.Kind) {
+		clusterNames = append(clusterNames, clusterObj.(*lang.Cluster).Name)
+	}
+	sort.Strings(clusterNames)
+
+	rejected := []string{}
+	for _, name := range clusterNames {
+		if name == clusterName || !node.allowsCluster(name, excluded) {
+			continue
+		}
+
+		node.labels = lang.NewLabelSet(labelsBeforeRules.Labels)
+		node.labels.Labels[lang.LabelCluster] = name
+		node.pinnedCluster = name
+		result, err := node.processRules()
+		node.pinnedCluster = ""
+		if err != nil {
+			if result != nil && result.RejectDependency {
+				rejected = append(rejected, name)
+				continue
+			}
+			return nil, err
+		}
+
+		node.logClusterSelected(clusterName, name)
+		return result, nil
+	}
+
+	return nil, node.errorNoClusterSatisfiesPlacement(excluded, rejected)
+}
+
+// allowsCluster returns true if the current service instance can be placed into a given cluster according to its
+// placement constraints
+func (node *resolutionNode) allowsCluster(clusterName string, excluded map[string]*ComponentInstanceKey) bool {
+	if len(clusterName) <= 0 || excluded[clusterName] != nil {
+		return false
+	}
+	return node.affinityKey == nil || node.affinityKey.ClusterName == clusterName
+}
+
+// getAntiAffinityExcludedClusters returns clusters occupied by service instances allocated for other keys of the
+// current context, if the context has anti-affinity, together with keys of those service instances
+func (node *resolutionNode) getAntiAffinityExcludedClusters() map[string]*ComponentInstanceKey {
+	result := make(map[string]*ComponentInstanceKey)
+	if !node.context.AntiAffinity {
+		return result
+	}
+
+	contextKey := runtime.KeyFromParts(node.contract.Namespace, node.contract.Name, node.context.Name)
+	keysResolved := strings.Join(node.allocationKeysResolved, componentInstanceKeySeparator)
+
+	// instances of other dependencies, which have been already placed
+	for clusterName, key := range node.resolver.antiAffinity[contextKey] {
+		if key.KeysResolved != keysResolved {
+			result[clusterName] = key
+		}
+	}
+
+	// instances placed while resolving the current dependency
+	for _, instance := range node.resolution.ComponentInstanceMap {
+		key := instance.Metadata.Key
+		if key.IsService() && getContextKey(key) == contextKey && key.KeysResolved != keysResolved {
+			result[key.ClusterName] = key
+		}
+	}
+
+	return result
+}
+
+// getAffinityKey returns the current service key, if the service requires instances of the contract referenced by
+// the current component to be placed into the same cluster. Otherwise it returns nil
+func (node *resolutionNode) getAffinityKey() *ComponentInstanceKey {
+	if node.service.Affinity.RequiresSameCluster(node.component.Contract) {
+		return node.serviceKey
+	}
+	return nil
+}
+
 func (node *resolutionNode) transformLabels(labels *lang.LabelSet, operations lang.LabelOperations) {
 	changedLabels := labels.ApplyTransform(operations)
 	if changedLabels {
@@ -333,6 +463,9 @@ func (node *resolutionNode) processRulesWithinNamespace(policyNamespace *lang.Po
 		node.logTestedRuleMatch(rule, matched)
 		if matched {
 			rule.ApplyActions(result)
+			if len(node.pinnedCluster) > 0 {
+				result.Labels.Labels[lang.LabelCluster] = node.pinnedCluster
+			}
 
 			// if a dependency has been rejected, handle it right away and return that we cannot resolve it
 			if result.RejectDependency {
@@ -350,36 +483,135 @@ func (node *resolutionNode) processRulesWithinNamespace(policyNamespace *lang.Po
 
 func (node *resolutionNode) processRules() (*lang.RuleActionResult, error) {
 	result := lang.NewRuleActionResult(node.labels)
+	node.trace.addNamespace(node.namespace)
 
 	// process rules within the current namespace
 	var err = node.processRulesWithinNamespace(node.resolver.policy.Namespace[node.namespace], result)
 	if err != nil {
-		return nil, err
+		return result, err
 	}
 
 	// process rules globally (within system namespace)
 	err = node.processRulesWithinNamespace(node.resolver.policy.Namespace[runtime.SystemNS], result)
 	if err != nil {
-		return nil, err
+		return result, err
 	}
 	return result, nil
 }
 
 func (node *resolutionNode) calculateAndStoreCodeParams() error {
-	componentCodeParams, err := util.ProcessParameterTree(node.component.Code.Params, node.getContextualDataForCodeDiscoveryTemplate(), node.resolver.templateCache, util.ModeEvaluate)
+	deployVersion := node.getComponentDeployVersion()
+	componentCodeParams, probe, err := node.calculateCodeParamsAndReadinessProbe(node.getContextualDataForDeployVersion(deployVersion))
 	if err != nil {
 		return node.errorWhenProcessingCodeParams(err)
 	}
 
-	err = node.resolution.RecordCodeParams(node.componentKey, componentCodeParams)
+	err = node.resolution.RecordCodeParams(node.componentKey, node.dependency, componentCodeParams, node.component.Code.Merge)
 	if err != nil {
 		return node.errorWhenProcessingCodeParams(err)
 	}
 
+	err = node.resolution.RecordReadinessProbe(node.componentKey, probe)
+	if err != nil {
+		return node.errorWhenProcessingCodeParams(err)
+	}
+
+	// Calculate code params and readiness probe for the next deployment, which gets created next to the current one
+	// under the next versioned deploy name, if component gets updated via blue/green strategy
+	if !node.component.Code.Job && node.component.Code.UpdateStrategy == lang.UpdateStrategyBlueGreen {
+		nextCodeParams, nextProbe, err := node.calculateCodeParamsAndReadinessProbe(node.getContextualDataForDeployVersion(deployVersion + 1))
+		if err != nil {
+			return node.errorWhenProcessingCodeParams(err)
+		}
+
+		err = node.resolution.RecordNextCodeParams(node.componentKey, node.dependency, nextCodeParams, node.component.Code.Merge)
+		if err != nil {
+			return node.errorWhenProcessingCodeParams(err)
+		}
+
+		err = node.resolution.RecordNextReadinessProbe(node.componentKey, nextProbe)
+		if err != nil {
+			return node.errorWhenProcessingCodeParams(err)
+		}
+	}
+
+	// Calculate code params for hooks, which run code
+	for _, hook := range node.component.GetAllHooks() {
+		if hook.Code == nil {
+			continue
+		}
+
+		hookParams, err := util.ProcessParameterTree(hook.Code.Params, node.getContextualDataForCodeDiscoveryTemplate(), node.resolver.templateCache, util.ModeEvaluate)
+		if err != nil {
+			return node.errorWhenProcessingCodeParams(err)
+		}
+
+		err = node.resolution.RecordHookParams(node.componentKey, hook.Name, hookParams)
+		if err != nil {
+			return node.errorWhenProcessingCodeParams(err)
+		}
+	}
+
 	return nil
 }
 
-func (node *resolutionNode) calculateAndStoreDiscoveryParams() error {
+// calculateCodeParamsAndReadinessProbe calculates code params of the current component instance and URL or address
+// for its readiness probe (if readiness gets checked via HTTP or TCP), given contextual data for templates
+func (node *resolutionNode) calculateCodeParamsAndReadinessProbe(parameters *template.Parameters) (util.NestedParameterMap, string, error) {
+	codeParams, err := util.ProcessParameterTree(node.component.Code.Params, parameters, node.resolver.templateCache, util.ModeEvaluate)
+	if err != nil {
+		return nil, "", err
+	}
+
+	readiness := node.component.Readiness
+	if readiness == nil || readiness.Plugin {
+		return codeParams, "", nil
+	}
+
+	probe := readiness.HTTP
+	if len(probe) == 0 {
+		probe = readiness.TCP
+	}
+	target, err := node.resolver.templateCache.Evaluate(probe, parameters)
+	if err != nil {
+		return nil, "", err
+	}
+	return codeParams, target, nil
+}
+
+// getComponentOutputs returns outputs of the current component instance, which were produced during the last apply,
+// and whether some of them are still pending
+func (node *resolutionNode) getComponentOutputs() (map[string]string, bool) {
+	result := make(map[string]string)
+	if node.resolver.actualState == nil {
+		return result, false
+	}
+	instance, ok := node.resolver.actualState.ComponentInstanceMap[node.componentKey.GetKey()]
+	if !ok {
+		return result, false
+	}
+	for k, v := range instance.Outputs {
+		result[k] = v
+	}
+	return result, instance.OutputsPending
+}
+
+// getComponentDeployVersion returns version of the current deployment of the current component instance, as recorded
+// during the last apply
+func (node *resolutionNode) getComponentDeployVersion() int {
+	if node.resolver.actualState == nil {
+		return 0
+	}
+	instance, ok := node.resolver.actualState.ComponentInstanceMap[node.componentKey.GetKey()]
+	if !ok {
+		return 0
+	}
+	return instance.DeployVersion
+}
+
+// calculateAndStoreDiscoveryParams calculates discovery params for the current component instance and announces them,
+// together with the instance name and outputs, in a given node of the discovery tree
+func (node *resolutionNode) calculateAndStoreDiscoveryParams(discovery util.NestedParameterMap) error {
 	componentDiscoveryParams, err := util.ProcessParameterTree(node.component.Discovery, node.getContextualDataForCodeDiscoveryTemplate(), node.resolver.templateCache, util.ModeEvaluate)
 	if err != nil {
 		return node.errorWhenProcessingDiscoveryParams(err)
@@ -391,10 +623,36 @@ func (node *resolutionNode) calculateAndStoreDiscoveryParams() error {
 	}
 
 	// Populate discovery tree (allow this component to announce its discovery properties in the discovery tree)
-	node.discoveryTreeNode.GetNestedMap(node.component.Name)["instance"] = util.EscapeName(node.componentKey.GetDeployName())
+	discovery["instance"] = util.EscapeName(node.componentKey.GetDeployName())
+	if node.component.Code != nil {
+		outputs, pending := node.getComponentOutputs()
+		node.resolution.RecordOutputs(node.componentKey, outputs, pending)
+		discovery["outputs"] = outputs
+
+		// announce the current deployment, if component instance has been updated via blue/green strategy
+		deployVersion := node.getComponentDeployVersion()
+		node.resolution.RecordDeployVersion(node.componentKey, deployVersion)
+		discovery["instance"] = util.EscapeName(getVersionedDeployName(node.componentKey, deployVersion))
+	}
 	for k, v := range componentDiscoveryParams {
-		node.discoveryTreeNode.GetNestedMap(node.component.Name)[k] = v
+		discovery[k] = v
 	}
 
 	return nil
 }
+
+// calculateComponentCount returns the number of instances which have to be created for the current component
+func (node *resolutionNode) calculateComponentCount() (int, error) {
+	if len(node.component.Count) == 0 {
+		return 1, nil
+	}
+	countStr, err := node.resolver.templateCache.Evaluate(node.component.Count, node.getContextualDataForContextAllocationTemplate())
+	if err != nil {
+		return 0, node.errorWhenProcessingComponentCount(err)
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(countStr))
+	if err != nil || count < 0 {
+		return 0, node.errorWhenProcessingComponentCount(fmt.Errorf("count must be a non-negative integer, but found '%s'", countStr))
+	}
+	return count, nil
+}
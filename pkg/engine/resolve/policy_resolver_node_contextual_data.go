@@ -1,6 +1,7 @@
 package resolve
 
 import (
+	"fmt"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/lang/expression"
 	"github.com/Aptomi/aptomi/pkg/lang/template"
@@ -68,17 +69,27 @@ func (node *resolutionNode) getContextualDataForContextAllocationTemplate() *tem
 // This method defines which contextual information will be exposed to the template engine (for evaluating all templates - discovery, code params, etc)
 // Be careful about what gets exposed through this method. User can refer to structs and their methods from the policy
 func (node *resolutionNode) getContextualDataForCodeDiscoveryTemplate() *template.Parameters {
+	return node.getContextualDataForDeployVersion(node.getComponentDeployVersion())
+}
+
+// This method is the same as getContextualDataForCodeDiscoveryTemplate, but announces a given version of deployment of
+// the current component instance. It's used to calculate code params for the next deployment on blue/green update
+func (node *resolutionNode) getContextualDataForDeployVersion(deployVersion int) *template.Parameters {
 	return template.NewParams(
 		struct {
 			User      interface{}
 			Labels    interface{}
 			Discovery interface{}
+			Shard     interface{}
 		}{
 			User:      node.proxyUser(node.user),
 			Labels:    node.labels.Labels,
-			Discovery: node.proxyDiscovery(node.discoveryTreeNode, node.componentKey),
+			Discovery: node.proxyDiscovery(node.discoveryTreeNode, node.componentKey, deployVersion),
+			Shard:     node.proxyShard(),
 		},
-	)
+	).WithFuncs(map[string]interface{}{
+		"generatedSecret": node.proxyGeneratedSecret(node.componentKey),
+	})
 }
 
 /*
@@ -96,6 +107,34 @@ func (node *resolutionNode) proxyService(service *lang.Service) interface{} {
 	}
 }
 
+// How generated secrets are visible from the policy language. Secret is generated once per component instance
+// and persisted in the generated secret store, so it stays the same across policy resolutions
+func (node *resolutionNode) proxyGeneratedSecret(cik *ComponentInstanceKey) interface{} {
+	return func(name string, length int) (string, error) {
+		store := node.resolver.externalData.GeneratedSecretStore
+		if store == nil {
+			return "", fmt.Errorf("generated secret '%s' can't be used, secret store is not configured", name)
+		}
+		if length <= 0 {
+			return "", fmt.Errorf("generated secret '%s' must have positive length, but found %d", name, length)
+		}
+		return store.LoadOrGenerate(cik.GetKey(), name, func() string {
+			return util.RandomSecret(length)
+		})
+	}
+}
+
+// How shard of a replicated component is visible from the policy language
+func (node *resolutionNode) proxyShard() interface{} {
+	return struct {
+		Index interface{}
+		Count interface{}
+	}{
+		Index: node.shardIndex,
+		Count: node.shardCount,
+	}
+}
+
 // How user is visible from the policy language
 func (node *resolutionNode) proxyUser(user *lang.User) interface{} {
 	return struct {
@@ -120,11 +159,12 @@ func (node *resolutionNode) proxyDependency(dependency *lang.Dependency) interfa
 }
 
 // How discovery tree is visible from the policy language
-func (node *resolutionNode) proxyDiscovery(discoveryTree util.NestedParameterMap, cik *ComponentInstanceKey) interface{} {
+func (node *resolutionNode) proxyDiscovery(discoveryTree util.NestedParameterMap, cik *ComponentInstanceKey, deployVersion int) interface{} {
 	result := discoveryTree.MakeCopy()
 
-	// special case to announce own component instance
-	result["instance"] = util.EscapeName(cik.GetDeployName())
+	// special case to announce own component instance (with a given version of deployment, if it's been updated via
+	// blue/green strategy)
+	result["instance"] = util.EscapeName(getVersionedDeployName(cik, deployVersion))
 
 	// special case to announce own component ID
 	result["instanceId"] = util.HashFnv(cik.GetKey())
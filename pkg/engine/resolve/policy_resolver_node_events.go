@@ -6,6 +6,7 @@ import (
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/util"
 	"strings"
 )
 
@@ -56,6 +57,34 @@ func (node *resolutionNode) errorClusterDoesNotExist(clusterName string) error {
 	return NewCriticalError(err)
 }
 
+func (node *resolutionNode) errorNoClusterSatisfiesPlacement(excluded map[string]*ComponentInstanceKey, rejected []string) error {
+	conflicts := []string{}
+	details := errors.Details{
+		"labels":   node.labels.Labels,
+		"rejected": rejected,
+	}
+	if node.affinityKey != nil {
+		conflicts = append(conflicts, fmt.Sprintf("affinity requires cluster '%s' of consuming instance '%s'", node.affinityKey.ClusterName, node.affinityKey.GetKey()))
+		details["consumer"] = node.affinityKey.GetKey()
+	}
+	excludedKeys := make(map[string]string)
+	for _, clusterName := range util.GetSortedStringKeys(excluded) {
+		key := excluded[clusterName].GetKey()
+		conflicts = append(conflicts, fmt.Sprintf("anti-affinity excludes cluster '%s' occupied by instance '%s'", clusterName, key))
+		excludedKeys[clusterName] = key
+	}
+	details["excluded"] = excludedKeys
+	if len(rejected) > 0 {
+		conflicts = append(conflicts, fmt.Sprintf("rules reject clusters '%s'", strings.Join(rejected, "', '")))
+	}
+
+	err := errors.NewErrorWithDetails(
+		fmt.Sprintf("No cluster satisfies placement constraints of contract '%s', context '%s' for dependency '%s': %s", node.contract.Name, node.context.Name, runtime.KeyForStorable(node.dependency), strings.Join(conflicts, "; ")),
+		details,
+	)
+	return NewCriticalError(err)
+}
+
 func (node *resolutionNode) errorServiceIsNotInSameNamespaceAsContract(service *lang.Service) error {
 	err := errors.NewErrorWithDetails(
 		fmt.Sprintf("Service '%s' is not in the same namespace as contract %s", runtime.KeyForStorable(service), runtime.KeyForStorable(node.contract)),
@@ -122,6 +151,18 @@ func (node *resolutionNode) errorWhenProcessingCodeParams(cause error) error {
 	return NewCriticalError(err)
 }
 
+func (node *resolutionNode) errorWhenProcessingComponentCount(cause error) error {
+	err := errors.NewErrorWithDetails(
+		fmt.Sprintf("Error when processing count for service '%s', contract '%s', context '%s', component '%s': %s", node.service.Name, node.contract.Name, node.context.Name, node.component.Name, cause),
+		errors.Details{
+			"component":       node.component,
+			"contextual_data": node.getContextualDataForContextAllocationTemplate(),
+			"cause":           cause,
+		},
+	)
+	return NewCriticalError(err)
+}
+
 func (node *resolutionNode) errorWhenProcessingDiscoveryParams(cause error) error {
 	err := errors.NewErrorWithDetails(
 		fmt.Sprintf("Error when processing discovery params for service '%s', contract '%s', context '%s', component '%s': %s", node.service.Name, node.contract.Name, node.context.Name, node.component.Name, cause),
@@ -160,6 +201,10 @@ func (node *resolutionNode) logStartResolvingDependency() {
 	node.logLabels(node.labels, "initial")
 }
 
+func (node *resolutionNode) logDependencySuspended() {
+	node.eventLog.WithFields(event.Fields{}).Infof("Dependency '%s/%s' is suspended, skipping it", node.dependency.Metadata.Namespace, node.dependency.Name)
+}
+
 func (node *resolutionNode) logLabels(labelSet *lang.LabelSet, scope string) {
 	secretCnt := 0
 	if node.user != nil {
@@ -170,6 +215,10 @@ func (node *resolutionNode) logLabels(labelSet *lang.LabelSet, scope string) {
 	}).Infof("Labels (%s): %s and %d secrets", scope, labelSet.Labels, secretCnt)
 }
 
+func (node *resolutionNode) logClusterSelected(labeledClusterName string, clusterName string) {
+	node.eventLog.WithFields(event.Fields{}).Infof("Placement constraints of contract '%s', context '%s' moved service instance from cluster '%s' into cluster '%s'", node.contract.Name, node.context.Name, labeledClusterName, clusterName)
+}
+
 func (node *resolutionNode) logContractFound(contract *lang.Contract) {
 	node.eventLog.WithFields(event.Fields{
 		"contract": contract,
@@ -276,13 +325,18 @@ func (resolver *PolicyResolver) logComponentCodeParams(instance *ComponentInstan
 	code := serviceObj.(*lang.Service).GetComponentsMap()[instance.Metadata.Key.ComponentName].Code
 	if code != nil {
 		paramsTemplate := code.Params
-		params := instance.CalculatedCodeParams
+		params := instance.GetRedactedCodeParams()
 		diff := strings.TrimSpace(paramsTemplate.Diff(params))
 		if len(diff) > 0 {
 			resolver.eventLog.WithFields(event.Fields{
 				"params": diff,
 			}).Debugf("Calculated code params for component '%s'", instance.Metadata.Key.GetKey())
 		}
+		if len(instance.CodeParamsSources) > 0 {
+			resolver.eventLog.WithFields(event.Fields{
+				"sources": instance.CodeParamsSources,
+			}).Debugf("Dependencies contributed values for merged code params of component '%s'", instance.Metadata.Key.GetKey())
+		}
 	}
 }
 
@@ -292,7 +346,7 @@ func (resolver *PolicyResolver) logComponentDiscoveryParams(instance *ComponentI
 		panic(fmt.Sprintf("Fatal error while getting service '%s/%s' from the policy: %s", instance.Metadata.Key.ServiceName, instance.Metadata.Key.Namespace, err))
 	}
 	paramsTemplate := serviceObj.(*lang.Service).GetComponentsMap()[instance.Metadata.Key.ComponentName].Discovery
-	params := instance.CalculatedDiscovery
+	params := instance.GetRedactedDiscoveryParams()
 	diff := strings.TrimSpace(paramsTemplate.Diff(params))
 	if len(diff) > 0 {
 		resolver.eventLog.WithFields(event.Fields{
@@ -3,10 +3,12 @@ package resolve
 import (
 	"fmt"
 	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/external/secrets"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/lang/builder"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/Sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -264,6 +266,172 @@ func TestPolicyResolverCodeAndDiscoveryParams(t *testing.T) {
 	assert.Equal(t, 5, instance2.CalculatedCodeParams.GetNestedMap("nested").GetNestedMap("param")["nameInt"], "Code parameter should be calculated correctly (int)")
 }
 
+func TestPolicyResolverComponentOutputs(t *testing.T) {
+	b := builder.NewPolicyBuilder()
+
+	// create a service with 2 components, where the second component consumes outputs of the first one
+	service := b.AddService()
+	component1 := b.CodeComponent(nil, nil)
+	component2 := b.CodeComponent(
+		util.NestedParameterMap{"password": fmt.Sprintf("{{ index .Discovery.%s.outputs \"password\" }}", component1.Name)},
+		nil,
+	)
+	b.AddServiceComponent(service, component1)
+	b.AddServiceComponent(service, component2)
+	b.AddComponentDependency(component2, component1)
+
+	contract := b.AddContract(service, b.CriteriaTrue())
+	cluster := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster.Name)))
+	b.AddDependency(b.AddUser(), contract)
+
+	// policy should be resolved successfully, while outputs are not available yet
+	resolution := resolvePolicy(t, b, ResSuccess, "Successfully resolved")
+	instance2 := getInstanceByParams(t, cluster, contract, contract.Contexts[0], nil, service, component2, resolution)
+	assert.Equal(t, "", instance2.CalculatedCodeParams["password"], "Code parameter should be empty when outputs are not available")
+
+	// emulate that component 1 got deployed and produced outputs
+	instance1 := getInstanceByParams(t, cluster, contract, contract.Contexts[0], nil, service, component1, resolution)
+	instance1.UpdateOutputs(map[string]string{"password": "generated"})
+
+	// resolve policy again, taking into account actual state with outputs
+	resolver := NewPolicyResolver(b.Policy(), b.External(), resolution, event.NewLog("test-resolve", false))
+	resolutionNext, err := resolver.ResolveAllDependencies()
+	if !assert.NoError(t, err, "Policy should be resolved without errors") {
+		t.FailNow()
+	}
+
+	// check that outputs got propagated into code parameters of component 2 and preserved for component 1
+	instance1 = getInstanceByParams(t, cluster, contract, contract.Contexts[0], nil, service, component1, resolutionNext)
+	instance2 = getInstanceByParams(t, cluster, contract, contract.Contexts[0], nil, service, component2, resolutionNext)
+	assert.Equal(t, "generated", instance1.Outputs["password"], "Outputs should be carried over from actual state")
+	assert.Equal(t, "generated", instance2.CalculatedCodeParams["password"], "Code parameter should be calculated from outputs")
+}
+
+func TestPolicyResolverGeneratedSecrets(t *testing.T) {
+	b := builder.NewPolicyBuilder()
+
+	// create a service with a component which uses generated secret in its code and discovery parameters
+	service := b.AddService()
+	component := b.CodeComponent(
+		util.NestedParameterMap{"password": "{{ generatedSecret \"password\" 32 }}"},
+		util.NestedParameterMap{"password": "{{ generatedSecret \"password\" 32 }}"},
+	)
+	b.AddServiceComponent(service, component)
+	contract := b.AddContract(service, b.CriteriaTrue())
+	contract.Contexts[0].Allocation.Keys = b.AllocationKeys("{{.User.Name}}")
+
+	cluster := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster.Name)))
+	user1 := b.AddUser()
+	user2 := b.AddUser()
+	b.AddDependency(user1, contract)
+	b.AddDependency(user2, contract)
+
+	// policy should be resolved successfully
+	resolution := resolvePolicy(t, b, ResSuccess, "Successfully resolved")
+	instance1 := getInstanceByParams(t, cluster, contract, contract.Contexts[0], []string{user1.Name}, service, component, resolution)
+	instance2 := getInstanceByParams(t, cluster, contract, contract.Contexts[0], []string{user2.Name}, service, component, resolution)
+
+	// check that secrets got generated and that they are different for different component instances
+	assert.Len(t, instance1.CalculatedCodeParams["password"], 32, "Generated secret should have correct length")
+	assert.Equal(t, instance1.CalculatedCodeParams["password"], instance1.CalculatedDiscovery["password"], "Generated secret should be the same for the component instance")
+	assert.NotEqual(t, instance1.CalculatedCodeParams["password"], instance2.CalculatedCodeParams["password"], "Generated secrets should be different for different component instances")
+
+	// check that parameters with generated secrets get redacted
+	assert.Equal(t, []string{"password"}, instance1.SecretCodeParams, "Code parameter with generated secret should be found")
+	assert.Equal(t, []string{"password"}, instance1.SecretDiscoveryParams, "Discovery parameter with generated secret should be found")
+	assert.Equal(t, RedactedValue, instance1.GetRedactedCodeParams()["password"], "Generated secret should be redacted in code parameters")
+	assert.Equal(t, RedactedValue, instance1.GetRedactedDiscoveryParams()["password"], "Generated secret should be redacted in discovery parameters")
+	assert.Len(t, instance1.CalculatedCodeParams["password"], 32, "Code parameters should not be changed by redaction")
+
+	// check that secrets stay the same when policy gets resolved again
+	resolutionNext := resolvePolicy(t, b, ResSuccess, "Successfully resolved")
+	instance1Next := getInstanceByParams(t, cluster, contract, contract.Contexts[0], []string{user1.Name}, service, component, resolutionNext)
+	assert.Equal(t, instance1.CalculatedCodeParams["password"], instance1Next.CalculatedCodeParams["password"], "Generated secret should be stable across policy resolutions")
+
+	// check that secret gets generated again, once it's deleted from the store
+	err := b.External().GeneratedSecretStore.DeleteByInstance(instance1.GetKey())
+	assert.NoError(t, err, "Generated secrets should be deleted without errors")
+	resolutionNext = resolvePolicy(t, b, ResSuccess, "Successfully resolved")
+	instance1Next = getInstanceByParams(t, cluster, contract, contract.Contexts[0], []string{user1.Name}, service, component, resolutionNext)
+	assert.NotEqual(t, instance1.CalculatedCodeParams["password"], instance1Next.CalculatedCodeParams["password"], "Generated secret should be re-generated after deletion")
+}
+
+func TestPolicyResolverGeneratedSecretsNotLogged(t *testing.T) {
+	b := builder.NewPolicyBuilder()
+
+	// create a service with a component which uses generated secret and passes it to another component via discovery
+	service := b.AddService()
+	component1 := b.CodeComponent(
+		util.NestedParameterMap{"password": "{{ generatedSecret \"password\" 32 }}"},
+		util.NestedParameterMap{"password": "{{ generatedSecret \"password\" 32 }}"},
+	)
+	component2 := b.CodeComponent(
+		util.NestedParameterMap{"url": "db://admin:{{ .Discovery." + component1.Name + ".password }}@db"},
+		nil,
+	)
+	b.AddServiceComponent(service, component1)
+	b.AddServiceComponent(service, component2)
+	b.AddComponentDependency(component2, component1)
+	contract := b.AddContract(service, b.CriteriaTrue())
+	cluster := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster.Name)))
+	b.AddDependency(b.AddUser(), contract)
+
+	eventLog := event.NewLog("test-resolve", false)
+	resolution, err := NewPolicyResolver(b.Policy(), b.External(), nil, eventLog).ResolveAllDependencies()
+	assert.NoError(t, err, "Policy should be resolved without errors")
+
+	instance1 := getInstanceByParams(t, cluster, contract, contract.Contexts[0], nil, service, component1, resolution)
+	instance2 := getInstanceByParams(t, cluster, contract, contract.Contexts[0], nil, service, component2, resolution)
+	secret := instance1.CalculatedCodeParams["password"].(string)
+	assert.Contains(t, instance2.CalculatedCodeParams["url"], secret, "Generated secret should be passed via discovery")
+	assert.Equal(t, []string{"url"}, instance2.SecretCodeParams, "Secrets passed via discovery should be found as well")
+
+	// check that generated secret doesn't appear anywhere in the event log
+	hook := &entriesHook{}
+	eventLog.Save(hook)
+	assert.NotEmpty(t, hook.entries, "Event log should not be empty")
+	for _, entry := range hook.entries {
+		assert.NotContains(t, entry, secret, "Generated secret should not be logged")
+	}
+}
+
+func TestPolicyResolverGeneratedSecretsReadOnly(t *testing.T) {
+	b := builder.NewPolicyBuilder()
+	service := b.AddService()
+	component := b.CodeComponent(util.NestedParameterMap{"password": "{{ generatedSecret \"password\" 32 }}"}, nil)
+	b.AddServiceComponent(service, component)
+	contract := b.AddContract(service, b.CriteriaTrue())
+	contract.Contexts[0].Allocation.Keys = b.AllocationKeys("{{.User.Name}}")
+	cluster := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster.Name)))
+	user1 := b.AddUser()
+	b.AddDependency(user1, contract)
+
+	// secret gets generated and persisted for the first instance
+	resolution := resolvePolicy(t, b, ResSuccess, "Successfully resolved")
+	instance1 := getInstanceByParams(t, cluster, contract, contract.Contexts[0], []string{user1.Name}, service, component, resolution)
+
+	// resolve policy with read-only generated secret store and a new dependency
+	user2 := b.AddUser()
+	b.AddDependency(user2, contract)
+	external := b.External()
+	readOnly := external.WithGeneratedSecretStore(secrets.NewGeneratedSecretStoreReadOnly(external.GeneratedSecretStore))
+	resolution, err := NewPolicyResolver(b.Policy(), readOnly, nil, event.NewLog("test-resolve", false)).ResolveAllDependencies()
+	assert.NoError(t, err, "Policy should be resolved without errors")
+	instance1Next := getInstanceByParams(t, cluster, contract, contract.Contexts[0], []string{user1.Name}, service, component, resolution)
+	instance2 := getInstanceByParams(t, cluster, contract, contract.Contexts[0], []string{user2.Name}, service, component, resolution)
+	assert.Equal(t, instance1.CalculatedCodeParams["password"], instance1Next.CalculatedCodeParams["password"], "Existing secret should be used by read-only store")
+	assert.Len(t, instance2.CalculatedCodeParams["password"], 32, "Secret should be generated by read-only store")
+
+	// check that read-only store didn't persist the secret
+	generated, err := external.GeneratedSecretStore.LoadByInstance(instance2.GetKey())
+	assert.NoError(t, err, "Generated secrets should be loaded without errors")
+	assert.Empty(t, generated, "Secret should not be persisted by read-only store")
+}
+
 func TestPolicyResolverDependencyWithNonExistingUser(t *testing.T) {
 	b := builder.NewPolicyBuilder()
 	service := b.AddService()
@@ -276,6 +444,29 @@ func TestPolicyResolverDependencyWithNonExistingUser(t *testing.T) {
 	assert.NotContains(t, resolution.GetDependencyInstanceMap(), runtime.KeyForStorable(dependency), "Dependency should not be resolved")
 }
 
+func TestPolicyResolverSuspendedDependency(t *testing.T) {
+	b := builder.NewPolicyBuilder()
+	service := b.AddService()
+	component := b.AddServiceComponent(service, b.CodeComponent(nil, nil))
+	contract := b.AddContract(service, b.CriteriaTrue())
+	cluster := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster.Name)))
+
+	// add two dependencies on the same instance, suspend one of them
+	d1 := b.AddDependency(b.AddUser(), contract)
+	d2 := b.AddDependency(b.AddUser(), contract)
+	d2.Suspended = true
+
+	// suspended dependency should not be resolved, while the instance should still be kept for the active one
+	resolution := resolvePolicy(t, b, ResSuccess, "is suspended")
+	assert.Contains(t, resolution.GetDependencyInstanceMap(), runtime.KeyForStorable(d1), "Dependency should be resolved")
+	assert.NotContains(t, resolution.GetDependencyInstanceMap(), runtime.KeyForStorable(d2), "Suspended dependency should not be resolved")
+
+	instance := getInstanceByParams(t, cluster, contract, contract.Contexts[0], nil, service, component, resolution)
+	assert.Equal(t, 1, len(instance.DependencyKeys), "Instance should be referenced by active dependency only")
+	assert.Contains(t, instance.DependencyKeys, runtime.KeyForStorable(d1), "Instance should be referenced by active dependency")
+}
+
 func TestPolicyResolverConflictingCodeParams(t *testing.T) {
 	b := builder.NewPolicyBuilder()
 
@@ -302,6 +493,133 @@ func TestPolicyResolverConflictingCodeParams(t *testing.T) {
 	resolvePolicy(t, b, ResError, "Conflicting code parameters")
 }
 
+func TestPolicyResolverMergeCodeParams(t *testing.T) {
+	b := builder.NewPolicyBuilder()
+
+	// create a service with merge strategies for code parameters
+	service := b.AddService()
+	component := b.CodeComponent(
+		util.NestedParameterMap{
+			"replicas": "{{ .Labels.replicas }}",
+			"auth": util.NestedParameterMap{
+				"users": "{{ .Labels.users }}",
+			},
+			"version": "{{ .Labels.version }}",
+			"name":    "fixed",
+		},
+		nil,
+	)
+	component.Code.Merge = map[string]string{
+		"replicas":   lang.MergeStrategyMax,
+		"auth.users": lang.MergeStrategyUnion,
+		"version":    lang.MergeStrategyFirst,
+	}
+	b.AddServiceComponent(service, component)
+	contract := b.AddContract(service, b.CriteriaTrue())
+	cluster := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster.Name)))
+
+	// add dependencies which feed different labels into a given component
+	d1 := b.AddDependency(b.AddUser(), contract)
+	d1.Labels["replicas"] = "2"
+	d1.Labels["users"] = "bob,alice"
+	d1.Labels["version"] = "1.0"
+
+	d2 := b.AddDependency(b.AddUser(), contract)
+	d2.Labels["replicas"] = "5"
+	d2.Labels["users"] = "alice,carol"
+	d2.Labels["version"] = "2.0"
+
+	d3 := b.AddDependency(b.AddUser(), contract)
+	d3.Labels["replicas"] = "3"
+	d3.Labels["users"] = "dave"
+	d3.Labels["version"] = "3.0"
+
+	// policy should be resolved successfully
+	resolution := resolvePolicy(t, b, ResSuccess, "Successfully resolved")
+	instance := getInstanceByParams(t, cluster, contract, contract.Contexts[0], nil, service, component, resolution)
+
+	// check merged code parameters
+	assert.Equal(t, "5", instance.CalculatedCodeParams["replicas"], "Max value should be taken")
+	assert.Equal(t, "alice,bob,carol,dave", instance.CalculatedCodeParams.GetNestedMap("auth")["users"], "Union of values should be taken")
+	first := d1
+	for _, d := range []*lang.Dependency{d2, d3} {
+		if runtime.KeyForStorable(d) < runtime.KeyForStorable(first) {
+			first = d
+		}
+	}
+	assert.Equal(t, first.Labels["version"], instance.CalculatedCodeParams["version"], "Value from the first dependency should be taken")
+	assert.Equal(t, "fixed", instance.CalculatedCodeParams["name"], "Code parameter without merge strategy should be calculated correctly")
+
+	// check which dependencies contributed values
+	assert.Equal(t, []string{runtime.KeyForStorable(d2)}, instance.CodeParamsSources["replicas"], "Dependency which contributed max value should be recorded")
+	assert.Equal(t, 3, len(instance.CodeParamsSources["auth.users"]), "All dependencies should be recorded for union")
+	assert.Equal(t, []string{runtime.KeyForStorable(first)}, instance.CodeParamsSources["version"], "First dependency should be recorded")
+
+	// values which can't be merged should still be rejected
+	d3.Labels["replicas"] = "many"
+	resolvePolicy(t, b, ResError, "Conflicting code parameters")
+}
+
+func TestPolicyResolverReplicatedComponent(t *testing.T) {
+	b := builder.NewPolicyBuilder()
+
+	// create a service with replicated component and a component which uses all of its shards
+	service := b.AddService()
+	shard := b.CodeComponent(
+		util.NestedParameterMap{"shard": "{{ .Shard.Index }}-of-{{ .Shard.Count }}"},
+		util.NestedParameterMap{"url": "shard-{{ .Shard.Index }}"},
+	)
+	shard.Count = "{{ .Labels.shards }}"
+	b.AddServiceComponent(service, shard)
+	router := b.CodeComponent(
+		util.NestedParameterMap{
+			"urls":      fmt.Sprintf("{{ range .Discovery.%s.shards }}{{ .url }},{{ end }}", shard.Name),
+			"instances": fmt.Sprintf("{{ range .Discovery.%s.shards }}{{ .instance }},{{ end }}", shard.Name),
+			"count":     fmt.Sprintf("{{ .Discovery.%s.count }}", shard.Name),
+		},
+		nil,
+	)
+	router.Dependencies = []string{shard.Name}
+	b.AddServiceComponent(service, router)
+
+	contract := b.AddContract(service, b.CriteriaTrue())
+	cluster := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster.Name)))
+
+	d1 := b.AddDependency(b.AddUser(), contract)
+	d1.Labels["shards"] = "3"
+
+	// policy should be resolved successfully
+	resolution := resolvePolicy(t, b, ResSuccess, "Successfully resolved")
+
+	// every shard should be a separate component instance
+	key := NewComponentInstanceKey(cluster, contract, contract.Contexts[0], nil, service, shard)
+	deployNames := make(map[string]bool)
+	shardInstances := ""
+	for idx := 0; idx < 3; idx++ {
+		instance := resolution.ComponentInstanceMap[key.WithShard(idx).GetKey()]
+		if !assert.NotNil(t, instance, "Shard %d should be instantiated", idx) {
+			continue
+		}
+		assert.Equal(t, fmt.Sprintf("%d-of-3", idx), instance.CalculatedCodeParams["shard"], "Shard index should be available to code params")
+		deployNames[instance.GetDeployName()] = true
+		shardInstances += util.EscapeName(instance.GetDeployName()) + ","
+	}
+	assert.Equal(t, 3, len(deployNames), "Every shard should have its own deploy name")
+	assert.Nil(t, resolution.ComponentInstanceMap[key.WithShard(3).GetKey()], "Only requested number of shards should be instantiated")
+
+	// downstream component should see all shards in discovery
+	instance := getInstanceByParams(t, cluster, contract, contract.Contexts[0], nil, service, router, resolution)
+	assert.Equal(t, "shard-0,shard-1,shard-2,", instance.CalculatedCodeParams["urls"], "All shards should be available in discovery")
+	assert.Equal(t, shardInstances, instance.CalculatedCodeParams["instances"], "Instance of every shard should be available in discovery")
+	assert.Equal(t, "3", instance.CalculatedCodeParams["count"], "Number of shards should be available in discovery")
+
+	// count must be a non-negative integer
+	d1.Labels["shards"] = "many"
+	resolvePolicy(t, b, ResError, "count must be a non-negative integer")
+}
+
 func TestPolicyResolverConflictingDiscoveryParams(t *testing.T) {
 	b := builder.NewPolicyBuilder()
 
@@ -413,6 +731,197 @@ func TestPolicyResolverInternalPanic(t *testing.T) {
 	assert.Nil(t, resolution, "Policy should not be resolved when panic occurred")
 }
 
+func TestPolicyResolverAffinity(t *testing.T) {
+	for _, sameCluster := range []bool{true, false} {
+		b := builder.NewPolicyBuilder()
+
+		// create a service which consumes another service and requires it to be placed into the same cluster
+		service2 := b.AddService()
+		b.AddServiceComponent(service2, b.CodeComponent(nil, nil))
+		contract2 := b.AddContract(service2, b.CriteriaTrue())
+
+		service1 := b.AddService()
+		component := b.AddServiceComponent(service1, b.ContractComponent(contract2))
+		service1.Affinity = &lang.Affinity{SameClusterAs: []string{component.Contract}}
+		contract1 := b.AddContract(service1, b.CriteriaTrue())
+
+		// add rule to set cluster
+		cluster1 := b.AddCluster()
+		b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster1.Name)))
+
+		// optionally make rules move consumed service into a different cluster
+		if !sameCluster {
+			cluster2 := b.AddCluster()
+			contract2.Contexts[0].ChangeLabels = lang.NewLabelOperationsSetSingleLabel("placement", "elsewhere")
+			b.AddRule(b.Criteria("placement == 'elsewhere'", "true", "false"), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster2.Name)))
+		}
+
+		// add dependency
+		d := b.AddDependency(b.AddUser(), contract1)
+
+		// policy resolution should be completed successfully
+		resolution := resolvePolicy(t, b, ResSuccess, "Successfully resolved")
+
+		// consumed service instance should be placed into the same cluster as the consumer, regardless of rules
+		consumer := getInstanceByDependencyKey(t, runtime.KeyForStorable(d), resolution)
+		assert.Equal(t, cluster1.Name, consumer.Metadata.Key.ClusterName, "Consumer should be placed into the cluster set by rules")
+		consumed := getInstanceByParams(t, cluster1, contract2, contract2.Contexts[0], nil, service2, nil, resolution)
+		assert.Contains(t, consumed.DependencyKeys, runtime.KeyForStorable(d), "Consumed service instance should be placed into the cluster of the consumer")
+	}
+}
+
+func TestPolicyResolverAntiAffinity(t *testing.T) {
+	for _, clusterCount := range []int{1, 2} {
+		for _, antiAffinity := range []bool{false, true} {
+			b := builder.NewPolicyBuilder()
+
+			// create a service with a contract, which allocates a separate instance per user
+			service := b.AddService()
+			b.AddServiceComponent(service, b.CodeComponent(nil, nil))
+			contract := b.AddContract(service, b.CriteriaTrue())
+			contract.Contexts[0].Allocation.Keys = b.AllocationKeys("{{.User.Name}}")
+			contract.Contexts[0].AntiAffinity = antiAffinity
+
+			// add rule to set cluster (rules put all instances into the same cluster)
+			cluster := b.AddCluster()
+			for i := 1; i < clusterCount; i++ {
+				b.AddCluster()
+			}
+			b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster.Name)))
+
+			// add dependencies from different users
+			d1 := b.AddDependency(b.AddUser(), contract)
+			d2 := b.AddDependency(b.AddUser(), contract)
+
+			// policy resolution should fail, if anti-affinity can't be satisfied
+			if antiAffinity && clusterCount <= 1 {
+				resolvePolicy(t, b, ResError, "anti-affinity excludes cluster '"+cluster.Name+"' occupied by instance")
+				continue
+			}
+
+			resolution := resolvePolicy(t, b, ResSuccess, "Successfully resolved")
+			if !antiAffinity {
+				// both instances should be placed into the cluster set by rules
+				assert.Equal(t, cluster.Name, getInstanceByDependencyKey(t, runtime.KeyForStorable(d1), resolution).Metadata.Key.ClusterName, "Instance should be placed into the cluster set by rules")
+				assert.Equal(t, cluster.Name, getInstanceByDependencyKey(t, runtime.KeyForStorable(d2), resolution).Metadata.Key.ClusterName, "Instance should be placed into the cluster set by rules")
+			} else {
+				// instances should be placed into different clusters
+				cluster1 := getInstanceByDependencyKey(t, runtime.KeyForStorable(d1), resolution).Metadata.Key.ClusterName
+				cluster2 := getInstanceByDependencyKey(t, runtime.KeyForStorable(d2), resolution).Metadata.Key.ClusterName
+				assert.NotEqual(t, cluster1, cluster2, "Instances allocated for different keys should be placed into different clusters")
+			}
+		}
+	}
+}
+
+func TestPolicyResolverAntiAffinityRulesReprocessed(t *testing.T) {
+	for _, rejectCluster := range []bool{false, true} {
+		b := builder.NewPolicyBuilder()
+
+		// create a service with a contract, which allocates a separate instance per user
+		service := b.AddService()
+		b.AddServiceComponent(service, b.CodeComponent(util.NestedParameterMap{"zone": "{{ .Labels.zone }}"}, nil))
+		contract := b.AddContract(service, b.CriteriaTrue())
+		contract.Contexts[0].Allocation.Keys = b.AllocationKeys("{{.User.Name}}")
+		contract.Contexts[0].AntiAffinity = true
+
+		// rules put all instances into the first cluster and set labels depending on the cluster
+		cluster1 := b.AddCluster()
+		cluster2 := b.AddCluster()
+		b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster1.Name)))
+		b.AddRule(b.Criteria("cluster == '"+cluster2.Name+"'", "true", "false"), b.RuleActions(lang.NewLabelOperationsSetSingleLabel("zone", "second")))
+		if rejectCluster {
+			rule := b.AddRule(b.Criteria("cluster == '"+cluster2.Name+"'", "true", "false"), b.RuleActions(nil))
+			rule.Actions.Dependency = lang.Reject
+		}
+
+		d1 := b.AddDependency(b.AddUser(), contract)
+		d2 := b.AddDependency(b.AddUser(), contract)
+		d1.Labels["zone"] = "first"
+		d2.Labels["zone"] = "first"
+
+		// instance moved into another cluster by anti-affinity can't end up in a cluster rejected by rules
+		if rejectCluster {
+			resolvePolicy(t, b, ResError, "rules reject clusters '"+cluster2.Name+"'")
+			continue
+		}
+
+		// rules get processed again for the cluster selected by anti-affinity
+		resolution := resolvePolicy(t, b, ResSuccess, "Successfully resolved")
+		zones := map[string]string{}
+		for _, d := range []*lang.Dependency{d1, d2} {
+			instance := getInstanceByDependencyKey(t, runtime.KeyForStorable(d), resolution)
+			zones[instance.Metadata.Key.ClusterName] = instance.CalculatedLabels.Labels["zone"]
+		}
+		assert.Equal(t, map[string]string{cluster1.Name: "first", cluster2.Name: "second"}, zones, "Labels should be calculated by rules for the cluster every instance is placed into")
+	}
+}
+
+func TestPolicyResolutionValidateAffinity(t *testing.T) {
+	// move a given service instance into another cluster
+	move := func(resolution *PolicyResolution, contract *lang.Contract, from *lang.Cluster, to *lang.Cluster) {
+		t.Helper()
+		for _, key := range util.GetSortedStringKeys(resolution.ComponentInstanceMap) {
+			instanceKey := resolution.ComponentInstanceMap[key].Metadata.Key
+			if instanceKey.IsService() && instanceKey.ContractName == contract.Name && instanceKey.ClusterName == from.Name {
+				instanceKey.ClusterName = to.Name
+				return
+			}
+		}
+		t.Fatalf("Service instance of contract '%s' not found in cluster '%s'", contract.Name, from.Name)
+	}
+
+	// consumed service instance placed away from its consumer violates affinity
+	{
+		b := builder.NewPolicyBuilder()
+		service2 := b.AddService()
+		b.AddServiceComponent(service2, b.CodeComponent(nil, nil))
+		contract2 := b.AddContract(service2, b.CriteriaTrue())
+
+		service1 := b.AddService()
+		component := b.AddServiceComponent(service1, b.ContractComponent(contract2))
+		service1.Affinity = &lang.Affinity{SameClusterAs: []string{component.Contract}}
+		contract1 := b.AddContract(service1, b.CriteriaTrue())
+
+		cluster1 := b.AddCluster()
+		cluster2 := b.AddCluster()
+		b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster1.Name)))
+		b.AddDependency(b.AddUser(), contract1)
+
+		resolution := resolvePolicy(t, b, ResSuccess, "Successfully resolved")
+		assert.NoError(t, resolution.Validate(b.Policy()), "Resolution should be valid")
+		move(resolution, contract2, cluster1, cluster2)
+		err := resolution.Validate(b.Policy())
+		if assert.Error(t, err, "Resolution violating affinity should not be valid") {
+			assert.Contains(t, err.Error(), "affinity violated for service", "Affinity violation should be reported")
+		}
+	}
+
+	// service instances allocated for different keys in the same cluster violate anti-affinity
+	{
+		b := builder.NewPolicyBuilder()
+		service := b.AddService()
+		b.AddServiceComponent(service, b.CodeComponent(nil, nil))
+		contract := b.AddContract(service, b.CriteriaTrue())
+		contract.Contexts[0].Allocation.Keys = b.AllocationKeys("{{.User.Name}}")
+		contract.Contexts[0].AntiAffinity = true
+
+		cluster1 := b.AddCluster()
+		cluster2 := b.AddCluster()
+		b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster1.Name)))
+		b.AddDependency(b.AddUser(), contract)
+		b.AddDependency(b.AddUser(), contract)
+
+		resolution := resolvePolicy(t, b, ResSuccess, "Successfully resolved")
+		assert.NoError(t, resolution.Validate(b.Policy()), "Resolution should be valid")
+		move(resolution, contract, cluster2, cluster1)
+		err := resolution.Validate(b.Policy())
+		if assert.Error(t, err, "Resolution violating anti-affinity should not be valid") {
+			assert.Contains(t, err.Error(), "anti-affinity violated for context", "Anti-affinity violation should be reported")
+		}
+	}
+}
+
 /*
 	Helpers
 */
@@ -425,7 +934,7 @@ const (
 func resolvePolicy(t *testing.T, builder *builder.PolicyBuilder, expectedResult int, expectedLogMessage string) *PolicyResolution {
 	t.Helper()
 	eventLog := event.NewLog("test-resolve", false)
-	resolver := NewPolicyResolver(builder.Policy(), builder.External(), eventLog)
+	resolver := NewPolicyResolver(builder.Policy(), builder.External(), nil, eventLog)
 	result, err := resolver.ResolveAllDependencies()
 
 	if !assert.Equal(t, expectedResult != ResError, err == nil, "Policy resolution status (success vs. error)") {
@@ -471,3 +980,17 @@ func getInstanceByParams(t *testing.T, cluster *lang.Cluster, contract *lang.Con
 	}
 	return instance
 }
+
+// entriesHook collects string representations of all event log entries, including their fields
+type entriesHook struct {
+	entries []string
+}
+
+func (hook *entriesHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hook *entriesHook) Fire(e *logrus.Entry) error {
+	hook.entries = append(hook.entries, fmt.Sprintf("%s %v", e.Message, e.Data))
+	return nil
+}
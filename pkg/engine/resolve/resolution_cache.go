@@ -0,0 +1,92 @@
+package resolve
+
+import (
+	"github.com/Aptomi/aptomi/pkg/external"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"sync"
+	"time"
+)
+
+// ResolutionCacheKey identifies inputs, which PolicyResolution has been calculated for
+type ResolutionCacheKey struct {
+	// PolicyGen is a generation of the policy
+	PolicyGen runtime.Generation
+
+	// ExternalDataVersion is a version of external data (users and secrets)
+	ExternalDataVersion uint64
+
+	// Weekday is included, because dependencies can be suspended on certain days of the week
+	Weekday time.Weekday
+}
+
+// NewResolutionCacheKey creates a cache key for a given policy generation and external data at a given moment of time
+func NewResolutionCacheKey(policyGen runtime.Generation, externalData *external.Data, now time.Time) ResolutionCacheKey {
+	return ResolutionCacheKey{
+		PolicyGen:           policyGen,
+		ExternalDataVersion: externalData.Version(),
+		Weekday:             now.Weekday(),
+	}
+}
+
+// ResolutionCache keeps PolicyResolution results in memory, so policy doesn't have to be resolved again when neither
+// policy nor external data have changed. It holds a limited number of entries, evicting the oldest ones first.
+// Resolutions get copied when they are put into the cache and retrieved from it, so callers can modify them (e.g.
+// while applying desired state) and use them concurrently.
+// Results depend on the actual state as well (e.g. on outputs of deployed component instances), so the cache has to be
+// invalidated explicitly when the actual state changes in a way that affects resolution.
+type ResolutionCache struct {
+	mutex   sync.Mutex
+	size    int
+	keys    []ResolutionCacheKey
+	entries map[ResolutionCacheKey]*PolicyResolution
+}
+
+// NewResolutionCache creates a new empty resolution cache, which holds up to a given number of entries
+func NewResolutionCache(size int) *ResolutionCache {
+	return &ResolutionCache{
+		size:    size,
+		entries: make(map[ResolutionCacheKey]*PolicyResolution),
+	}
+}
+
+// Get returns a copy of cached PolicyResolution for a given key, or nil if it's not in the cache
+func (cache *ResolutionCache) Get(key ResolutionCacheKey) *PolicyResolution {
+	cache.mutex.Lock()
+	resolution := cache.entries[key]
+	cache.mutex.Unlock()
+
+	if resolution == nil {
+		return nil
+	}
+	return resolution.makeCopy()
+}
+
+// Put stores a copy of PolicyResolution in the cache under a given key
+func (cache *ResolutionCache) Put(key ResolutionCacheKey, resolution *PolicyResolution) {
+	resolution = resolution.makeCopy()
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.size <= 0 {
+		return
+	}
+
+	if _, exists := cache.entries[key]; !exists {
+		if len(cache.keys) >= cache.size {
+			delete(cache.entries, cache.keys[0])
+			cache.keys = cache.keys[1:]
+		}
+		cache.keys = append(cache.keys, key)
+	}
+	cache.entries[key] = resolution
+}
+
+// Invalidate removes all entries from the cache
+func (cache *ResolutionCache) Invalidate() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.keys = nil
+	cache.entries = make(map[ResolutionCacheKey]*PolicyResolution)
+}
@@ -0,0 +1,95 @@
+package resolve
+
+import (
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/lang/builder"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestResolutionCache(t *testing.T) {
+	externalData := builder.NewPolicyBuilder().External()
+	now := time.Now()
+	cache := NewResolutionCache(2)
+
+	key1 := NewResolutionCacheKey(runtime.Generation(1), externalData, now)
+	resolution1 := NewPolicyResolution(true)
+	cache.Put(key1, resolution1)
+	assert.Equal(t, resolution1, cache.Get(key1), "Resolution should be retrieved from the cache")
+
+	// different weekday or policy generation should not hit the cache
+	assert.Nil(t, cache.Get(NewResolutionCacheKey(runtime.Generation(1), externalData, now.AddDate(0, 0, 1))), "Resolution should not be cached for a different weekday")
+	assert.Nil(t, cache.Get(NewResolutionCacheKey(runtime.Generation(2), externalData, now)), "Resolution should not be cached for a different policy generation")
+
+	// external data change should not hit the cache
+	externalData.Invalidate()
+	assert.Nil(t, cache.Get(NewResolutionCacheKey(runtime.Generation(1), externalData, now)), "Resolution should not be cached for a different external data version")
+
+	// oldest entries should be evicted
+	key2 := NewResolutionCacheKey(runtime.Generation(2), externalData, now)
+	key3 := NewResolutionCacheKey(runtime.Generation(3), externalData, now)
+	cache.Put(key2, NewPolicyResolution(true))
+	cache.Put(key3, NewPolicyResolution(true))
+	assert.Nil(t, cache.Get(key1), "Oldest resolution should be evicted from the cache")
+	assert.NotNil(t, cache.Get(key2), "Resolution should be retrieved from the cache")
+	assert.NotNil(t, cache.Get(key3), "Resolution should be retrieved from the cache")
+
+	// invalidation should remove everything
+	cache.Invalidate()
+	assert.Nil(t, cache.Get(key2), "Resolution should not be retrieved after cache invalidation")
+	assert.Nil(t, cache.Get(key3), "Resolution should not be retrieved after cache invalidation")
+}
+
+func TestResolutionCacheReturnsCopies(t *testing.T) {
+	b := builder.NewPolicyBuilder()
+	service := b.AddService()
+	b.AddServiceComponent(service, b.CodeComponent(util.NestedParameterMap{"nested": util.NestedParameterMap{"name": "value"}}, nil))
+	contract := b.AddContract(service, b.CriteriaTrue())
+	cluster := b.AddCluster()
+	b.AddRule(b.CriteriaTrue(), b.RuleActions(lang.NewLabelOperationsSetSingleLabel(lang.LabelCluster, cluster.Name)))
+	b.AddDependency(b.AddUser(), contract)
+	resolution := resolvePolicy(t, b, ResSuccess, "Successfully resolved")
+
+	cache := NewResolutionCache(1)
+	key := NewResolutionCacheKey(runtime.Generation(1), b.External(), time.Now())
+	cache.Put(key, resolution)
+
+	// modifying the original resolution should not affect the cache
+	for _, instance := range resolution.ComponentInstanceMap {
+		instance.DependencyKeys["modified"] = true
+	}
+	for _, instance := range cache.Get(key).ComponentInstanceMap {
+		assert.NotContains(t, instance.DependencyKeys, "modified", "Cached resolution should not be affected by changes in the original")
+	}
+
+	// resolutions retrieved from the cache should be safe to modify concurrently (run with -race)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for _, instance := range cache.Get(key).ComponentInstanceMap {
+				instance.DependencyKeys["modified"] = true
+				instance.CalculatedLabels.Labels["modified"] = "true"
+				instance.Job = &JobStatus{ExitCode: i}
+				if nested, ok := instance.CalculatedCodeParams["nested"].(util.NestedParameterMap); ok {
+					nested["name"] = "modified"
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, instance := range cache.Get(key).ComponentInstanceMap {
+		assert.NotContains(t, instance.DependencyKeys, "modified", "Cached resolution should not be affected by changes in retrieved copies")
+		assert.NotContains(t, instance.CalculatedLabels.Labels, "modified", "Cached resolution should not be affected by changes in retrieved copies")
+		assert.Nil(t, instance.Job, "Cached resolution should not be affected by changes in retrieved copies")
+		if nested, ok := instance.CalculatedCodeParams["nested"].(util.NestedParameterMap); ok {
+			assert.Equal(t, "value", nested["name"], "Cached resolution should not be affected by changes in retrieved copies")
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"fmt"
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"time"
@@ -38,8 +39,14 @@ type Revision struct {
 	Progress  RevisionProgress
 	AppliedAt time.Time
 
+	// Rollouts represents progress of staged rollouts of services (service key -> progress)
+	Rollouts map[string]*RolloutProgress
+
 	ResolveLog []*event.APIEvent
 	ApplyLog   []*event.APIEvent
+
+	// Compacted is set when logs of the revision have been trimmed down to warnings and errors to save space
+	Compacted bool `yaml:",omitempty"`
 }
 
 // RevisionProgress represents revision applying progress
@@ -48,6 +55,80 @@ type RevisionProgress struct {
 	Total   int
 }
 
+const (
+	// RolloutStatusInProgress represents rollout status with instances in the current stage being updated
+	RolloutStatusInProgress = "inprogress"
+	// RolloutStatusSoaking represents rollout status with the current stage completed and soak period not passed yet
+	RolloutStatusSoaking = "soaking"
+	// RolloutStatusWaitingApproval represents rollout status with the current stage completed and waiting for approval
+	RolloutStatusWaitingApproval = "waiting-approval"
+	// RolloutStatusAborted represents rollout status with too many failed updates within a stage
+	RolloutStatusAborted = "aborted"
+	// RolloutStatusCompleted represents rollout status with all instances updated
+	RolloutStatusCompleted = "completed"
+)
+
+// RolloutProgress represents progress of a staged rollout of updates across instances of a service
+type RolloutProgress struct {
+	// Service is a key of the service being rolled out
+	Service string
+
+	// Policy represents generation of the policy, which rollout is performed for
+	Policy runtime.Generation
+
+	Status  string
+	Message string
+
+	// Stage is the name of the current stage (empty for the last, implicit stage) and StageIndex is its index
+	Stage      string
+	StageIndex int
+
+	// StageCompletedAt is the time when all instances in the current stage got updated
+	StageCompletedAt time.Time
+
+	// Approved indicates that rollout has been approved to continue with the next stage
+	Approved bool
+
+	// Total, Updated and Failed are the numbers of service instances in the current stage
+	Total   int
+	Updated int
+	Failed  int
+
+	// Pending is the number of service instances across all stages, which haven't been updated yet
+	Pending int
+}
+
+// ApproveRollout approves rollout of a given service to continue with the next stage. Rollout must be waiting for
+// approval
+func (revision *Revision) ApproveRollout(serviceKey string) error {
+	progress, ok := revision.Rollouts[serviceKey]
+	if !ok {
+		return fmt.Errorf("rollout of service '%s' not found", serviceKey)
+	}
+	if progress.Status != RolloutStatusWaitingApproval {
+		return fmt.Errorf("rollout of service '%s' is not waiting for approval, its status is '%s'", serviceKey, progress.Status)
+	}
+	progress.Approved = true
+	return nil
+}
+
+// MergeApprovals copies approvals of rollouts from a given revision, if they are still waiting for approval of the same
+// stage. It's used when saving revision, so approvals made while it was being processed don't get lost
+func (revision *Revision) MergeApprovals(from *Revision) {
+	if from == nil {
+		return
+	}
+	for serviceKey, approved := range from.Rollouts {
+		progress, ok := revision.Rollouts[serviceKey]
+		if !ok || !approved.Approved || progress.Approved {
+			continue
+		}
+		if progress.Status == RolloutStatusWaitingApproval && progress.Policy == approved.Policy && progress.StageIndex == approved.StageIndex {
+			progress.Approved = true
+		}
+	}
+}
+
 // GetName returns Revision name
 func (revision *Revision) GetName() string {
 	return runtime.EmptyName
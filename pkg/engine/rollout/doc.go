@@ -0,0 +1,4 @@
+// Package rollout implements staged rollouts of updates across instances of a service. It decides which updates can
+// be applied in the current revision according to rollout policies of services, and tracks rollout progress across
+// revisions.
+package rollout
@@ -0,0 +1,330 @@
+package rollout
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action/component"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action/global"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/lang/expression"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"sort"
+	"time"
+)
+
+// Planner decides which updates of service instances can be applied in the current revision, according to rollout
+// policies of services. Updates of service instances which belong to later stages get deferred, so they will show
+// up again in the next revisions, once rollout gets to their stage
+type Planner struct {
+	policy       *lang.Policy
+	policyGen    runtime.Generation
+	desiredState *resolve.PolicyResolution
+	actualState  *resolve.PolicyResolution
+	now          time.Time
+
+	// rollout progress (service key -> progress)
+	progress map[string]*engine.RolloutProgress
+
+	// stage indexes of service instances (service key -> service instance key -> stage index)
+	stages map[string]map[string]int
+
+	// service instances which updates are deferred (service instance key -> true)
+	deferred map[string]bool
+}
+
+// NewPlanner creates a new rollout planner, given desired policy and its generation, desired and actual states, as
+// well as rollout progress recorded in the previous revision
+func NewPlanner(policy *lang.Policy, policyGen runtime.Generation, desiredState *resolve.PolicyResolution, actualState *resolve.PolicyResolution, prevProgress map[string]*engine.RolloutProgress, now time.Time) *Planner {
+	progress := make(map[string]*engine.RolloutProgress)
+	for key, value := range prevProgress {
+		valueCopy := *value
+		progress[key] = &valueCopy
+	}
+	return &Planner{
+		policy:       policy,
+		policyGen:    policyGen,
+		desiredState: desiredState,
+		actualState:  actualState,
+		now:          now,
+		progress:     progress,
+		stages:       make(map[string]map[string]int),
+		deferred:     make(map[string]bool),
+	}
+}
+
+// Progress returns rollout progress (service key -> progress)
+func (planner *Planner) Progress() map[string]*engine.RolloutProgress {
+	return planner.progress
+}
+
+// Filter advances rollouts of all services and returns the list of actions, which can be applied in the current
+// revision. Update actions for service instances in later stages get removed from the list
+func (planner *Planner) Filter(actions []action.Base) ([]action.Base, error) {
+	outdated := planner.getOutdatedServiceInstances()
+	services := make(map[string]bool)
+	for _, obj := range planner.policy.GetObjectsByKind(lang.ServiceObject.Kind) {
+		service := obj.(*lang.Service)
+		if service.Rollout == nil {
+			continue
+		}
+		services[runtime.KeyForStorable(service)] = true
+		err := planner.advance(service, outdated)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// forget about rollouts of services, which have been removed or don't have rollout policy anymore
+	for serviceKey := range planner.progress {
+		if !services[serviceKey] {
+			delete(planner.progress, serviceKey)
+		}
+	}
+
+	if len(planner.deferred) <= 0 {
+		return actions, nil
+	}
+
+	result := []action.Base{}
+	componentActions := 0
+	for _, act := range actions {
+		if update, ok := act.(*component.UpdateAction); ok && planner.deferred[planner.getServiceInstanceKey(update.ComponentKey)] {
+			continue
+		}
+		if _, ok := act.(*global.PostProcessAction); !ok {
+			componentActions++
+		}
+		result = append(result, act)
+	}
+
+	// don't run post-processing if all actions got deferred
+	if componentActions <= 0 {
+		return []action.Base{}, nil
+	}
+	return result, nil
+}
+
+// RecordResults updates rollout progress after actions have been applied, counting failed updates within the current
+// stages and aborting rollouts which exceed their error thresholds
+func (planner *Planner) RecordResults(actualState *resolve.PolicyResolution) {
+	planner.actualState = actualState
+	outdated := planner.getOutdatedServiceInstances()
+	for _, obj := range planner.policy.GetObjectsByKind(lang.ServiceObject.Kind) {
+		service := obj.(*lang.Service)
+		serviceKey := runtime.KeyForStorable(service)
+		progress := planner.progress[serviceKey]
+		if service.Rollout == nil || progress == nil || progress.Policy != planner.policyGen || progress.Status != engine.RolloutStatusInProgress {
+			continue
+		}
+
+		progress.Failed = 0
+		for instanceKey, stageIdx := range planner.stages[serviceKey] {
+			if stageIdx == progress.StageIndex && outdated[instanceKey] && !planner.deferred[instanceKey] {
+				progress.Failed++
+			}
+		}
+		progress.Updated = progress.Total - progress.Failed
+
+		threshold := service.Rollout.ErrorThreshold
+		if threshold > 0 && progress.Failed*100 > threshold*progress.Total {
+			progress.Status = engine.RolloutStatusAborted
+			progress.Message = fmt.Sprintf("%d out of %d instances failed to update in stage '%s', exceeding error threshold of %d%%", progress.Failed, progress.Total, progress.Stage, threshold)
+		} else if progress.Failed <= 0 {
+			progress.StageCompletedAt = planner.now
+		}
+	}
+}
+
+// advance moves rollout of a given service through the stages, which have been completed, and defers updates of
+// service instances in stages which haven't been reached yet
+func (planner *Planner) advance(service *lang.Service, outdated map[string]bool) error {
+	serviceKey := runtime.KeyForStorable(service)
+	instances := planner.getServiceInstances(service)
+
+	stages, err := planner.assignStages(service, instances)
+	if err != nil {
+		return err
+	}
+	planner.stages[serviceKey] = stages
+
+	pending := 0
+	for _, instanceKey := range instances {
+		if outdated[instanceKey] {
+			pending++
+		}
+	}
+
+	progress := planner.progress[serviceKey]
+	if pending <= 0 {
+		// nothing to roll out, mark rollout as completed if there was one
+		if progress != nil && progress.Status != engine.RolloutStatusAborted {
+			progress.Status = engine.RolloutStatusCompleted
+			progress.Message = ""
+			progress.Pending = 0
+		}
+		return nil
+	}
+
+	// start a new rollout if policy has changed
+	if progress == nil || progress.Policy != planner.policyGen {
+		progress = &engine.RolloutProgress{
+			Service: serviceKey,
+			Policy:  planner.policyGen,
+			Status:  engine.RolloutStatusInProgress,
+		}
+		planner.progress[serviceKey] = progress
+	}
+	progress.Pending = pending
+
+	if progress.Status != engine.RolloutStatusAborted {
+		planner.advanceStages(service, progress, stages, outdated)
+	}
+
+	// defer updates of service instances in the stages, which haven't been reached yet
+	for _, instanceKey := range instances {
+		if !outdated[instanceKey] {
+			continue
+		}
+		if progress.Status != engine.RolloutStatusInProgress || stages[instanceKey] > progress.StageIndex {
+			planner.deferred[instanceKey] = true
+		}
+	}
+	return nil
+}
+
+// advanceStages moves rollout to the next stage for as long as the current stage is completed, its soak period has
+// passed and it's been approved (if approval is required)
+func (planner *Planner) advanceStages(service *lang.Service, progress *engine.RolloutProgress, stages map[string]int, outdated map[string]bool) {
+	for {
+		progress.Stage = ""
+		if progress.StageIndex < len(service.Rollout.Stages) {
+			progress.Stage = service.Rollout.Stages[progress.StageIndex].Name
+		}
+
+		progress.Total = 0
+		progress.Updated = 0
+		for instanceKey, stageIdx := range stages {
+			if stageIdx == progress.StageIndex {
+				progress.Total++
+				if !outdated[instanceKey] {
+					progress.Updated++
+				}
+			}
+		}
+
+		// there are instances to update in the current stage, or it's the last stage
+		if progress.Updated < progress.Total || progress.StageIndex >= len(service.Rollout.Stages) {
+			progress.Status = engine.RolloutStatusInProgress
+			progress.Message = ""
+			return
+		}
+
+		// the current stage has been completed
+		stage := service.Rollout.Stages[progress.StageIndex]
+		if progress.StageCompletedAt.IsZero() {
+			progress.StageCompletedAt = planner.now
+		}
+		soakUntil := progress.StageCompletedAt.Add(stage.Soak)
+		if planner.now.Before(soakUntil) {
+			progress.Status = engine.RolloutStatusSoaking
+			progress.Message = fmt.Sprintf("stage '%s' is soaking until %s", stage.Name, soakUntil.Format(time.RFC3339))
+			return
+		}
+		if stage.Approval && !progress.Approved {
+			progress.Status = engine.RolloutStatusWaitingApproval
+			progress.Message = fmt.Sprintf("stage '%s' is waiting for approval", stage.Name)
+			return
+		}
+
+		// move on to the next stage
+		progress.StageIndex++
+		progress.StageCompletedAt = time.Time{}
+		progress.Approved = false
+		progress.Failed = 0
+	}
+}
+
+// assignStages splits service instances into rollout stages. Every stage takes instances matching its criteria out
+// of the remaining ones, limited by its percentage of all instances. Instances which don't belong to any stage go
+// into the last, implicit stage
+func (planner *Planner) assignStages(service *lang.Service, instances []string) (map[string]int, error) {
+	result := make(map[string]int)
+	cache := expression.NewCache()
+	for idx, stage := range service.Rollout.Stages {
+		limit := len(instances)
+		if stage.Percent > 0 {
+			limit = (len(instances)*stage.Percent + 99) / 100
+		}
+
+		count := 0
+		for _, instanceKey := range instances {
+			if count >= limit {
+				break
+			}
+			if _, assigned := result[instanceKey]; assigned {
+				continue
+			}
+
+			labels := planner.desiredState.ComponentInstanceMap[instanceKey].CalculatedLabels
+			matches, err := stage.Matches(expression.NewParams(labels.Labels, nil), cache)
+			if err != nil {
+				return nil, fmt.Errorf("unable to evaluate criteria of rollout stage '%s' for service '%s': %s", stage.Name, service.Name, err)
+			}
+			if matches {
+				result[instanceKey] = idx
+				count++
+			}
+		}
+	}
+
+	for _, instanceKey := range instances {
+		if _, assigned := result[instanceKey]; !assigned {
+			result[instanceKey] = len(service.Rollout.Stages)
+		}
+	}
+	return result, nil
+}
+
+// getServiceInstances returns a sorted list of keys of service instances, which exist in both desired and actual
+// state. New service instances are not subject to rollout, as there is nothing to update
+func (planner *Planner) getServiceInstances(service *lang.Service) []string {
+	result := []string{}
+	for key, instance := range planner.desiredState.ComponentInstanceMap {
+		cik := instance.Metadata.Key
+		if !cik.IsService() || cik.Namespace != service.Namespace || cik.ServiceName != service.Name {
+			continue
+		}
+		if _, exists := planner.actualState.ComponentInstanceMap[key]; exists {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// getOutdatedServiceInstances returns keys of service instances, which have at least one component instance with
+// code parameters different in desired and actual state
+func (planner *Planner) getOutdatedServiceInstances() map[string]bool {
+	result := make(map[string]bool)
+	for key, instance := range planner.desiredState.ComponentInstanceMap {
+		instanceActual, exists := planner.actualState.ComponentInstanceMap[key]
+		if !exists || len(instanceActual.DependencyKeys) <= 0 {
+			continue
+		}
+		if !instance.CalculatedCodeParams.DeepEqual(instanceActual.CalculatedCodeParams) {
+			result[instance.Metadata.Key.GetParentServiceKey().GetKey()] = true
+		}
+	}
+	return result
+}
+
+// getServiceInstanceKey returns a key of service instance, which component instance with a given key belongs to
+func (planner *Planner) getServiceInstanceKey(componentKey string) string {
+	instance, ok := planner.desiredState.ComponentInstanceMap[componentKey]
+	if !ok {
+		return componentKey
+	}
+	return instance.Metadata.Key.GetParentServiceKey().GetKey()
+}
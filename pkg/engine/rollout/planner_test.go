@@ -0,0 +1,216 @@
+package rollout
+
+import (
+	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action/component"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action/global"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/lang/builder"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/util"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type testData struct {
+	policy  *lang.Policy
+	service *lang.Service
+	desired *resolve.PolicyResolution
+	actual  *resolve.PolicyResolution
+
+	// component instance keys for every service instance, in the order of service instance keys
+	keys []*resolve.ComponentInstanceKey
+}
+
+func TestRolloutStages(t *testing.T) {
+	td := makeTestData(&lang.Rollout{
+		Stages: []*lang.RolloutStage{
+			{Name: "canary", Criteria: &lang.Criteria{RequireAll: []string{"stage == 'canary'"}}, Soak: time.Hour},
+			{Name: "half", Percent: 50, Approval: true},
+		},
+	}, 4, 2)
+	now := time.Now()
+
+	// only canary instance gets updated first
+	planner, actions := td.filter(t, nil, now)
+	progress := planner.Progress()[runtime.KeyForStorable(td.service)]
+	assert.Equal(t, engine.RolloutStatusInProgress, progress.Status, "Rollout should be in progress")
+	assert.Equal(t, "canary", progress.Stage, "Rollout should start with canary stage")
+	assert.Equal(t, 1, progress.Total, "Canary stage should have one instance")
+	assert.Equal(t, 4, progress.Pending, "All instances should be pending")
+	assert.Equal(t, []string{td.keys[2].GetKey()}, getUpdatedKeys(actions), "Only canary instance should be updated")
+
+	td.update(td.keys[2])
+	planner.RecordResults(td.actual)
+	assert.Equal(t, 1, progress.Updated, "Canary instance should be updated")
+
+	// rollout soaks after canary stage
+	planner, actions = td.filter(t, planner.Progress(), now.Add(30*time.Minute))
+	progress = planner.Progress()[runtime.KeyForStorable(td.service)]
+	assert.Equal(t, engine.RolloutStatusSoaking, progress.Status, "Rollout should be soaking")
+	assert.Empty(t, actions, "All updates should be deferred while soaking")
+
+	// once soak period is over, half of instances get updated
+	planner, actions = td.filter(t, planner.Progress(), now.Add(2*time.Hour))
+	progress = planner.Progress()[runtime.KeyForStorable(td.service)]
+	assert.Equal(t, engine.RolloutStatusInProgress, progress.Status, "Rollout should be in progress")
+	assert.Equal(t, "half", progress.Stage, "Rollout should continue with the next stage")
+	assert.Equal(t, 2, len(getUpdatedKeys(actions)), "Half of instances should be updated")
+
+	for _, key := range getUpdatedKeys(actions) {
+		td.update(td.desired.ComponentInstanceMap[key].Metadata.Key)
+	}
+	planner.RecordResults(td.actual)
+
+	// rollout waits for approval
+	planner, actions = td.filter(t, planner.Progress(), now.Add(3*time.Hour))
+	progress = planner.Progress()[runtime.KeyForStorable(td.service)]
+	assert.Equal(t, engine.RolloutStatusWaitingApproval, progress.Status, "Rollout should be waiting for approval")
+	assert.Empty(t, actions, "All updates should be deferred while waiting for approval")
+
+	revision := &engine.Revision{Rollouts: planner.Progress()}
+	assert.Error(t, revision.ApproveRollout("unknown"), "Unknown rollout should not be approved")
+	assert.NoError(t, revision.ApproveRollout(runtime.KeyForStorable(td.service)), "Rollout should be approved")
+
+	// once approved, the remaining instance gets updated
+	planner, actions = td.filter(t, revision.Rollouts, now.Add(3*time.Hour))
+	progress = planner.Progress()[runtime.KeyForStorable(td.service)]
+	assert.Equal(t, engine.RolloutStatusInProgress, progress.Status, "Rollout should be in progress")
+	assert.Equal(t, "", progress.Stage, "Rollout should continue with the last stage")
+	assert.Equal(t, 1, len(getUpdatedKeys(actions)), "Remaining instance should be updated")
+
+	for _, key := range getUpdatedKeys(actions) {
+		td.update(td.desired.ComponentInstanceMap[key].Metadata.Key)
+	}
+	planner.RecordResults(td.actual)
+
+	planner, actions = td.filter(t, planner.Progress(), now.Add(3*time.Hour))
+	progress = planner.Progress()[runtime.KeyForStorable(td.service)]
+	assert.Equal(t, engine.RolloutStatusCompleted, progress.Status, "Rollout should be completed")
+	assert.Empty(t, actions, "There should be nothing to update")
+}
+
+func TestRolloutErrorThreshold(t *testing.T) {
+	// one out of two instances in a stage fails to update
+	for threshold, expectedStatus := range map[int]string{
+		50: engine.RolloutStatusInProgress,
+		40: engine.RolloutStatusAborted,
+	} {
+		td := makeTestData(&lang.Rollout{
+			Stages:         []*lang.RolloutStage{{Name: "first", Percent: 50}},
+			ErrorThreshold: threshold,
+		}, 4, -1)
+		now := time.Now()
+
+		planner, actions := td.filter(t, nil, now)
+		assert.Equal(t, 2, len(getUpdatedKeys(actions)), "Half of instances should be updated")
+		td.update(td.desired.ComponentInstanceMap[getUpdatedKeys(actions)[0]].Metadata.Key)
+		planner.RecordResults(td.actual)
+		progress := planner.Progress()[runtime.KeyForStorable(td.service)]
+		assert.Equal(t, expectedStatus, progress.Status, "Rollout status with error threshold %d%%", threshold)
+		assert.Equal(t, 1, progress.Failed, "One instance should fail")
+
+		// failed instance gets retried, unless rollout has been aborted
+		planner, actions = td.filter(t, planner.Progress(), now)
+		if expectedStatus == engine.RolloutStatusAborted {
+			assert.Empty(t, actions, "All updates should be deferred after rollout got aborted")
+		} else {
+			assert.Equal(t, 1, len(getUpdatedKeys(actions)), "Failed instance should be retried")
+		}
+
+		// new rollout starts when policy changes
+		planner = NewPlanner(td.policy, runtime.Generation(2), td.desired, td.actual, planner.Progress(), now)
+		actions, err := planner.Filter(td.actions())
+		assert.NoError(t, err, "Rollout should be planned without errors")
+		assert.Equal(t, 1, len(getUpdatedKeys(actions)), "New rollout should start with the failed instance when policy changes")
+	}
+}
+
+func makeTestData(rollout *lang.Rollout, instances int, canary int) *testData {
+	b := builder.NewPolicyBuilder()
+	service := b.AddService()
+	service.Rollout = rollout
+	component := b.AddServiceComponent(service, b.CodeComponent(nil, nil))
+	criteria := []*lang.Criteria{}
+	for i := 0; i < instances; i++ {
+		criteria = append(criteria, b.CriteriaTrue())
+	}
+	contract := b.AddContractMultipleContexts(service, criteria...)
+	cluster := b.AddCluster()
+
+	td := &testData{
+		policy:  b.Policy(),
+		service: service,
+		desired: resolve.NewPolicyResolution(true),
+		actual:  resolve.NewPolicyResolution(false),
+	}
+	for i, context := range contract.Contexts {
+		labels := map[string]string{}
+		if i == canary {
+			labels["stage"] = "canary"
+		}
+		key := resolve.NewComponentInstanceKey(cluster, contract, context, nil, service, component)
+		for _, cik := range []*resolve.ComponentInstanceKey{key.GetParentServiceKey(), key} {
+			td.record(td.desired, cik, labels, "new")
+			td.record(td.actual, cik, labels, "old")
+		}
+		td.keys = append(td.keys, key)
+	}
+	return td
+}
+
+func (td *testData) record(resolution *resolve.PolicyResolution, cik *resolve.ComponentInstanceKey, labels map[string]string, param string) {
+	instance := resolution.GetComponentInstanceEntry(cik)
+	instance.CalculatedLabels = lang.NewLabelSet(labels)
+	instance.DependencyKeys = map[string]bool{"dependency": true}
+	if cik.IsComponent() {
+		instance.CalculatedCodeParams = util.NestedParameterMap{"param": param}
+	}
+}
+
+func (td *testData) update(cik *resolve.ComponentInstanceKey) {
+	td.actual.ComponentInstanceMap[cik.GetKey()].CalculatedCodeParams = td.desired.ComponentInstanceMap[cik.GetKey()].CalculatedCodeParams
+}
+
+func (td *testData) actions() []action.Base {
+	result := []action.Base{}
+	for _, key := range td.keys {
+		// only instances with changed parameters get updated
+		if td.desired.ComponentInstanceMap[key.GetKey()].CalculatedCodeParams.DeepEqual(td.actual.ComponentInstanceMap[key.GetKey()].CalculatedCodeParams) {
+			continue
+		}
+		result = append(result, component.NewUpdateAction(key.GetKey()), component.NewUpdateAction(key.GetParentServiceKey().GetKey()))
+	}
+	if len(result) <= 0 {
+		return result
+	}
+	return append(result, global.NewPostProcessAction())
+}
+
+func (td *testData) filter(t *testing.T, progress map[string]*engine.RolloutProgress, now time.Time) (*Planner, []action.Base) {
+	t.Helper()
+	planner := NewPlanner(td.policy, runtime.Generation(1), td.desired, td.actual, progress, now)
+	actions, err := planner.Filter(td.actions())
+	if !assert.NoError(t, err, "Rollout should be planned without errors") {
+		t.FailNow()
+	}
+	return planner, actions
+}
+
+// returns keys of component instances (not services), which have update actions
+func getUpdatedKeys(actions []action.Base) []string {
+	result := []string{}
+	for _, act := range actions {
+		if update, ok := act.(*component.UpdateAction); ok && !isServiceKey(update.ComponentKey) {
+			result = append(result, update.ComponentKey)
+		}
+	}
+	return result
+}
+
+func isServiceKey(key string) bool {
+	return len(key) > 5 && key[len(key)-5:] == "#root"
+}
@@ -3,18 +3,71 @@ package external
 import (
 	"github.com/Aptomi/aptomi/pkg/external/secrets"
 	"github.com/Aptomi/aptomi/pkg/external/users"
+	"sync/atomic"
 )
 
+// changeNotifier is implemented by loaders, which can report changes in data they load
+type changeNotifier interface {
+	NotifyOnChange(f func())
+}
+
 // Data represents all data which is external to Aptomi, including Users and Secrets
 type Data struct {
-	UserLoader   users.UserLoader
-	SecretLoader secrets.SecretLoader
+	UserLoader           users.UserLoader
+	SecretLoader         secrets.SecretLoader
+	GeneratedSecretStore secrets.GeneratedSecretStore
+
+	// version gets incremented every time loaders report changes in users or secrets. It's shared with copies
+	// of external data, which use a different generated secret store
+	version *uint64
+}
+
+// NewData creates a new instance of external Data. If user or secret loaders are able to report changes
+// in the data they load, data version will be incremented every time it happens
+func NewData(userLoader users.UserLoader, secretLoader secrets.SecretLoader, generatedSecretStore secrets.GeneratedSecretStore) *Data {
+	data := &Data{
+		UserLoader:           userLoader,
+		SecretLoader:         secretLoader,
+		GeneratedSecretStore: generatedSecretStore,
+		version:              new(uint64),
+	}
+	if notifier, ok := userLoader.(changeNotifier); ok {
+		notifier.NotifyOnChange(data.Invalidate)
+	}
+	if notifier, ok := secretLoader.(changeNotifier); ok {
+		notifier.NotifyOnChange(data.Invalidate)
+	}
+	return data
 }
 
-// NewData creates a new instance of external Data
-func NewData(userLoader users.UserLoader, secretLoader secrets.SecretLoader) *Data {
+// Version returns current version of external data. It changes every time users or secrets change
+func (data *Data) Version() uint64 {
+	return atomic.LoadUint64(data.version)
+}
+
+// Invalidate increments version of external data, indicating that users or secrets have changed
+func (data *Data) Invalidate() {
+	atomic.AddUint64(data.version, 1)
+}
+
+// WithGeneratedSecretStore returns a copy of external data, which uses a given generated secret store. Copy shares
+// user and secret loaders, as well as the version, with the original
+func (data *Data) WithGeneratedSecretStore(generatedSecretStore secrets.GeneratedSecretStore) *Data {
 	return &Data{
-		UserLoader:   userLoader,
-		SecretLoader: secretLoader,
+		UserLoader:           data.UserLoader,
+		SecretLoader:         data.SecretLoader,
+		GeneratedSecretStore: generatedSecretStore,
+		version:              data.version,
+	}
+}
+
+// Refresh makes loaders load users and secrets, so they can detect changes and report them. It should be called
+// periodically when loaders aren't getting called otherwise (e.g. when cached policy resolution is being used)
+func (data *Data) Refresh() {
+	data.UserLoader.LoadUsersAll()
+	if loader, ok := data.SecretLoader.(interface {
+		LoadSecretsAll() map[string]map[string]string
+	}); ok {
+		loader.LoadSecretsAll()
 	}
 }
@@ -0,0 +1,26 @@
+package secrets
+
+import (
+	utilsync "github.com/Aptomi/aptomi/pkg/util/sync"
+	"reflect"
+	"sync"
+)
+
+// changeTracker remembers the last loaded set of secrets and notifies subscribers when it changes
+type changeTracker struct {
+	mutex    sync.Mutex
+	last     map[string]map[string]string
+	notifier utilsync.Notifier
+}
+
+// Should be called every time secrets get (re)loaded from the source
+func (tracker *changeTracker) loaded(secrets map[string]map[string]string) {
+	tracker.mutex.Lock()
+	changed := tracker.last != nil && !reflect.DeepEqual(tracker.last, secrets)
+	tracker.last = secrets
+	tracker.mutex.Unlock()
+
+	if changed {
+		tracker.notifier.Notify()
+	}
+}
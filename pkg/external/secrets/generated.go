@@ -0,0 +1,58 @@
+package secrets
+
+import (
+	"github.com/Aptomi/aptomi/pkg/runtime"
+)
+
+// GeneratedSecretStore is an interface which allows aptomi to persist secrets generated for component instances
+// during policy resolution (e.g. database passwords). Secret gets generated once per component instance and stays
+// the same until the component instance gets destroyed
+type GeneratedSecretStore interface {
+	// LoadOrGenerate should return a secret with a given name for a given component instance. If it doesn't exist,
+	// it should be created by calling a given generate function and persisted. It should be thread-safe
+	LoadOrGenerate(instanceKey string, name string, generate func() string) (string, error)
+
+	// LoadByInstance should return all secrets generated for a given component instance (secret name -> secret value)
+	LoadByInstance(instanceKey string) (map[string]string, error)
+
+	// DeleteByInstance should delete all secrets generated for a given component instance
+	DeleteByInstance(instanceKey string) error
+}
+
+// GeneratedSecretsObject is an informational data structure with Kind and Constructor for GeneratedSecrets
+var GeneratedSecretsObject = &runtime.Info{
+	Kind:        "generated-secrets",
+	Storable:    true,
+	Versioned:   false,
+	Constructor: func() runtime.Object { return &GeneratedSecrets{} },
+}
+
+// GeneratedSecrets represents a set of secrets, which were generated for a single component instance
+type GeneratedSecrets struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	// InstanceKey is a key of the component instance which secrets belong to
+	InstanceKey string
+
+	// Secrets is a map of secret name -> secret value
+	Secrets map[string]string
+}
+
+// NewGeneratedSecrets creates a new empty set of secrets for a given component instance
+func NewGeneratedSecrets(instanceKey string) *GeneratedSecrets {
+	return &GeneratedSecrets{
+		TypeKind:    GeneratedSecretsObject.GetTypeKind(),
+		InstanceKey: instanceKey,
+		Secrets:     make(map[string]string),
+	}
+}
+
+// GetNamespace returns an object namespace. It's a system namespace for all generated secrets
+func (secrets *GeneratedSecrets) GetNamespace() string {
+	return runtime.SystemNS
+}
+
+// GetName returns object name
+func (secrets *GeneratedSecrets) GetName() string {
+	return secrets.InstanceKey
+}
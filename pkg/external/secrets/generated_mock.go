@@ -0,0 +1,57 @@
+package secrets
+
+import (
+	"sync"
+)
+
+// GeneratedSecretStoreMock allows to mock generated secret store and keep generated secrets in memory
+type GeneratedSecretStoreMock struct {
+	mutex   sync.Mutex
+	secrets map[string]*GeneratedSecrets
+}
+
+// NewGeneratedSecretStoreMock returns new GeneratedSecretStoreMock
+func NewGeneratedSecretStoreMock() *GeneratedSecretStoreMock {
+	return &GeneratedSecretStoreMock{
+		secrets: make(map[string]*GeneratedSecrets),
+	}
+}
+
+// LoadOrGenerate returns a secret for a given component instance, generating it if it doesn't exist
+func (store *GeneratedSecretStoreMock) LoadOrGenerate(instanceKey string, name string, generate func() string) (string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	instanceSecrets, ok := store.secrets[instanceKey]
+	if !ok {
+		instanceSecrets = NewGeneratedSecrets(instanceKey)
+		store.secrets[instanceKey] = instanceSecrets
+	}
+	if _, exists := instanceSecrets.Secrets[name]; !exists {
+		instanceSecrets.Secrets[name] = generate()
+	}
+	return instanceSecrets.Secrets[name], nil
+}
+
+// LoadByInstance returns all secrets generated for a given component instance
+func (store *GeneratedSecretStoreMock) LoadByInstance(instanceKey string) (map[string]string, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	result := make(map[string]string)
+	if instanceSecrets, ok := store.secrets[instanceKey]; ok {
+		for name, value := range instanceSecrets.Secrets {
+			result[name] = value
+		}
+	}
+	return result, nil
+}
+
+// DeleteByInstance deletes all secrets generated for a given component instance
+func (store *GeneratedSecretStoreMock) DeleteByInstance(instanceKey string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.secrets, instanceKey)
+	return nil
+}
@@ -0,0 +1,37 @@
+package secrets
+
+// readOnlyGeneratedSecretStore returns secrets which have already been generated, but never persists new ones
+type readOnlyGeneratedSecretStore struct {
+	store GeneratedSecretStore
+}
+
+// NewGeneratedSecretStoreReadOnly returns a generated secret store, which never changes a given underlying store.
+// It should be used for policy resolutions, which don't get applied (e.g. the ones made by API), so they don't
+// leave behind secrets for component instances which may never get created. If a secret doesn't exist, a value
+// will be generated, but not persisted. Such value doesn't match the one which will be generated when policy gets
+// applied
+func NewGeneratedSecretStoreReadOnly(store GeneratedSecretStore) GeneratedSecretStore {
+	return &readOnlyGeneratedSecretStore{store: store}
+}
+
+// LoadOrGenerate returns an existing secret, or a newly generated one without persisting it
+func (ro *readOnlyGeneratedSecretStore) LoadOrGenerate(instanceKey string, name string, generate func() string) (string, error) {
+	instanceSecrets, err := ro.store.LoadByInstance(instanceKey)
+	if err != nil {
+		return "", err
+	}
+	if value, exists := instanceSecrets[name]; exists {
+		return value, nil
+	}
+	return generate(), nil
+}
+
+// LoadByInstance returns all secrets generated for a given component instance
+func (ro *readOnlyGeneratedSecretStore) LoadByInstance(instanceKey string) (map[string]string, error) {
+	return ro.store.LoadByInstance(instanceKey)
+}
+
+// DeleteByInstance does nothing, as the underlying store never gets changed
+func (ro *readOnlyGeneratedSecretStore) DeleteByInstance(instanceKey string) error {
+	return nil
+}
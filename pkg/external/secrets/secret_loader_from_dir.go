@@ -17,6 +17,7 @@ import (
 type SecretLoaderFromDir struct {
 	baseDir string
 	cache   *cache.Cache
+	changes changeTracker
 }
 
 // UserSecrets represents a single user secret (user name and a map of secrets)
@@ -69,9 +70,15 @@ func (loader *SecretLoaderFromDir) LoadSecretsAll() map[string]map[string]string
 	}
 
 	loader.cache.Set("secrets", result, cache.DefaultExpiration)
+	loader.changes.loaded(result)
 	return result
 }
 
+// NotifyOnChange registers a function, which will be called when secrets in the directory change
+func (loader *SecretLoaderFromDir) NotifyOnChange(f func()) {
+	loader.changes.notifier.Subscribe(f)
+}
+
 // LoadSecretsByUserName loads secrets for a single user
 func (loader *SecretLoaderFromDir) LoadSecretsByUserName(user string) map[string]string {
 	return loader.LoadSecretsAll()[strings.ToLower(user)]
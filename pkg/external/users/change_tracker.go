@@ -0,0 +1,32 @@
+package users
+
+import (
+	"github.com/Aptomi/aptomi/pkg/lang"
+	utilsync "github.com/Aptomi/aptomi/pkg/util/sync"
+	"reflect"
+	"sync"
+)
+
+// changeNotifier is implemented by user loaders, which can report changes in users they load
+type changeNotifier interface {
+	NotifyOnChange(f func())
+}
+
+// changeTracker remembers the last loaded set of users and notifies subscribers when it changes
+type changeTracker struct {
+	mutex    sync.Mutex
+	last     *lang.GlobalUsers
+	notifier utilsync.Notifier
+}
+
+// Should be called every time users get (re)loaded from the source
+func (tracker *changeTracker) loaded(users *lang.GlobalUsers) {
+	tracker.mutex.Lock()
+	changed := tracker.last != nil && !reflect.DeepEqual(tracker.last, users)
+	tracker.last = users
+	tracker.mutex.Unlock()
+
+	if changed {
+		tracker.notifier.Notify()
+	}
+}
@@ -17,6 +17,7 @@ type UserLoaderFromFile struct {
 	fileName             string
 	cache                *cache.Cache
 	domainAdminOverrides map[string]bool
+	changes              changeTracker
 }
 
 // NewUserLoaderFromFile returns new UserLoaderFromFile
@@ -50,9 +51,15 @@ func (loader *UserLoaderFromFile) LoadUsersAll() *lang.GlobalUsers {
 		}
 	}
 	loader.cache.Set("users", result, cache.DefaultExpiration)
+	loader.changes.loaded(result)
 	return result
 }
 
+// NotifyOnChange registers a function, which will be called when users in the file change
+func (loader *UserLoaderFromFile) NotifyOnChange(f func()) {
+	loader.changes.notifier.Subscribe(f)
+}
+
 // LoadUserByName loads a single user by name
 func (loader *UserLoaderFromFile) LoadUserByName(name string) *lang.User {
 	return loader.LoadUsersAll().Users[strings.ToLower(name)]
@@ -18,6 +18,7 @@ type UserLoaderFromLDAP struct {
 	cfg                  config.LDAP
 	cache                *cache.Cache
 	domainAdminOverrides map[string]bool
+	changes              changeTracker
 }
 
 // NewUserLoaderFromLDAP returns new UserLoaderFromLDAP, given location with LDAP configuration file (with host/port and mapping)
@@ -55,9 +56,15 @@ func (loader *UserLoaderFromLDAP) LoadUsersAll() *lang.GlobalUsers {
 		}
 	}
 	loader.cache.Set("ldapUsers", result, cache.DefaultExpiration)
+	loader.changes.loaded(result)
 	return result
 }
 
+// NotifyOnChange registers a function, which will be called when users in LDAP change
+func (loader *UserLoaderFromLDAP) NotifyOnChange(f func()) {
+	loader.changes.notifier.Subscribe(f)
+}
+
 // LoadUserByName loads a single user by name
 func (loader *UserLoaderFromLDAP) LoadUserByName(name string) *lang.User {
 	return loader.LoadUsersAll().Users[strings.ToLower(name)]
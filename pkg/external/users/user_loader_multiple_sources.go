@@ -54,6 +54,15 @@ func (loader *UserLoaderMultipleSources) Authenticate(name, password string) (*l
 	return nil, fmt.Errorf("user '%s' does not exist", name)
 }
 
+// NotifyOnChange registers a function, which will be called when users change in any of the sources
+func (loader *UserLoaderMultipleSources) NotifyOnChange(f func()) {
+	for _, l := range loader.loaders {
+		if notifier, ok := l.(changeNotifier); ok {
+			notifier.NotifyOnChange(f)
+		}
+	}
+}
+
 // Summary returns summary as string
 func (loader *UserLoaderMultipleSources) Summary() string {
 	return strconv.Itoa(len(loader.LoadUsersAll().Users)) + " (multiple sources)"
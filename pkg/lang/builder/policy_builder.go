@@ -24,6 +24,7 @@ type PolicyBuilder struct {
 	policy    *lang.Policy
 	users     *users.UserLoaderMock
 	secrets   *secrets.SecretLoaderMock
+	generated *secrets.GeneratedSecretStoreMock
 
 	domainAdmin     *lang.User
 	domainAdminView *lang.PolicyView
@@ -42,6 +43,7 @@ func NewPolicyBuilderWithNS(namespace string) *PolicyBuilder {
 		policy:    lang.NewPolicy(),
 		users:     users.NewUserLoaderMock(),
 		secrets:   secrets.NewSecretLoaderMock(),
+		generated: secrets.NewGeneratedSecretStoreMock(),
 	}
 
 	result.domainAdmin = result.AddUserDomainAdmin()
@@ -264,6 +266,7 @@ func (builder *PolicyBuilder) External() *external.Data {
 	return external.NewData(
 		builder.users,
 		builder.secrets,
+		builder.generated,
 	)
 }
 
@@ -50,6 +50,10 @@ type Context struct {
 
 	// Allocation defines how the context will get allocated (which service to allocate and which unique key to use)
 	Allocation *Allocation `validate:"required"`
+
+	// AntiAffinity, if set to true, requires service instances allocated by this context for different allocation
+	// keys to be placed into different clusters
+	AntiAffinity bool `yaml:"anti-affinity,omitempty"`
 }
 
 // Allocation determines which service should be allocated for by the given context
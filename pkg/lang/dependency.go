@@ -1,7 +1,10 @@
 package lang
 
 import (
+	"fmt"
 	"github.com/Aptomi/aptomi/pkg/runtime"
+	"strings"
+	"time"
 )
 
 // DependencyObject is an informational data structure with Kind and Constructor for Dependency
@@ -30,6 +33,89 @@ type Dependency struct {
 
 	// Labels which are provided by the user.
 	Labels map[string]string `yaml:"labels,omitempty" validate:"omitempty,labels"`
+
+	// ExpiresAt is an optional absolute time, after which dependency will be removed from the policy. It's useful
+	// for ephemeral environments, which should be torn down automatically. Only one of ExpiresAt and TTL can be set.
+	ExpiresAt time.Time `yaml:"expires-at,omitempty"`
+
+	// TTL is an optional time-to-live for the dependency, counted from the moment when dependency was created.
+	// Once it passes, dependency will be removed from the policy. Only one of ExpiresAt and TTL can be set.
+	TTL time.Duration `yaml:"ttl,omitempty" validate:"gte=0"`
+
+	// Suspended allows to temporarily turn dependency off without deleting it. Suspended dependency is not resolved,
+	// so its instances get detached and destroyed if nothing else references them.
+	Suspended bool `yaml:"suspended,omitempty"`
+
+	// SuspendOn is an optional list of week days (e.g. 'saturday', 'sunday'), on which dependency is suspended. Week
+	// days are evaluated in the local time of Aptomi server.
+	SuspendOn []string `yaml:"suspend-on,omitempty" validate:"dive,weekday"`
+
+	// CreatedAt is the time when dependency was added to the policy. It gets populated by Aptomi automatically.
+	CreatedAt time.Time `yaml:"created-at,omitempty"`
+}
+
+// MakeCopy makes a deep copy of the Dependency struct, so the copy could be modified without affecting the original
+// dependency, which may be shared by the cached policy
+func (dependency *Dependency) MakeCopy() *Dependency {
+	result := *dependency
+	if dependency.Labels != nil {
+		result.Labels = make(map[string]string, len(dependency.Labels))
+		for k, v := range dependency.Labels {
+			result.Labels[k] = v
+		}
+	}
+	if dependency.SuspendOn != nil {
+		result.SuspendOn = append([]string{}, dependency.SuspendOn...)
+	}
+	return &result
+}
+
+// GetExpiry returns the time when dependency expires. If dependency doesn't have an expiry set, false will be
+// returned as the second value
+func (dependency *Dependency) GetExpiry() (time.Time, bool) {
+	if !dependency.ExpiresAt.IsZero() {
+		return dependency.ExpiresAt, true
+	}
+	if dependency.TTL > 0 {
+		return dependency.CreatedAt.Add(dependency.TTL), true
+	}
+	return time.Time{}, false
+}
+
+// IsExpired returns true if dependency has an expiry set and it has already passed at the given moment of time
+func (dependency *Dependency) IsExpired(now time.Time) bool {
+	expiry, ok := dependency.GetExpiry()
+	return ok && !now.Before(expiry)
+}
+
+// Extend renews dependency by moving its expiry forward by the given duration. If dependency has already expired,
+// the duration is counted from the given moment of time. Extended expiry is always stored as an absolute time. An error
+// is returned if dependency doesn't have an expiry set, as extending it would make a permanent dependency expire
+func (dependency *Dependency) Extend(duration time.Duration, now time.Time) error {
+	expiry, ok := dependency.GetExpiry()
+	if !ok {
+		return fmt.Errorf("dependency '%s/%s' doesn't have expiry set and never expires", dependency.Namespace, dependency.Name)
+	}
+	if expiry.Before(now) {
+		expiry = now
+	}
+	dependency.ExpiresAt = expiry.Add(duration)
+	dependency.TTL = 0
+	return nil
+}
+
+// IsSuspended returns true if dependency is suspended at the given moment of time, either explicitly or according
+// to its schedule
+func (dependency *Dependency) IsSuspended(now time.Time) bool {
+	if dependency.Suspended {
+		return true
+	}
+	for _, day := range dependency.SuspendOn {
+		if strings.EqualFold(day, now.Weekday().String()) {
+			return true
+		}
+	}
+	return false
 }
 
 // GlobalDependencies represents the list of global dependencies (see the definition above)
@@ -3,6 +3,7 @@ package lang
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestAddDependency(t *testing.T) {
@@ -25,3 +26,77 @@ func TestAddDependency(t *testing.T) {
 	assert.Equal(t, 1, len(dependencies.DependenciesByContract["newcontract"]), "Dependency on 'newcontract' should be added")
 	assert.Equal(t, "dep_id_new", dependencies.DependenciesByContract["newcontract"][0].Name, "Dependency on 'newcontract' should be added")
 }
+
+func TestDependencyExpiry(t *testing.T) {
+	now := time.Date(2017, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// no expiry set
+	dependency := &Dependency{CreatedAt: now}
+	_, ok := dependency.GetExpiry()
+	assert.False(t, ok, "Dependency without expiry should not expire")
+	assert.False(t, dependency.IsExpired(now.Add(1000*time.Hour)), "Dependency without expiry should not expire")
+
+	// dependency without expiry can't be extended, so it doesn't start expiring
+	assert.Error(t, dependency.Extend(time.Hour, now), "Dependency without expiry should not be extended")
+	_, ok = dependency.GetExpiry()
+	assert.False(t, ok, "Dependency without expiry should not expire after failed extend")
+
+	// TTL is counted from creation time
+	dependency.TTL = time.Hour
+	expiry, ok := dependency.GetExpiry()
+	assert.True(t, ok, "Dependency with TTL should have expiry")
+	assert.Equal(t, now.Add(time.Hour), expiry, "Dependency expiry should be calculated from its creation time")
+	assert.False(t, dependency.IsExpired(now.Add(59*time.Minute)), "Dependency should not be expired before TTL passes")
+	assert.True(t, dependency.IsExpired(now.Add(time.Hour)), "Dependency should be expired once TTL passes")
+
+	// extending dependency moves its expiry forward
+	assert.NoError(t, dependency.Extend(2*time.Hour, now.Add(30*time.Minute)), "Dependency with TTL should be extended")
+	expiry, _ = dependency.GetExpiry()
+	assert.Equal(t, now.Add(3*time.Hour), expiry, "Dependency expiry should be moved forward")
+	assert.Equal(t, time.Duration(0), dependency.TTL, "Extended dependency should have absolute expiry")
+
+	// extending expired dependency counts from the current time
+	assert.NoError(t, dependency.Extend(time.Hour, now.Add(10*time.Hour)), "Expired dependency should be extended")
+	expiry, _ = dependency.GetExpiry()
+	assert.Equal(t, now.Add(11*time.Hour), expiry, "Expired dependency should be extended from the current time")
+}
+
+func TestDependencySuspended(t *testing.T) {
+	saturday := time.Date(2017, 10, 7, 12, 0, 0, 0, time.UTC)
+	monday := time.Date(2017, 10, 9, 12, 0, 0, 0, time.UTC)
+
+	dependency := &Dependency{}
+	assert.False(t, dependency.IsSuspended(saturday), "Dependency should not be suspended by default")
+
+	// suspended according to schedule
+	dependency.SuspendOn = []string{"Saturday", "sunday"}
+	assert.True(t, dependency.IsSuspended(saturday), "Dependency should be suspended on weekend")
+	assert.False(t, dependency.IsSuspended(monday), "Dependency should not be suspended on weekdays")
+
+	// suspended explicitly
+	dependency.Suspended = true
+	assert.True(t, dependency.IsSuspended(monday), "Dependency should be suspended explicitly")
+}
+
+func TestDependencyMakeCopy(t *testing.T) {
+	dependency := &Dependency{
+		Metadata:  Metadata{Namespace: "main", Name: "dep"},
+		User:      "alice",
+		Contract:  "contract",
+		Labels:    map[string]string{"param": "value"},
+		SuspendOn: []string{"saturday"},
+	}
+
+	// modifying a copy doesn't affect the original dependency
+	result := dependency.MakeCopy()
+	assert.Equal(t, dependency, result, "Copy should be equal to the original dependency")
+	result.Labels["param"] = "changed"
+	result.SuspendOn[0] = "sunday"
+	result.ExpiresAt = time.Now()
+	result.SetDeleted(true)
+
+	assert.Equal(t, "value", dependency.Labels["param"], "Labels of the original dependency should not change")
+	assert.Equal(t, []string{"saturday"}, dependency.SuspendOn, "Suspend days of the original dependency should not change")
+	assert.True(t, dependency.ExpiresAt.IsZero(), "Expiry of the original dependency should not change")
+	assert.False(t, dependency.IsDeleted(), "Original dependency should not be deleted")
+}
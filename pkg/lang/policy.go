@@ -69,6 +69,22 @@ func (policy *Policy) RemoveObject(obj Base) bool {
 	return policyNamespace.removeObject(obj)
 }
 
+// MakeCopy makes a copy of the policy, which objects could be added to or removed from without affecting the original
+// policy. Objects themselves are shared between both policies and should not be modified
+func (policy *Policy) MakeCopy() *Policy {
+	result := NewPolicy()
+	for _, info := range PolicyObjects {
+		for _, obj := range policy.GetObjectsByKind(info.Kind) {
+			err := result.AddObject(obj)
+			if err != nil {
+				// it should never happen, as all objects have already been added to the original policy
+				panic(fmt.Sprintf("error while copying policy object %s: %s", runtime.KeyForStorable(obj), err))
+			}
+		}
+	}
+	return result
+}
+
 // GetObjectsByKind returns all objects in a policy with a given kind, across all namespaces
 func (policy *Policy) GetObjectsByKind(kind string) []Base {
 	result := []Base{}
@@ -25,13 +25,10 @@ func NewPolicyView(policy *Policy, user *User) *PolicyView {
 // AddObject adds an object into the policy. When you add objects to the policy, they get added to the corresponding
 // Namespace. If error occurs (e.g. object has an unknown kind, etc) then the error will be returned
 func (view *PolicyView) AddObject(obj Base) error {
-	privilege, err := view.Policy.aclResolver.GetUserPrivileges(view.User, obj)
+	err := view.ManageObject(obj)
 	if err != nil {
 		return err
 	}
-	if !privilege.Manage {
-		return fmt.Errorf("user '%s' doesn't have ACL permissions to manage object '%s/%s/%s'", view.User.Name, obj.GetNamespace(), obj.GetKind(), obj.GetName())
-	}
 	return view.Policy.AddObject(obj)
 }
 
@@ -49,7 +46,8 @@ func (view *PolicyView) ViewObject(obj Base) error {
 }
 
 // ManageObject checks if user has permissions to manage a given object. If user has no permissions, then ACL error
-// will be returned
+// will be returned. Services with hooks executing commands on Aptomi server or with readiness probes dialed from
+// Aptomi server can only be managed by domain admins
 func (view *PolicyView) ManageObject(obj Base) error {
 	privilege, err := view.Policy.aclResolver.GetUserPrivileges(view.User, obj)
 	if err != nil {
@@ -58,6 +56,26 @@ func (view *PolicyView) ManageObject(obj Base) error {
 	if !privilege.Manage {
 		return fmt.Errorf("user '%s' doesn't have ACL permissions to manage object '%s/%s/%s'", view.User.Name, obj.GetNamespace(), obj.GetKind(), obj.GetName())
 	}
+
+	if service, ok := obj.(*Service); ok {
+		reason := ""
+		if service.HasExecHooks() {
+			reason = "exec hooks"
+		} else if service.HasServerProbes() {
+			reason = "HTTP/TCP readiness probes"
+		}
+		if len(reason) <= 0 {
+			return nil
+		}
+
+		isDomainAdmin, err := view.Policy.aclResolver.IsDomainAdmin(view.User)
+		if err != nil {
+			return err
+		}
+		if !isDomainAdmin {
+			return fmt.Errorf("user '%s' is not a domain admin and can't manage service '%s/%s' with %s", view.User.Name, obj.GetNamespace(), obj.GetName(), reason)
+		}
+	}
 	return nil
 }
 
@@ -114,6 +114,98 @@ func TestPolicyViewManageACLRules(t *testing.T) {
 	assert.Equal(t, []int{0, 1, 1}, errCnt, "PolicyView.AddObject() should work correctly for ACL rules")
 }
 
+func TestPolicyViewManageServiceWithExecHooks(t *testing.T) {
+	// users which will be used for viewing policy
+	users := []*User{
+		{Name: "1", Labels: map[string]string{"is_domain_admin": "true"}},
+		{Name: "2", Labels: map[string]string{"is_namespace_admin": "true"}},
+		{Name: "3", Labels: map[string]string{"is_consumer": "true"}},
+	}
+
+	// service with a hook, which runs a command on Aptomi server
+	service := &Service{
+		TypeKind: ServiceObject.GetTypeKind(),
+		Metadata: Metadata{
+			Namespace: "main",
+			Name:      "exec",
+		},
+		Components: []*ServiceComponent{
+			{
+				Name: "component",
+				Code: &Code{Type: "helm"},
+				Hooks: &Hooks{
+					PreCreate: []*Hook{{Name: "hook", Exec: []string{"echo", "hello"}}},
+				},
+			},
+		},
+	}
+
+	// check AddObject()
+	errCnt := []int{0, 0, 0}
+	for i := 0; i < len(users); i++ {
+		policyView := makeEmptyPolicyWithACL().View(users[i])
+		if policyView.AddObject(service) != nil {
+			errCnt[i]++
+		}
+	}
+	assert.Equal(t, []int{0, 1, 1}, errCnt, "Only domain admins should be able to add services with exec hooks")
+
+	// check ManageObject()
+	policy := makeEmptyPolicyWithACL()
+	assert.NoError(t, policy.AddObject(service), "Policy.AddObject() should work correctly")
+	errCntManage := []int{0, 0, 0}
+	for i := 0; i < len(users); i++ {
+		if policy.View(users[i]).ManageObject(service) != nil {
+			errCntManage[i]++
+		}
+	}
+	assert.Equal(t, []int{0, 1, 1}, errCntManage, "Only domain admins should be able to manage services with exec hooks")
+}
+
+func TestPolicyViewManageServiceWithReadinessProbes(t *testing.T) {
+	// users which will be used for viewing policy
+	users := []*User{
+		{Name: "1", Labels: map[string]string{"is_domain_admin": "true"}},
+		{Name: "2", Labels: map[string]string{"is_namespace_admin": "true"}},
+		{Name: "3", Labels: map[string]string{"is_consumer": "true"}},
+	}
+
+	// probes which get dialed from Aptomi server require domain admin, probes done by plugin don't
+	for _, probe := range []struct {
+		readiness *Readiness
+		errCnt    []int
+	}{
+		{&Readiness{HTTP: "http://{{ .Discovery.instance }}/health"}, []int{0, 1, 1}},
+		{&Readiness{TCP: "{{ .Discovery.instance }}:5432"}, []int{0, 1, 1}},
+		{&Readiness{Plugin: true}, []int{0, 0, 1}},
+	} {
+		service := &Service{
+			TypeKind: ServiceObject.GetTypeKind(),
+			Metadata: Metadata{
+				Namespace: "main",
+				Name:      "probe",
+			},
+			Components: []*ServiceComponent{
+				{
+					Name:      "component",
+					Code:      &Code{Type: "helm"},
+					Readiness: probe.readiness,
+				},
+			},
+		}
+
+		policy := makeEmptyPolicyWithACL()
+		assert.NoError(t, policy.AddObject(service), "Policy.AddObject() should work correctly")
+		errCnt := []int{0, 0, 0}
+		for i := 0; i < len(users); i++ {
+			if policy.View(users[i]).ManageObject(service) != nil {
+				errCnt[i]++
+			}
+		}
+		assert.Equal(t, probe.errCnt, errCnt, "Only domain admins should be able to manage services with HTTP/TCP readiness probes: %+v", probe.readiness)
+	}
+}
+
 func makeEmptyPolicyWithACL() *Policy {
 	var aclRules = []*ACLRule{
 		// domain admins
@@ -74,3 +74,12 @@ func (resolver *ACLResolver) GetUserRoleMap(user *User) (map[string]map[string]b
 	resolver.roleMapCache.Store(user.Name, result.RoleMap)
 	return result.RoleMap, nil
 }
+
+// IsDomainAdmin returns true if a given user is domain admin (i.e. has domain admin role for all namespaces)
+func (resolver *ACLResolver) IsDomainAdmin(user *User) (bool, error) {
+	roleMap, err := resolver.GetUserRoleMap(user)
+	if err != nil {
+		return false, err
+	}
+	return roleMap[domainAdmin.ID][namespaceAll], nil
+}
@@ -44,6 +44,11 @@ func runACLTests(testCases []aclTestCase, rules []*ACLRule, t *testing.T) {
 			tc.print(t)
 		}
 
+		isDomainAdmin, err := resolver.IsDomainAdmin(tc.user)
+		if assert.NoError(t, err, "User role should be retrieved successfully") && tc.role == domainAdmin {
+			assert.Equal(t, tc.expected, isDomainAdmin, "User should be domain admin only if they have domain admin role for all namespaces")
+		}
+
 		for _, tcObj := range tc.objectPrivileges {
 			privilege, errPrivilege := resolver.GetUserPrivileges(tc.user, tcObj.obj)
 			if !assert.NoError(t, errPrivilege, "User privileges should be retrieved successfully") {
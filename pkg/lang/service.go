@@ -6,6 +6,7 @@ import (
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/util"
 	"sync"
+	"time"
 )
 
 // ServiceObject is an informational data structure with Kind and Constructor for Service
@@ -33,6 +34,13 @@ type Service struct {
 	// Components is the list of components service consists of
 	Components []*ServiceComponent `validate:"dive"`
 
+	// Affinity defines placement constraints for instances of this service with respect to the services it consumes
+	Affinity *Affinity `yaml:"affinity,omitempty" validate:"omitempty"`
+
+	// Rollout defines how updates get rolled out across instances of this service. If it's not specified, all
+	// instances get updated at once
+	Rollout *Rollout `yaml:"rollout,omitempty" validate:"omitempty"`
+
 	// Lazily evaluated fields (all components topologically sorted). Use via getter
 	componentsOrderedOnce sync.Once
 	componentsOrderedErr  error
@@ -66,8 +74,183 @@ type ServiceComponent struct {
 	// Dependencies is cross-component dependencies within a service. Component may need other components within that
 	// service to run, before it gets instantiated
 	Dependencies []string `yaml:"dependencies,omitempty" validate:"dive,identifier"`
+
+	// Count, if not empty, means that code component gets instantiated multiple times (e.g. for sharded workloads).
+	// It's a text template, which can refer to labels and must evaluate into a non-negative integer. Every shard gets
+	// its own component instance, with its index available to code and discovery templates via '.Shard.Index'.
+	// Discovery parameters of all shards (including 'instance') are available to other components via
+	// '.Discovery.<component>.shards', along with the number of shards in '.Discovery.<component>.count'. Replicated
+	// component doesn't have a single instance, so policy referring to '.Discovery.<component>.instance' is invalid
+	Count string `yaml:"count,omitempty" validate:"omitempty,template"`
+
+	// Hooks define actions, which get executed around deployment of a code component (e.g. register a DNS record
+	// before creation, snapshot a volume before destruction, call a webhook after an update)
+	Hooks *Hooks `yaml:"hooks,omitempty" validate:"omitempty"`
+
+	// Readiness, if not empty, defines how to check that a deployed code component is ready. Components which depend on
+	// it don't get created or updated until it becomes ready
+	Readiness *Readiness `yaml:"readiness,omitempty" validate:"omitempty"`
+}
+
+// GetHooks returns hooks of a component, which have to be executed in order in a given phase
+func (component *ServiceComponent) GetHooks(phase string) []*Hook {
+	if component.Hooks == nil {
+		return nil
+	}
+	switch phase {
+	case HookPreCreate:
+		return component.Hooks.PreCreate
+	case HookPostCreate:
+		return component.Hooks.PostCreate
+	case HookPreUpdate:
+		return component.Hooks.PreUpdate
+	case HookPostUpdate:
+		return component.Hooks.PostUpdate
+	case HookPreDestroy:
+		return component.Hooks.PreDestroy
+	case HookPostDestroy:
+		return component.Hooks.PostDestroy
+	}
+	return nil
+}
+
+// GetAllHooks returns all hooks of a component, over all phases
+func (component *ServiceComponent) GetAllHooks() []*Hook {
+	result := []*Hook{}
+	for _, phase := range HookPhases {
+		result = append(result, component.GetHooks(phase)...)
+	}
+	return result
 }
 
+// getTemplates returns all text templates of a component, which get evaluated with discovery parameters
+func (component *ServiceComponent) getTemplates() []string {
+	result := []string{}
+	if component.Code != nil {
+		result = appendTemplates(result, component.Code.Params)
+	}
+	result = appendTemplates(result, component.Discovery)
+	for _, hook := range component.GetAllHooks() {
+		if hook.Code != nil {
+			result = appendTemplates(result, hook.Code.Params)
+		}
+	}
+	if component.Readiness != nil {
+		result = append(result, component.Readiness.HTTP, component.Readiness.TCP)
+	}
+	return result
+}
+
+func appendTemplates(result []string, params util.NestedParameterMap) []string {
+	for _, value := range params {
+		if str, ok := value.(string); ok {
+			result = append(result, str)
+		} else if nestedMap, ok := value.(util.NestedParameterMap); ok {
+			result = appendTemplates(result, nestedMap)
+		}
+	}
+	return result
+}
+
+// HasExecHooks returns true if any component of a service has hooks, which execute commands locally on Aptomi server
+func (service *Service) HasExecHooks() bool {
+	for _, component := range service.Components {
+		for _, hook := range component.GetAllHooks() {
+			if len(hook.Exec) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasServerProbes returns true if any component of a service has HTTP or TCP readiness probes, which get dialed from
+// Aptomi server
+func (service *Service) HasServerProbes() bool {
+	for _, component := range service.Components {
+		if component.Readiness != nil && (len(component.Readiness.HTTP) > 0 || len(component.Readiness.TCP) > 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hooks define actions, which get executed before and after code component instances get created, updated or
+// destroyed. Hooks within every phase get executed in order
+type Hooks struct {
+	PreCreate   []*Hook `yaml:"pre-create,omitempty" validate:"dive"`
+	PostCreate  []*Hook `yaml:"post-create,omitempty" validate:"dive"`
+	PreUpdate   []*Hook `yaml:"pre-update,omitempty" validate:"dive"`
+	PostUpdate  []*Hook `yaml:"post-update,omitempty" validate:"dive"`
+	PreDestroy  []*Hook `yaml:"pre-destroy,omitempty" validate:"dive"`
+	PostDestroy []*Hook `yaml:"post-destroy,omitempty" validate:"dive"`
+}
+
+// Readiness defines how to check that a deployed code component is ready (e.g. database is accepting connections).
+// Exactly one of Plugin, HTTP and TCP has to be set
+type Readiness struct {
+	// Plugin, if true, means that readiness gets determined by the code plugin, based on native status of deployed
+	// objects (e.g. all replicas of k8s deployments are available)
+	Plugin bool `yaml:"plugin,omitempty"`
+
+	// HTTP, if not empty, is a URL which has to respond with 2xx or 3xx status code. It's a text template, which can
+	// refer to labels and discovery parameters, same as code params. HTTP and TCP probes get dialed from Aptomi
+	// server, so only domain admins can manage services which have them
+	HTTP string `yaml:"http,omitempty" validate:"omitempty,template"`
+
+	// TCP, if not empty, is a host:port address which has to accept TCP connections. It's a text template, which can
+	// refer to labels and discovery parameters, same as code params
+	TCP string `yaml:"tcp,omitempty" validate:"omitempty,template"`
+
+	// Timeout is how long to wait for component to become ready. If not set, the default timeout is used
+	Timeout time.Duration `yaml:"timeout,omitempty" validate:"gte=0"`
+
+	// Interval is how often readiness gets checked. If not set, the default interval is used
+	Interval time.Duration `yaml:"interval,omitempty" validate:"gte=0"`
+}
+
+// Hook phases
+const (
+	HookPreCreate   = "pre-create"
+	HookPostCreate  = "post-create"
+	HookPreUpdate   = "pre-update"
+	HookPostUpdate  = "post-update"
+	HookPreDestroy  = "pre-destroy"
+	HookPostDestroy = "post-destroy"
+)
+
+// HookPhases is a list of all hook phases
+var HookPhases = []string{HookPreCreate, HookPostCreate, HookPreUpdate, HookPostUpdate, HookPreDestroy, HookPostDestroy}
+
+// Hook is an action, which gets executed around deployment of a code component. It either runs code to completion
+// via a code plugin (which has to support one-shot jobs), or executes a command locally on Aptomi server
+type Hook struct {
+	// Name is a user-defined hook name, unique within a component
+	Name string `validate:"identifier"`
+
+	// Code, if not empty, means that hook runs code to completion via a code plugin. Code params follow the same
+	// template syntax as code params of the component and must be the same for all dependencies
+	Code *Code `yaml:"code,omitempty" validate:"omitempty"`
+
+	// Exec, if not empty, is a command with arguments, which gets executed locally. Component instance key, deploy name
+	// and hook phase are passed to it via APTOMI_COMPONENT_KEY, APTOMI_DEPLOY_NAME and APTOMI_HOOK_PHASE env variables.
+	// Since command runs on Aptomi server, services with such hooks can only be managed by domain admins
+	Exec []string `yaml:"exec,omitempty"`
+
+	// OnFailure defines what happens when hook fails. By default, the action gets aborted
+	OnFailure string `yaml:"on-failure,omitempty" validate:"omitempty,hookFailurePolicy"`
+}
+
+// Hook failure policies
+const (
+	// HookFailureAbort aborts the action (i.e. component instance doesn't get created/updated/destroyed, or the action
+	// gets reported as failed if component instance has been created/updated/destroyed already)
+	HookFailureAbort = "abort"
+
+	// HookFailureIgnore records hook failure in the event log and proceeds with the action
+	HookFailureIgnore = "ignore"
+)
+
 // Code with type and parameters, used to instantiate/update/delete component instances
 type Code struct {
 	// Type represents code type (e.g. "helm"). It determines the plugin that will get executed for
@@ -76,8 +259,112 @@ type Code struct {
 
 	// Params define parameters that will be passed down to the deployment plugin. Params follow text template syntax
 	// and can refer to arbitrary labels, as well as discovery parameters exposed by other components (within the
-	// current service) and discovery parameters exposed by services the current service depends on
+	// current service) and discovery parameters exposed by services the current service depends on. Outputs
+	// produced by deployed components are available as well, via '.Discovery.<component>.outputs'
 	Params util.NestedParameterMap `validate:"omitempty,templateNestedMap"`
+
+	// Merge defines how values of code parameters get merged, when a component instance is shared by multiple
+	// dependencies and they have calculated different values for it. Keys are paths to code parameters (e.g. "replicas"
+	// or "auth.users"), values are merge strategies. If no merge strategy is defined for a parameter, all dependencies
+	// must calculate the same value for it
+	Merge map[string]string `yaml:"merge,omitempty" validate:"dive,mergeStrategy"`
+
+	// Job indicates that code is a one-shot job (e.g. database migration or data seeding), which runs to completion
+	// instead of running continuously. Engine waits for a job to succeed before deploying components which depend on
+	// it. Job gets re-run only when its code parameters change
+	Job bool `yaml:"job,omitempty"`
+
+	// UpdateStrategy defines how running component instances get updated when their code parameters change. By
+	// default, they get updated in place. With blue/green strategy, components which depend on this component discover
+	// the current deployment via '.Discovery.<component>.instance'
+	UpdateStrategy string `yaml:"update-strategy,omitempty" validate:"omitempty,updateStrategy"`
+}
+
+// Update strategies for code components
+const (
+	// UpdateStrategyInPlace updates running component instance in place
+	UpdateStrategyInPlace = "in-place"
+
+	// UpdateStrategyBlueGreen creates a new deployment under a new versioned deploy name, waits for it to become
+	// ready, switches discovery and endpoints to it and then destroys the old deployment, once components which
+	// depend on it have been updated to discover the new one. If the new deployment fails, the old one is left untouched
+	UpdateStrategyBlueGreen = "blue-green"
+)
+
+// Merge strategies for code parameters
+const (
+	// MergeStrategyMax takes the largest numeric value
+	MergeStrategyMax = "max"
+
+	// MergeStrategyUnion treats values as comma-separated lists and takes a sorted union of them
+	MergeStrategyUnion = "union"
+
+	// MergeStrategyFirst takes the value calculated by the first dependency (ordered by dependency key)
+	MergeStrategyFirst = "first"
+)
+
+// Affinity defines placement constraints between an instance of a service and instances of other services
+type Affinity struct {
+	// SameClusterAs is a list of contracts (referenced by components of the service). Service instances allocated
+	// for those contracts must be placed into the same cluster as the instance of the service which consumes them
+	SameClusterAs []string `yaml:"same-cluster-as,omitempty"`
+}
+
+// RequiresSameCluster returns true if instances of a given contract must be placed into the same cluster as the
+// instance of the service which consumes them
+func (affinity *Affinity) RequiresSameCluster(contractName string) bool {
+	if affinity == nil {
+		return false
+	}
+	for _, name := range affinity.SameClusterAs {
+		if name == contractName {
+			return true
+		}
+	}
+	return false
+}
+
+// Rollout defines a staged rollout of updates across instances of a service. Instances get split into stages, which
+// are processed one after another. Once all instances in a stage have been updated, rollout pauses for a soak period
+// and/or until it gets approved, and then continues with the next stage. Instances which don't belong to any stage get
+// updated in the last, implicit stage
+type Rollout struct {
+	// Stages is an ordered list of rollout stages
+	Stages []*RolloutStage `validate:"dive"`
+
+	// ErrorThreshold is a percentage of instances within a stage, which are allowed to fail their update. If more
+	// instances fail, rollout gets aborted and the remaining instances don't get updated until policy changes. If
+	// it's not specified, rollout never gets aborted
+	ErrorThreshold int `yaml:"error-threshold,omitempty" validate:"min=0,max=100"`
+}
+
+// RolloutStage defines a batch of service instances, which get updated together during a staged rollout
+type RolloutStage struct {
+	// Name is a user-defined stage name
+	Name string `validate:"identifier"`
+
+	// Criteria selects service instances for the stage by their labels (e.g. stage == 'canary'). It's an optional
+	// field, so if it's nil then all remaining instances are considered
+	Criteria *Criteria `validate:"omitempty"`
+
+	// Percent limits the stage to a given percentage of all service instances. If it's not specified, all selected
+	// instances belong to the stage
+	Percent int `yaml:"percent,omitempty" validate:"min=0,max=100"`
+
+	// Soak is how long rollout waits after all instances in the stage have been updated, before continuing with the
+	// next stage
+	Soak time.Duration `yaml:"soak,omitempty" validate:"gte=0"`
+
+	// Approval indicates that rollout doesn't continue with the next stage until it gets approved via API
+	Approval bool `yaml:"approval,omitempty"`
+}
+
+// Matches checks if stage criteria is satisfied
+func (stage *RolloutStage) Matches(params *expression.Parameters, cache *expression.Cache) (bool, error) {
+	if stage.Criteria == nil {
+		return true, nil
+	}
+	return stage.Criteria.allows(params, cache)
 }
 
 // Matches checks if component criteria is satisfied
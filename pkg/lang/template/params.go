@@ -3,9 +3,17 @@ package template
 // Parameters is a set of named parameters for the text template
 type Parameters struct {
 	params interface{}
+	funcs  map[string]interface{}
 }
 
 // NewParams creates a new instance of Parameters
 func NewParams(params interface{}) *Parameters {
 	return &Parameters{params: params}
 }
+
+// WithFuncs attaches a set of functions to Parameters, which are bound to the context of evaluation (e.g. a component
+// instance). They override functions with the same name, which were declared at template compile time
+func (params *Parameters) WithFuncs(funcs map[string]interface{}) *Parameters {
+	params.funcs = funcs
+	return params
+}
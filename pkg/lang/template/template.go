@@ -52,6 +52,12 @@ var textFuncMap = t.FuncMap{
 		}
 		return value
 	},
+
+	// placeholder for a function returning a stable generated secret. it has to be bound to a component instance
+	// when template gets evaluated (see Parameters.WithFuncs), otherwise template evaluation will fail
+	"generatedSecret": func(name string, length int) (string, error) {
+		return "", fmt.Errorf("generated secret '%s' is not supported in this context", name)
+	},
 }
 
 // NewTemplate compiles a text template and returns the result in Template struct
@@ -73,7 +79,10 @@ func (template *Template) Evaluate(params *Parameters) (string, error) {
 	var doc bytes.Buffer
 
 	// Multiple executions of the same template can execute safely in parallel
-	err := template.templateCompiled.Execute(&doc, params.params)
+	templateCompiled, err := template.withFuncs(params)
+	if err == nil {
+		err = templateCompiled.Execute(&doc, params.params)
+	}
 	if err != nil {
 		return "", errors.NewErrorWithDetails(
 			fmt.Sprintf("Unable to evaluate template '%s': %s", template.templateStr, err),
@@ -98,3 +107,23 @@ func (template *Template) Evaluate(params *Parameters) (string, error) {
 
 	return result, nil
 }
+
+// Returns compiled template with functions from parameters bound to it. Compiled template is shared between
+// goroutines, so it gets cloned first (only if it refers to any of the functions being bound)
+func (template *Template) withFuncs(params *Parameters) (*t.Template, error) {
+	funcs := t.FuncMap{}
+	for name, f := range params.funcs {
+		if strings.Contains(template.templateStr, name) {
+			funcs[name] = f
+		}
+	}
+	if len(funcs) <= 0 {
+		return template.templateCompiled, nil
+	}
+
+	result, err := template.templateCompiled.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return result.Funcs(funcs), nil
+}
@@ -1,6 +1,7 @@
 package template
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -93,3 +94,19 @@ func TestTemplateEvaluation(t *testing.T) {
 	}
 
 }
+
+func TestTemplateEvaluationWithFuncs(t *testing.T) {
+	templateStr := "secret-{{ generatedSecret \"password\" 8 }}"
+
+	// generated secret is not available, unless bound to the parameters
+	evaluate(t, templateStr, ResEvalError, "", NewParams(struct{}{}))
+
+	// once function is bound, it should be called
+	params := NewParams(struct{}{}).WithFuncs(map[string]interface{}{
+		"generatedSecret": func(name string, length int) (string, error) {
+			return fmt.Sprintf("%s-%d", name, length), nil
+		},
+	})
+	evaluate(t, templateStr, ResSuccess, "secret-password-8", params)
+	evaluateWithCache(t, templateStr, ResSuccess, "secret-password-8", params, NewCache())
+}
@@ -14,6 +14,7 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // Constants
@@ -23,6 +24,11 @@ var (
 	codeTypes       = []string{"helm", "raw"}
 	labelOpsKeys    = []string{"set", "remove"}
 	allowReject     = []string{"allow", "reject"}
+	mergeStrategies = []string{MergeStrategyMax, MergeStrategyUnion, MergeStrategyFirst}
+
+	hookFailurePolicies = []string{HookFailureAbort, HookFailureIgnore}
+
+	updateStrategies = []string{UpdateStrategyInPlace, UpdateStrategyBlueGreen}
 )
 
 // Custom type for context key, so we don't have to use 'string' directly
@@ -70,6 +76,10 @@ func NewPolicyValidator(policy *Policy) *PolicyValidator {
 	_ = result.RegisterValidation("labelOperations", validateLabelOperations)
 	_ = result.RegisterValidation("allowReject", validateAllowRejectAction)
 	_ = result.RegisterValidation("addRoleNS", validateACLRoleActionMap)
+	_ = result.RegisterValidation("weekday", validateWeekday)
+	_ = result.RegisterValidation("mergeStrategy", validateMergeStrategy)
+	_ = result.RegisterValidation("hookFailurePolicy", validateHookFailurePolicy)
+	_ = result.RegisterValidation("updateStrategy", validateUpdateStrategy)
 
 	// validators with context containing policy
 	result.RegisterStructValidation(validateRule, Rule{})
@@ -136,6 +146,22 @@ func NewPolicyValidator(policy *Policy) *PolicyValidator {
 			tag:         "addRoleNS",
 			translation: fmt.Sprintf("{0} must be a valid role assignment map (key must be in %s, namespace list must be comma-separated identifiers/wildcards)", util.GetSortedStringKeys(ACLRolesMap)),
 		},
+		{
+			tag:         "weekday",
+			translation: fmt.Sprintf("{0} must be a day of the week, but found '{1}'"),
+		},
+		{
+			tag:         "mergeStrategy",
+			translation: fmt.Sprintf("{0} must be in %s, but found '{1}'", mergeStrategies),
+		},
+		{
+			tag:         "hookFailurePolicy",
+			translation: fmt.Sprintf("{0} must be in %s, but found '{1}'", hookFailurePolicies),
+		},
+		{
+			tag:         "updateStrategy",
+			translation: fmt.Sprintf("{0} must be in %s, but found '{1}'", updateStrategies),
+		},
 		// dynamic/custom
 		{
 			tag:         "exists",
@@ -149,10 +175,18 @@ func NewPolicyValidator(policy *Policy) *PolicyValidator {
 			tag:         "unique",
 			translation: fmt.Sprintf("must be unique, but it is not"),
 		},
+		{
+			tag:         "codeOnly",
+			translation: fmt.Sprintf("can only be set for code components"),
+		},
 		{
 			tag:         "noComponentCycle",
 			translation: fmt.Sprintf("circular dependency detected in components"),
 		},
+		{
+			tag:         "replicatedInstance",
+			translation: fmt.Sprintf("replicated component doesn't have a single instance, use '.shards' to refer to instances of all shards"),
+		},
 		{
 			tag:         "ruleActions",
 			translation: fmt.Sprintf("{0} must have at least one action defined"),
@@ -224,6 +258,21 @@ func validateAllowRejectAction(fl validator.FieldLevel) bool {
 	return util.ContainsString(allowReject, fl.Field().String())
 }
 
+// checks if a given string is a valid merge strategy for code parameters
+func validateMergeStrategy(fl validator.FieldLevel) bool {
+	return util.ContainsString(mergeStrategies, fl.Field().String())
+}
+
+// checks if a given string is valid hook failure policy
+func validateHookFailurePolicy(fl validator.FieldLevel) bool {
+	return util.ContainsString(hookFailurePolicies, fl.Field().String())
+}
+
+// checks if a given string is valid update strategy for code components
+func validateUpdateStrategy(fl validator.FieldLevel) bool {
+	return util.ContainsString(updateStrategies, fl.Field().String())
+}
+
 // checks if a given string is a valid cluster type
 func validateClusterType(fl validator.FieldLevel) bool {
 	return util.ContainsString(clusterTypes, fl.Field().String())
@@ -305,6 +354,17 @@ func validateLabels(fl validator.FieldLevel) bool {
 	return true
 }
 
+// checks if value is a day of the week (e.g. 'monday')
+func validateWeekday(fl validator.FieldLevel) bool {
+	day := fl.Field().String()
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(day, weekday.String()) {
+			return true
+		}
+	}
+	return false
+}
+
 // checks if service is valid
 func validateService(ctx context.Context, sl validator.StructLevel) {
 	service := sl.Current().Addr().Interface().(*Service)
@@ -324,6 +384,54 @@ func validateService(ctx context.Context, sl validator.StructLevel) {
 			return
 		}
 
+		// only code components can be replicated
+		if len(component.Count) > 0 && component.Code == nil {
+			sl.ReportError(service, fmt.Sprintf("Component[%s].Count", component.Name), "", "codeOnly", "")
+			return
+		}
+
+		// only code components can have hooks
+		if component.Hooks != nil && component.Code == nil {
+			sl.ReportError(service, fmt.Sprintf("Component[%s].Hooks", component.Name), "", "codeOnly", "")
+			return
+		}
+
+		// only code components can have readiness checks, and exactly one type of check has to be set
+		if component.Readiness != nil {
+			if component.Code == nil {
+				sl.ReportError(service, fmt.Sprintf("Component[%s].Readiness", component.Name), "", "codeOnly", "")
+				return
+			}
+			checks := 0
+			if component.Readiness.Plugin {
+				checks++
+			}
+			if len(component.Readiness.HTTP) > 0 {
+				checks++
+			}
+			if len(component.Readiness.TCP) > 0 {
+				checks++
+			}
+			if checks != 1 {
+				sl.ReportError(service, fmt.Sprintf("Component[%s].Readiness.Plugin|HTTP|TCP", component.Name), "", "single", "")
+				return
+			}
+		}
+
+		// hooks should either run code or execute a command, and should not have duplicate names
+		hookNames := make(map[string]bool)
+		for _, hook := range component.GetAllHooks() {
+			if (hook.Code != nil) == (len(hook.Exec) > 0) {
+				sl.ReportError(service, fmt.Sprintf("Component[%s].Hooks[%s].Code|Exec", component.Name, hook.Name), "", "single", "")
+				return
+			}
+			if hookNames[hook.Name] {
+				sl.ReportError(service, fmt.Sprintf("Component[%s].Hooks[%s].Name", component.Name, hook.Name), "", "unique", "")
+				return
+			}
+			hookNames[hook.Name] = true
+		}
+
 		// if contract is set, it should point to an existing contract
 		if len(component.Contract) > 0 {
 			obj, err := policy.GetObject(ContractObject.Kind, component.Contract, service.Namespace)
@@ -359,6 +467,52 @@ func validateService(ctx context.Context, sl validator.StructLevel) {
 			}
 		}
 	}
+
+	// replicated components don't have a single instance, so '.Discovery.<component>.instance' should not be used
+	// in templates. Every shard is available via '.Discovery.<component>.shards' instead
+	for _, component := range service.Components {
+		if len(component.Count) == 0 {
+			continue
+		}
+		ref := regexp.MustCompile(`\.Discovery\.` + regexp.QuoteMeta(component.Name) + `\.instance\b`)
+		for _, other := range service.Components {
+			for _, templateStr := range other.getTemplates() {
+				if ref.MatchString(templateStr) {
+					sl.ReportError(service, fmt.Sprintf("Component[%s].Discovery[%s].instance", other.Name, component.Name), "", "replicatedInstance", "")
+					return
+				}
+			}
+		}
+	}
+
+	// affinity should only refer to contracts consumed by service components
+	if service.Affinity != nil {
+		for _, contractName := range service.Affinity.SameClusterAs {
+			found := false
+			for _, component := range service.Components {
+				if component.Contract == contractName {
+					found = true
+					break
+				}
+			}
+			if !found {
+				sl.ReportError(service, fmt.Sprintf("Affinity.SameClusterAs[%s]", contractName), "", "exists", "")
+				return
+			}
+		}
+	}
+
+	// rollout stage names should be unique
+	if service.Rollout != nil {
+		stageNames := make(map[string]bool)
+		for _, stage := range service.Rollout.Stages {
+			if stageNames[stage.Name] {
+				sl.ReportError(service, fmt.Sprintf("Rollout.Stages[%s]", stage.Name), "", "unique", "")
+				return
+			}
+			stageNames[stage.Name] = true
+		}
+	}
 }
 
 // checks if dependency is valid
@@ -366,6 +520,12 @@ func validateDependency(ctx context.Context, sl validator.StructLevel) {
 	dependency := sl.Current().Addr().Interface().(*Dependency)
 	policy := ctx.Value(policyKey).(*Policy)
 
+	// dependency should have either absolute expiry or TTL, but not both
+	if !dependency.ExpiresAt.IsZero() && dependency.TTL > 0 {
+		sl.ReportError(dependency, "ExpiresAt|TTL", "", "single", "")
+		return
+	}
+
 	// dependency should point to an existing contract
 	obj, err := policy.GetObject(ContractObject.Kind, dependency.Contract, dependency.Namespace)
 	if obj == nil || err != nil {
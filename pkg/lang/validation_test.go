@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"strconv"
 	"testing"
+	"time"
 )
 
 const (
@@ -69,6 +70,186 @@ func TestPolicyValidationService(t *testing.T) {
 		service.Components = components
 		runValidationTests(t, ResFailure, false, []Base{service, contract})
 	}
+
+	// Service Affinity should refer to contracts used by service components
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, contract.Name, Nil, 0)
+		service.Affinity = &Affinity{SameClusterAs: []string{contract.Name}}
+		runValidationTests(t, ResSuccess, false, []Base{service, contract})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, contract.Name, Nil, 0)
+		service.Affinity = &Affinity{SameClusterAs: []string{contract.Name + "extra"}}
+		runValidationTests(t, ResFailure, false, []Base{service, contract})
+	}
+
+	// Service Components can only be replicated if they are code components
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, "", 1, 1)
+		service.Components[0].Count = "{{ .Labels.shards }}"
+		runValidationTests(t, ResSuccess, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, "", 1, 1)
+		service.Components[0].Count = "{{ broken___$$%@ }}"
+		runValidationTests(t, ResFailure, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, contract.Name, Nil, 0)
+		service.Components[0].Count = "3"
+		runValidationTests(t, ResFailure, false, []Base{service, contract})
+	}
+
+	// Service Components should not refer to a single instance of a replicated component
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(2, "", 1, 1)
+		service.Components[0].Name = "shard"
+		service.Components[0].Count = "3"
+		service.Components[1].Dependencies = []string{"shard"}
+		service.Components[1].Code.Params = util.NestedParameterMap{"urls": "{{ range .Discovery." + service.Components[0].Name + ".shards }}{{ .instance }}{{ end }}"}
+		runValidationTests(t, ResSuccess, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(2, "", 1, 1)
+		service.Components[0].Name = "shard"
+		service.Components[0].Count = "3"
+		service.Components[1].Dependencies = []string{"shard"}
+		service.Components[1].Code.Params = util.NestedParameterMap{"nested": util.NestedParameterMap{"url": "{{ .Discovery." + service.Components[0].Name + ".instance }}"}}
+		runValidationTests(t, ResFailure, false, []Base{service})
+	}
+
+	// Service Components can only use known merge strategies for code parameters
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, "", 1, 1)
+		service.Components[0].Code.Merge = map[string]string{"a": "max", "nested.c": "union", "b": "first"}
+		runValidationTests(t, ResSuccess, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, "", 1, 1)
+		service.Components[0].Code.Merge = map[string]string{"a": "average"}
+		runValidationTests(t, ResFailure, false, []Base{service})
+	}
+
+	// Service can have a staged rollout with unique stage names
+	{
+		service := makeService("service", Empty)
+		service.Rollout = &Rollout{
+			Stages: []*RolloutStage{
+				{Name: "canary", Criteria: &Criteria{RequireAll: []string{"stage == 'canary'"}}, Soak: time.Minute},
+				{Name: "half", Percent: 50, Approval: true},
+			},
+			ErrorThreshold: 10,
+		}
+		runValidationTests(t, ResSuccess, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Rollout = &Rollout{
+			Stages: []*RolloutStage{{Name: "canary"}, {Name: "canary"}},
+		}
+		runValidationTests(t, ResFailure, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Rollout = &Rollout{
+			Stages:         []*RolloutStage{{Name: "canary", Percent: 150}},
+			ErrorThreshold: -1,
+		}
+		runValidationTests(t, ResFailure, false, []Base{service})
+	}
+
+	// Service Components can only use known update strategies
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, "", 1, 1)
+		service.Components[0].Code.UpdateStrategy = UpdateStrategyBlueGreen
+		runValidationTests(t, ResSuccess, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, "", 1, 1)
+		service.Components[0].Code.UpdateStrategy = "rolling"
+		runValidationTests(t, ResFailure, false, []Base{service})
+	}
+
+	// Service Components can have readiness checks of a single type
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, "", 1, 1)
+		service.Components[0].Readiness = &Readiness{HTTP: "http://{{ .Discovery.instance }}:8080/health"}
+		runValidationTests(t, ResSuccess, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, "", 1, 1)
+		service.Components[0].Readiness = &Readiness{Plugin: true, TCP: "{{ .Discovery.instance }}:5432"}
+		runValidationTests(t, ResFailure, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, "", 1, 1)
+		service.Components[0].Readiness = &Readiness{}
+		runValidationTests(t, ResFailure, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, contract.Name, Nil, 0)
+		service.Components[0].Readiness = &Readiness{Plugin: true}
+		runValidationTests(t, ResFailure, false, []Base{service, contract})
+	}
+
+	// Service Components can have hooks, which either run code or execute a command
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, "", 1, 1)
+		service.Components[0].Hooks = &Hooks{
+			PreCreate:  []*Hook{{Name: "dns", Exec: []string{"register-dns"}}},
+			PreDestroy: []*Hook{{Name: "snapshot", Code: &Code{Type: "helm"}, OnFailure: HookFailureIgnore}},
+		}
+		runValidationTests(t, ResSuccess, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, "", 1, 1)
+		service.Components[0].Hooks = &Hooks{
+			PreCreate: []*Hook{{Name: "dns", Exec: []string{"register-dns"}, Code: &Code{Type: "helm"}}},
+		}
+		runValidationTests(t, ResFailure, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, "", 1, 1)
+		service.Components[0].Hooks = &Hooks{
+			PreCreate:  []*Hook{{Name: "dns", Exec: []string{"register-dns"}}},
+			PostUpdate: []*Hook{{Name: "dns", Exec: []string{"update-dns"}}},
+		}
+		runValidationTests(t, ResFailure, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, "", 1, 1)
+		service.Components[0].Hooks = &Hooks{
+			PostCreate: []*Hook{{Name: "webhook", Exec: []string{"curl"}, OnFailure: "retry"}},
+		}
+		runValidationTests(t, ResFailure, false, []Base{service})
+	}
+	{
+		service := makeService("service", Empty)
+		service.Components = makeServiceComponents(1, contract.Name, Nil, 0)
+		service.Components[0].Hooks = &Hooks{
+			PreCreate: []*Hook{{Name: "dns", Exec: []string{"register-dns"}}},
+		}
+		runValidationTests(t, ResFailure, false, []Base{service, contract})
+	}
 }
 
 func TestPolicyValidationContract(t *testing.T) {
@@ -112,6 +293,41 @@ func TestPolicyValidationDependency(t *testing.T) {
 		makeContract("contract", 0, ""),
 		makeDependency("contract-unknown"),
 	})
+
+	// Dependency can have either absolute expiry or TTL, but not both
+	expiring := makeDependency("contract")
+	expiring.TTL = time.Hour
+	runValidationTests(t, ResSuccess, false, []Base{
+		makeContract("contract", 0, ""),
+		expiring,
+	})
+	expiring = makeDependency("contract")
+	expiring.TTL = -time.Hour
+	runValidationTests(t, ResFailure, false, []Base{
+		makeContract("contract", 0, ""),
+		expiring,
+	})
+	expiring = makeDependency("contract")
+	expiring.TTL = time.Hour
+	expiring.ExpiresAt = time.Now()
+	runValidationTests(t, ResFailure, false, []Base{
+		makeContract("contract", 0, ""),
+		expiring,
+	})
+
+	// Dependency can be suspended on days of the week only
+	suspended := makeDependency("contract")
+	suspended.SuspendOn = []string{"saturday", "Sunday"}
+	runValidationTests(t, ResSuccess, false, []Base{
+		makeContract("contract", 0, ""),
+		suspended,
+	})
+	suspended = makeDependency("contract")
+	suspended.SuspendOn = []string{"weekend"}
+	runValidationTests(t, ResFailure, false, []Base{
+		makeContract("contract", 0, ""),
+		suspended,
+	})
 }
 
 func TestPolicyValidationRule(t *testing.T) {
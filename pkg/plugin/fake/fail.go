@@ -2,9 +2,11 @@ package fake
 
 import (
 	"fmt"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/plugin"
 	"github.com/Aptomi/aptomi/pkg/util"
+	"time"
 )
 
 // failCodePlugin is a plugin which fails all of its actions
@@ -14,6 +16,7 @@ type failCodePlugin struct {
 }
 
 var _ plugin.CodePlugin = &failCodePlugin{}
+var _ plugin.JobPlugin = &failCodePlugin{}
 
 // NewFailCodePlugin returns fake code plugin that does nothing, except fails component actions if their deploy name
 // contains one of the given strings
@@ -51,10 +54,27 @@ func (plugin *failCodePlugin) Destroy(deployName string, params util.NestedParam
 	return plugin.fail("delete", deployName)
 }
 
+// RunJob reports that a job has failed with non-zero exit code (or panics, if failAsPanic is set)
+func (plugin *failCodePlugin) RunJob(deployName string, params util.NestedParameterMap, eventLog *event.Log) (*resolve.JobStatus, error) {
+	eventLog.WithFields(event.Fields{}).Infof("[>] %s", deployName)
+	if plugin.failAsPanic {
+		return nil, plugin.fail("job", deployName)
+	}
+	return &resolve.JobStatus{
+		ExitCode:    1,
+		Log:         fmt.Sprintf("job failed by plugin mock for component '%s'", deployName),
+		CompletedAt: time.Now(),
+	}, nil
+}
+
 func (plugin *failCodePlugin) Endpoints(deployName string, params util.NestedParameterMap, eventLog *event.Log) (map[string]string, error) {
 	return make(map[string]string), nil
 }
 
+func (plugin *failCodePlugin) Outputs(deployName string, params util.NestedParameterMap, eventLog *event.Log) (map[string]string, error) {
+	return make(map[string]string), nil
+}
+
 func (plugin *failCodePlugin) Resources(deployName string, params util.NestedParameterMap, eventLog *event.Log) (plugin.Resources, error) {
 	return nil, nil
 }
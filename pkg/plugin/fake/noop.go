@@ -16,6 +16,8 @@ type noOpPlugin struct {
 
 var _ plugin.ClusterPlugin = &noOpPlugin{}
 var _ plugin.CodePlugin = &noOpPlugin{}
+var _ plugin.JobPlugin = &noOpPlugin{}
+var _ plugin.ReadinessPlugin = &noOpPlugin{}
 var _ plugin.PostProcessPlugin = &noOpPlugin{}
 
 // NewNoOpClusterPlugin returns fake cluster plugin which does nothing, except sleeping a given time amount on every action
@@ -64,11 +66,25 @@ func (plugin *noOpPlugin) Destroy(deployName string, params util.NestedParameter
 	return nil
 }
 
+func (plugin *noOpPlugin) RunJob(deployName string, params util.NestedParameterMap, eventLog *event.Log) (*resolve.JobStatus, error) {
+	time.Sleep(plugin.sleepTime)
+	return &resolve.JobStatus{Succeeded: true, CompletedAt: time.Now()}, nil
+}
+
+func (plugin *noOpPlugin) Ready(deployName string, params util.NestedParameterMap, eventLog *event.Log) (bool, string, error) {
+	time.Sleep(plugin.sleepTime)
+	return true, "", nil
+}
+
 func (plugin *noOpPlugin) Endpoints(deployName string, params util.NestedParameterMap, eventLog *event.Log) (map[string]string, error) {
 	time.Sleep(plugin.sleepTime)
 	return make(map[string]string), nil
 }
 
+func (plugin *noOpPlugin) Outputs(deployName string, params util.NestedParameterMap, eventLog *event.Log) (map[string]string, error) {
+	return make(map[string]string), nil
+}
+
 func (plugin *noOpPlugin) Resources(deployName string, params util.NestedParameterMap, eventLog *event.Log) (plugin.Resources, error) {
 	return nil, nil
 }
@@ -28,6 +28,7 @@ type Plugin struct {
 }
 
 var _ plugin.CodePlugin = &Plugin{}
+var _ plugin.ReadinessPlugin = &Plugin{}
 
 // New returns new instance of the Helm code plugin for specified Kubernetes cluster plugin and plugins config
 func New(clusterPlugin plugin.ClusterPlugin, cfg config.Plugins) (plugin.CodePlugin, error) {
@@ -247,6 +248,60 @@ func (p *Plugin) Endpoints(deployName string, params util.NestedParameterMap, ev
 	return p.kube.EndpointsForManifests(deployName, currRelease.Release.Manifest, eventLog)
 }
 
+// Outputs returns named outputs produced by Helm release: load balancer addresses of its services and release notes
+func (p *Plugin) Outputs(deployName string, params util.NestedParameterMap, eventLog *event.Log) (map[string]string, error) {
+	err := p.init(eventLog)
+	if err != nil {
+		return nil, err
+	}
+
+	helmClient, err := p.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	releaseName := getReleaseName(deployName)
+
+	currRelease, err := helmClient.ReleaseContent(releaseName)
+	if err != nil {
+		return nil, fmt.Errorf("error while looking for Helm release %s: %s", releaseName, err)
+	}
+
+	outputs, err := p.kube.OutputsForManifests(deployName, currRelease.Release.Manifest, eventLog)
+	if err != nil {
+		return nil, err
+	}
+
+	notes := currRelease.Release.GetInfo().GetStatus().GetNotes()
+	if len(notes) > 0 {
+		outputs["notes"] = notes
+	}
+
+	return outputs, nil
+}
+
+// Ready returns whether all k8s objects of the deployed Helm release are ready
+func (p *Plugin) Ready(deployName string, params util.NestedParameterMap, eventLog *event.Log) (bool, string, error) {
+	err := p.init(eventLog)
+	if err != nil {
+		return false, "", err
+	}
+
+	helmClient, err := p.newClient()
+	if err != nil {
+		return false, "", err
+	}
+
+	releaseName := getReleaseName(deployName)
+
+	currRelease, err := helmClient.ReleaseContent(releaseName)
+	if err != nil {
+		return false, "", fmt.Errorf("error while looking for Helm release %s: %s", releaseName, err)
+	}
+
+	return p.kube.ReadinessForManifest(deployName, currRelease.Release.Manifest, eventLog)
+}
+
 // Resources returns list of all resources (like services, config maps, etc.) into the cluster by specified component instance
 func (p *Plugin) Resources(deployName string, params util.NestedParameterMap, eventLog *event.Log) (plugin.Resources, error) {
 	err := p.init(eventLog)
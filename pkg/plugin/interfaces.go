@@ -44,9 +44,32 @@ type CodePlugin interface {
 	Update(deployName string, params util.NestedParameterMap, eventLog *event.Log) error
 	Destroy(deployName string, params util.NestedParameterMap, eventLog *event.Log) error
 	Endpoints(deployName string, params util.NestedParameterMap, eventLog *event.Log) (map[string]string, error)
+
+	// Outputs returns named values produced by the deployed code. Outputs which are not available yet (e.g. load
+	// balancer address which is still being provisioned) are returned with empty values and get polled again later
+	Outputs(deployName string, params util.NestedParameterMap, eventLog *event.Log) (map[string]string, error)
 	Resources(deployName string, params util.NestedParameterMap, eventLog *event.Log) (Resources, error)
 }
 
+// JobPlugin is an optional interface for code plugins, which are able to run component instances as one-shot jobs
+// (i.e. code which runs to completion, instead of running continuously)
+type JobPlugin interface {
+	CodePlugin
+
+	// RunJob (re)creates a job and waits for it to complete. Failure of the job itself is reported via returned
+	// JobStatus, while returned error indicates that the job couldn't be run or its status couldn't be retrieved
+	RunJob(deployName string, params util.NestedParameterMap, eventLog *event.Log) (*resolve.JobStatus, error)
+}
+
+// ReadinessPlugin is an optional interface for code plugins, which are able to check readiness of deployed component
+// instances based on native status of deployed objects
+type ReadinessPlugin interface {
+	CodePlugin
+
+	// Ready returns whether component instance is ready, as well as a message describing its status
+	Ready(deployName string, params util.NestedParameterMap, eventLog *event.Log) (bool, string, error)
+}
+
 // CodePluginConstructor represents constructor the the code plugin
 type CodePluginConstructor func(cluster ClusterPlugin, cfg config.Plugins) (CodePlugin, error)
 
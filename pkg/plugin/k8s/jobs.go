@@ -0,0 +1,132 @@
+package k8s
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/event"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	api "k8s.io/client-go/pkg/api/v1"
+	batch "k8s.io/client-go/pkg/apis/batch/v1"
+	"strings"
+	"time"
+)
+
+// jobPollInterval is how often status of k8s jobs gets checked, while waiting for their completion
+const jobPollInterval = 2 * time.Second
+
+// jobLogTailLines is how many lines of output get retrieved from every completed k8s job
+var jobLogTailLines int64 = 100
+
+// WaitForJobs waits for all k8s jobs in specified manifest to complete and returns their combined status. Job is
+// considered completed when it either has a succeeded pod or has a failed condition
+func (p *Plugin) WaitForJobs(deployName, targetManifest string, timeout time.Duration, eventLog *event.Log) (*resolve.JobStatus, error) {
+	kubeClient, err := p.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	helmKube := p.NewHelmKube(deployName, eventLog)
+
+	infos, err := helmKube.BuildUnstructured(p.Namespace, strings.NewReader(targetManifest))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &resolve.JobStatus{Succeeded: true}
+	logs := []string{}
+	for _, info := range infos {
+		if info.Mapping.GroupVersionKind.Kind != "Job" {
+			continue
+		}
+
+		job, waitErr := p.waitForJob(kubeClient, info.Name, timeout)
+		if waitErr != nil {
+			return nil, fmt.Errorf("error while waiting for job %s to complete: %s", info.Name, waitErr)
+		}
+
+		exitCode, log, outputErr := p.getJobOutput(kubeClient, job)
+		if outputErr != nil {
+			return nil, outputErr
+		}
+		logs = append(logs, log)
+
+		if !isJobSucceeded(job) && result.Succeeded {
+			result.Succeeded = false
+			result.ExitCode = exitCode
+			if result.ExitCode == 0 {
+				// job failed without a terminated container (e.g. deadline exceeded)
+				result.ExitCode = 1
+			}
+		}
+	}
+
+	if len(logs) == 0 {
+		return nil, fmt.Errorf("no jobs found in manifest for %s", deployName)
+	}
+
+	result.Log = strings.Join(logs, "\n")
+	result.CompletedAt = time.Now()
+
+	return result, nil
+}
+
+func (p *Plugin) waitForJob(client kubernetes.Interface, name string, timeout time.Duration) (*batch.Job, error) {
+	var job *batch.Job
+	err := wait.PollImmediate(jobPollInterval, timeout, func() (bool, error) {
+		var getErr error
+		job, getErr = client.BatchV1().Jobs(p.Namespace).Get(name, meta.GetOptions{})
+		if getErr != nil {
+			return false, getErr
+		}
+		return isJobSucceeded(job) || isJobFailed(job), nil
+	})
+	return job, err
+}
+
+// getJobOutput returns exit code and output of the last terminated pod of a given job
+func (p *Plugin) getJobOutput(client kubernetes.Interface, job *batch.Job) (int, string, error) {
+	pods, err := client.CoreV1().Pods(p.Namespace).List(meta.ListOptions{LabelSelector: "job-name=" + job.Name})
+	if err != nil {
+		return 0, "", err
+	}
+
+	var lastPod *api.Pod
+	var lastExitCode int32
+	var lastFinishedAt time.Time
+	for i := range pods.Items {
+		for _, status := range pods.Items[i].Status.ContainerStatuses {
+			terminated := status.State.Terminated
+			if terminated != nil && !terminated.FinishedAt.Time.Before(lastFinishedAt) {
+				lastPod = &pods.Items[i]
+				lastExitCode = terminated.ExitCode
+				lastFinishedAt = terminated.FinishedAt.Time
+			}
+		}
+	}
+
+	if lastPod == nil {
+		return 0, "", nil
+	}
+
+	log, err := client.CoreV1().Pods(p.Namespace).GetLogs(lastPod.Name, &api.PodLogOptions{TailLines: &jobLogTailLines}).Do().Raw()
+	if err != nil {
+		return 0, "", fmt.Errorf("error while retrieving logs of job %s: %s", job.Name, err)
+	}
+
+	return int(lastExitCode), string(log), nil
+}
+
+func isJobSucceeded(job *batch.Job) bool {
+	return job.Status.Succeeded > 0
+}
+
+func isJobFailed(job *batch.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batch.JobFailed && condition.Status == api.ConditionTrue {
+			return true
+		}
+	}
+	return false
+}
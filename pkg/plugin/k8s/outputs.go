@@ -0,0 +1,51 @@
+package k8s
+
+import (
+	"github.com/Aptomi/aptomi/pkg/event"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+)
+
+// OutputsForManifests returns outputs for specified manifest. Currently it includes external addresses of all services
+// with type LoadBalancer (service name -> IP or hostname). Addresses which haven't been provisioned by the cloud
+// provider yet are returned as empty values
+func (p *Plugin) OutputsForManifests(deployName, targetManifest string, eventLog *event.Log) (map[string]string, error) {
+	kubeClient, err := p.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	helmKube := p.NewHelmKube(deployName, eventLog)
+
+	infos, err := helmKube.BuildUnstructured(p.Namespace, strings.NewReader(targetManifest))
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make(map[string]string)
+
+	for _, info := range infos {
+		if info.Mapping.GroupVersionKind.Kind == "Service" {
+			service, getErr := kubeClient.CoreV1().Services(p.Namespace).Get(info.Name, meta.GetOptions{})
+			if getErr != nil {
+				return nil, getErr
+			}
+
+			if service.Spec.Type == "LoadBalancer" {
+				outputs[service.Name] = ""
+			}
+			for _, ingress := range service.Status.LoadBalancer.Ingress {
+				address := ingress.IP
+				if len(address) == 0 {
+					address = ingress.Hostname
+				}
+				if len(address) > 0 {
+					outputs[service.Name] = address
+					break
+				}
+			}
+		}
+	}
+
+	return outputs, nil
+}
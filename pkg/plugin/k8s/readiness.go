@@ -0,0 +1,57 @@
+package k8s
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/event"
+	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+)
+
+// ReadinessForManifest returns whether all objects in specified manifest are ready, as well as a message listing the
+// ones which are not. Currently it checks that all replicas of deployments and stateful sets are up to date and
+// available
+func (p *Plugin) ReadinessForManifest(deployName, targetManifest string, eventLog *event.Log) (bool, string, error) {
+	kubeClient, err := p.NewClient()
+	if err != nil {
+		return false, "", err
+	}
+
+	helmKube := p.NewHelmKube(deployName, eventLog)
+
+	infos, err := helmKube.BuildUnstructured(p.Namespace, strings.NewReader(targetManifest))
+	if err != nil {
+		return false, "", err
+	}
+
+	notReady := []string{}
+	for _, info := range infos {
+		switch kind := info.Mapping.GroupVersionKind.Kind; kind {
+		case "Deployment":
+			deployment, getErr := kubeClient.AppsV1beta1().Deployments(p.Namespace).Get(info.Name, meta.GetOptions{})
+			if getErr != nil {
+				return false, "", getErr
+			}
+			desired := int32(1)
+			if deployment.Spec.Replicas != nil {
+				desired = *deployment.Spec.Replicas
+			}
+			if deployment.Status.UpdatedReplicas < desired || deployment.Status.AvailableReplicas < desired {
+				notReady = append(notReady, fmt.Sprintf("deployment %s: %d/%d replicas available", info.Name, deployment.Status.AvailableReplicas, desired))
+			}
+		case "StatefulSet":
+			statefulSet, getErr := kubeClient.AppsV1beta1().StatefulSets(p.Namespace).Get(info.Name, meta.GetOptions{})
+			if getErr != nil {
+				return false, "", getErr
+			}
+			desired := int32(1)
+			if statefulSet.Spec.Replicas != nil {
+				desired = *statefulSet.Spec.Replicas
+			}
+			if statefulSet.Status.ReadyReplicas < desired {
+				notReady = append(notReady, fmt.Sprintf("stateful set %s: %d/%d replicas ready", info.Name, statefulSet.Status.ReadyReplicas, desired))
+			}
+		}
+	}
+
+	return len(notReady) == 0, strings.Join(notReady, "; "), nil
+}
@@ -3,6 +3,7 @@ package k8sraw
 import (
 	"fmt"
 	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/plugin"
@@ -10,8 +11,15 @@ import (
 	"github.com/Aptomi/aptomi/pkg/util"
 	"github.com/Aptomi/aptomi/pkg/util/sync"
 	"strings"
+	"time"
 )
 
+// defaultJobTimeout is how long to wait for jobs to complete, if it's not specified in plugin config
+const defaultJobTimeout = 10 * time.Minute
+
+var _ plugin.JobPlugin = &Plugin{}
+var _ plugin.ReadinessPlugin = &Plugin{}
+
 // Plugin represents Kubernetes Raw code plugin that supports deploying specified k8s objects into the cluster
 type Plugin struct {
 	once          sync.Init
@@ -147,6 +155,54 @@ func (p *Plugin) Destroy(deployName string, params util.NestedParameterMap, even
 	return p.deleteManifest(kubeClient, deployName)
 }
 
+// RunJob implements running a component instance as a one-shot job by deploying raw k8s objects (which are expected to
+// include k8s jobs) and waiting for all jobs to complete. As k8s jobs can't be updated, objects which have been
+// deployed by the previous run get deleted first
+func (p *Plugin) RunJob(deployName string, params util.NestedParameterMap, eventLog *event.Log) (*resolve.JobStatus, error) {
+	err := p.init()
+	if err != nil {
+		return nil, err
+	}
+
+	kubeClient, err := p.kube.NewClient()
+	if err != nil {
+		return nil, err
+	}
+
+	targetManifest, ok := params["manifest"].(string)
+	if !ok {
+		return nil, fmt.Errorf("manifest is a mandatory parameter")
+	}
+
+	client := p.kube.NewHelmKube(deployName, eventLog)
+
+	// if manifest can't be loaded, then job hasn't been run before
+	currentManifest, err := p.loadManifest(kubeClient, deployName)
+	if err == nil {
+		err = client.Delete(p.kube.Namespace, strings.NewReader(currentManifest))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = client.Create(p.kube.Namespace, strings.NewReader(targetManifest), 42, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.storeManifest(kubeClient, deployName, targetManifest)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := p.config.JobTimeout
+	if timeout <= 0 {
+		timeout = defaultJobTimeout
+	}
+
+	return p.kube.WaitForJobs(deployName, targetManifest, timeout, eventLog)
+}
+
 // Endpoints returns map from port type to url for all services of the deployed raw k8s objects
 func (p *Plugin) Endpoints(deployName string, params util.NestedParameterMap, eventLog *event.Log) (map[string]string, error) {
 	err := p.init()
@@ -162,6 +218,36 @@ func (p *Plugin) Endpoints(deployName string, params util.NestedParameterMap, ev
 	return p.kube.EndpointsForManifests(deployName, targetManifest, eventLog)
 }
 
+// Outputs returns named outputs (e.g. load balancer addresses) produced by the deployed raw k8s objects
+func (p *Plugin) Outputs(deployName string, params util.NestedParameterMap, eventLog *event.Log) (map[string]string, error) {
+	err := p.init()
+	if err != nil {
+		return nil, err
+	}
+
+	targetManifest, ok := params["manifest"].(string)
+	if !ok {
+		return nil, fmt.Errorf("manifest is a mandatory parameter")
+	}
+
+	return p.kube.OutputsForManifests(deployName, targetManifest, eventLog)
+}
+
+// Ready returns whether all deployed raw k8s objects are ready
+func (p *Plugin) Ready(deployName string, params util.NestedParameterMap, eventLog *event.Log) (bool, string, error) {
+	err := p.init()
+	if err != nil {
+		return false, "", err
+	}
+
+	targetManifest, ok := params["manifest"].(string)
+	if !ok {
+		return false, "", fmt.Errorf("manifest is a mandatory parameter")
+	}
+
+	return p.kube.ReadinessForManifest(deployName, targetManifest, eventLog)
+}
+
 // Resources returns list of all resources (like services, config maps, etc.) into the cluster by specified component instance
 func (p *Plugin) Resources(deployName string, params util.NestedParameterMap, eventLog *event.Log) (plugin.Resources, error) {
 	err := p.init()
@@ -0,0 +1,37 @@
+package store
+
+import (
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"time"
+)
+
+// BackupFormatVersion is the version of backup format. Only backups of the same format version could be restored
+const BackupFormatVersion = 1
+
+// BackupHeaderObject is an informational data structure with Kind and Constructor for BackupHeader
+var BackupHeaderObject = &runtime.Info{
+	Kind:        "backup",
+	Constructor: func() runtime.Object { return &BackupHeader{} },
+}
+
+// BackupObjects is the list of informational data for all objects, which backup consists of
+var BackupObjects = runtime.AppendAll([]*runtime.Info{BackupHeaderObject}, Objects)
+
+// BackupHeader is the first object of every backup, which describes the rest of the objects in it. Backup is a list of
+// objects encoded by the runtime codec: backup header followed by all stored objects (all generations of versioned
+// objects), which makes it portable between store backends
+type BackupHeader struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	// FormatVersion is the version of backup format
+	FormatVersion int
+
+	// AptomiVersion is the version of Aptomi, which created backup
+	AptomiVersion string
+
+	// CreatedAt is the time when backup was created
+	CreatedAt time.Time
+
+	// Objects is the number of objects in backup following the header
+	Objects int
+}
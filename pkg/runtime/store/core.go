@@ -1,12 +1,17 @@
 package store
 
 import (
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/election"
 	"github.com/Aptomi/aptomi/pkg/engine"
 	"github.com/Aptomi/aptomi/pkg/engine/actual"
 	"github.com/Aptomi/aptomi/pkg/engine/progress"
 	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/external/secrets"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/runtime"
+	"time"
 )
 
 // Core represents main object store interface that covers database operations for all objects
@@ -14,15 +19,27 @@ type Core interface {
 	Policy
 	Revision
 	ActualState
+	GeneratedSecrets
+	LeaderElection
+	Compaction
+	Backup
 }
 
 // Policy represents database operations for Policy object
 type Policy interface {
+	// GetPolicy returns policy of a given generation. Returned policy is cached and shared between the callers, which
+	// may run concurrently, so neither the policy nor its objects must be modified. Use lang.Policy.MakeCopy() to get a
+	// policy, which objects could be added to or removed from, and MakeCopy() of an object to get a deep copy of it
+	// before modifying it (e.g. lang.Dependency.MakeCopy())
 	GetPolicy(runtime.Generation) (*lang.Policy, runtime.Generation, error)
 	GetPolicyData(runtime.Generation) (*engine.PolicyData, error)
 	InitPolicy() error
 	UpdatePolicy(updated []lang.Base, performedBy string) (changed bool, data *engine.PolicyData, err error)
 	DeleteFromPolicy(deleted []lang.Base, performedBy string) (changed bool, data *engine.PolicyData, err error)
+
+	// GetPolicyObjectHistory returns all stored generations of a given policy object ordered from the oldest to the
+	// newest one, or an empty list if there is no such object
+	GetPolicyObjectHistory(ns string, kind string, name string) ([]*engine.PolicyObjectVersion, error)
 }
 
 // Revision represents database operations for Revision object
@@ -33,7 +50,20 @@ type Revision interface {
 	NewRevision(policyGen runtime.Generation) (*engine.Revision, error)
 	SaveRevision(revision *engine.Revision) error
 	UpdateRevision(revision *engine.Revision) error
-	GetRevisionProgressUpdater(revision *engine.Revision) progress.Indicator
+
+	// ApproveRollout approves rollout of a given service in the last revision, atomically with respect to other
+	// revision updates. It returns the updated revision, or nil if there are no revisions yet
+	ApproveRollout(serviceKey string) (*engine.Revision, error)
+
+	GetRevisionProgressUpdater(revision *engine.Revision, applyLog *event.Log) progress.Indicator
+
+	// GetRevisionApplyLog returns apply log of a given revision. While revision is being applied, it returns events
+	// saved so far by the revision progress updater
+	GetRevisionApplyLog(gen runtime.Generation) ([]*event.APIEvent, error)
+
+	// WatchRevisions returns a channel with revisions as they get saved or updated, and a function to stop watching.
+	// Channel gets closed once watching is stopped, either by calling the function or by the store itself
+	WatchRevisions() (<-chan *engine.Revision, func())
 }
 
 // ActualState represents database operations for the actual state handling
@@ -42,3 +72,43 @@ type ActualState interface {
 	GetActualStateUpdater() actual.StateUpdater
 	ResetActualState() error
 }
+
+// GeneratedSecrets represents database operations for secrets generated for component instances
+type GeneratedSecrets interface {
+	GetGeneratedSecretStore() secrets.GeneratedSecretStore
+}
+
+// LeaderElection represents database operations for leader election between multiple servers sharing the same store
+type LeaderElection interface {
+	GetLeaderLock(name string) election.Lock
+}
+
+// Compaction represents database operations for removing data, which isn't needed anymore
+type Compaction interface {
+	Compact(retention config.Retention, now time.Time) (*CompactionResult, error)
+}
+
+// CompactionResult represents results of DB compaction
+type CompactionResult struct {
+	// RevisionsTrimmed is the number of revisions, which logs have been trimmed
+	RevisionsTrimmed int
+
+	// RevisionsRemoved is the number of revisions, which have been removed completely
+	RevisionsRemoved int
+
+	// PolicyGenerationsRemoved is the number of removed policy generations
+	PolicyGenerationsRemoved int
+
+	// ObjectGenerationsRemoved is the number of removed generations of policy objects
+	ObjectGenerationsRemoved int
+
+	// RemovedDataBytes is the encoded size of removed and trimmed data. It's not the size DB shrinks by, as DB may
+	// keep the freed space for reuse (e.g. BoltDB doesn't shrink its file)
+	RemovedDataBytes int
+}
+
+// Backup represents database operations for backing up and restoring the whole store
+type Backup interface {
+	Dump(includeSecrets bool) ([]runtime.Object, error)
+	Restore(backup []runtime.Object) (restored int, err error)
+}
@@ -27,11 +27,18 @@ func (ds *defaultStore) GetActualState() (*resolve.PolicyResolution, error) {
 }
 
 func (ds *defaultStore) GetActualStateUpdater() actual.StateUpdater {
-	return &actualStateUpdater{ds.store}
+	return &actualStateUpdater{store: ds.store, changes: make(map[string]runtime.Storable)}
 }
 
+// actualStateUpdater buffers changes of component instances and writes them into the store in a single batch on flush,
+// so actions changing the same component instance many times don't result in a separate write for every change. It
+// isn't safe for concurrent use
 type actualStateUpdater struct {
 	store store.Generic
+
+	// keys of changed objects in the order they have been changed first, and their latest versions (nil if deleted)
+	keys    []string
+	changes map[string]runtime.Storable
 }
 
 func (updater *actualStateUpdater) Save(obj runtime.Storable) error {
@@ -39,30 +46,69 @@ func (updater *actualStateUpdater) Save(obj runtime.Storable) error {
 		return fmt.Errorf("only ComponentInstances could be updated using actual.StateUpdater, not: %T", obj)
 	}
 
-	_, err := updater.store.Save(obj)
-	return err
+	updater.change(runtime.KeyForStorable(obj), obj)
+	return nil
 }
 
 // Delete is used for reacting on object delete event (not supported for now)
 func (updater *actualStateUpdater) Delete(key string) error {
-	return updater.store.Delete(key)
+	updater.change(key, nil)
+	return nil
 }
 
-func (ds *defaultStore) ResetActualState() error {
-	instances, err := ds.store.List(runtime.KeyFromParts(runtime.SystemNS, resolve.ComponentInstanceObject.Kind, ""))
-	if err != nil {
-		return fmt.Errorf("error while getting all component instances: %s", err)
+func (updater *actualStateUpdater) change(key string, obj runtime.Storable) {
+	if _, exists := updater.changes[key]; !exists {
+		updater.keys = append(updater.keys, key)
 	}
+	updater.changes[key] = obj
+}
 
-	for _, instanceObj := range instances {
-		if instance, ok := instanceObj.(*resolve.ComponentInstance); ok {
-			key := runtime.KeyForStorable(instance)
-			deleteErr := ds.store.Delete(key)
-			if deleteErr != nil {
-				return deleteErr
+// Flush writes all buffered changes atomically. If they can't be written, they are kept buffered for the next flush
+func (updater *actualStateUpdater) Flush() error {
+	if len(updater.keys) <= 0 {
+		return nil
+	}
+
+	err := updater.store.Batch(func(ops store.Operations) error {
+		for _, key := range updater.keys {
+			if obj := updater.changes[key]; obj != nil {
+				if _, err := ops.Save(obj); err != nil {
+					return fmt.Errorf("error while saving %s: %s", key, err)
+				}
+			} else if err := ops.Delete(key); err != nil {
+				return fmt.Errorf("error while deleting %s: %s", key, err)
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
+	updater.keys = nil
+	updater.changes = make(map[string]runtime.Storable)
+
 	return nil
 }
+
+func (ds *defaultStore) ResetActualState() error {
+	// all component instances are deleted atomically, so actual state is never left partially reset
+	return ds.store.Batch(func(ops store.Operations) error {
+		instances, err := ops.List(runtime.KeyFromParts(runtime.SystemNS, resolve.ComponentInstanceObject.Kind, ""))
+		if err != nil {
+			return fmt.Errorf("error while getting all component instances: %s", err)
+		}
+
+		for _, instanceObj := range instances {
+			if instance, ok := instanceObj.(*resolve.ComponentInstance); ok {
+				key := runtime.KeyForStorable(instance)
+				deleteErr := ops.Delete(key)
+				if deleteErr != nil {
+					return deleteErr
+				}
+			}
+		}
+
+		return nil
+	})
+}
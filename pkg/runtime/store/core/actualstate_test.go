@@ -0,0 +1,46 @@
+package core
+
+import (
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestActualStateUpdaterFlush(t *testing.T) {
+	generic, ds := newFaultyStore(t)
+	updater := ds.GetActualStateUpdater()
+
+	// changes are not written until flush
+	for _, name := range []string{"one", "two", "three"} {
+		assert.NoError(t, updater.Save(newComponentInstance(name)), "Component instance should be saved")
+	}
+	assert.NoError(t, updater.Delete(runtime.KeyForStorable(newComponentInstance("two"))), "Component instance should be deleted")
+	checkActualState(t, ds)
+
+	// failed flush keeps changes for the next one
+	generic.failAt = 2
+	assert.Error(t, updater.Flush(), "Actual state flush should fail")
+	checkActualState(t, ds)
+
+	generic.failAt = 0
+	assert.NoError(t, updater.Flush(), "Actual state changes should be flushed")
+	checkActualState(t, ds, "one", "three")
+
+	// deleting and saving instance again within the same flush results in saved instance
+	assert.NoError(t, updater.Delete(runtime.KeyForStorable(newComponentInstance("one"))), "Component instance should be deleted")
+	assert.NoError(t, updater.Save(newComponentInstance("one")), "Component instance should be saved")
+	assert.NoError(t, updater.Delete(runtime.KeyForStorable(newComponentInstance("three"))), "Component instance should be deleted")
+	assert.NoError(t, updater.Flush(), "Actual state changes should be flushed")
+	checkActualState(t, ds, "one")
+}
+
+func checkActualState(t *testing.T, ds store.Core, names ...string) {
+	t.Helper()
+	actualState, err := ds.GetActualState()
+	assert.NoError(t, err, "Actual state should be loaded")
+	assert.Len(t, actualState.ComponentInstanceMap, len(names), "Actual state should contain %d component instances", len(names))
+	for _, name := range names {
+		assert.Contains(t, actualState.ComponentInstanceMap, newComponentInstance(name).GetKey(), "Component instance %s should be in actual state", name)
+	}
+}
@@ -0,0 +1,182 @@
+package core
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/election"
+	"github.com/Aptomi/aptomi/pkg/external/secrets"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/Aptomi/aptomi/pkg/version"
+	"time"
+)
+
+// Dump returns backup of the whole store: backup header followed by all stored objects, including all generations of
+// versioned objects. Leases are not included, as they only make sense for the servers running at the moment. Generated
+// secrets are included only if requested, as backup could be stored with less care than the DB itself
+func (ds *defaultStore) Dump(includeSecrets bool) ([]runtime.Object, error) {
+	// policy can't be changed while it's being dumped, so the backup has consistent policy
+	ds.policyChangeLock.Lock()
+	defer ds.policyChangeLock.Unlock()
+
+	objs, err := ds.store.List("")
+	if err != nil {
+		return nil, fmt.Errorf("error while listing objects: %s", err)
+	}
+
+	header := &store.BackupHeader{
+		TypeKind:      store.BackupHeaderObject.GetTypeKind(),
+		FormatVersion: store.BackupFormatVersion,
+		AptomiVersion: version.GetBuildInfo().GitVersion,
+		CreatedAt:     time.Now(),
+	}
+	result := []runtime.Object{header}
+	for _, obj := range objs {
+		if obj.GetKind() == election.LeaseObject.Kind {
+			continue
+		}
+		if obj.GetKind() == secrets.GeneratedSecretsObject.Kind && !includeSecrets {
+			continue
+		}
+		result = append(result, obj)
+	}
+	header.Objects = len(result) - 1
+
+	return result, nil
+}
+
+// Restore validates a given backup and imports all objects from it into the store in a single batch, preserving
+// their generations. Store should be empty, so backup doesn't get mixed with the existing data. Schema version recorded
+// into the empty store on server start is replaced with the one from backup, so restored objects get migrated from
+// their own schema version. Backup made before schema versioning has none, so it's removed and objects get migrated
+// from the very first schema version
+func (ds *defaultStore) Restore(backup []runtime.Object) (int, error) {
+	ds.policyChangeLock.Lock()
+	defer ds.policyChangeLock.Unlock()
+
+	// restored policy generations replace the ones, which could be cached before store has been emptied
+	defer ds.policyCache.Invalidate()
+
+	objs, err := validateBackup(backup)
+	if err != nil {
+		return 0, fmt.Errorf("invalid backup: %s", err)
+	}
+
+	// either the whole backup gets restored or nothing, so restore could be retried into the same store
+	err = ds.store.Batch(func(ops store.Operations) error {
+		existing, err := ops.List("")
+		if err != nil {
+			return fmt.Errorf("error while listing objects: %s", err)
+		}
+		schemaExists := false
+		for _, obj := range existing {
+			if obj.GetKind() == store.SchemaVersionObject.Kind {
+				schemaExists = true
+				continue
+			}
+			if obj.GetKind() != election.LeaseObject.Kind {
+				return fmt.Errorf("backup can only be restored into an empty store, but it has %s", runtime.KeyForStorable(obj))
+			}
+		}
+
+		schemaRestored := false
+		for _, obj := range objs {
+			err = restoreObject(ops, obj)
+			if err != nil {
+				return fmt.Errorf("error while restoring %s: %s", runtime.KeyForStorable(obj), err)
+			}
+			if obj.GetKind() == store.SchemaVersionObject.Kind {
+				schemaRestored = true
+			}
+		}
+
+		if schemaExists && !schemaRestored {
+			err = ops.Delete(store.SchemaVersionKey)
+			if err != nil {
+				return fmt.Errorf("error while deleting schema version: %s", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(objs), nil
+}
+
+// restoreObject saves a single object from backup preserving its generation
+func restoreObject(ops store.Operations, obj runtime.Storable) error {
+	versioned, ok := obj.(runtime.Versioned)
+	if !ok {
+		_, err := ops.Save(obj)
+		return err
+	}
+
+	gen := versioned.GetGeneration()
+
+	// store doesn't allow to create objects marked as deleted, so they get created first and marked as deleted after
+	deletable, ok := obj.(runtime.Deletable)
+	deleted := ok && deletable.IsDeleted()
+	if deleted {
+		deletable.SetDeleted(false)
+	}
+	_, err := ops.Save(obj)
+	if err != nil {
+		return err
+	}
+	if deleted {
+		deletable.SetDeleted(true)
+		_, err = ops.Update(obj)
+		if err != nil {
+			return err
+		}
+	}
+
+	if versioned.GetGeneration() != gen {
+		return fmt.Errorf("generation %s has been restored as %s", gen, versioned.GetGeneration())
+	}
+	return nil
+}
+
+// validateBackup checks backup header and returns the list of objects to restore
+func validateBackup(backup []runtime.Object) ([]runtime.Storable, error) {
+	if len(backup) <= 0 {
+		return nil, fmt.Errorf("backup is empty")
+	}
+
+	header, ok := backup[0].(*store.BackupHeader)
+	if !ok {
+		return nil, fmt.Errorf("backup should start with header, but found: %s", backup[0].GetKind())
+	}
+	if header.FormatVersion != store.BackupFormatVersion {
+		return nil, fmt.Errorf("backup format version %d isn't supported, expected version %d", header.FormatVersion, store.BackupFormatVersion)
+	}
+	if header.Objects != len(backup)-1 {
+		return nil, fmt.Errorf("backup is incomplete, header declares %d objects, but found %d", header.Objects, len(backup)-1)
+	}
+
+	result := make([]runtime.Storable, 0, len(backup)-1)
+	seen := make(map[string]bool)
+	for _, obj := range backup[1:] {
+		storable, ok := obj.(runtime.Storable)
+		if !ok {
+			return nil, fmt.Errorf("object of kind %s can't be stored", obj.GetKind())
+		}
+
+		key := runtime.KeyForStorable(storable)
+		if versioned, ok := obj.(runtime.Versioned); ok {
+			if versioned.GetGeneration() == runtime.LastGen {
+				return nil, fmt.Errorf("generation isn't specified for %s", key)
+			}
+			key += "@" + versioned.GetGeneration().String()
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("duplicate object %s", key)
+		}
+		seen[key] = true
+
+		result = append(result, storable)
+	}
+
+	return result, nil
+}
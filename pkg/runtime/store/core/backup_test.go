@@ -0,0 +1,187 @@
+package core
+
+import (
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/external/secrets"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/codec/yaml"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/generic/mem"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/migration"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	ds := newInMemoryStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+
+	// service gets two generations and gets deleted, so its last generation is marked as deleted
+	updatePolicy(t, ds, newService("one"))
+	service := newService("one")
+	service.Labels = map[string]string{"label": "value"}
+	updatePolicy(t, ds, service)
+	updatePolicy(t, ds, newService("two"))
+	_, _, err := ds.DeleteFromPolicy([]lang.Base{newService("one")}, "test")
+	assert.NoError(t, err, "Service should be deleted from policy")
+	saveRevision(t, ds, 5, time.Now())
+
+	backup, err := ds.Dump(false)
+	assert.NoError(t, err, "Store should be dumped")
+	header, ok := backup[0].(*store.BackupHeader)
+	if !assert.True(t, ok, "Backup should start with header") {
+		return
+	}
+	assert.Equal(t, store.BackupFormatVersion, header.FormatVersion, "Backup should have current format version")
+	assert.Equal(t, len(backup)-1, header.Objects, "Backup header should have number of objects")
+
+	// backup is restored after being encoded and decoded, same as it happens with the backup file
+	registry := runtime.NewRegistry().Append(store.BackupObjects...)
+	for _, codec := range []runtime.Codec{yaml.NewCodec(registry), yaml.NewJSONCodec(registry)} {
+		data, errEncode := codec.EncodeMany(backup)
+		assert.NoError(t, errEncode, "Backup should be encoded")
+		decoded, errDecode := yaml.NewCodec(registry).DecodeOneOrMany(data)
+		assert.NoError(t, errDecode, "Backup should be decoded")
+		checkRestore(t, ds, decoded, header.Objects)
+	}
+}
+
+func checkRestore(t *testing.T, ds store.Core, decoded []runtime.Object, expectedCount int) {
+	t.Helper()
+	restored := newInMemoryStore(t)
+	count, err := restored.Restore(decoded)
+	assert.NoError(t, err, "Backup should be restored")
+	assert.Equal(t, expectedCount, count, "All objects should be restored")
+
+	// all generations are preserved
+	for gen := runtime.Generation(1); gen <= 5; gen++ {
+		expected, _, errExpected := ds.GetPolicy(gen)
+		assert.NoError(t, errExpected, "Policy should be loaded from original store")
+		actual, _, errActual := restored.GetPolicy(gen)
+		assert.NoError(t, errActual, "Policy should be loaded from restored store")
+		assert.Equal(t, len(expected.GetObjectsByKind(lang.ServiceObject.Kind)), len(actual.GetObjectsByKind(lang.ServiceObject.Kind)), "Restored policy generation %d should have the same services", gen)
+	}
+	revision, err := restored.GetRevision(runtime.LastGen)
+	assert.NoError(t, err, "Revision should be loaded from restored store")
+	assert.Equal(t, runtime.Generation(5), revision.Policy, "Revision should be restored")
+	assert.Equal(t, engine.RevisionStatusError, revision.Status, "Revision should be restored")
+
+	// generations keep counting after restore
+	updatePolicy(t, restored, newService("three"))
+	_, gen, err := restored.GetPolicy(runtime.LastGen)
+	assert.NoError(t, err, "Last policy should be loaded")
+	assert.Equal(t, runtime.Generation(6), gen, "Policy should get the next generation")
+
+	// backup can't be restored into non-empty store
+	_, err = restored.Restore(decoded)
+	assert.Error(t, err, "Backup should not be restored into non-empty store")
+}
+
+func TestBackupGeneratedSecrets(t *testing.T) {
+	ds := newInMemoryStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+	_, err := ds.GetGeneratedSecretStore().LoadOrGenerate("instance", "password", func() string { return "secret" })
+	assert.NoError(t, err, "Secret should be generated")
+
+	for _, includeSecrets := range []bool{false, true} {
+		backup, errDump := ds.Dump(includeSecrets)
+		assert.NoError(t, errDump, "Store should be dumped")
+		found := false
+		for _, obj := range backup {
+			found = found || obj.GetKind() == secrets.GeneratedSecretsObject.Kind
+		}
+		assert.Equal(t, includeSecrets, found, "Generated secrets should be in the backup only if requested")
+	}
+}
+
+func TestRestoreNoPartialWrites(t *testing.T) {
+	ds := newInMemoryStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+	updatePolicy(t, ds, newService("one"))
+	backup, err := ds.Dump(false)
+	assert.NoError(t, err, "Store should be dumped")
+
+	generic, restored := newFaultyStore(t)
+	generic.failAt = 3
+	_, err = restored.Restore(backup)
+	assert.Error(t, err, "Restore should fail on write #3")
+	objs, err := generic.List("")
+	assert.NoError(t, err, "Objects should be listed")
+	assert.Empty(t, objs, "No objects should be saved by failed restore")
+
+	// restore could be retried into the same store
+	generic.failAt = 0
+	count, err := restored.Restore(backup)
+	assert.NoError(t, err, "Backup should be restored")
+	assert.Equal(t, len(backup)-1, count, "All objects should be restored")
+}
+
+func TestRestoreValidation(t *testing.T) {
+	ds := newInMemoryStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+	backup, err := ds.Dump(false)
+	assert.NoError(t, err, "Store should be dumped")
+
+	header := *backup[0].(*store.BackupHeader)
+	header.FormatVersion = store.BackupFormatVersion + 1
+	wrongVersion := append([]runtime.Object{&header}, backup[1:]...)
+
+	header = *backup[0].(*store.BackupHeader)
+	header.Objects++
+	incomplete := append([]runtime.Object{&header}, backup[1:]...)
+
+	header = *backup[0].(*store.BackupHeader)
+	header.Objects++
+	duplicate := append([]runtime.Object{&header}, backup[1:]...)
+	duplicate = append(duplicate, backup[1])
+
+	invalid := map[string][]runtime.Object{
+		"empty":          {},
+		"without header": backup[1:],
+		"wrong version":  wrongVersion,
+		"incomplete":     incomplete,
+		"duplicate":      duplicate,
+	}
+	for name, objs := range invalid {
+		_, err = newInMemoryStore(t).Restore(objs)
+		assert.Error(t, err, "Invalid backup should not be restored: %s", name)
+	}
+}
+
+func TestRestoreIntoMigratedStore(t *testing.T) {
+	ds := newInMemoryStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+	updatePolicy(t, ds, newService("one"))
+	backup, err := ds.Dump(false)
+	assert.NoError(t, err, "Store should be dumped")
+
+	// backup with schema version recorded
+	header := *backup[0].(*store.BackupHeader)
+	header.Objects++
+	versioned := append([]runtime.Object{&header}, backup[1:]...)
+	versioned = append(versioned, store.NewSchemaVersion(1, time.Now()))
+
+	// server records the latest schema version into the empty store on start, before backup is restored
+	for _, objs := range [][]runtime.Object{backup, versioned} {
+		db := mem.NewGenericStore(runtime.NewRegistry().Append(store.Objects...))
+		assert.NoError(t, db.Open(config.DB{Connection: mem.Scheme}), "In-memory store should be opened")
+		_, err = migration.Run(db, migration.All, "", false)
+		assert.NoError(t, err, "Empty store should be migrated")
+
+		count, errRestore := NewStore(db).Restore(objs)
+		assert.NoError(t, errRestore, "Backup should be restored into migrated empty store")
+		assert.Equal(t, len(objs)-1, count, "All objects should be restored")
+
+		// schema version of the backup wins, so restored objects get migrated from it
+		result, errMigrate := migration.Run(db, migration.All, "", true)
+		assert.NoError(t, errMigrate, "Restored store should be migrated")
+		if len(objs) == len(backup) {
+			assert.Equal(t, 0, result.FromVersion, "Backup without schema version should be migrated from the start")
+		} else {
+			assert.Equal(t, 1, result.FromVersion, "Backup should be migrated from its schema version")
+		}
+	}
+}
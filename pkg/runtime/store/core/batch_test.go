@@ -0,0 +1,185 @@
+package core
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/generic/mem"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestUpdatePolicyNoPartialWrites(t *testing.T) {
+	// fail while saving the second service and while saving policy data
+	for failAt := 2; failAt <= 3; failAt++ {
+		generic, ds := newFaultyStore(t)
+		assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+
+		generic.failAt = failAt
+		_, _, err := ds.UpdatePolicy([]lang.Base{newService("one"), newService("two")}, "test")
+		assert.Error(t, err, "Policy update should fail on write #%d", failAt)
+
+		checkPolicyGen(t, ds, runtime.FirstGen)
+		for _, name := range []string{"one", "two"} {
+			generations, listErr := generic.ListGenerations(runtime.KeyForStorable(newService(name)))
+			assert.NoError(t, listErr, "Generations should be listed")
+			assert.Empty(t, generations, "Service %s should not be saved by failed policy update on write #%d", name, failAt)
+		}
+	}
+}
+
+func TestDeleteFromPolicyNoPartialWrites(t *testing.T) {
+	// fail while marking the second service deleted and while saving policy data
+	for failAt := 2; failAt <= 3; failAt++ {
+		generic, ds := newFaultyStore(t)
+		assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+		_, _, err := ds.UpdatePolicy([]lang.Base{newService("one"), newService("two")}, "test")
+		assert.NoError(t, err, "Policy should be updated")
+
+		generic.failAt = failAt
+		_, _, err = ds.DeleteFromPolicy([]lang.Base{newService("one"), newService("two")}, "test")
+		assert.Error(t, err, "Policy delete should fail on write #%d", failAt)
+
+		checkPolicyGen(t, ds, 2)
+		for _, name := range []string{"one", "two"} {
+			generations, listErr := generic.ListGenerations(runtime.KeyForStorable(newService(name)))
+			assert.NoError(t, listErr, "Generations should be listed")
+			if assert.Len(t, generations, 1, "Service %s should not be changed by failed policy delete on write #%d", name, failAt) {
+				assert.False(t, generations[0].(*lang.Service).IsDeleted(), "Service %s should not be marked deleted by failed policy delete on write #%d", name, failAt)
+			}
+		}
+	}
+}
+
+func TestResetActualStateNoPartialWrites(t *testing.T) {
+	generic, ds := newFaultyStore(t)
+	updater := ds.GetActualStateUpdater()
+	for _, name := range []string{"one", "two", "three"} {
+		assert.NoError(t, updater.Save(newComponentInstance(name)), "Component instance should be saved")
+	}
+	assert.NoError(t, updater.Flush(), "Actual state changes should be flushed")
+
+	generic.failAt = 2
+	assert.Error(t, ds.ResetActualState(), "Actual state reset should fail")
+
+	actualState, err := ds.GetActualState()
+	assert.NoError(t, err, "Actual state should be loaded")
+	assert.Len(t, actualState.ComponentInstanceMap, 3, "Component instances should not be deleted by failed actual state reset")
+
+	generic.failAt = 0
+	assert.NoError(t, ds.ResetActualState(), "Actual state should be reset")
+	actualState, err = ds.GetActualState()
+	assert.NoError(t, err, "Actual state should be loaded")
+	assert.Empty(t, actualState.ComponentInstanceMap, "All component instances should be deleted by actual state reset")
+}
+
+func TestSaveRevisionChecksPolicy(t *testing.T) {
+	_, ds := newFaultyStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+
+	revision, err := ds.NewRevision(2)
+	assert.NoError(t, err, "Revision should be created")
+	assert.Error(t, ds.SaveRevision(revision), "Revision referring to non-existing policy should not be saved")
+
+	revision, err = ds.GetRevision(runtime.LastGen)
+	assert.NoError(t, err, "Last revision should be loaded")
+	assert.Nil(t, revision, "Revision referring to non-existing policy should not be found")
+
+	revision, err = ds.NewRevision(runtime.FirstGen)
+	assert.NoError(t, err, "Revision should be created")
+	assert.NoError(t, ds.SaveRevision(revision), "Revision referring to existing policy should be saved")
+}
+
+func checkPolicyGen(t *testing.T, ds store.Core, expected runtime.Generation) {
+	t.Helper()
+	policyData, err := ds.GetPolicyData(runtime.LastGen)
+	assert.NoError(t, err, "Last policy data should be loaded")
+	if assert.NotNil(t, policyData, "Last policy data should be found") {
+		assert.Equal(t, expected, policyData.GetGeneration(), "Policy generation should not be changed by failed update")
+	}
+}
+
+func newComponentInstance(name string) *resolve.ComponentInstance {
+	return &resolve.ComponentInstance{
+		TypeKind: resolve.ComponentInstanceObject.GetTypeKind(),
+		Metadata: &resolve.ComponentInstanceMetadata{
+			Key: &resolve.ComponentInstanceKey{
+				ClusterName:         "cluster",
+				Namespace:           "main",
+				ContractName:        "contract",
+				ContextName:         "context",
+				ContextNameWithKeys: "context",
+				ServiceName:         "service",
+				ComponentName:       name,
+			},
+		},
+	}
+}
+
+// faultyStore is an in-memory store, which fails the N-th write made inside a batch
+type faultyStore struct {
+	store.Generic
+	failAt int
+}
+
+func newFaultyStore(t *testing.T) (*faultyStore, store.Core) {
+	t.Helper()
+	s := mem.NewGenericStore(runtime.NewRegistry().Append(store.Objects...))
+	err := s.Open(config.DB{Connection: mem.Scheme})
+	if err != nil {
+		t.Fatalf("Unable to open in-memory store: %s", err)
+	}
+	generic := &faultyStore{Generic: s}
+	return generic, NewStore(generic)
+}
+
+func (fs *faultyStore) Batch(f func(ops store.Operations) error) error {
+	return fs.Generic.Batch(func(ops store.Operations) error {
+		return f(&faultyOps{Operations: ops, failAt: fs.failAt})
+	})
+}
+
+type faultyOps struct {
+	store.Operations
+	failAt int
+	writes int
+}
+
+func (ops *faultyOps) fault() error {
+	ops.writes++
+	if ops.writes == ops.failAt {
+		return fmt.Errorf("injected failure on write #%d", ops.writes)
+	}
+	return nil
+}
+
+func (ops *faultyOps) Save(obj runtime.Storable) (bool, error) {
+	if err := ops.fault(); err != nil {
+		return false, err
+	}
+	return ops.Operations.Save(obj)
+}
+
+func (ops *faultyOps) Update(obj runtime.Storable) (bool, error) {
+	if err := ops.fault(); err != nil {
+		return false, err
+	}
+	return ops.Operations.Update(obj)
+}
+
+func (ops *faultyOps) Delete(key string) error {
+	if err := ops.fault(); err != nil {
+		return err
+	}
+	return ops.Operations.Delete(key)
+}
+
+func (ops *faultyOps) DeleteGen(key string, gen runtime.Generation) error {
+	if err := ops.fault(); err != nil {
+		return err
+	}
+	return ops.Operations.DeleteGen(key, gen)
+}
@@ -0,0 +1,125 @@
+package core
+
+import (
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/generic/bolt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const (
+	benchmarkPolicyObjects = 5000
+	benchmarkInstances     = 1000
+	benchmarkGroupChanges  = 5
+)
+
+func BenchmarkGetPolicyUncached(b *testing.B) {
+	benchmarkGetPolicy(b, runtime.LastGen, false)
+}
+
+func BenchmarkGetPolicyCachedLast(b *testing.B) {
+	benchmarkGetPolicy(b, runtime.LastGen, true)
+}
+
+func BenchmarkGetPolicyCachedGen(b *testing.B) {
+	benchmarkGetPolicy(b, 2, true)
+}
+
+// benchmarkGetPolicy loads policy with thousands of objects either by the last or by a given generation
+func benchmarkGetPolicy(b *testing.B, gen runtime.Generation, cached bool) {
+	ds, cleanup := newBoltStore(b)
+	defer cleanup()
+
+	if err := ds.InitPolicy(); err != nil {
+		b.Fatalf("Unable to init policy: %s", err)
+	}
+	objects := []lang.Base{}
+	for i := 0; i < benchmarkPolicyObjects; i++ {
+		objects = append(objects, newService("service-"+strconv.Itoa(i)))
+	}
+	if _, _, err := ds.UpdatePolicy(objects, "test"); err != nil {
+		b.Fatalf("Unable to update policy: %s", err)
+	}
+
+	if cached {
+		if _, _, err := ds.GetPolicy(gen); err != nil {
+			b.Fatalf("Unable to get policy: %s", err)
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !cached {
+			ds.(*defaultStore).policyCache.Invalidate()
+		}
+		policy, _, err := ds.GetPolicy(gen)
+		if err != nil || policy == nil {
+			b.Fatalf("Unable to get policy: %s", err)
+		}
+	}
+}
+
+func BenchmarkActualStateSaveUnbatched(b *testing.B) {
+	benchmarkActualStateSave(b, false)
+}
+
+func BenchmarkActualStateSaveBatched(b *testing.B) {
+	benchmarkActualStateSave(b, true)
+}
+
+// benchmarkActualStateSave saves every component instance several times, like it's done by the actions for the same
+// instance, flushing either after every change or once per group of changes for the same instance
+func benchmarkActualStateSave(b *testing.B, batched bool) {
+	ds, cleanup := newBoltStore(b)
+	defer cleanup()
+
+	instances := []runtime.Storable{}
+	for i := 0; i < benchmarkInstances; i++ {
+		instances = append(instances, newComponentInstance("component-"+strconv.Itoa(i)))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		updater := ds.GetActualStateUpdater()
+		for _, instance := range instances {
+			for change := 0; change < benchmarkGroupChanges; change++ {
+				if err := updater.Save(instance); err != nil {
+					b.Fatalf("Unable to save component instance: %s", err)
+				}
+				if !batched {
+					if err := updater.Flush(); err != nil {
+						b.Fatalf("Unable to flush actual state: %s", err)
+					}
+				}
+			}
+			if err := updater.Flush(); err != nil {
+				b.Fatalf("Unable to flush actual state: %s", err)
+			}
+		}
+	}
+}
+
+func newBoltStore(b *testing.B) (store.Core, func()) {
+	b.Helper()
+	dir, err := ioutil.TempDir("", "aptomi-core-benchmark")
+	if err != nil {
+		b.Fatalf("Unable to create temp dir: %s", err)
+	}
+
+	s := bolt.NewGenericStore(runtime.NewRegistry().Append(store.Objects...))
+	err = s.Open(config.DB{Connection: bolt.Scheme + filepath.Join(dir, "db.bolt")})
+	if err != nil {
+		b.Fatalf("Unable to open BoltDB store: %s", err)
+	}
+
+	return NewStore(s), func() {
+		s.Close()         // nolint: errcheck
+		os.RemoveAll(dir) // nolint: errcheck
+	}
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/codec/yaml"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+// Compact removes data, which isn't needed anymore according to a given retention policy. Logs of revisions, which
+// are not retained, get trimmed down to warnings and errors, and revisions older than the removal age get removed
+// completely. Policy generations older than the ones used by retained
+// revisions get removed, and so do generations of policy objects not referenced by retained policy generations. The
+// last generation of every object is always kept, so generations keep counting from it
+func (ds *defaultStore) Compact(retention config.Retention, now time.Time) (*store.CompactionResult, error) {
+	result := &store.CompactionResult{}
+	codec := yaml.NewCodec(runtime.NewRegistry().Append(store.Objects...))
+
+	minPolicyGen, err := ds.compactRevisions(retention, now, codec, result)
+	if err != nil {
+		return result, err
+	}
+
+	// policy can't be changed while it's being compacted
+	ds.policyChangeLock.Lock()
+	defer ds.policyChangeLock.Unlock()
+
+	err = ds.compactPolicy(minPolicyGen, codec, result)
+	return result, err
+}
+
+// compactRevisions trims logs of revisions, which are not retained, removes the ones older than the removal age and
+// returns the oldest policy generation used by retained revisions
+func (ds *defaultStore) compactRevisions(retention config.Retention, now time.Time, codec runtime.Codec, result *store.CompactionResult) (runtime.Generation, error) {
+	revisionObjs, err := ds.store.ListGenerations(engine.RevisionKey)
+	if err != nil {
+		return runtime.LastGen, fmt.Errorf("error while listing revisions: %s", err)
+	}
+
+	// the last revision is always retained
+	keepLast := retention.Revisions
+	if keepLast < 1 {
+		keepLast = 1
+	}
+
+	minPolicyGen := runtime.LastGen
+	for idx, revisionObj := range revisionObjs {
+		revision, ok := revisionObj.(*engine.Revision)
+		if !ok {
+			return runtime.LastGen, fmt.Errorf("unexpected type while getting Revision from DB")
+		}
+
+		retained := idx >= len(revisionObjs)-keepLast ||
+			revision.Status == engine.RevisionStatusInProgress ||
+			revision.AppliedAt.IsZero() ||
+			now.Sub(revision.AppliedAt) < retention.Age
+		if retained {
+			if minPolicyGen == runtime.LastGen || revision.Policy < minPolicyGen {
+				minPolicyGen = revision.Policy
+			}
+			continue
+		}
+		if retention.RemoveAge > 0 && now.Sub(revision.AppliedAt) >= retention.RemoveAge {
+			err = ds.deleteGen(engine.RevisionKey, revision, codec, result)
+			if err != nil {
+				return runtime.LastGen, err
+			}
+			result.RevisionsRemoved++
+			continue
+		}
+		if revision.Compacted {
+			continue
+		}
+
+		sizeBefore, err := encodedSize(codec, revision)
+		if err != nil {
+			return runtime.LastGen, err
+		}
+		revision.ResolveLog = trimAPIEvents(revision.ResolveLog)
+		revision.ApplyLog = trimAPIEvents(revision.ApplyLog)
+		revision.Compacted = true
+		sizeAfter, err := encodedSize(codec, revision)
+		if err != nil {
+			return runtime.LastGen, err
+		}
+
+		err = ds.UpdateRevision(revision)
+		if err != nil {
+			return runtime.LastGen, err
+		}
+		result.RevisionsTrimmed++
+		result.RemovedDataBytes += sizeBefore - sizeAfter
+	}
+
+	return minPolicyGen, nil
+}
+
+// compactPolicy removes policy generations older than a given one, as well as generations of policy objects, which
+// aren't referenced by the remaining policy generations
+func (ds *defaultStore) compactPolicy(minPolicyGen runtime.Generation, codec runtime.Codec, result *store.CompactionResult) error {
+	policyDataObjs, err := ds.store.ListGenerations(engine.PolicyDataKey)
+	if err != nil {
+		return fmt.Errorf("error while listing policy generations: %s", err)
+	}
+	if len(policyDataObjs) <= 0 {
+		return nil
+	}
+
+	// policy generations newer than the ones used by revisions haven't been enforced yet, so they are retained too
+	lastPolicyGen := policyDataObjs[len(policyDataObjs)-1].(*engine.PolicyData).GetGeneration()
+	if minPolicyGen == runtime.LastGen || minPolicyGen > lastPolicyGen {
+		minPolicyGen = lastPolicyGen
+	}
+
+	// object key -> generation -> true
+	referenced := make(map[string]map[runtime.Generation]bool)
+	for _, policyDataObj := range policyDataObjs {
+		policyData, ok := policyDataObj.(*engine.PolicyData)
+		if !ok {
+			return fmt.Errorf("unexpected type while getting PolicyData from DB")
+		}
+		retained := policyData.GetGeneration() >= minPolicyGen
+
+		for ns, kindNameGen := range policyData.Objects {
+			for kind, nameGen := range kindNameGen {
+				for name, gen := range nameGen {
+					key := runtime.KeyFromParts(ns, kind, name)
+					if referenced[key] == nil {
+						referenced[key] = make(map[runtime.Generation]bool)
+					}
+					if retained {
+						referenced[key][gen] = true
+					}
+				}
+			}
+		}
+
+		if !retained {
+			err = ds.deleteGen(engine.PolicyDataKey, policyData, codec, result)
+			if err != nil {
+				return err
+			}
+			ds.policyCache.Remove(policyData.GetGeneration())
+			result.PolicyGenerationsRemoved++
+		}
+	}
+
+	for key, gens := range referenced {
+		objs, err := ds.store.ListGenerations(key)
+		if err != nil {
+			return fmt.Errorf("error while listing generations of %s: %s", key, err)
+		}
+
+		// the last generation is kept even if it's not referenced (e.g. it's marked as deleted)
+		for idx := 0; idx < len(objs)-1; idx++ {
+			obj, ok := objs[idx].(runtime.Versioned)
+			if !ok || gens[obj.GetGeneration()] {
+				continue
+			}
+			err = ds.deleteGen(key, obj, codec, result)
+			if err != nil {
+				return err
+			}
+			result.ObjectGenerationsRemoved++
+		}
+	}
+
+	return nil
+}
+
+func (ds *defaultStore) deleteGen(key string, obj runtime.Versioned, codec runtime.Codec, result *store.CompactionResult) error {
+	size, err := encodedSize(codec, obj)
+	if err != nil {
+		return err
+	}
+
+	err = ds.store.DeleteGen(key, obj.GetGeneration())
+	if err != nil {
+		return fmt.Errorf("error while removing generation %s of %s: %s", obj.GetGeneration(), key, err)
+	}
+	result.RemovedDataBytes += size
+
+	return nil
+}
+
+func encodedSize(codec runtime.Codec, obj runtime.Object) (int, error) {
+	data, err := codec.EncodeOne(obj)
+	if err != nil {
+		return 0, fmt.Errorf("error while encoding %s: %s", obj.GetKind(), err)
+	}
+	return len(data), nil
+}
+
+// trimAPIEvents returns only warning and error events out of a given list
+func trimAPIEvents(events []*event.APIEvent) []*event.APIEvent {
+	var result []*event.APIEvent
+	for _, e := range events {
+		level, err := log.ParseLevel(e.LogLevel)
+		if err != nil || level <= log.WarnLevel {
+			result = append(result, e)
+		}
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCompaction(t *testing.T) {
+	ds := newInMemoryStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+	now := time.Now()
+
+	// policy gen 2: service gen 1, policy gen 3: service gen 2, policy gen 4: service gen 3 (deleted)
+	updatePolicy(t, ds, newService("one"))
+	service := newService("one")
+	service.Labels = map[string]string{"label": "value"}
+	updatePolicy(t, ds, service)
+	_, _, err := ds.DeleteFromPolicy([]lang.Base{newService("one")}, "test")
+	assert.NoError(t, err, "Service should be deleted from policy")
+
+	saveRevision(t, ds, 2, now.Add(-10*24*time.Hour))
+	saveRevision(t, ds, 3, now.Add(-5*24*time.Hour))
+	saveRevision(t, ds, 4, now)
+
+	// old policy generation gets cached before compaction
+	policy, _, err := ds.GetPolicy(3)
+	assert.NoError(t, err, "Old policy generation should be loaded")
+	assert.NotNil(t, policy, "Old policy generation should be found")
+
+	result, err := ds.Compact(config.Retention{Revisions: 1, Age: 24 * time.Hour}, now)
+	assert.NoError(t, err, "Compaction should succeed")
+	assert.Equal(t, 2, result.RevisionsTrimmed, "Logs of old revisions should be trimmed")
+	assert.Equal(t, 3, result.PolicyGenerationsRemoved, "Policy generations older than retained revisions should be removed")
+	assert.Equal(t, 2, result.ObjectGenerationsRemoved, "Unreferenced generations of service should be removed, except the last one")
+	assert.True(t, result.RemovedDataBytes > 0, "Some data should be removed")
+
+	// old revisions keep status and errors only
+	revision, err := ds.GetRevision(1)
+	assert.NoError(t, err, "Old revision should be loaded")
+	assert.True(t, revision.Compacted, "Old revision should be marked as compacted")
+	assert.Equal(t, engine.RevisionStatusError, revision.Status, "Old revision should keep its status")
+	assert.Len(t, revision.ApplyLog, 1, "Only errors should be kept in the logs of old revision")
+	assert.Len(t, revision.ResolveLog, 0, "Only errors should be kept in the logs of old revision")
+
+	revision, err = ds.GetRevision(runtime.LastGen)
+	assert.NoError(t, err, "Last revision should be loaded")
+	assert.False(t, revision.Compacted, "Last revision should not be compacted")
+	assert.Len(t, revision.ApplyLog, 2, "Logs of the last revision should be kept")
+
+	policyData, err := ds.GetPolicyData(3)
+	assert.NoError(t, err, "Removed policy generation should be requested without error")
+	assert.Nil(t, policyData, "Old policy generation should be removed")
+	policy, _, err = ds.GetPolicy(3)
+	assert.NoError(t, err, "Removed policy generation should be requested without error")
+	assert.Nil(t, policy, "Old policy generation should be removed from the cache")
+
+	// compaction is idempotent
+	result, err = ds.Compact(config.Retention{Revisions: 1, Age: 24 * time.Hour}, now)
+	assert.NoError(t, err, "Compaction should succeed")
+	assert.Equal(t, &store.CompactionResult{}, result, "Nothing should be compacted again")
+
+	// service could be added again after compaction, generations keep counting
+	service = newService("one")
+	updatePolicy(t, ds, service)
+	assert.Equal(t, runtime.Generation(4), service.GetGeneration(), "Service should get the next generation")
+	policy, gen, err := ds.GetPolicy(runtime.LastGen)
+	assert.NoError(t, err, "Last policy should be loaded")
+	assert.Equal(t, runtime.Generation(5), gen, "Policy should get the next generation")
+	assert.Len(t, policy.GetObjectsByKind(lang.ServiceObject.Kind), 1, "Service should be added back into policy")
+}
+
+func TestCompactionRemovesRevisions(t *testing.T) {
+	ds := newInMemoryStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+	now := time.Now()
+
+	saveRevision(t, ds, runtime.FirstGen, now.Add(-100*24*time.Hour))
+	saveRevision(t, ds, runtime.FirstGen, now.Add(-50*24*time.Hour))
+	saveRevision(t, ds, runtime.FirstGen, now.Add(-40*24*time.Hour))
+
+	// revisions are never removed by default
+	result, err := ds.Compact(config.Retention{Revisions: 1, Age: 24 * time.Hour}, now)
+	assert.NoError(t, err, "Compaction should succeed")
+	assert.Equal(t, 0, result.RevisionsRemoved, "Revisions should not be removed without removal age")
+	assert.Equal(t, 2, result.RevisionsTrimmed, "Logs of old revisions should be trimmed")
+
+	result, err = ds.Compact(config.Retention{Revisions: 1, Age: 24 * time.Hour, RemoveAge: 45 * 24 * time.Hour}, now)
+	assert.NoError(t, err, "Compaction should succeed")
+	assert.Equal(t, 2, result.RevisionsRemoved, "Revisions older than removal age should be removed")
+
+	revision, err := ds.GetRevision(1)
+	assert.NoError(t, err, "Removed revision should be requested without error")
+	assert.Nil(t, revision, "Old revision should be removed")
+
+	// the last revision is kept even if it's older than removal age, so generations keep counting from it
+	result, err = ds.Compact(config.Retention{Revisions: 1, Age: 24 * time.Hour, RemoveAge: time.Hour}, now)
+	assert.NoError(t, err, "Compaction should succeed")
+	assert.Equal(t, 0, result.RevisionsRemoved, "The last revision should not be removed")
+
+	revision, err = ds.NewRevision(runtime.FirstGen)
+	assert.NoError(t, err, "New revision should be created")
+	assert.Equal(t, runtime.Generation(4), revision.GetGeneration(), "Revision should get the next generation")
+}
+
+func updatePolicy(t *testing.T, ds store.Core, obj lang.Base) {
+	t.Helper()
+	changed, _, err := ds.UpdatePolicy([]lang.Base{obj}, "test")
+	assert.NoError(t, err, "Policy should be updated")
+	assert.True(t, changed, "Policy should be changed")
+}
+
+func saveRevision(t *testing.T, ds store.Core, policyGen runtime.Generation, appliedAt time.Time) {
+	t.Helper()
+	revision, err := ds.NewRevision(policyGen)
+	assert.NoError(t, err, "New revision should be created")
+	revision.Status = engine.RevisionStatusError
+	revision.AppliedAt = appliedAt
+	revision.ResolveLog = []*event.APIEvent{{Time: appliedAt, LogLevel: "info", Message: "resolved"}}
+	revision.ApplyLog = []*event.APIEvent{
+		{Time: appliedAt, LogLevel: "debug", Message: "applying"},
+		{Time: appliedAt, LogLevel: "error", Message: "failed"},
+	}
+	assert.NoError(t, ds.SaveRevision(revision), "Revision should be saved")
+}
@@ -10,9 +10,15 @@ import (
 type defaultStore struct {
 	policyChangeLock sync.Mutex
 	store            store.Generic
+	policyCache      *policyCache
+	generatedSecrets *generatedSecretStore
 }
 
 // NewStore returns default implementation of generic store
 func NewStore(store store.Generic) store.Core {
-	return &defaultStore{sync.Mutex{}, store}
+	return &defaultStore{
+		store:            store,
+		policyCache:      newPolicyCache(policyCacheSize),
+		generatedSecrets: &generatedSecretStore{store: store},
+	}
 }
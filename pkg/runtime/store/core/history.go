@@ -0,0 +1,90 @@
+package core
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+)
+
+// policyRemoval is a policy generation, which has removed object with a given generation from the policy
+type policyRemoval struct {
+	removedGen runtime.Generation
+	policyData *engine.PolicyData
+}
+
+// GetPolicyObjectHistory returns all stored generations of a given policy object. Every generation is matched with the
+// policy generation, which has introduced it, to find out when and by whom the object has been changed
+func (ds *defaultStore) GetPolicyObjectHistory(ns string, kind string, name string) ([]*engine.PolicyObjectVersion, error) {
+	key := runtime.KeyFromParts(ns, kind, name)
+	objs, err := ds.store.ListGenerations(key)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing generations of %s: %s", key, err)
+	}
+	result := make([]*engine.PolicyObjectVersion, 0, len(objs))
+	if len(objs) <= 0 {
+		return result, nil
+	}
+
+	policyDataObjs, err := ds.store.ListGenerations(engine.PolicyDataKey)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing policy generations: %s", err)
+	}
+
+	// object generations are saved together with the policy generations, which either refer to them for the first time
+	// or don't refer to the object anymore (for generations marked as deleted)
+	added := make(map[runtime.Generation]*engine.PolicyData)
+	removals := []*policyRemoval{}
+	prevGen := runtime.LastGen
+	for _, policyDataObj := range policyDataObjs {
+		policyData, ok := policyDataObj.(*engine.PolicyData)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type while getting PolicyData from DB")
+		}
+
+		gen := policyData.Objects[ns][kind][name]
+		if gen != prevGen {
+			if gen == runtime.LastGen {
+				removals = append(removals, &policyRemoval{prevGen, policyData})
+			} else if added[gen] == nil {
+				added[gen] = policyData
+			}
+		}
+		prevGen = gen
+	}
+
+	for _, obj := range objs {
+		langObj, ok := obj.(lang.Base)
+		if !ok {
+			return nil, fmt.Errorf("can't cast obj %s to lang.Base", runtime.KeyForStorable(obj))
+		}
+
+		version := &engine.PolicyObjectVersion{Object: langObj, Policy: runtime.LastGen}
+		policyData := added[langObj.GetGeneration()]
+		if langObj.IsDeleted() {
+			policyData = findRemoval(removals, langObj.GetGeneration())
+		}
+		if policyData != nil {
+			version.Policy = policyData.GetGeneration()
+			version.UpdatedAt = policyData.Metadata.UpdatedAt
+			version.UpdatedBy = policyData.Metadata.UpdatedBy
+		}
+
+		result = append(result, version)
+	}
+
+	return result, nil
+}
+
+// findRemoval returns the policy generation, which has removed the object right before a given generation marked as
+// deleted has been saved, or nil if it isn't known
+func findRemoval(removals []*policyRemoval, deletedGen runtime.Generation) *engine.PolicyData {
+	var result *engine.PolicyData
+	for _, removal := range removals {
+		if removal.removedGen >= deletedGen {
+			break
+		}
+		result = removal.policyData
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGetPolicyObjectHistory(t *testing.T) {
+	ds := newInMemoryStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+
+	// policy gen 2: service gen 1 (alice), policy gen 3: other service, policy gen 4: service gen 2 (bob)
+	updatePolicyBy(t, ds, newService("one"), "alice")
+	updatePolicyBy(t, ds, newService("two"), "alice")
+	service := newService("one")
+	service.Labels = map[string]string{"label": "value"}
+	updatePolicyBy(t, ds, service, "bob")
+
+	// policy gen 5: service gen 3 (deleted by carol), policy gen 6: service gen 4 (added back by dave)
+	_, _, err := ds.DeleteFromPolicy([]lang.Base{newService("one")}, "carol")
+	assert.NoError(t, err, "Service should be deleted from policy")
+	updatePolicyBy(t, ds, newService("one"), "dave")
+
+	history, err := ds.GetPolicyObjectHistory("main", lang.ServiceObject.Kind, "one")
+	assert.NoError(t, err, "Service history should be loaded")
+	expected := []struct {
+		gen     runtime.Generation
+		deleted bool
+		policy  runtime.Generation
+		author  string
+	}{
+		{1, false, 2, "alice"},
+		{2, false, 4, "bob"},
+		{3, true, 5, "carol"},
+		{4, false, 6, "dave"},
+	}
+	if assert.Len(t, history, len(expected), "All generations of service should be returned") {
+		for idx, version := range history {
+			assert.Equal(t, expected[idx].gen, version.Object.GetGeneration(), "Generations should be ordered")
+			assert.Equal(t, expected[idx].deleted, version.Object.IsDeleted(), "Deleted flag should be returned for generation %d", expected[idx].gen)
+			assert.Equal(t, expected[idx].policy, version.Policy, "Policy generation should be found for generation %d", expected[idx].gen)
+			assert.Equal(t, expected[idx].author, version.UpdatedBy, "Author should be found for generation %d", expected[idx].gen)
+			assert.False(t, version.UpdatedAt.IsZero(), "Update time should be found for generation %d", expected[idx].gen)
+		}
+		assert.Equal(t, map[string]string{"label": "value"}, history[1].Object.(*lang.Service).Labels, "Object of each generation should be returned")
+	}
+
+	history, err = ds.GetPolicyObjectHistory("main", lang.ServiceObject.Kind, "three")
+	assert.NoError(t, err, "History of non-existing object should be requested without error")
+	assert.Empty(t, history, "History of non-existing object should be empty")
+}
+
+func updatePolicyBy(t *testing.T, ds store.Core, obj lang.Base, performedBy string) {
+	t.Helper()
+	changed, _, err := ds.UpdatePolicy([]lang.Base{obj}, performedBy)
+	assert.NoError(t, err, "Policy should be updated")
+	assert.True(t, changed, "Policy should be changed")
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/election"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"sync"
+	"time"
+)
+
+// GetLeaderLock returns a lock with a given name, which is persisted in the store as a lease. It's shared between all
+// servers using the same store
+func (ds *defaultStore) GetLeaderLock(name string) election.Lock {
+	return &leaderLock{store: ds.store, name: name, now: time.Now}
+}
+
+// leaderLock is a lock persisted in the store. Lease is checked and written in a single batch, so when multiple
+// servers try to acquire expired lock at the same time, only one of them succeeds. Others either see the new lease or
+// fail to commit the batch, as the lease they have read has been changed in the meantime
+type leaderLock struct {
+	mutex sync.Mutex
+	store store.Generic
+	name  string
+	now   func() time.Time
+}
+
+func (lock *leaderLock) key() string {
+	return runtime.KeyFromParts(runtime.SystemNS, election.LeaseObject.Kind, lock.name)
+}
+
+func (lock *leaderLock) get(ops store.Operations) (*election.Lease, error) {
+	obj, err := ops.Get(lock.key())
+	if err != nil {
+		return nil, fmt.Errorf("error while getting lease '%s': %s", lock.name, err)
+	}
+	if obj == nil {
+		return nil, nil
+	}
+
+	lease, ok := obj.(*election.Lease)
+	if !ok {
+		return nil, fmt.Errorf("unexpected type while getting lease '%s' from DB", lock.name)
+	}
+
+	return lease, nil
+}
+
+func (lock *leaderLock) Acquire(holder string, ttl time.Duration) (bool, error) {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	acquired := false
+	err := lock.store.Batch(func(ops store.Operations) error {
+		lease, err := lock.get(ops)
+		if err != nil {
+			return err
+		}
+		now := lock.now()
+		acquired = lease == nil || !lease.IsHeld(now) || lease.Holder == holder
+		if !acquired {
+			return nil
+		}
+
+		_, err = ops.Save(election.NewLease(lock.name, holder, now.Add(ttl)))
+		if err != nil {
+			return fmt.Errorf("error while saving lease '%s': %s", lock.name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return acquired, nil
+}
+
+func (lock *leaderLock) Release(holder string) error {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	return lock.store.Batch(func(ops store.Operations) error {
+		lease, err := lock.get(ops)
+		if err != nil {
+			return err
+		}
+		if lease == nil || lease.Holder != holder {
+			return nil
+		}
+
+		err = ops.Delete(lock.key())
+		if err != nil {
+			return fmt.Errorf("error while deleting lease '%s': %s", lock.name, err)
+		}
+		return nil
+	})
+}
+
+func (lock *leaderLock) Holder() (string, error) {
+	lock.mutex.Lock()
+	defer lock.mutex.Unlock()
+
+	lease, err := lock.get(lock.store)
+	if err != nil || lease == nil || !lease.IsHeld(lock.now()) {
+		return "", err
+	}
+
+	return lease.Holder, nil
+}
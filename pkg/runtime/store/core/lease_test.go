@@ -0,0 +1,73 @@
+package core
+
+import (
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLeaderLock(t *testing.T) {
+	now := time.Now()
+	lock := newInMemoryStore(t).GetLeaderLock("enforcer").(*leaderLock)
+	lock.now = func() time.Time { return now }
+
+	holder, err := lock.Holder()
+	assert.NoError(t, err, "Holder should be retrieved")
+	assert.Empty(t, holder, "Lock should not be held initially")
+
+	acquired, err := lock.Acquire("first", time.Minute)
+	assert.NoError(t, err, "Lock should be acquired")
+	assert.True(t, acquired, "Lock should be acquired by the first holder")
+
+	acquired, err = lock.Acquire("second", time.Minute)
+	assert.NoError(t, err, "Lock acquisition should not fail")
+	assert.False(t, acquired, "Lock should not be acquired by the second holder while it's held")
+
+	holder, err = lock.Holder()
+	assert.NoError(t, err, "Holder should be retrieved")
+	assert.Equal(t, "first", holder, "Lock should be held by the first holder")
+
+	// lock expires, so the second holder acquires it
+	now = now.Add(2 * time.Minute)
+	acquired, err = lock.Acquire("second", time.Minute)
+	assert.NoError(t, err, "Lock should be acquired")
+	assert.True(t, acquired, "Lock should be acquired by the second holder once it expired")
+
+	// only the holder can release the lock
+	assert.NoError(t, lock.Release("first"), "Lock release by non-holder should not fail")
+	holder, _ = lock.Holder()
+	assert.Equal(t, "second", holder, "Lock should not be released by non-holder")
+
+	assert.NoError(t, lock.Release("second"), "Lock should be released")
+	holder, _ = lock.Holder()
+	assert.Empty(t, holder, "Lock should not be held after it's released")
+}
+
+func TestLeaderLockConcurrentAcquire(t *testing.T) {
+	ds := newInMemoryStore(t)
+	holders := []string{"first", "second", "third", "fourth", "fifth"}
+
+	// every holder uses its own lock instance, same as servers sharing the same store
+	results := make(chan bool, len(holders))
+	var wg sync.WaitGroup
+	for _, holder := range holders {
+		wg.Add(1)
+		go func(holder string) {
+			defer wg.Done()
+			acquired, err := ds.GetLeaderLock("enforcer").Acquire(holder, time.Minute)
+			assert.NoError(t, err, "Lock acquisition should not fail")
+			results <- acquired
+		}(holder)
+	}
+	wg.Wait()
+	close(results)
+
+	count := 0
+	for acquired := range results {
+		if acquired {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count, "Lock should be acquired by exactly one holder")
+}
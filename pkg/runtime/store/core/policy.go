@@ -5,12 +5,18 @@ import (
 	"github.com/Aptomi/aptomi/pkg/engine"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
 	"time"
 )
 
 // GetPolicyData retrieves PolicyData given its generation
 func (ds *defaultStore) GetPolicyData(gen runtime.Generation) (*engine.PolicyData, error) {
-	dataObj, err := ds.store.GetGen(engine.PolicyDataKey, gen)
+	return getPolicyData(ds.store, gen)
+}
+
+// getPolicyData retrieves PolicyData given its generation using provided store operations
+func getPolicyData(ops store.Operations, gen runtime.Generation) (*engine.PolicyData, error) {
+	dataObj, err := ops.GetGen(engine.PolicyDataKey, gen)
 	if err != nil {
 		return nil, err
 	}
@@ -59,11 +65,31 @@ func (ds *defaultStore) getPolicyFromData(policyData *engine.PolicyData) (*lang.
 // if there is no policy yet (Aptomi not initialized), it will return nil
 func (ds *defaultStore) GetPolicy(gen runtime.Generation) (*lang.Policy, runtime.Generation, error) {
 	// todo should we use RWMutex for get/update policy?
+	if gen != runtime.LastGen {
+		if policy := ds.policyCache.Get(gen); policy != nil {
+			return policy, gen, nil
+		}
+	}
+
+	// policy data has to be loaded to find out the last generation, but policy could still be cached
 	policyData, err := ds.GetPolicyData(gen)
 	if err != nil {
 		return nil, runtime.LastGen, err
 	}
-	return ds.getPolicyFromData(policyData)
+	if policyData == nil {
+		return nil, runtime.LastGen, nil
+	}
+	if policy := ds.policyCache.Get(policyData.GetGeneration()); policy != nil {
+		return policy, policyData.GetGeneration(), nil
+	}
+
+	policy, policyGen, err := ds.getPolicyFromData(policyData)
+	if err != nil {
+		return nil, policyGen, err
+	}
+	ds.policyCache.Put(policyGen, policy)
+
+	return policy, policyGen, nil
 }
 
 // UpdatePolicy updates a list of changed objects in the underlying data store
@@ -72,44 +98,52 @@ func (ds *defaultStore) UpdatePolicy(updatedObjects []lang.Base, performedBy str
 	ds.policyChangeLock.Lock()
 	defer ds.policyChangeLock.Unlock()
 
-	policyData, err := ds.GetPolicyData(runtime.LastGen)
-	if err != nil {
-		return false, nil, err
-	}
-	if policyData == nil {
-		panic(fmt.Sprintf("Cannot retrieve last policy from the store, policyData is nil"))
-	}
-
+	var policyData *engine.PolicyData
 	changed := false
-	for _, updatedObj := range updatedObjects {
-		if updatedObj.IsDeleted() {
-			return false, nil, fmt.Errorf("objects with deleted=true not supported while updating policy: %s", runtime.KeyForStorable(updatedObj))
-		}
 
-		var changedObj bool
-		changedObj, err = ds.store.Save(updatedObj)
+	// all objects and policy data are saved atomically, so policy can't end up referring to partially saved objects
+	err := ds.store.Batch(func(ops store.Operations) error {
+		var err error
+		policyData, err = getPolicyData(ops, runtime.LastGen)
 		if err != nil {
-			return false, nil, err
+			return err
 		}
-		if changedObj {
-			policyData.Add(updatedObj)
-			changed = true
+		if policyData == nil {
+			panic(fmt.Sprintf("Cannot retrieve last policy from the store, policyData is nil"))
 		}
-	}
 
-	if changed {
-		// update metadata before saving policy data (to capture who and when edited the policy)
-		policyData.Metadata.UpdatedAt = time.Now()
-		policyData.Metadata.UpdatedBy = performedBy
+		changed = false
+		for _, updatedObj := range updatedObjects {
+			if updatedObj.IsDeleted() {
+				return fmt.Errorf("objects with deleted=true not supported while updating policy: %s", runtime.KeyForStorable(updatedObj))
+			}
 
-		// save policy data
-		_, err = ds.store.Save(policyData)
-		if err != nil {
-			return false, nil, err
+			changedObj, saveErr := ops.Save(updatedObj)
+			if saveErr != nil {
+				return saveErr
+			}
+			if changedObj {
+				policyData.Add(updatedObj)
+				changed = true
+			}
+		}
+
+		if changed {
+			// update metadata before saving policy data (to capture who and when edited the policy)
+			policyData.Metadata.UpdatedAt = time.Now()
+			policyData.Metadata.UpdatedBy = performedBy
+
+			// save policy data
+			_, err = ops.Save(policyData)
 		}
+
+		return err
+	})
+	if err != nil {
+		return false, nil, err
 	}
 
-	return changed, policyData, err
+	return changed, policyData, nil
 }
 
 // InitPolicy initializes policy (on the first run of Aptomi)
@@ -135,35 +169,44 @@ func (ds *defaultStore) DeleteFromPolicy(deleted []lang.Base, performedBy string
 	ds.policyChangeLock.Lock()
 	defer ds.policyChangeLock.Unlock()
 
-	policyData, err := ds.GetPolicyData(runtime.LastGen)
-	if err != nil {
-		return false, nil, err
-	}
-
+	var policyData *engine.PolicyData
 	policyChanged := false
-	for _, obj := range deleted {
-		if policyData.Remove(obj) {
-			policyChanged = true
+
+	// objects are marked deleted atomically together with saving policy data
+	err := ds.store.Batch(func(ops store.Operations) error {
+		var err error
+		policyData, err = getPolicyData(ops, runtime.LastGen)
+		if err != nil {
+			return err
 		}
 
-		if !obj.IsDeleted() {
-			obj.SetDeleted(true)
-			_, err = ds.store.Save(obj)
-			if err != nil {
-				return false, nil, fmt.Errorf("error while setting deleted=true for %s: %s", runtime.KeyForStorable(obj), err)
+		policyChanged = false
+		for _, obj := range deleted {
+			if policyData.Remove(obj) {
+				policyChanged = true
+			}
+
+			if !obj.IsDeleted() {
+				obj.SetDeleted(true)
+				_, err = ops.Save(obj)
+				if err != nil {
+					return fmt.Errorf("error while setting deleted=true for %s: %s", runtime.KeyForStorable(obj), err)
+				}
 			}
 		}
-	}
 
-	if policyChanged {
-		policyData.Metadata.UpdatedAt = time.Now()
-		policyData.Metadata.UpdatedBy = performedBy
+		if policyChanged {
+			policyData.Metadata.UpdatedAt = time.Now()
+			policyData.Metadata.UpdatedBy = performedBy
 
-		// save policy data
-		_, err = ds.store.Save(policyData)
-		if err != nil {
-			return false, nil, err
+			// save policy data
+			_, err = ops.Save(policyData)
 		}
+
+		return err
+	})
+	if err != nil {
+		return false, nil, err
 	}
 
 	return policyChanged, policyData, nil
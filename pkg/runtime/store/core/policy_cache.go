@@ -0,0 +1,97 @@
+package core
+
+import (
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"sync"
+)
+
+// policyCacheSize is a number of policy generations kept in memory
+const policyCacheSize = 8
+
+// policyCache keeps recently used policies in memory, so they don't have to be loaded from the store object by object
+// every time. Policy generation never changes once it's saved, so cached policy stays valid until its generation gets
+// compacted or the whole store content gets replaced (e.g. when backup is restored). It holds a limited number of
+// entries, evicting the least recently used ones first
+type policyCache struct {
+	mutex   sync.Mutex
+	size    int
+	gens    []runtime.Generation
+	entries map[runtime.Generation]*lang.Policy
+}
+
+// newPolicyCache creates a new empty policy cache, which holds up to a given number of entries
+func newPolicyCache(size int) *policyCache {
+	return &policyCache{
+		size:    size,
+		entries: make(map[runtime.Generation]*lang.Policy),
+	}
+}
+
+// Get returns cached policy for a given generation, or nil if it's not in the cache
+func (cache *policyCache) Get(gen runtime.Generation) *lang.Policy {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	policy, exists := cache.entries[gen]
+	if exists {
+		cache.touch(gen)
+	}
+
+	return policy
+}
+
+// Put stores policy in the cache under a given generation
+func (cache *policyCache) Put(gen runtime.Generation, policy *lang.Policy) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if cache.size <= 0 {
+		return
+	}
+
+	if _, exists := cache.entries[gen]; exists {
+		cache.touch(gen)
+	} else {
+		if len(cache.gens) >= cache.size {
+			delete(cache.entries, cache.gens[0])
+			cache.gens = cache.gens[1:]
+		}
+		cache.gens = append(cache.gens, gen)
+	}
+	cache.entries[gen] = policy
+}
+
+// Remove removes policy of a given generation from the cache
+func (cache *policyCache) Remove(gen runtime.Generation) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if _, exists := cache.entries[gen]; exists {
+		delete(cache.entries, gen)
+		cache.gens = removeGen(cache.gens, gen)
+	}
+}
+
+// Invalidate removes all entries from the cache
+func (cache *policyCache) Invalidate() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cache.gens = nil
+	cache.entries = make(map[runtime.Generation]*lang.Policy)
+}
+
+// touch moves a given generation to the end of the eviction order. Caller should hold the lock
+func (cache *policyCache) touch(gen runtime.Generation) {
+	cache.gens = append(removeGen(cache.gens, gen), gen)
+}
+
+func removeGen(gens []runtime.Generation, gen runtime.Generation) []runtime.Generation {
+	for i, existing := range gens {
+		if existing == gen {
+			return append(gens[:i], gens[i+1:]...)
+		}
+	}
+	return gens
+}
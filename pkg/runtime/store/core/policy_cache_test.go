@@ -0,0 +1,64 @@
+package core
+
+import (
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPolicyCache(t *testing.T) {
+	cache := newPolicyCache(2)
+
+	policy1 := lang.NewPolicy()
+	cache.Put(1, policy1)
+	assert.Equal(t, policy1, cache.Get(1), "Policy should be retrieved from the cache")
+	assert.Nil(t, cache.Get(2), "Policy should not be cached for a different generation")
+
+	// least recently used entries should be evicted
+	cache.Put(2, lang.NewPolicy())
+	assert.NotNil(t, cache.Get(1), "Policy should be retrieved from the cache")
+	cache.Put(3, lang.NewPolicy())
+	assert.Nil(t, cache.Get(2), "Least recently used policy should be evicted from the cache")
+	assert.NotNil(t, cache.Get(1), "Recently used policy should stay in the cache")
+	assert.NotNil(t, cache.Get(3), "Policy should be retrieved from the cache")
+
+	// invalidation should remove everything
+	cache.Invalidate()
+	for _, gen := range []runtime.Generation{1, 2, 3} {
+		assert.Nil(t, cache.Get(gen), "Policy should not be retrieved after cache invalidation")
+	}
+}
+
+func TestGetPolicyCached(t *testing.T) {
+	ds := newInMemoryStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+	updatePolicy(t, ds, newService("one"))
+
+	policy, gen, err := ds.GetPolicy(runtime.LastGen)
+	assert.NoError(t, err, "Last policy should be loaded")
+	assert.Equal(t, runtime.Generation(2), gen, "Last policy generation should be loaded")
+
+	cached, _, err := ds.GetPolicy(2)
+	assert.NoError(t, err, "Policy should be loaded")
+	assert.True(t, policy == cached, "Policy should be returned from the cache")
+
+	// new generation is loaded from the store and previous one stays unchanged
+	updatePolicy(t, ds, newService("two"))
+	policy, gen, err = ds.GetPolicy(runtime.LastGen)
+	assert.NoError(t, err, "Last policy should be loaded")
+	assert.Equal(t, runtime.Generation(3), gen, "Last policy generation should be loaded")
+	assert.Len(t, policy.GetObjectsByKind(lang.ServiceObject.Kind), 2, "Both services should be present in the last policy")
+	assert.Len(t, cached.GetObjectsByKind(lang.ServiceObject.Kind), 1, "Cached policy should not be changed")
+
+	// copy of the cached policy could be modified without affecting it
+	policyCopy := policy.MakeCopy()
+	policyCopy.RemoveObject(newService("one"))
+	assert.Len(t, policyCopy.GetObjectsByKind(lang.ServiceObject.Kind), 1, "Service should be removed from the policy copy")
+	assert.Len(t, policy.GetObjectsByKind(lang.ServiceObject.Kind), 2, "Service should not be removed from the cached policy")
+
+	// non-existing generation isn't returned
+	policy, _, err = ds.GetPolicy(10)
+	assert.NoError(t, err, "Non-existing policy should not cause an error")
+	assert.Nil(t, policy, "Non-existing policy should not be returned")
+}
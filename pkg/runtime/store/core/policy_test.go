@@ -0,0 +1,64 @@
+package core
+
+import (
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/generic/mem"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestPolicyUpdateAndDelete(t *testing.T) {
+	ds := newInMemoryStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+
+	// add service into the policy
+	service := newService("one")
+	changed, policyData, err := ds.UpdatePolicy([]lang.Base{service}, "test")
+	assert.NoError(t, err, "Policy should be updated")
+	assert.True(t, changed, "Policy should be changed")
+	assert.Equal(t, runtime.Generation(2), policyData.GetGeneration(), "Policy generation should be incremented")
+
+	// saving the same service doesn't change the policy
+	changed, _, err = ds.UpdatePolicy([]lang.Base{newService("one")}, "test")
+	assert.NoError(t, err, "Policy should be updated")
+	assert.False(t, changed, "Policy should not be changed")
+
+	// delete service from the policy
+	changed, policyData, err = ds.DeleteFromPolicy([]lang.Base{newService("one")}, "test")
+	assert.NoError(t, err, "Service should be deleted from policy")
+	assert.True(t, changed, "Policy should be changed")
+	assert.Equal(t, runtime.Generation(3), policyData.GetGeneration(), "Policy generation should be incremented")
+
+	// service stays in the previous generation of policy only
+	policy, gen, err := ds.GetPolicy(runtime.LastGen)
+	assert.NoError(t, err, "Last policy should be loaded")
+	assert.Equal(t, runtime.Generation(3), gen, "Last policy generation should be loaded")
+	assert.Empty(t, policy.GetObjectsByKind(lang.ServiceObject.Kind), "Service should be deleted from the last policy")
+
+	policy, _, err = ds.GetPolicy(2)
+	assert.NoError(t, err, "Previous policy should be loaded")
+	assert.Len(t, policy.GetObjectsByKind(lang.ServiceObject.Kind), 1, "Service should be present in the previous policy")
+}
+
+func newInMemoryStore(t *testing.T) store.Core {
+	t.Helper()
+	s := mem.NewGenericStore(runtime.NewRegistry().Append(store.Objects...))
+	err := s.Open(config.DB{Connection: mem.Scheme})
+	if err != nil {
+		t.Fatalf("Unable to open in-memory store: %s", err)
+	}
+	return NewStore(s)
+}
+
+func newService(name string) *lang.Service {
+	return &lang.Service{
+		TypeKind: lang.ServiceObject.GetTypeKind(),
+		Metadata: lang.Metadata{
+			Namespace: "main",
+			Name:      name,
+		},
+	}
+}
@@ -4,28 +4,34 @@ import (
 	"fmt"
 	"github.com/Aptomi/aptomi/pkg/engine"
 	"github.com/Aptomi/aptomi/pkg/engine/progress"
+	"github.com/Aptomi/aptomi/pkg/event"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/runtime/store"
 	log "github.com/Sirupsen/logrus"
 	"math"
+	"sort"
+	"sync"
 	"time"
 )
 
 // GetRevision returns Revision for specified generation
 func (ds *defaultStore) GetRevision(gen runtime.Generation) (*engine.Revision, error) {
-	dataObj, err := ds.store.GetGen(engine.RevisionKey, gen)
+	return getRevision(ds.store, gen)
+}
+
+// getRevision retrieves Revision given its generation using provided store operations
+func getRevision(ops store.Operations, gen runtime.Generation) (*engine.Revision, error) {
+	dataObj, err := ops.GetGen(engine.RevisionKey, gen)
 	if err != nil {
 		return nil, err
 	}
 	if dataObj == nil {
 		return nil, nil
 	}
-
 	data, ok := dataObj.(*engine.Revision)
 	if !ok {
 		return nil, fmt.Errorf("unexpected type while getting Revision from DB")
 	}
-
 	return data, nil
 }
 
@@ -94,9 +100,28 @@ func (ds *defaultStore) NewRevision(policyGen runtime.Generation) (*engine.Revis
 	}, nil
 }
 
-// SaveRevision saves specified Revision into the store with possibly new generation creation
+// SaveRevision saves specified Revision into the store with possibly new generation creation. Revision is saved only
+// if policy generation it refers to exists, which is checked atomically with saving. Approvals of rollouts made in the
+// last revision get carried over, if rollouts are still waiting for them
 func (ds *defaultStore) SaveRevision(revision *engine.Revision) error {
-	_, err := ds.store.Save(revision)
+	err := ds.store.Batch(func(ops store.Operations) error {
+		policyData, err := getPolicyData(ops, revision.Policy)
+		if err != nil {
+			return fmt.Errorf("error while getting policy %s: %s", revision.Policy, err)
+		}
+		if policyData == nil {
+			return fmt.Errorf("policy %s doesn't exist", revision.Policy)
+		}
+
+		lastRevision, err := getRevision(ops, runtime.LastGen)
+		if err != nil {
+			return fmt.Errorf("error while getting last revision: %s", err)
+		}
+		revision.MergeApprovals(lastRevision)
+
+		_, err = ops.Save(revision)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("error while saving revision: %s", err)
 	}
@@ -104,9 +129,68 @@ func (ds *defaultStore) SaveRevision(revision *engine.Revision) error {
 	return nil
 }
 
-// UpdateRevision updates specified Revision in the store without creating new generation
+// WatchRevisions returns a channel with revisions as they get saved or updated
+func (ds *defaultStore) WatchRevisions() (<-chan *engine.Revision, func()) {
+	events, stopWatch := ds.store.Watch(engine.RevisionKey)
+
+	revisions := make(chan *engine.Revision)
+	done := make(chan bool)
+	go func() {
+		defer close(revisions)
+		for e := range events {
+			revision, ok := e.Object.(*engine.Revision)
+			if !ok {
+				continue
+			}
+
+			select {
+			case revisions <- revision:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	stopOnce := sync.Once{}
+	return revisions, func() {
+		stopOnce.Do(func() {
+			close(done)
+			stopWatch()
+		})
+	}
+}
+
+// UpdateRevision updates specified Revision in the store without creating new generation. Approvals of rollouts made
+// in the stored revision get preserved, so updating a revision loaded before approval doesn't revert it. Once apply log
+// is saved into the revision, its chunks saved by the revision progress updater get removed
 func (ds *defaultStore) UpdateRevision(revision *engine.Revision) error {
-	_, err := ds.store.Update(revision)
+	err := ds.store.Batch(func(ops store.Operations) error {
+		stored, err := getRevision(ops, revision.GetGeneration())
+		if err != nil {
+			return fmt.Errorf("error while getting revision %s: %s", revision.GetGeneration(), err)
+		}
+		revision.MergeApprovals(stored)
+
+		_, err = ops.Update(revision)
+		if err != nil {
+			return err
+		}
+
+		if len(revision.ApplyLog) <= 0 {
+			return nil
+		}
+		chunks, err := getApplyLogChunks(ops, revision.GetGeneration())
+		if err != nil {
+			return err
+		}
+		for _, chunk := range chunks {
+			err = ops.Delete(runtime.KeyForStorable(chunk))
+			if err != nil {
+				return fmt.Errorf("error while deleting apply log chunk %s: %s", chunk.GetName(), err)
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return fmt.Errorf("error while updating revision: %s", err)
 	}
@@ -114,16 +198,111 @@ func (ds *defaultStore) UpdateRevision(revision *engine.Revision) error {
 	return nil
 }
 
-func (ds *defaultStore) GetRevisionProgressUpdater(revision *engine.Revision) progress.Indicator {
-	return &revisionProgressUpdater{ds, revision}
+// ApproveRollout approves rollout of a given service in the last revision to continue with the next stage, and
+// returns the updated revision. It returns nil if there are no revisions yet
+func (ds *defaultStore) ApproveRollout(serviceKey string) (*engine.Revision, error) {
+	var result *engine.Revision
+	err := ds.store.Batch(func(ops store.Operations) error {
+		revision, err := getRevision(ops, runtime.LastGen)
+		if err != nil {
+			return fmt.Errorf("error while getting last revision: %s", err)
+		}
+		if revision == nil {
+			return nil
+		}
+
+		err = revision.ApproveRollout(serviceKey)
+		if err != nil {
+			return err
+		}
+
+		_, err = ops.Update(revision)
+		if err != nil {
+			return fmt.Errorf("error while updating revision: %s", err)
+		}
+		result = revision
+		return nil
+	})
+	return result, err
+}
+
+// GetRevisionApplyLog returns apply log of a given revision. While revision is being applied, it returns events from
+// the apply log chunks saved so far. Chunks get removed in the same batch as apply log gets saved into the revision, so
+// revision is read only if there are no chunks
+func (ds *defaultStore) GetRevisionApplyLog(gen runtime.Generation) ([]*event.APIEvent, error) {
+	chunks, err := getApplyLogChunks(ds.store, gen)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) > 0 {
+		var result []*event.APIEvent
+		for _, chunk := range chunks {
+			result = append(result, chunk.Events...)
+		}
+		return result, nil
+	}
+
+	revision, err := ds.GetRevision(gen)
+	if err != nil || revision == nil {
+		return nil, err
+	}
+	return revision.ApplyLog, nil
+}
+
+// getApplyLogChunks returns apply log chunks of a given revision in order using provided store operations
+func getApplyLogChunks(ops store.Operations, gen runtime.Generation) ([]*engine.ApplyLogChunk, error) {
+	chunkObjs, err := ops.List(engine.ApplyLogChunkPrefix(gen))
+	if err != nil {
+		return nil, fmt.Errorf("error while listing apply log chunks of revision %s: %s", gen, err)
+	}
+
+	result := []*engine.ApplyLogChunk{}
+	for _, chunkObj := range chunkObjs {
+		chunk, ok := chunkObj.(*engine.ApplyLogChunk)
+		if !ok {
+			return nil, fmt.Errorf("unexpected type while getting apply log chunk from DB")
+		}
+		result = append(result, chunk)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Index < result[j].Index
+	})
+
+	return result, nil
+}
+
+// GetRevisionProgressUpdater returns progress indicator, which saves progress into a given revision. If apply log is
+// specified, its new events get saved as apply log chunks along with progress, so clients watching the revision could
+// see them without the whole apply log being saved every time
+func (ds *defaultStore) GetRevisionProgressUpdater(revision *engine.Revision, applyLog *event.Log) progress.Indicator {
+	return &revisionProgressUpdater{store: ds, revision: revision, applyLog: applyLog}
 }
 
 type revisionProgressUpdater struct {
-	store    store.Core
+	store    *defaultStore
 	revision *engine.Revision
+	applyLog *event.Log
+
+	// savedLog is the number of apply log events already saved and chunks is the number of saved apply log chunks
+	savedLog int
+	chunks   int
 }
 
 func (p *revisionProgressUpdater) save() {
+	// apply log chunk is saved before progress, so clients get new events along with the revision update
+	if p.applyLog != nil {
+		events := p.applyLog.AsAPIEvents()
+		if len(events) > p.savedLog {
+			_, err := p.store.store.Save(engine.NewApplyLogChunk(p.revision.GetGeneration(), p.chunks, events[p.savedLog:]))
+			if err != nil {
+				log.Warnf("Unable to save revision %s apply log with err: %s", p.revision.GetGeneration(), err)
+			} else {
+				p.savedLog = len(events)
+				p.chunks++
+			}
+		}
+	}
+
 	err := p.store.UpdateRevision(p.revision)
 	if err != nil {
 		log.Warnf("Unable to save revision %s progress with err: %s", p.revision.GetGeneration(), err)
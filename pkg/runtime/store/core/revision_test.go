@@ -0,0 +1,157 @@
+package core
+
+import (
+	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWatchRevisions(t *testing.T) {
+	ds := newInMemoryStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+
+	revisions, stop := ds.WatchRevisions()
+
+	revision, err := ds.NewRevision(runtime.FirstGen)
+	assert.NoError(t, err, "Revision should be created")
+	assert.NoError(t, ds.SaveRevision(revision), "Revision should be saved")
+
+	// progress is saved into revision as it changes
+	updater := ds.GetRevisionProgressUpdater(revision, event.NewLog("test-apply", false))
+	updater.SetTotal(1)
+	updater.Advance()
+	updater.Done(true)
+
+	expected := []struct {
+		status  string
+		current int
+	}{
+		{engine.RevisionStatusInProgress, 0},
+		{engine.RevisionStatusInProgress, 0},
+		{engine.RevisionStatusInProgress, 1},
+		{engine.RevisionStatusSuccess, 1},
+	}
+	for _, exp := range expected {
+		select {
+		case watched, ok := <-revisions:
+			if !assert.True(t, ok, "Revision should be reported") {
+				return
+			}
+			assert.Equal(t, revision.GetGeneration(), watched.GetGeneration(), "Revision generation should be reported")
+			assert.Equal(t, exp.status, watched.Status, "Revision status should be reported")
+			assert.Equal(t, exp.current, watched.Progress.Current, "Revision progress should be reported")
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout while waiting for revision update")
+		}
+	}
+
+	stop()
+	_, ok := <-revisions
+	assert.False(t, ok, "Channel should be closed once watch is stopped")
+}
+
+func TestRevisionApplyLog(t *testing.T) {
+	ds := newInMemoryStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+
+	revision, err := ds.NewRevision(runtime.FirstGen)
+	assert.NoError(t, err, "Revision should be created")
+	assert.NoError(t, ds.SaveRevision(revision), "Revision should be saved")
+
+	checkApplyLog := func(expected int) {
+		t.Helper()
+		applyLog, logErr := ds.GetRevisionApplyLog(revision.GetGeneration())
+		assert.NoError(t, logErr, "Apply log should be retrieved")
+		assert.Len(t, applyLog, expected, "Apply log should contain all saved events")
+	}
+
+	// new events are saved as apply log chunks, without being saved into the revision
+	applyLog := event.NewLog("test-apply", false)
+	updater := ds.GetRevisionProgressUpdater(revision, applyLog)
+	updater.SetTotal(2)
+	checkApplyLog(0)
+
+	applyLog.WithFields(event.Fields{}).Info("applying first action")
+	updater.Advance()
+	checkApplyLog(1)
+
+	updater.Advance()
+	applyLog.WithFields(event.Fields{}).Info("applying second action")
+	applyLog.WithFields(event.Fields{}).Info("applied second action")
+	updater.Done(true)
+	checkApplyLog(3)
+
+	stored, err := ds.GetRevision(revision.GetGeneration())
+	assert.NoError(t, err, "Revision should be retrieved")
+	assert.Empty(t, stored.ApplyLog, "Apply log shouldn't be saved into revision by progress updater")
+
+	// once apply log is saved into the revision, chunks get removed
+	stored.ApplyLog = applyLog.AsAPIEvents()
+	assert.NoError(t, ds.UpdateRevision(stored), "Revision should be updated")
+	checkApplyLog(3)
+
+	chunks, err := ds.(*defaultStore).store.List(engine.ApplyLogChunkPrefix(revision.GetGeneration()))
+	assert.NoError(t, err, "Apply log chunks should be listed")
+	assert.Empty(t, chunks, "Apply log chunks should be removed")
+}
+
+func TestApproveRolloutWhileSavingProgress(t *testing.T) {
+	ds := newInMemoryStore(t)
+	assert.NoError(t, ds.InitPolicy(), "Policy should be initialized")
+
+	newRollouts := func(status string, stageIndex int) map[string]*engine.RolloutProgress {
+		return map[string]*engine.RolloutProgress{
+			"main/service": {Service: "main/service", Policy: runtime.FirstGen, Status: status, StageIndex: stageIndex},
+		}
+	}
+
+	// revision with a rollout waiting for approval
+	revision, err := ds.NewRevision(runtime.FirstGen)
+	assert.NoError(t, err, "Revision should be created")
+	revision.Rollouts = newRollouts(engine.RolloutStatusWaitingApproval, 0)
+	assert.NoError(t, ds.SaveRevision(revision), "Revision should be saved")
+
+	// approve rollout while enforcer keeps saving progress from its own copy of the revision
+	updater := ds.GetRevisionProgressUpdater(revision, event.NewLog("test-apply", false))
+	updater.SetTotal(100)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			updater.Advance()
+		}
+	}()
+	approved, err := ds.ApproveRollout("main/service")
+	if assert.NoError(t, err, "Rollout should be approved") && assert.NotNil(t, approved, "Approved revision should be returned") {
+		assert.True(t, approved.Rollouts["main/service"].Approved, "Rollout should be approved in returned revision")
+	}
+	<-done
+	updater.Done(true)
+
+	stored, err := ds.GetRevision(runtime.LastGen)
+	assert.NoError(t, err, "Last revision should be loaded")
+	assert.Equal(t, 100, stored.Progress.Current, "Progress should be saved")
+	assert.True(t, stored.Rollouts["main/service"].Approved, "Approval should not be overwritten by progress updates")
+
+	// next revision created from rollout progress loaded before approval keeps approval
+	next, err := ds.NewRevision(runtime.FirstGen)
+	assert.NoError(t, err, "Revision should be created")
+	next.Rollouts = newRollouts(engine.RolloutStatusWaitingApproval, 0)
+	assert.NoError(t, ds.SaveRevision(next), "Revision should be saved")
+	stored, err = ds.GetRevision(runtime.LastGen)
+	assert.NoError(t, err, "Last revision should be loaded")
+	assert.Equal(t, next.GetGeneration(), stored.GetGeneration(), "Next revision should be the last one")
+	assert.True(t, stored.Rollouts["main/service"].Approved, "Approval should be carried over to the next revision")
+
+	// approval doesn't get carried over once rollout moves to the next stage
+	next, err = ds.NewRevision(runtime.FirstGen)
+	assert.NoError(t, err, "Revision should be created")
+	next.Rollouts = newRollouts(engine.RolloutStatusWaitingApproval, 1)
+	assert.NoError(t, ds.SaveRevision(next), "Revision should be saved")
+	stored, err = ds.GetRevision(runtime.LastGen)
+	assert.NoError(t, err, "Last revision should be loaded")
+	assert.False(t, stored.Rollouts["main/service"].Approved, "Approval should not be carried over to the next stage")
+}
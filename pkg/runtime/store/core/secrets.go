@@ -0,0 +1,77 @@
+package core
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/external/secrets"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"sync"
+)
+
+func (ds *defaultStore) GetGeneratedSecretStore() secrets.GeneratedSecretStore {
+	return ds.generatedSecrets
+}
+
+// generatedSecretStore persists generated secrets in the generic store. There is a single instance of it per store,
+// so concurrent calls to LoadOrGenerate never generate the same secret twice
+type generatedSecretStore struct {
+	mutex sync.Mutex
+	store store.Generic
+}
+
+func (gss *generatedSecretStore) LoadOrGenerate(instanceKey string, name string, generate func() string) (string, error) {
+	gss.mutex.Lock()
+	defer gss.mutex.Unlock()
+
+	instanceSecrets, err := gss.load(instanceKey)
+	if err != nil {
+		return "", err
+	}
+
+	if value, exists := instanceSecrets.Secrets[name]; exists {
+		return value, nil
+	}
+
+	value := generate()
+	instanceSecrets.Secrets[name] = value
+	_, err = gss.store.Save(instanceSecrets)
+	if err != nil {
+		return "", fmt.Errorf("error while saving generated secrets for component instance '%s': %s", instanceKey, err)
+	}
+
+	return value, nil
+}
+
+func (gss *generatedSecretStore) LoadByInstance(instanceKey string) (map[string]string, error) {
+	gss.mutex.Lock()
+	defer gss.mutex.Unlock()
+
+	instanceSecrets, err := gss.load(instanceKey)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	for name, value := range instanceSecrets.Secrets {
+		result[name] = value
+	}
+	return result, nil
+}
+
+func (gss *generatedSecretStore) load(instanceKey string) (*secrets.GeneratedSecrets, error) {
+	key := runtime.KeyFromParts(runtime.SystemNS, secrets.GeneratedSecretsObject.Kind, instanceKey)
+	obj, err := gss.store.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("error while getting generated secrets for component instance '%s': %s", instanceKey, err)
+	}
+	if obj == nil {
+		return secrets.NewGeneratedSecrets(instanceKey), nil
+	}
+	return obj.(*secrets.GeneratedSecrets), nil
+}
+
+func (gss *generatedSecretStore) DeleteByInstance(instanceKey string) error {
+	gss.mutex.Lock()
+	defer gss.mutex.Unlock()
+
+	return gss.store.Delete(runtime.KeyFromParts(runtime.SystemNS, secrets.GeneratedSecretsObject.Kind, instanceKey))
+}
@@ -10,6 +10,28 @@ type Generic interface {
 	Open(config.DB) error
 	Close() error
 
+	Operations
+
+	// Batch runs a given function in a transaction. Changes made through operations passed to the function are written
+	// atomically once it returns nil, and discarded if it returns error. Changes are visible to the reads done through
+	// the same operations, but not visible to anyone else until they are written. Function may be called more than once,
+	// if store has to retry the transaction because of concurrent changes, so it should not have any other side effects
+	Batch(f func(ops Operations) error) error
+
+	// Watch returns a channel with events about changes of objects with keys starting with a given prefix, which are
+	// written after watch is started, and a function to stop watching. Channel gets closed once watching is stopped,
+	// either by calling the function or by the store itself (e.g. when watcher doesn't keep up with changes)
+	Watch(prefix string) (<-chan WatchEvent, func())
+
+	// WithRegistry returns a store, which shares data and connection with the opened store, but encodes and decodes
+	// objects using a given registry. It's used to work with objects, which can't be decoded into their Go types
+	// anymore (e.g. by migrations). Returned store shouldn't be closed, it's closed together with the original one
+	WithRegistry(registry *runtime.Registry) Generic
+}
+
+// Operations is an interface which describes operations on storable objects, which could be done either directly in
+// DB or within a batch
+type Operations interface {
 	Get(key string) (runtime.Storable, error)
 	GetGen(key string, gen runtime.Generation) (runtime.Versioned, error)
 
@@ -24,4 +46,6 @@ type Generic interface {
 	Update(runtime.Storable) (updated bool, err error)
 
 	Delete(key string) error
+	// DeleteGen deletes a single generation of versioned object, it's used to compact DB by removing old generations
+	DeleteGen(key string, gen runtime.Generation) error
 }
@@ -11,25 +11,37 @@ import (
 	"github.com/Aptomi/aptomi/pkg/runtime/store"
 	"github.com/boltdb/bolt"
 	"reflect"
+	"strings"
+	"sync"
 	"time"
 )
 
 // NewGenericStore creates a new object store based on BoltDB
 func NewGenericStore(registry *runtime.Registry) store.Generic {
 	codec := yaml.NewCodec(registry)
-	return &boltStore{registry: registry, codec: codec}
+	return &boltStore{registry: registry, codec: codec, notifier: store.NewNotifier(codec), updateMutex: &sync.Mutex{}}
 }
 
 type boltStore struct {
 	registry *runtime.Registry
 	codec    runtime.Codec
 	db       *bolt.DB
+	notifier *store.Notifier
+
+	// updateMutex serializes read-write transactions together with notifying watchers, so watchers get changes in the
+	// same order as they are committed. BoltDB allows only one read-write transaction at a time anyway. It's shared with
+	// stores created by WithRegistry
+	updateMutex *sync.Mutex
 }
 
 var objectsBucket = []byte("objects")
 
+// Scheme is an optional scheme of the connection string for BoltDB store, connection string without any scheme is
+// treated as a path to BoltDB file as well
+const Scheme = "bolt://"
+
 func (bs *boltStore) Open(cfg config.DB) error {
-	connection := cfg.Connection
+	connection := strings.TrimPrefix(cfg.Connection, Scheme)
 	db, err := bolt.Open(connection, 0600, &bolt.Options{Timeout: 5 * time.Second})
 	if err != nil {
 		return fmt.Errorf("error while opening BoltDB: %s error: %s", connection, err)
@@ -57,26 +69,9 @@ const boltSeparator = "@"
 func (bs *boltStore) Get(key string) (runtime.Storable, error) {
 	var result runtime.Storable
 	err := bs.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(objectsBucket)
-		if bucket == nil {
-			return fmt.Errorf("bucket not found: %s", objectsBucket)
-		}
-
-		data := bucket.Get([]byte(key + boltSeparator + genStr(runtime.LastGen)))
-
-		if data != nil {
-			obj, err := bs.codec.DecodeOne(data)
-			if err != nil {
-				return err
-			}
-			storable, ok := obj.(runtime.Storable)
-			if !ok {
-				return fmt.Errorf("storable object is expected to be decoded from bolt, but got: %s", obj.GetKind())
-			}
-			result = storable
-		}
-
-		return nil
+		var err error
+		result, err = bs.ops(tx).Get(key)
+		return err
 	})
 
 	return result, err
@@ -85,63 +80,20 @@ func (bs *boltStore) Get(key string) (runtime.Storable, error) {
 func (bs *boltStore) GetGen(key string, gen runtime.Generation) (runtime.Versioned, error) {
 	var result runtime.Versioned
 	err := bs.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(objectsBucket)
-		if bucket == nil {
-			return fmt.Errorf("bucket not found: %s", objectsBucket)
-		}
-
-		var data []byte
-		if gen == runtime.LastGen {
-			c := bucket.Cursor()
-			prefix := []byte(key + boltSeparator)
-			for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
-				data = v
-			}
-		} else {
-			data = bucket.Get([]byte(key + boltSeparator + genStr(gen)))
-		}
-
-		if data != nil {
-			obj, err := bs.codec.DecodeOne(data)
-			if err != nil {
-				return err
-			}
-			versioned, ok := obj.(runtime.Versioned)
-			if !ok {
-				return fmt.Errorf("versioned object is expected to be decoded from bolt, but got: %s", obj.GetKind())
-			}
-			result = versioned
-		}
-
-		return nil
+		var err error
+		result, err = bs.ops(tx).GetGen(key, gen)
+		return err
 	})
 
 	return result, err
 }
 
 func (bs *boltStore) List(prefix string) ([]runtime.Storable, error) {
-	result := make([]runtime.Storable, 0)
+	var result []runtime.Storable
 	err := bs.db.View(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(objectsBucket)
-		if bucket == nil {
-			return fmt.Errorf("bucket not found: %s", objectsBucket)
-		}
-
-		c := bucket.Cursor()
-		prefixBytes := []byte(prefix)
-		for k, v := c.Seek(prefixBytes); k != nil && bytes.HasPrefix(k, prefixBytes); k, v = c.Next() {
-			baseObj, err := bs.codec.DecodeOne(v)
-			if err != nil {
-				return err
-			}
-			obj, ok := baseObj.(runtime.Storable)
-			if !ok {
-				return fmt.Errorf("storable object is expected to be decoded from bolt, but got: %s", baseObj.GetKind())
-			}
-			result = append(result, obj)
-		}
-
-		return nil
+		var err error
+		result, err = bs.ops(tx).List(prefix)
+		return err
 	})
 
 	return result, err
@@ -151,13 +103,193 @@ func (bs *boltStore) ListGenerations(key string) ([]runtime.Storable, error) {
 	return bs.List(key + boltSeparator)
 }
 
-func (bs *boltStore) setNextGeneration(obj runtime.Versioned) error {
+func (bs *boltStore) Save(obj runtime.Storable) (bool, error) {
+	var updated bool
+	err := bs.update(func(ops *boltOps) error {
+		var err error
+		updated, err = ops.Save(obj)
+		return err
+	})
+
+	return updated, err
+}
+
+func (bs *boltStore) Update(obj runtime.Storable) (bool, error) {
+	var updated bool
+	err := bs.update(func(ops *boltOps) error {
+		var err error
+		updated, err = ops.Update(obj)
+		return err
+	})
+
+	return updated, err
+}
+
+func (bs *boltStore) Delete(key string) error {
+	return bs.update(func(ops *boltOps) error {
+		return ops.Delete(key)
+	})
+}
+
+func (bs *boltStore) DeleteGen(key string, gen runtime.Generation) error {
+	return bs.update(func(ops *boltOps) error {
+		return ops.DeleteGen(key, gen)
+	})
+}
+
+// Batch runs a given function in a single BoltDB read-write transaction, which gets rolled back if function returns
+// error. BoltDB allows only one read-write transaction at a time, while read-only transactions see the data as it was
+// before the batch
+func (bs *boltStore) Batch(f func(ops store.Operations) error) error {
+	return bs.update(func(ops *boltOps) error {
+		return f(ops)
+	})
+}
+
+func (bs *boltStore) WithRegistry(registry *runtime.Registry) store.Generic {
+	return &boltStore{registry: registry, codec: yaml.NewCodec(registry), db: bs.db, notifier: bs.notifier, updateMutex: bs.updateMutex}
+}
+
+// Watch uses in-process notifications, so only changes made through this store are reported. Removal of a single
+// generation of versioned object isn't reported as it doesn't change the object
+func (bs *boltStore) Watch(prefix string) (<-chan store.WatchEvent, func()) {
+	return bs.notifier.Watch(prefix)
+}
+
+// update runs a given function in BoltDB read-write transaction and notifies watchers about the changes once the
+// transaction is committed
+func (bs *boltStore) update(f func(ops *boltOps) error) error {
+	bs.updateMutex.Lock()
+	var changes []store.Change
+	err := bs.db.Update(func(tx *bolt.Tx) error {
+		ops := bs.ops(tx)
+		err := f(ops)
+		changes = ops.changes
+		return err
+	})
+	if err == nil {
+		bs.notifier.Queue(changes)
+	}
+	bs.updateMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	bs.notifier.Deliver()
+
+	return nil
+}
+
+func (bs *boltStore) ops(tx *bolt.Tx) *boltOps {
+	return &boltOps{store: bs, tx: tx}
+}
+
+// boltOps implements operations on storable objects within a given BoltDB transaction
+type boltOps struct {
+	store *boltStore
+	tx    *bolt.Tx
+
+	// changes made within the transaction, which watchers get notified about once it's committed
+	changes []store.Change
+}
+
+func (ops *boltOps) bucket() (*bolt.Bucket, error) {
+	bucket := ops.tx.Bucket(objectsBucket)
+	if bucket == nil {
+		return nil, fmt.Errorf("bucket not found: %s", objectsBucket)
+	}
+	return bucket, nil
+}
+
+func (ops *boltOps) Get(key string) (runtime.Storable, error) {
+	bucket, err := ops.bucket()
+	if err != nil {
+		return nil, err
+	}
+
+	data := bucket.Get([]byte(key + boltSeparator + genStr(runtime.LastGen)))
+	if data == nil {
+		return nil, nil
+	}
+
+	obj, err := ops.store.codec.DecodeOne(data)
+	if err != nil {
+		return nil, err
+	}
+	storable, ok := obj.(runtime.Storable)
+	if !ok {
+		return nil, fmt.Errorf("storable object is expected to be decoded from bolt, but got: %s", obj.GetKind())
+	}
+
+	return storable, nil
+}
+
+func (ops *boltOps) GetGen(key string, gen runtime.Generation) (runtime.Versioned, error) {
+	bucket, err := ops.bucket()
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if gen == runtime.LastGen {
+		c := bucket.Cursor()
+		prefix := []byte(key + boltSeparator)
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			data = v
+		}
+	} else {
+		data = bucket.Get([]byte(key + boltSeparator + genStr(gen)))
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	obj, err := ops.store.codec.DecodeOne(data)
+	if err != nil {
+		return nil, err
+	}
+	versioned, ok := obj.(runtime.Versioned)
+	if !ok {
+		return nil, fmt.Errorf("versioned object is expected to be decoded from bolt, but got: %s", obj.GetKind())
+	}
+
+	return versioned, nil
+}
+
+func (ops *boltOps) List(prefix string) ([]runtime.Storable, error) {
+	bucket, err := ops.bucket()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]runtime.Storable, 0)
+	c := bucket.Cursor()
+	prefixBytes := []byte(prefix)
+	for k, v := c.Seek(prefixBytes); k != nil && bytes.HasPrefix(k, prefixBytes); k, v = c.Next() {
+		baseObj, err := ops.store.codec.DecodeOne(v)
+		if err != nil {
+			return nil, err
+		}
+		obj, ok := baseObj.(runtime.Storable)
+		if !ok {
+			return nil, fmt.Errorf("storable object is expected to be decoded from bolt, but got: %s", baseObj.GetKind())
+		}
+		result = append(result, obj)
+	}
+
+	return result, nil
+}
+
+func (ops *boltOps) ListGenerations(key string) ([]runtime.Storable, error) {
+	return ops.List(key + boltSeparator)
+}
+
+func (ops *boltOps) setNextGeneration(obj runtime.Versioned) error {
 	// todo replace this code by checking index that returns last generation
-	info := bs.registry.Get(obj.GetKind())
+	info := ops.store.registry.Get(obj.GetKind())
 	if !info.Versioned {
 		return fmt.Errorf("kind %s isn't versioned", obj.GetKind())
 	}
-	last, err := bs.GetGen(runtime.KeyForStorable(obj), runtime.LastGen)
+	last, err := ops.GetGen(runtime.KeyForStorable(obj), runtime.LastGen)
 	if err != nil {
 		return err
 	}
@@ -169,16 +301,16 @@ func (bs *boltStore) setNextGeneration(obj runtime.Versioned) error {
 	return nil
 }
 
-func (bs *boltStore) Save(obj runtime.Storable) (bool, error) {
-	return bs.save(obj, false)
+func (ops *boltOps) Save(obj runtime.Storable) (bool, error) {
+	return ops.save(obj, false)
 }
 
-func (bs *boltStore) Update(obj runtime.Storable) (bool, error) {
-	return bs.save(obj, true)
+func (ops *boltOps) Update(obj runtime.Storable) (bool, error) {
+	return ops.save(obj, true)
 }
 
-func (bs *boltStore) save(obj runtime.Storable, updateCurrent bool) (bool, error) {
-	info := bs.registry.Get(obj.GetKind())
+func (ops *boltOps) save(obj runtime.Storable, updateCurrent bool) (bool, error) {
+	info := ops.store.registry.Get(obj.GetKind())
 	if info == nil {
 		return false, fmt.Errorf("unknown kind: %s", obj.GetKind())
 	}
@@ -193,7 +325,7 @@ func (bs *boltStore) save(obj runtime.Storable, updateCurrent bool) (bool, error
 		}
 
 		// todo we should compare with latest in some cases
-		existingObj, err := bs.GetGen(key, versionedObj.GetGeneration())
+		existingObj, err := ops.GetGen(key, versionedObj.GetGeneration())
 		if err != nil {
 			return false, err
 		}
@@ -211,12 +343,12 @@ func (bs *boltStore) save(obj runtime.Storable, updateCurrent bool) (bool, error
 
 		if existingObj != nil {
 			versionedObj.SetGeneration(existingObj.GetGeneration())
-			equals, equalsErr := bs.equals(obj, existingObj)
+			equals, equalsErr := ops.store.equals(obj, existingObj)
 			if equalsErr != nil {
 				return false, equalsErr
 			}
 			if !updateCurrent && !equals {
-				errGen := bs.setNextGeneration(versionedObj)
+				errGen := ops.setNextGeneration(versionedObj)
 				if errGen != nil {
 					return false, fmt.Errorf("error while calling setNextGeneration(%s): %s", obj, errGen)
 				}
@@ -234,52 +366,78 @@ func (bs *boltStore) save(obj runtime.Storable, updateCurrent bool) (bool, error
 		boltPath += boltSeparator + genStr(runtime.LastGen)
 	}
 
-	err := bs.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(objectsBucket)
-		if bucket == nil {
-			return fmt.Errorf("bucket not found: %s", objectsBucket)
-		}
+	bucket, err := ops.bucket()
+	if err != nil {
+		return false, err
+	}
 
-		data, err := bs.codec.EncodeOne(obj)
-		if err != nil {
-			return err
-		}
+	data, err := ops.store.codec.EncodeOne(obj)
+	if err != nil {
+		return false, err
+	}
 
-		return bucket.Put([]byte(boltPath), data)
-	})
+	err = bucket.Put([]byte(boltPath), data)
+	if err != nil {
+		return false, err
+	}
+	ops.changes = append(ops.changes, store.Change{Key: key, Data: data})
 
-	return updated, err
+	return updated, nil
 }
 
-func (bs *boltStore) Delete(key string) error {
+func (ops *boltOps) Delete(key string) error {
 	// todo support deleting version objects, potentially we don't want to remove any object, just mark as deleted
 
-	return bs.db.Update(func(tx *bolt.Tx) error {
-		bucket := tx.Bucket(objectsBucket)
-		if bucket == nil {
-			return fmt.Errorf("bucket not found: %s", objectsBucket)
-		}
+	bucket, err := ops.bucket()
+	if err != nil {
+		return err
+	}
 
-		c := bucket.Cursor()
-		prefixBytes := []byte(key + boltSeparator)
-		for k, v := c.Seek(prefixBytes); k != nil && bytes.HasPrefix(k, prefixBytes); k, v = c.Next() {
-			baseObj, err := bs.codec.DecodeOne(v)
-			if err != nil {
-				return err
-			}
-			_, ok := baseObj.(runtime.Versioned)
-			if ok {
-				return fmt.Errorf("deleting versioned objects isn't implmeneted")
-			}
+	// keys are collected first, as bucket shouldn't be modified while iterating over it
+	keys := [][]byte{}
+	c := bucket.Cursor()
+	prefixBytes := []byte(key + boltSeparator)
+	for k, v := c.Seek(prefixBytes); k != nil && bytes.HasPrefix(k, prefixBytes); k, v = c.Next() {
+		baseObj, err := ops.store.codec.DecodeOne(v)
+		if err != nil {
+			return err
+		}
+		_, ok := baseObj.(runtime.Versioned)
+		if ok {
+			return fmt.Errorf("deleting versioned objects isn't implmeneted")
+		}
+		keys = append(keys, append([]byte{}, k...))
+	}
 
-			err = bucket.Delete(k)
-			if err != nil {
-				return fmt.Errorf("error while deleting object with key: %s", k)
-			}
+	for _, k := range keys {
+		err = bucket.Delete(k)
+		if err != nil {
+			return fmt.Errorf("error while deleting object with key: %s", k)
 		}
+	}
+	if len(keys) > 0 {
+		ops.changes = append(ops.changes, store.Change{Key: key})
+	}
 
-		return nil
-	})
+	return nil
+}
+
+func (ops *boltOps) DeleteGen(key string, gen runtime.Generation) error {
+	if gen == runtime.LastGen {
+		return fmt.Errorf("generation should be specified to delete generation of object with key: %s", key)
+	}
+
+	bucket, err := ops.bucket()
+	if err != nil {
+		return err
+	}
+
+	err = bucket.Delete([]byte(key + boltSeparator + genStr(gen)))
+	if err != nil {
+		return fmt.Errorf("error while deleting generation %s of object with key: %s", gen, key)
+	}
+
+	return nil
 }
 
 func (bs *boltStore) equals(o1 runtime.Object, o2 runtime.Object) (bool, error) {
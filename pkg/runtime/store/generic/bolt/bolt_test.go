@@ -0,0 +1,32 @@
+package bolt
+
+import (
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/generic/conformance"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestBoltStoreConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aptomi-bolt-test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	count := 0
+	conformance.RunTests(t, func(t *testing.T, registry *runtime.Registry) store.Generic {
+		count++
+		s := NewGenericStore(registry)
+		err := s.Open(config.DB{Connection: Scheme + filepath.Join(dir, "db"+strconv.Itoa(count)+".bolt")})
+		if err != nil {
+			t.Fatalf("Unable to open BoltDB store: %s", err)
+		}
+		return s
+	})
+}
@@ -0,0 +1,761 @@
+// Package conformance provides a test suite, which every implementation of store.Generic has to pass in order to be
+// used as an object store. It checks that generations, versioning and equality semantics of the store are the same as
+// the ones of BoltDB store, that batches are atomic, that watchers get notified about changes, as well as that the
+// store could be safely accessed concurrently
+package conformance
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+)
+
+// StoreFactory creates a new empty store for a given registry and opens it. Every test gets its own store, which
+// gets closed once the test is over
+type StoreFactory func(t *testing.T, registry *runtime.Registry) store.Generic
+
+// VersionedObject is a versioned and deletable object used by the conformance tests
+var VersionedObject = &runtime.Info{
+	Kind:        "conformance-versioned",
+	Storable:    true,
+	Versioned:   true,
+	Deletable:   true,
+	Constructor: func() runtime.Object { return &testVersioned{} },
+}
+
+// PlainObject is a non-versioned object used by the conformance tests
+var PlainObject = &runtime.Info{
+	Kind:        "conformance-plain",
+	Storable:    true,
+	Constructor: func() runtime.Object { return &testPlain{} },
+}
+
+// Objects is the list of informational data for all objects used by the conformance tests
+var Objects = []*runtime.Info{
+	VersionedObject,
+	PlainObject,
+}
+
+type testMetadata struct {
+	Namespace  string
+	Name       string
+	Generation runtime.Generation
+	Deleted    bool
+}
+
+type testVersioned struct {
+	runtime.TypeKind `yaml:",inline"`
+	Metadata         testMetadata
+	Data             string
+}
+
+func (obj *testVersioned) GetName() string {
+	return obj.Metadata.Name
+}
+
+func (obj *testVersioned) GetNamespace() string {
+	return obj.Metadata.Namespace
+}
+
+func (obj *testVersioned) GetGeneration() runtime.Generation {
+	return obj.Metadata.Generation
+}
+
+func (obj *testVersioned) SetGeneration(gen runtime.Generation) {
+	obj.Metadata.Generation = gen
+}
+
+func (obj *testVersioned) IsDeleted() bool {
+	return obj.Metadata.Deleted
+}
+
+func (obj *testVersioned) SetDeleted(deleted bool) {
+	obj.Metadata.Deleted = deleted
+}
+
+type testPlain struct {
+	runtime.TypeKind `yaml:",inline"`
+	Metadata         testMetadata
+	Data             string
+}
+
+func (obj *testPlain) GetName() string {
+	return obj.Metadata.Name
+}
+
+func (obj *testPlain) GetNamespace() string {
+	return obj.Metadata.Namespace
+}
+
+// testPlainNext is the next version of testPlain Go type, which is used to check stores with a different registry
+type testPlainNext struct {
+	runtime.TypeKind `yaml:",inline"`
+	Metadata         testMetadata
+	Data             string
+	Extra            string
+}
+
+func (obj *testPlainNext) GetName() string {
+	return obj.Metadata.Name
+}
+
+func (obj *testPlainNext) GetNamespace() string {
+	return obj.Metadata.Namespace
+}
+
+func newVersioned(name string, data string) *testVersioned {
+	return &testVersioned{
+		TypeKind: VersionedObject.GetTypeKind(),
+		Metadata: testMetadata{Namespace: runtime.SystemNS, Name: name},
+		Data:     data,
+	}
+}
+
+func newPlain(name string, data string) *testPlain {
+	return &testPlain{
+		TypeKind: PlainObject.GetTypeKind(),
+		Metadata: testMetadata{Namespace: runtime.SystemNS, Name: name},
+		Data:     data,
+	}
+}
+
+// RunTests runs the whole conformance test suite against stores created by a given factory
+func RunTests(t *testing.T, factory StoreFactory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s store.Generic)
+	}{
+		{"SavePlain", testSavePlain},
+		{"SaveVersioned", testSaveVersioned},
+		{"UpdateVersioned", testUpdateVersioned},
+		{"GetGen", testGetGen},
+		{"List", testList},
+		{"ListGenerations", testListGenerations},
+		{"Deleted", testDeleted},
+		{"Delete", testDelete},
+		{"DeleteGen", testDeleteGen},
+		{"ConcurrentAccess", testConcurrentAccess},
+		{"ConcurrentSaveSameObject", testConcurrentSaveSameObject},
+		{"Batch", testBatch},
+		{"BatchRollback", testBatchRollback},
+		{"BatchIsolation", testBatchIsolation},
+		{"Watch", testWatch},
+		{"WithRegistry", testWithRegistry},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := factory(t, runtime.NewRegistry().Append(Objects...))
+			defer func() {
+				assert.NoError(t, s.Close(), "Store should be closed without errs")
+			}()
+			tt.test(t, s)
+		})
+	}
+}
+
+func testSavePlain(t *testing.T, s store.Generic) {
+	obj := newPlain("plain", "one")
+	key := runtime.KeyForStorable(obj)
+
+	result, err := s.Get(key)
+	assert.NoError(t, err, "Get should succeed for non-existing object")
+	assert.Nil(t, result, "Non-existing object should not be found")
+
+	updated, err := s.Save(obj)
+	assert.NoError(t, err, "Non-versioned object should be saved")
+	assert.False(t, updated, "Non-versioned object should never be reported as updated")
+
+	obj.Data = "two"
+	_, err = s.Save(obj)
+	assert.NoError(t, err, "Non-versioned object should be overwritten")
+
+	result, err = s.Get(key)
+	assert.NoError(t, err, "Non-versioned object should be loaded")
+	assert.Equal(t, "two", result.(*testPlain).Data, "Latest data of non-versioned object should be loaded")
+
+	generations, err := s.ListGenerations(key)
+	assert.NoError(t, err, "Generations should be listed")
+	assert.Len(t, generations, 1, "Non-versioned object should have a single generation")
+}
+
+func testSaveVersioned(t *testing.T, s store.Generic) {
+	obj := newVersioned("versioned", "one")
+	key := runtime.KeyForStorable(obj)
+
+	updated, err := s.Save(obj)
+	assert.NoError(t, err, "New versioned object should be saved")
+	assert.True(t, updated, "New versioned object should be reported as updated")
+	assert.Equal(t, runtime.FirstGen, obj.GetGeneration(), "New versioned object should get the first generation")
+
+	// saving the same object again doesn't create a new generation
+	same := newVersioned("versioned", "one")
+	updated, err = s.Save(same)
+	assert.NoError(t, err, "Unchanged versioned object should be saved")
+	assert.False(t, updated, "Unchanged versioned object should not be reported as updated")
+	assert.Equal(t, runtime.FirstGen, same.GetGeneration(), "Unchanged versioned object should keep its generation")
+
+	// saving changed object creates a new generation
+	changed := newVersioned("versioned", "two")
+	updated, err = s.Save(changed)
+	assert.NoError(t, err, "Changed versioned object should be saved")
+	assert.True(t, updated, "Changed versioned object should be reported as updated")
+	assert.Equal(t, runtime.Generation(2), changed.GetGeneration(), "Changed versioned object should get the next generation")
+
+	// saving changed object based on an old generation creates a new generation as well
+	old := newVersioned("versioned", "three")
+	old.SetGeneration(runtime.FirstGen)
+	updated, err = s.Save(old)
+	assert.NoError(t, err, "Changed versioned object based on the old generation should be saved")
+	assert.True(t, updated, "Changed versioned object based on the old generation should be reported as updated")
+	assert.Equal(t, runtime.Generation(3), old.GetGeneration(), "Changed versioned object based on the old generation should get the next generation")
+
+	last, err := s.GetGen(key, runtime.LastGen)
+	assert.NoError(t, err, "Last generation should be loaded")
+	assert.Equal(t, "three", last.(*testVersioned).Data, "Last generation should have the latest data")
+}
+
+func testUpdateVersioned(t *testing.T, s store.Generic) {
+	obj := newVersioned("versioned", "one")
+	key := runtime.KeyForStorable(obj)
+	_, err := s.Save(obj)
+	assert.NoError(t, err, "New versioned object should be saved")
+
+	obj.Data = "two"
+	updated, err := s.Update(obj)
+	assert.NoError(t, err, "Versioned object should be updated")
+	assert.False(t, updated, "Update should not create a new generation")
+	assert.Equal(t, runtime.FirstGen, obj.GetGeneration(), "Update should keep generation")
+
+	generations, err := s.ListGenerations(key)
+	assert.NoError(t, err, "Generations should be listed")
+	assert.Len(t, generations, 1, "Update should not create a new generation")
+
+	result, err := s.GetGen(key, runtime.FirstGen)
+	assert.NoError(t, err, "Updated generation should be loaded")
+	assert.Equal(t, "two", result.(*testVersioned).Data, "Updated generation should have the new data")
+}
+
+func testGetGen(t *testing.T, s store.Generic) {
+	obj := newVersioned("versioned", "")
+	key := runtime.KeyForStorable(obj)
+
+	result, err := s.GetGen(key, runtime.LastGen)
+	assert.NoError(t, err, "GetGen should succeed for non-existing object")
+	assert.Nil(t, result, "Non-existing object should not be found")
+
+	// there should be more than 10 generations to make sure they are ordered as numbers, not as strings
+	for i := 1; i <= 12; i++ {
+		_, err = s.Save(newVersioned("versioned", fmt.Sprintf("data-%d", i)))
+		assert.NoError(t, err, "Versioned object should be saved")
+	}
+
+	for _, gen := range []runtime.Generation{1, 2, 10, 12} {
+		result, err = s.GetGen(key, gen)
+		assert.NoError(t, err, "Generation %s should be loaded", gen)
+		if assert.NotNil(t, result, "Generation %s should be found", gen) {
+			assert.Equal(t, gen, result.GetGeneration(), "Generation %s should be loaded", gen)
+			assert.Equal(t, fmt.Sprintf("data-%d", gen), result.(*testVersioned).Data, "Generation %s should have its own data", gen)
+		}
+	}
+
+	result, err = s.GetGen(key, runtime.LastGen)
+	assert.NoError(t, err, "Last generation should be loaded")
+	if assert.NotNil(t, result, "Last generation should be found") {
+		assert.Equal(t, runtime.Generation(12), result.GetGeneration(), "Last generation should be the latest one")
+	}
+
+	result, err = s.GetGen(key, 13)
+	assert.NoError(t, err, "GetGen should succeed for non-existing generation")
+	assert.Nil(t, result, "Non-existing generation should not be found")
+}
+
+func testList(t *testing.T, s store.Generic) {
+	for _, name := range []string{"a", "b", "c"} {
+		_, err := s.Save(newPlain(name, name))
+		assert.NoError(t, err, "Non-versioned object should be saved")
+	}
+	_, err := s.Save(newVersioned("a", "a"))
+	assert.NoError(t, err, "Versioned object should be saved")
+
+	result, err := s.List(runtime.KeyFromParts(runtime.SystemNS, PlainObject.Kind, ""))
+	assert.NoError(t, err, "Objects should be listed by prefix")
+	names := []string{}
+	for _, obj := range result {
+		names = append(names, obj.GetName())
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, names, "Only objects matching prefix should be listed in the order of keys")
+
+	result, err = s.List("unknown")
+	assert.NoError(t, err, "Objects should be listed by unknown prefix")
+	assert.NotNil(t, result, "List should return an empty list for unknown prefix")
+	assert.Empty(t, result, "Nothing should be listed for unknown prefix")
+}
+
+func testListGenerations(t *testing.T, s store.Generic) {
+	for i := 1; i <= 3; i++ {
+		_, err := s.Save(newVersioned("versioned", fmt.Sprintf("data-%d", i)))
+		assert.NoError(t, err, "Versioned object should be saved")
+	}
+
+	// object with a key sharing the same prefix shouldn't be listed
+	_, err := s.Save(newVersioned("versioned-other", "other"))
+	assert.NoError(t, err, "Versioned object should be saved")
+
+	result, err := s.ListGenerations(runtime.KeyForStorable(newVersioned("versioned", "")))
+	assert.NoError(t, err, "Generations should be listed")
+	if assert.Len(t, result, 3, "All generations should be listed") {
+		for i, obj := range result {
+			assert.Equal(t, runtime.Generation(i+1), obj.(runtime.Versioned).GetGeneration(), "Generations should be listed in order")
+		}
+	}
+}
+
+func testDeleted(t *testing.T, s store.Generic) {
+	obj := newVersioned("versioned", "one")
+	obj.SetDeleted(true)
+	_, err := s.Save(obj)
+	assert.Error(t, err, "Non-existing object should not be saved as deleted")
+
+	obj = newVersioned("versioned", "one")
+	_, err = s.Save(obj)
+	assert.NoError(t, err, "Versioned object should be saved")
+
+	obj = newVersioned("versioned", "one")
+	obj.SetDeleted(true)
+	updated, err := s.Save(obj)
+	assert.NoError(t, err, "Existing object should be saved as deleted")
+	assert.True(t, updated, "Object marked as deleted should be reported as updated")
+	assert.Equal(t, runtime.Generation(2), obj.GetGeneration(), "Object marked as deleted should get the next generation")
+
+	// object could be created again with the same content
+	obj = newVersioned("versioned", "one")
+	updated, err = s.Save(obj)
+	assert.NoError(t, err, "Deleted object should be created again")
+	assert.True(t, updated, "Deleted object created again should be reported as updated")
+	assert.Equal(t, runtime.Generation(3), obj.GetGeneration(), "Deleted object created again should get the next generation")
+}
+
+func testDelete(t *testing.T, s store.Generic) {
+	obj := newPlain("plain", "one")
+	key := runtime.KeyForStorable(obj)
+	_, err := s.Save(obj)
+	assert.NoError(t, err, "Non-versioned object should be saved")
+
+	assert.NoError(t, s.Delete(key), "Non-versioned object should be deleted")
+	result, err := s.Get(key)
+	assert.NoError(t, err, "Get should succeed for deleted object")
+	assert.Nil(t, result, "Deleted object should not be found")
+
+	assert.NoError(t, s.Delete(key), "Deleting non-existing object should succeed")
+
+	versioned := newVersioned("versioned", "one")
+	_, err = s.Save(versioned)
+	assert.NoError(t, err, "Versioned object should be saved")
+	assert.Error(t, s.Delete(runtime.KeyForStorable(versioned)), "Versioned object should not be deleted")
+
+	generations, err := s.ListGenerations(runtime.KeyForStorable(versioned))
+	assert.NoError(t, err, "Generations should be listed")
+	assert.Len(t, generations, 1, "Versioned object should be kept")
+}
+
+func testDeleteGen(t *testing.T, s store.Generic) {
+	for i := 1; i <= 3; i++ {
+		_, err := s.Save(newVersioned("versioned", fmt.Sprintf("data-%d", i)))
+		assert.NoError(t, err, "Versioned object should be saved")
+	}
+	key := runtime.KeyForStorable(newVersioned("versioned", ""))
+
+	assert.NoError(t, s.DeleteGen(key, 2), "Generation should be deleted")
+	assert.NoError(t, s.DeleteGen(key, 5), "Deleting non-existing generation should succeed")
+	assert.Error(t, s.DeleteGen(key, runtime.LastGen), "Generation should be specified explicitly")
+
+	result, err := s.GetGen(key, 2)
+	assert.NoError(t, err, "GetGen should succeed for deleted generation")
+	assert.Nil(t, result, "Deleted generation should not be found")
+
+	generations, err := s.ListGenerations(key)
+	assert.NoError(t, err, "Generations should be listed")
+	if assert.Len(t, generations, 2, "Only deleted generation should be removed") {
+		assert.Equal(t, runtime.Generation(1), generations[0].(runtime.Versioned).GetGeneration(), "First generation should be kept")
+		assert.Equal(t, runtime.Generation(3), generations[1].(runtime.Versioned).GetGeneration(), "Last generation should be kept")
+	}
+
+	// generations keep counting from the last one
+	obj := newVersioned("versioned", "data-4")
+	_, err = s.Save(obj)
+	assert.NoError(t, err, "Versioned object should be saved")
+	assert.Equal(t, runtime.Generation(4), obj.GetGeneration(), "New generation should follow the last one")
+}
+
+func testConcurrentAccess(t *testing.T, s store.Generic) {
+	workers := 8
+	generations := 5
+
+	// every worker saves its own objects, while listing all objects at the same time
+	errs := make(chan error, workers*generations*4)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			name := fmt.Sprintf("worker-%d", w)
+			for i := 1; i <= generations; i++ {
+				data := fmt.Sprintf("data-%d", i)
+				if _, err := s.Save(newVersioned(name, data)); err != nil {
+					errs <- err
+				}
+				if _, err := s.Save(newPlain(name, data)); err != nil {
+					errs <- err
+				}
+				if _, err := s.List(runtime.KeyFromParts(runtime.SystemNS, VersionedObject.Kind, "")); err != nil {
+					errs <- err
+				}
+				if _, err := s.GetGen(runtime.KeyForStorable(newVersioned(name, "")), runtime.LastGen); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err, "Store should be accessed concurrently without errs")
+	}
+
+	for w := 0; w < workers; w++ {
+		name := fmt.Sprintf("worker-%d", w)
+		result, err := s.ListGenerations(runtime.KeyForStorable(newVersioned(name, "")))
+		assert.NoError(t, err, "Generations should be listed")
+		assert.Len(t, result, generations, "All generations of %s should be saved", name)
+
+		obj, err := s.Get(runtime.KeyForStorable(newPlain(name, "")))
+		assert.NoError(t, err, "Non-versioned object should be loaded")
+		if assert.NotNil(t, obj, "Non-versioned object %s should be found", name) {
+			assert.Equal(t, fmt.Sprintf("data-%d", generations), obj.(*testPlain).Data, "Latest data of %s should be saved", name)
+		}
+	}
+}
+
+func testConcurrentSaveSameObject(t *testing.T, s store.Generic) {
+	workers := 8
+
+	errs := make(chan error, workers)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			if _, err := s.Save(newVersioned("versioned", fmt.Sprintf("worker-%d", w))); err != nil {
+				errs <- err
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err, "Same object should be saved concurrently without errs")
+	}
+
+	// store may either serialize saves or let the last one win, but generations should always be consecutive
+	result, err := s.ListGenerations(runtime.KeyForStorable(newVersioned("versioned", "")))
+	assert.NoError(t, err, "Generations should be listed")
+	assert.NotEmpty(t, result, "At least one generation should be saved")
+	for i, obj := range result {
+		assert.Equal(t, runtime.Generation(i+1), obj.(runtime.Versioned).GetGeneration(), "Generations should be consecutive")
+	}
+}
+
+func testBatch(t *testing.T, s store.Generic) {
+	_, err := s.Save(newPlain("removed", "one"))
+	assert.NoError(t, err, "Non-versioned object should be saved")
+
+	versioned := newVersioned("versioned", "one")
+	err = s.Batch(func(ops store.Operations) error {
+		if _, saveErr := ops.Save(newPlain("plain", "one")); saveErr != nil {
+			return saveErr
+		}
+		if _, saveErr := ops.Save(versioned); saveErr != nil {
+			return saveErr
+		}
+		versioned.Data = "two"
+		if _, saveErr := ops.Save(versioned); saveErr != nil {
+			return saveErr
+		}
+		if deleteErr := ops.Delete(runtime.KeyForStorable(newPlain("removed", ""))); deleteErr != nil {
+			return deleteErr
+		}
+
+		// changes are visible within the batch
+		obj, getErr := ops.Get(runtime.KeyForStorable(newPlain("plain", "")))
+		assert.NoError(t, getErr, "Object saved in batch should be loaded in batch")
+		assert.NotNil(t, obj, "Object saved in batch should be found in batch")
+		last, getErr := ops.GetGen(runtime.KeyForStorable(versioned), runtime.LastGen)
+		assert.NoError(t, getErr, "Object saved in batch should be loaded in batch")
+		if assert.NotNil(t, last, "Object saved in batch should be found in batch") {
+			assert.Equal(t, runtime.Generation(2), last.GetGeneration(), "Last generation saved in batch should be found in batch")
+		}
+		plain, listErr := ops.List(runtime.KeyFromParts(runtime.SystemNS, PlainObject.Kind, ""))
+		assert.NoError(t, listErr, "Objects should be listed in batch")
+		assert.Len(t, plain, 1, "Objects saved and deleted in batch should be listed in batch accordingly")
+
+		return nil
+	})
+	assert.NoError(t, err, "Batch should be written")
+	assert.Equal(t, runtime.Generation(2), versioned.GetGeneration(), "Generations should be assigned in batch")
+
+	obj, err := s.Get(runtime.KeyForStorable(newPlain("plain", "")))
+	assert.NoError(t, err, "Object saved in batch should be loaded")
+	assert.NotNil(t, obj, "Object saved in batch should be found")
+	obj, err = s.Get(runtime.KeyForStorable(newPlain("removed", "")))
+	assert.NoError(t, err, "Object deleted in batch should be requested without errs")
+	assert.Nil(t, obj, "Object deleted in batch should not be found")
+	generations, err := s.ListGenerations(runtime.KeyForStorable(versioned))
+	assert.NoError(t, err, "Generations should be listed")
+	assert.Len(t, generations, 2, "All generations saved in batch should be found")
+}
+
+func testBatchRollback(t *testing.T, s store.Generic) {
+	kept := newPlain("kept", "one")
+	_, err := s.Save(kept)
+	assert.NoError(t, err, "Non-versioned object should be saved")
+	versioned := newVersioned("versioned", "one")
+	_, err = s.Save(versioned)
+	assert.NoError(t, err, "Versioned object should be saved")
+
+	// batch fails either because of the error in the batch function itself or because of the failed operation
+	failures := map[string]func(ops store.Operations) error{
+		"function error": func(ops store.Operations) error {
+			return fmt.Errorf("injected failure")
+		},
+		"operation error": func(ops store.Operations) error {
+			_, saveErr := ops.Save(&testVersioned{
+				TypeKind: VersionedObject.GetTypeKind(),
+				Metadata: testMetadata{Namespace: runtime.SystemNS, Name: "non-existing", Deleted: true},
+			})
+			return saveErr
+		},
+	}
+	for name, fail := range failures {
+		err = s.Batch(func(ops store.Operations) error {
+			if _, saveErr := ops.Save(newPlain("plain", "one")); saveErr != nil {
+				return saveErr
+			}
+			if _, saveErr := ops.Save(newVersioned("versioned", "two")); saveErr != nil {
+				return saveErr
+			}
+			if deleteErr := ops.Delete(runtime.KeyForStorable(kept)); deleteErr != nil {
+				return deleteErr
+			}
+			if deleteErr := ops.DeleteGen(runtime.KeyForStorable(versioned), runtime.FirstGen); deleteErr != nil {
+				return deleteErr
+			}
+			return fail(ops)
+		})
+		assert.Error(t, err, "Batch should fail (%s)", name)
+
+		obj, getErr := s.Get(runtime.KeyForStorable(newPlain("plain", "")))
+		assert.NoError(t, getErr, "Get should succeed after failed batch (%s)", name)
+		assert.Nil(t, obj, "Object saved in failed batch should not be found (%s)", name)
+		obj, getErr = s.Get(runtime.KeyForStorable(kept))
+		assert.NoError(t, getErr, "Get should succeed after failed batch (%s)", name)
+		assert.NotNil(t, obj, "Object deleted in failed batch should be kept (%s)", name)
+		generations, listErr := s.ListGenerations(runtime.KeyForStorable(versioned))
+		assert.NoError(t, listErr, "Generations should be listed after failed batch (%s)", name)
+		if assert.Len(t, generations, 1, "Generations should not be changed by failed batch (%s)", name) {
+			assert.Equal(t, "one", generations[0].(*testVersioned).Data, "Generations should not be changed by failed batch (%s)", name)
+		}
+	}
+}
+
+func testBatchIsolation(t *testing.T, s store.Generic) {
+	batches := 10
+	objects := 5
+	prefix := runtime.KeyFromParts(runtime.SystemNS, PlainObject.Kind, "")
+
+	// readers should see either all objects saved by the batch or none of them
+	done := make(chan bool)
+	errs := make(chan error, 1)
+	wg := &sync.WaitGroup{}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				result, err := s.List(prefix)
+				if err == nil && len(result) != 0 && len(result) != objects {
+					err = fmt.Errorf("%d out of %d objects saved by batch are visible", len(result), objects)
+				}
+				for _, obj := range result {
+					if err == nil && obj.(*testPlain).Data != result[0].(*testPlain).Data {
+						err = fmt.Errorf("objects saved by different batches are visible at the same time")
+					}
+				}
+				if err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	for b := 0; b < batches; b++ {
+		err := s.Batch(func(ops store.Operations) error {
+			for i := 0; i < objects; i++ {
+				if _, saveErr := ops.Save(newPlain(fmt.Sprintf("plain-%d", i), fmt.Sprintf("batch-%d", b))); saveErr != nil {
+					return saveErr
+				}
+			}
+			return nil
+		})
+		assert.NoError(t, err, "Batch should be written")
+	}
+	close(done)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err, "Partial writes of batch should not be visible")
+	}
+}
+
+func testWatch(t *testing.T, s store.Generic) {
+	// watching all versioned objects and a single plain object
+	versionedEvents, stopVersioned := s.Watch(runtime.KeyFromParts(runtime.SystemNS, VersionedObject.Kind, ""))
+	plainEvents, stopPlain := s.Watch(runtime.KeyForStorable(newPlain("watched", "")))
+
+	versioned := newVersioned("versioned", "one")
+	_, err := s.Save(versioned)
+	assert.NoError(t, err, "Versioned object should be saved")
+	versioned.Data = "two"
+	_, err = s.Save(versioned)
+	assert.NoError(t, err, "Versioned object should be saved")
+	versioned.Data = "three"
+	_, err = s.Update(versioned)
+	assert.NoError(t, err, "Versioned object should be updated")
+	assert.NoError(t, s.DeleteGen(runtime.KeyForStorable(versioned), runtime.FirstGen), "Generation should be deleted")
+
+	_, err = s.Save(newPlain("other", "one"))
+	assert.NoError(t, err, "Non-versioned object should be saved")
+	_, err = s.Save(newPlain("watched", "one"))
+	assert.NoError(t, err, "Non-versioned object should be saved")
+	assert.NoError(t, s.Delete(runtime.KeyForStorable(newPlain("watched", ""))), "Non-versioned object should be deleted")
+
+	// failed batch isn't reported, successful batch is reported once it's written
+	err = s.Batch(func(ops store.Operations) error {
+		if _, saveErr := ops.Save(newPlain("watched", "failed")); saveErr != nil {
+			return saveErr
+		}
+		return fmt.Errorf("injected failure")
+	})
+	assert.Error(t, err, "Batch should fail")
+	err = s.Batch(func(ops store.Operations) error {
+		if _, saveErr := ops.Save(newVersioned("batched", "one")); saveErr != nil {
+			return saveErr
+		}
+		_, saveErr := ops.Save(newPlain("watched", "batched"))
+		return saveErr
+	})
+	assert.NoError(t, err, "Batch should be written")
+
+	expected := []struct {
+		name string
+		gen  runtime.Generation
+		data string
+	}{
+		{"versioned", 1, "one"},
+		{"versioned", 2, "two"},
+		{"versioned", 2, "three"},
+		{"batched", 1, "one"},
+	}
+	for _, exp := range expected {
+		event, ok := receiveEvent(t, versionedEvents)
+		if !ok {
+			return
+		}
+		obj, isVersioned := event.Object.(*testVersioned)
+		if assert.True(t, isVersioned, "Versioned object should be reported") {
+			assert.Equal(t, runtime.KeyForStorable(newVersioned(exp.name, "")), event.Key, "Key of changed object should be reported")
+			assert.Equal(t, exp.gen, obj.GetGeneration(), "Generation of changed object should be reported")
+			assert.Equal(t, exp.data, obj.Data, "Changed object should be reported")
+		}
+	}
+
+	for _, data := range []string{"one", "", "batched"} {
+		event, ok := receiveEvent(t, plainEvents)
+		if !ok {
+			return
+		}
+		assert.Equal(t, runtime.KeyForStorable(newPlain("watched", "")), event.Key, "Key of changed object should be reported")
+		if len(data) <= 0 {
+			assert.Nil(t, event.Object, "Deleted object should be reported without object")
+		} else if assert.NotNil(t, event.Object, "Saved object should be reported") {
+			assert.Equal(t, data, event.Object.(*testPlain).Data, "Changed object should be reported")
+		}
+	}
+
+	// no more events are reported and channels get closed once watch is stopped
+	stopVersioned()
+	stopPlain()
+	for _, events := range []<-chan store.WatchEvent{versionedEvents, plainEvents} {
+		event, ok := receiveEvent(t, events)
+		assert.False(t, ok, "No more events should be reported, but got: %v", event)
+	}
+}
+
+// receiveEvent returns the next watch event or false if channel gets closed
+func receiveEvent(t *testing.T, events <-chan store.WatchEvent) (store.WatchEvent, bool) {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		return event, ok
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout while waiting for watch event")
+	}
+	return store.WatchEvent{}, false
+}
+
+func testWithRegistry(t *testing.T, s store.Generic) {
+	registry := runtime.NewRegistry().Append(VersionedObject, &runtime.Info{
+		Kind:        PlainObject.Kind,
+		Storable:    true,
+		Constructor: func() runtime.Object { return &testPlainNext{} },
+	})
+	next := s.WithRegistry(registry)
+
+	obj := newPlain("plain", "one")
+	key := runtime.KeyForStorable(obj)
+	_, err := s.Save(obj)
+	assert.NoError(t, err, "Object should be saved")
+
+	result, err := next.Get(key)
+	assert.NoError(t, err, "Object saved through the original store should be loaded")
+	if assert.IsType(t, &testPlainNext{}, result, "Object should be decoded using the given registry") {
+		assert.Equal(t, "one", result.(*testPlainNext).Data, "Object data should be decoded")
+	}
+
+	err = next.Batch(func(ops store.Operations) error {
+		_, errSave := ops.Save(&testPlainNext{TypeKind: PlainObject.GetTypeKind(), Metadata: obj.Metadata, Data: "two", Extra: "extra"})
+		return errSave
+	})
+	assert.NoError(t, err, "Batch should succeed")
+
+	result, err = s.Get(key)
+	assert.NoError(t, err, "Object saved through the store with the given registry should be loaded")
+	if assert.IsType(t, &testPlain{}, result, "Object should be decoded using the original registry") {
+		assert.Equal(t, "two", result.(*testPlain).Data, "Object data should be shared between stores")
+	}
+}
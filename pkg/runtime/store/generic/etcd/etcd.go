@@ -0,0 +1,691 @@
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/codec/yaml"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	log "github.com/Sirupsen/logrus"
+	"github.com/coreos/etcd/clientv3"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Scheme is a scheme of the connection string for etcd store. Connection string has the following format:
+// etcd://host1:2379,host2:2379/prefix, where prefix is optional and defaults to "aptomi". Endpoints are accessed over
+// http, unless TLS is enabled in DB config
+const Scheme = "etcd://"
+
+const (
+	defaultPrefix  = "aptomi"
+	dialTimeout    = 5 * time.Second
+	requestTimeout = 5 * time.Second
+
+	// number of attempts to commit a batch, when objects read or written by it are concurrently changed by someone else
+	commitAttempts = 10
+)
+
+// NewGenericStore creates a new object store based on etcd v3
+func NewGenericStore(registry *runtime.Registry) store.Generic {
+	codec := yaml.NewCodec(registry)
+	return &etcdStore{registry: registry, codec: codec}
+}
+
+type etcdStore struct {
+	registry *runtime.Registry
+	codec    runtime.Codec
+	client   *clientv3.Client
+	prefix   string
+}
+
+func (es *etcdStore) Open(cfg config.DB) error {
+	endpoints, prefix, err := parseConnection(cfg.Connection, cfg.TLS.Enabled)
+	if err != nil {
+		return err
+	}
+
+	var tlsConfig *tls.Config
+	if cfg.TLS.Enabled {
+		tlsConfig, err = newTLSConfig(cfg.TLS)
+		if err != nil {
+			return err
+		}
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: dialTimeout,
+		TLS:         tlsConfig,
+	})
+	if err != nil {
+		return fmt.Errorf("error while connecting to etcd: %s error: %s", cfg.Connection, err)
+	}
+	es.client = client
+	es.prefix = "/" + prefix + "/objects/"
+
+	return nil
+}
+
+// parseConnection returns list of etcd endpoints and key prefix from the connection string
+func parseConnection(connection string, secure bool) ([]string, string, error) {
+	if !strings.HasPrefix(connection, Scheme) {
+		return nil, "", fmt.Errorf("etcd connection string should start with %s: %s", Scheme, connection)
+	}
+
+	hosts := strings.TrimPrefix(connection, Scheme)
+	prefix := defaultPrefix
+	if idx := strings.Index(hosts, "/"); idx >= 0 {
+		if path := strings.Trim(hosts[idx:], "/"); len(path) > 0 {
+			prefix = path
+		}
+		hosts = hosts[:idx]
+	}
+
+	scheme := "http://"
+	if secure {
+		scheme = "https://"
+	}
+	endpoints := []string{}
+	for _, host := range strings.Split(hosts, ",") {
+		if len(host) > 0 {
+			endpoints = append(endpoints, scheme+host)
+		}
+	}
+	if len(endpoints) <= 0 {
+		return nil, "", fmt.Errorf("no etcd endpoints specified in connection string: %s", connection)
+	}
+
+	return endpoints, prefix, nil
+}
+
+// newTLSConfig creates TLS config for connecting to etcd, which verifies etcd servers using given CA certificate and
+// authenticates using given client certificate, if they are specified
+func newTLSConfig(cfg config.DBTLS) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if len(cfg.CAFile) > 0 {
+		data, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading etcd CA certificate: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in etcd CA certificate file: %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(cfg.CertFile) > 0 || len(cfg.KeyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error while loading etcd client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func (es *etcdStore) Close() error {
+	err := es.client.Close()
+	if err != nil {
+		return fmt.Errorf("error while closing etcd client: %s", err)
+	}
+
+	return err
+}
+
+const etcdSeparator = "@"
+
+func (es *etcdStore) Get(key string) (runtime.Storable, error) {
+	return es.newBatch().Get(key)
+}
+
+func (es *etcdStore) GetGen(key string, gen runtime.Generation) (runtime.Versioned, error) {
+	return es.newBatch().GetGen(key, gen)
+}
+
+func (es *etcdStore) List(prefix string) ([]runtime.Storable, error) {
+	return es.newBatch().List(prefix)
+}
+
+func (es *etcdStore) ListGenerations(key string) ([]runtime.Storable, error) {
+	return es.List(key + etcdSeparator)
+}
+
+func (es *etcdStore) Save(obj runtime.Storable) (bool, error) {
+	return es.save(obj, false)
+}
+
+func (es *etcdStore) Update(obj runtime.Storable) (bool, error) {
+	return es.save(obj, true)
+}
+
+func (es *etcdStore) save(obj runtime.Storable, updateCurrent bool) (bool, error) {
+	// new generation is written only if nobody else has written it in the meantime, otherwise it gets re-calculated
+	versionedObj, versioned := obj.(runtime.Versioned)
+	var gen runtime.Generation
+	if versioned {
+		gen = versionedObj.GetGeneration()
+	}
+
+	var updated bool
+	err := es.Batch(func(ops store.Operations) error {
+		if versioned {
+			versionedObj.SetGeneration(gen)
+		}
+
+		var errSave error
+		if updateCurrent {
+			updated, errSave = ops.Update(obj)
+		} else {
+			updated, errSave = ops.Save(obj)
+		}
+		return errSave
+	})
+
+	return updated, err
+}
+
+func (es *etcdStore) Delete(key string) error {
+	return es.Batch(func(ops store.Operations) error {
+		return ops.Delete(key)
+	})
+}
+
+func (es *etcdStore) DeleteGen(key string, gen runtime.Generation) error {
+	return es.Batch(func(ops store.Operations) error {
+		return ops.DeleteGen(key, gen)
+	})
+}
+
+// Batch runs a given function over the snapshot of etcd data and writes all changes made by it in a single etcd
+// transaction. Transaction fails if objects read in the batch have been concurrently modified, generations created
+// in the batch have been concurrently created by someone else or objects deleted in the batch have been concurrently
+// modified. In that case function gets called again over the new snapshot, up to commitAttempts times
+func (es *etcdStore) Batch(f func(ops store.Operations) error) error {
+	for attempt := 0; attempt < commitAttempts; attempt++ {
+		batch := es.newBatch()
+		err := f(batch)
+		if err != nil {
+			return err
+		}
+
+		err = batch.commit()
+		if err == errConflict {
+			continue
+		}
+
+		return err
+	}
+
+	return fmt.Errorf("error while writing objects to etcd: %s after %d attempts", errConflict, commitAttempts)
+}
+
+func (es *etcdStore) WithRegistry(registry *runtime.Registry) store.Generic {
+	return &etcdStore{registry: registry, codec: yaml.NewCodec(registry), client: es.client, prefix: es.prefix}
+}
+
+// Watch uses etcd watch, so changes made by all Aptomi instances sharing the same etcd are reported. Removal of a
+// single generation of versioned object isn't reported as it doesn't change the object
+func (es *etcdStore) Watch(prefix string) (<-chan store.WatchEvent, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	watchChan := es.client.Watch(ctx, es.prefix+prefix, clientv3.WithPrefix())
+
+	events := make(chan store.WatchEvent, store.WatchBufferSize)
+	go func() {
+		defer close(events)
+
+		for resp := range watchChan {
+			if err := resp.Err(); err != nil {
+				log.Warnf("Stopping watch of %s: %s", prefix, err)
+				return
+			}
+
+			for _, ev := range resp.Events {
+				event, ok, err := es.watchEvent(ev)
+				if err != nil {
+					log.Warnf("Stopping watch of %s: %s", prefix, err)
+					return
+				}
+				if !ok {
+					continue
+				}
+
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return events, cancel
+}
+
+// watchEvent converts etcd event into the store watch event, it returns false if event should be skipped
+func (es *etcdStore) watchEvent(ev *clientv3.Event) (store.WatchEvent, bool, error) {
+	path := string(ev.Kv.Key)
+	key := strings.TrimPrefix(path, es.prefix)
+	if idx := strings.LastIndex(key, etcdSeparator); idx >= 0 {
+		key = key[:idx]
+	}
+	event := store.WatchEvent{Key: key}
+
+	if ev.Type == clientv3.EventTypeDelete {
+		// only non-versioned objects are deleted as a whole, they are stored under the path with zero generation
+		return event, strings.HasSuffix(path, etcdSeparator+genStr(runtime.LastGen)), nil
+	}
+
+	obj, err := es.codec.DecodeOne(ev.Kv.Value)
+	if err != nil {
+		return event, false, fmt.Errorf("error while decoding changed object %s: %s", key, err)
+	}
+	storable, ok := obj.(runtime.Storable)
+	if !ok {
+		return event, false, fmt.Errorf("storable object is expected to be decoded from etcd, but got: %s", obj.GetKind())
+	}
+	event.Object = storable
+
+	return event, true, nil
+}
+
+var errConflict = fmt.Errorf("objects have been concurrently modified")
+
+func (es *etcdStore) newBatch() *etcdBatch {
+	return &etcdBatch{store: es, changes: make(map[string][]byte), reads: make(map[string]clientv3.Cmp)}
+}
+
+// etcdBatch implements operations on storable objects within a batch. All reads are done from the same revision of
+// etcd data and merged with changes made in the batch, which are kept in memory until they are committed
+type etcdBatch struct {
+	store *etcdStore
+
+	// rev is etcd revision, which all reads are done from (zero until the first read)
+	rev int64
+
+	// changes is a map from path to encoded object or nil for deleted objects
+	changes map[string][]byte
+
+	// reads is a map from path to condition that object read under that path hasn't been changed since it was read
+	reads map[string]clientv3.Cmp
+
+	// cmps are conditions for committing changes
+	cmps []clientv3.Cmp
+}
+
+func (batch *etcdBatch) Get(key string) (runtime.Storable, error) {
+	data, err := batch.get(batch.store.path(key, runtime.LastGen))
+	if err != nil {
+		return nil, fmt.Errorf("error while getting object with key %s from etcd: %s", key, err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	obj, err := batch.store.codec.DecodeOne(data)
+	if err != nil {
+		return nil, err
+	}
+	storable, ok := obj.(runtime.Storable)
+	if !ok {
+		return nil, fmt.Errorf("storable object is expected to be decoded from etcd, but got: %s", obj.GetKind())
+	}
+
+	return storable, nil
+}
+
+func (batch *etcdBatch) GetGen(key string, gen runtime.Generation) (runtime.Versioned, error) {
+	var data []byte
+	if gen == runtime.LastGen {
+		// keys of all generations share the same prefix and sorted by generation, so the last one is the latest
+		paths, values, err := batch.list(batch.store.prefix + key + etcdSeparator)
+		if err != nil {
+			return nil, fmt.Errorf("error while getting object with key %s and generation %s from etcd: %s", key, gen, err)
+		}
+		if len(paths) > 0 {
+			data = values[len(values)-1]
+		}
+	} else {
+		var err error
+		data, err = batch.get(batch.store.path(key, gen))
+		if err != nil {
+			return nil, fmt.Errorf("error while getting object with key %s and generation %s from etcd: %s", key, gen, err)
+		}
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	obj, err := batch.store.codec.DecodeOne(data)
+	if err != nil {
+		return nil, err
+	}
+	versioned, ok := obj.(runtime.Versioned)
+	if !ok {
+		return nil, fmt.Errorf("versioned object is expected to be decoded from etcd, but got: %s", obj.GetKind())
+	}
+
+	return versioned, nil
+}
+
+func (batch *etcdBatch) List(prefix string) ([]runtime.Storable, error) {
+	_, values, err := batch.list(batch.store.prefix + prefix)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing objects with prefix %s from etcd: %s", prefix, err)
+	}
+
+	result := make([]runtime.Storable, 0, len(values))
+	for _, value := range values {
+		baseObj, err := batch.store.codec.DecodeOne(value)
+		if err != nil {
+			return nil, err
+		}
+		obj, ok := baseObj.(runtime.Storable)
+		if !ok {
+			return nil, fmt.Errorf("storable object is expected to be decoded from etcd, but got: %s", baseObj.GetKind())
+		}
+		result = append(result, obj)
+	}
+
+	return result, nil
+}
+
+func (batch *etcdBatch) ListGenerations(key string) ([]runtime.Storable, error) {
+	return batch.List(key + etcdSeparator)
+}
+
+func (batch *etcdBatch) setNextGeneration(obj runtime.Versioned) error {
+	info := batch.store.registry.Get(obj.GetKind())
+	if !info.Versioned {
+		return fmt.Errorf("kind %s isn't versioned", obj.GetKind())
+	}
+	last, err := batch.GetGen(runtime.KeyForStorable(obj), runtime.LastGen)
+	if err != nil {
+		return err
+	}
+	var newGen runtime.Generation = 1
+	if last != nil {
+		newGen = last.GetGeneration().Next()
+	}
+	obj.SetGeneration(newGen)
+	return nil
+}
+
+func (batch *etcdBatch) Save(obj runtime.Storable) (bool, error) {
+	return batch.save(obj, false)
+}
+
+func (batch *etcdBatch) Update(obj runtime.Storable) (bool, error) {
+	return batch.save(obj, true)
+}
+
+func (batch *etcdBatch) save(obj runtime.Storable, updateCurrent bool) (bool, error) {
+	info := batch.store.registry.Get(obj.GetKind())
+	if info == nil {
+		return false, fmt.Errorf("unknown kind: %s", obj.GetKind())
+	}
+
+	if !info.Versioned {
+		return false, batch.put(batch.store.path(runtime.KeyForStorable(obj), runtime.LastGen), obj, false)
+	}
+
+	versionedObj, ok := obj.(runtime.Versioned)
+	if !ok {
+		return false, fmt.Errorf("versioned object doesn't implement Versioned interface: %s", obj.GetKind())
+	}
+
+	updated, newGen, err := batch.prepareVersioned(versionedObj, info, updateCurrent)
+	if err != nil {
+		return false, err
+	}
+
+	return updated, batch.put(batch.store.path(runtime.KeyForStorable(obj), versionedObj.GetGeneration()), obj, newGen)
+}
+
+// prepareVersioned sets generation of versioned object the same way as BoltDB store does and returns whether object
+// is updated and whether a new generation is going to be created
+func (batch *etcdBatch) prepareVersioned(versionedObj runtime.Versioned, info *runtime.Info, updateCurrent bool) (bool, bool, error) {
+	key := runtime.KeyForStorable(versionedObj)
+
+	existingObj, err := batch.GetGen(key, versionedObj.GetGeneration())
+	if err != nil {
+		return false, false, err
+	}
+
+	deletable, ok := versionedObj.(runtime.Deletable)
+	if ok && deletable.IsDeleted() {
+		if !info.Deletable {
+			return false, false, fmt.Errorf("trying mark object deleted=true that isn't explicitly marked as deletable: %s %s", info.Kind, key)
+		}
+
+		if existingObj == nil {
+			return false, false, fmt.Errorf("trying to make non-existing in db object with deleted=true: %s %s", info.Kind, key)
+		}
+	}
+
+	if existingObj == nil {
+		if versionedObj.GetGeneration() == runtime.LastGen {
+			versionedObj.SetGeneration(runtime.FirstGen)
+		}
+		return true, true, nil
+	}
+
+	versionedObj.SetGeneration(existingObj.GetGeneration())
+	equals, err := batch.store.equals(versionedObj, existingObj)
+	if err != nil {
+		return false, false, err
+	}
+	if !updateCurrent && !equals {
+		errGen := batch.setNextGeneration(versionedObj)
+		if errGen != nil {
+			return false, false, fmt.Errorf("error while calling setNextGeneration(%s): %s", versionedObj, errGen)
+		}
+		return true, true, nil
+	}
+
+	return false, false, nil
+}
+
+// put writes object into the batch under the given path. If onlyNew is true, batch is committed only if nobody else
+// has written an object under the given path in the meantime
+func (batch *etcdBatch) put(path string, obj runtime.Storable, onlyNew bool) error {
+	data, err := batch.store.codec.EncodeOne(obj)
+	if err != nil {
+		return err
+	}
+
+	if onlyNew {
+		batch.cmps = append(batch.cmps, clientv3.Compare(clientv3.CreateRevision(path), "=", 0))
+	}
+	batch.changes[path] = data
+
+	return nil
+}
+
+func (batch *etcdBatch) Delete(key string) error {
+	// todo support deleting version objects, same as in BoltDB store
+
+	prefix := batch.store.prefix + key + etcdSeparator
+	paths, values, err := batch.list(prefix)
+	if err != nil {
+		return fmt.Errorf("error while getting objects with key %s from etcd: %s", key, err)
+	}
+
+	for idx, value := range values {
+		baseObj, err := batch.store.codec.DecodeOne(value)
+		if err != nil {
+			return err
+		}
+		_, ok := baseObj.(runtime.Versioned)
+		if ok {
+			return fmt.Errorf("deleting versioned objects isn't implmeneted")
+		}
+
+		// delete only if object hasn't been changed since it was read
+		batch.cmps = append(batch.cmps, clientv3.Compare(clientv3.ModRevision(paths[idx]), "<", batch.rev+1))
+		batch.changes[paths[idx]] = nil
+	}
+
+	return nil
+}
+
+func (batch *etcdBatch) DeleteGen(key string, gen runtime.Generation) error {
+	if gen == runtime.LastGen {
+		return fmt.Errorf("generation should be specified to delete generation of object with key: %s", key)
+	}
+
+	batch.changes[batch.store.path(key, gen)] = nil
+
+	return nil
+}
+
+// get returns data stored under a given path, taking changes made in the batch into account
+func (batch *etcdBatch) get(path string) ([]byte, error) {
+	if data, changed := batch.changes[path]; changed {
+		return data, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp, err := batch.store.client.Get(ctx, path, batch.readOpts()...)
+	if err != nil {
+		return nil, err
+	}
+	batch.setRev(resp.Header.Revision)
+	if len(resp.Kvs) <= 0 {
+		// object should not be created by someone else, as batch relies on its absence
+		batch.reads[path] = clientv3.Compare(clientv3.CreateRevision(path), "=", 0)
+		return nil, nil
+	}
+	batch.reads[path] = clientv3.Compare(clientv3.ModRevision(path), "=", resp.Kvs[0].ModRevision)
+
+	return resp.Kvs[0].Value, nil
+}
+
+// list returns sorted paths and data of all objects with a given path prefix, taking changes made in the batch
+// into account
+func (batch *etcdBatch) list(prefix string) ([]string, [][]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	opts := append(batch.readOpts(), clientv3.WithPrefix())
+	resp, err := batch.store.client.Get(ctx, prefix, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	batch.setRev(resp.Header.Revision)
+
+	// objects created under the prefix by someone else aren't detected, as etcd doesn't support conditions on
+	// ranges, but new generations are still protected by the condition on their creation
+	data := make(map[string][]byte)
+	for _, kv := range resp.Kvs {
+		data[string(kv.Key)] = kv.Value
+		if _, changed := batch.changes[string(kv.Key)]; !changed {
+			batch.reads[string(kv.Key)] = clientv3.Compare(clientv3.ModRevision(string(kv.Key)), "=", kv.ModRevision)
+		}
+	}
+	for path, value := range batch.changes {
+		if strings.HasPrefix(path, prefix) {
+			data[path] = value
+		}
+	}
+
+	paths := make([]string, 0, len(data))
+	for path, value := range data {
+		if value != nil {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	values := make([][]byte, 0, len(paths))
+	for _, path := range paths {
+		values = append(values, data[path])
+	}
+
+	return paths, values, nil
+}
+
+// setRev records etcd revision of the first read, so all subsequent reads in the batch are done from it
+func (batch *etcdBatch) setRev(rev int64) {
+	if batch.rev <= 0 {
+		batch.rev = rev
+	}
+}
+
+// readOpts returns options for reading from the same revision as the previous reads in the batch
+func (batch *etcdBatch) readOpts() []clientv3.OpOption {
+	if batch.rev <= 0 {
+		return []clientv3.OpOption{}
+	}
+	return []clientv3.OpOption{clientv3.WithRev(batch.rev)}
+}
+
+// commit writes all changes made in the batch in a single etcd transaction
+func (batch *etcdBatch) commit() error {
+	if len(batch.changes) <= 0 {
+		return nil
+	}
+
+	ops := make([]clientv3.Op, 0, len(batch.changes))
+	for path, data := range batch.changes {
+		if data != nil {
+			ops = append(ops, clientv3.OpPut(path, string(data)))
+		} else {
+			ops = append(ops, clientv3.OpDelete(path))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	cmps := make([]clientv3.Cmp, 0, len(batch.reads)+len(batch.cmps))
+	for _, cmp := range batch.reads {
+		cmps = append(cmps, cmp)
+	}
+	cmps = append(cmps, batch.cmps...)
+
+	resp, err := batch.store.client.Txn(ctx).If(cmps...).Then(ops...).Commit()
+	if err != nil {
+		return fmt.Errorf("error while writing objects to etcd: %s", err)
+	}
+	if !resp.Succeeded {
+		return errConflict
+	}
+
+	return nil
+}
+
+func (es *etcdStore) path(key string, gen runtime.Generation) string {
+	return es.prefix + key + etcdSeparator + genStr(gen)
+}
+
+func (es *etcdStore) equals(o1 runtime.Object, o2 runtime.Object) (bool, error) {
+	o1bytes, err := es.codec.EncodeOne(o1)
+	if err != nil {
+		return false, err
+	}
+
+	o2bytes, err := es.codec.EncodeOne(o2)
+	if err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(o1bytes, o2bytes), nil
+}
+
+// genStr returns generation padded to the fixed width, so keys of generations are sorted in etcd the same way as
+// generations themselves
+func genStr(gen runtime.Generation) string {
+	return fmt.Sprintf("%20d", gen)
+}
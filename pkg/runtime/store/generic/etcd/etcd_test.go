@@ -0,0 +1,114 @@
+package etcd
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/generic/conformance"
+	"github.com/coreos/etcd/embed"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEtcdStoreConformance(t *testing.T) {
+	endpoint, stop := startEmbeddedEtcd(t)
+	defer stop()
+
+	// every test gets its own prefix, so they don't see objects of each other
+	count := 0
+	conformance.RunTests(t, func(t *testing.T, registry *runtime.Registry) store.Generic {
+		count++
+		s := NewGenericStore(registry)
+		err := s.Open(config.DB{Connection: fmt.Sprintf("%s%s/test-%d", Scheme, endpoint, count)})
+		if err != nil {
+			t.Fatalf("Unable to open etcd store: %s", err)
+		}
+		return s
+	})
+}
+
+func TestParseConnection(t *testing.T) {
+	endpoints, prefix, err := parseConnection("etcd://host1:2379,host2:2379", false)
+	assert.NoError(t, err, "Connection string should be parsed")
+	assert.Equal(t, []string{"http://host1:2379", "http://host2:2379"}, endpoints, "All endpoints should be parsed")
+	assert.Equal(t, defaultPrefix, prefix, "Default prefix should be used")
+
+	endpoints, _, err = parseConnection("etcd://host1:2379,host2:2379", true)
+	assert.NoError(t, err, "Connection string should be parsed")
+	assert.Equal(t, []string{"https://host1:2379", "https://host2:2379"}, endpoints, "Endpoints should be accessed over https with TLS enabled")
+
+	_, prefix, err = parseConnection("etcd://host1:2379/custom/", false)
+	assert.NoError(t, err, "Connection string with prefix should be parsed")
+	assert.Equal(t, "custom", prefix, "Custom prefix should be used")
+
+	_, _, err = parseConnection("etcd:///custom", false)
+	assert.Error(t, err, "Connection string without endpoints should not be parsed")
+
+	_, _, err = parseConnection("/var/lib/aptomi/db.bolt", false)
+	assert.Error(t, err, "Connection string without etcd scheme should not be parsed")
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	tlsConfig, err := newTLSConfig(config.DBTLS{Enabled: true})
+	assert.NoError(t, err, "TLS config without files should be created")
+	assert.Nil(t, tlsConfig.RootCAs, "System CAs should be used by default")
+	assert.Empty(t, tlsConfig.Certificates, "No client certificate should be used by default")
+
+	_, err = newTLSConfig(config.DBTLS{Enabled: true, CAFile: "/nonexistent/ca.pem"})
+	assert.Error(t, err, "TLS config should not be created with missing CA file")
+
+	_, err = newTLSConfig(config.DBTLS{Enabled: true, CertFile: "/nonexistent/cert.pem"})
+	assert.Error(t, err, "TLS config should not be created with client certificate, but without key")
+}
+
+// startEmbeddedEtcd starts etcd server in a temp dir and returns its client endpoint (host:port) and a function to
+// stop the server and remove its data
+func startEmbeddedEtcd(t *testing.T) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "aptomi-etcd-test")
+	if err != nil {
+		t.Fatalf("Unable to create temp dir: %s", err)
+	}
+
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	clientURL, _ := url.Parse("http://" + freeAddr(t))
+	peerURL, _ := url.Parse("http://" + freeAddr(t))
+	cfg.LCUrls, cfg.ACUrls = []url.URL{*clientURL}, []url.URL{*clientURL}
+	cfg.LPUrls, cfg.APUrls = []url.URL{*peerURL}, []url.URL{*peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	server, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("Unable to start embedded etcd: %s", err)
+	}
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		server.Close()
+		t.Fatalf("Embedded etcd took too long to start")
+	}
+
+	return clientURL.Host, func() {
+		server.Close()
+		os.RemoveAll(dir) // nolint: errcheck
+	}
+}
+
+// freeAddr returns local address (host:port) with a port, which isn't used by anyone at the moment
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to find free port: %s", err)
+	}
+	defer listener.Close() // nolint: errcheck
+
+	return listener.Addr().String()
+}
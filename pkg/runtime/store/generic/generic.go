@@ -0,0 +1,37 @@
+// Package generic provides a way to open an object store, picking one of the available store backends by the scheme
+// of the connection string
+package generic
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/generic/bolt"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/generic/etcd"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/generic/mem"
+	"strings"
+)
+
+// NewStore creates a new object store and opens it. Store backend is selected by the scheme of the connection
+// string: etcd:// for etcd, mem:// for in-memory store, bolt:// or no scheme at all for BoltDB
+func NewStore(registry *runtime.Registry, cfg config.DB) (store.Generic, error) {
+	var result store.Generic
+	switch {
+	case strings.HasPrefix(cfg.Connection, etcd.Scheme):
+		result = etcd.NewGenericStore(registry)
+	case strings.HasPrefix(cfg.Connection, mem.Scheme):
+		result = mem.NewGenericStore(registry)
+	case strings.HasPrefix(cfg.Connection, bolt.Scheme) || !strings.Contains(cfg.Connection, "://"):
+		result = bolt.NewGenericStore(registry)
+	default:
+		return nil, fmt.Errorf("unsupported scheme of connection string: %s", cfg.Connection)
+	}
+
+	err := result.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
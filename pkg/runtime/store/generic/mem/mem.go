@@ -0,0 +1,451 @@
+package mem
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/codec/yaml"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Scheme is a scheme of the connection string for in-memory store. Everything after the scheme is ignored, every
+// opened in-memory store is empty and all its data is lost once it's closed
+const Scheme = "mem://"
+
+// NewGenericStore creates a new object store, which keeps all objects in memory. Objects are stored encoded, same as
+// in BoltDB store, so stored objects can't be changed by modifying objects passed to or returned from the store
+func NewGenericStore(registry *runtime.Registry) store.Generic {
+	codec := yaml.NewCodec(registry)
+	return &memStore{registry: registry, codec: codec, notifier: store.NewNotifier(codec), memData: &memData{}}
+}
+
+type memStore struct {
+	registry *runtime.Registry
+	codec    runtime.Codec
+	notifier *store.Notifier
+
+	// memData is shared with stores created by WithRegistry
+	*memData
+}
+
+type memData struct {
+	// mutex protects objects, all changes are done under write lock to make reading of the last generation and
+	// writing of the next one atomic
+	mutex   sync.RWMutex
+	objects map[string][]byte
+}
+
+func (ms *memStore) Open(cfg config.DB) error {
+	if !strings.HasPrefix(cfg.Connection, Scheme) {
+		return fmt.Errorf("in-memory store connection string should start with %s: %s", Scheme, cfg.Connection)
+	}
+
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.objects = make(map[string][]byte)
+
+	return nil
+}
+
+func (ms *memStore) Close() error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+	ms.objects = nil
+
+	return nil
+}
+
+const memSeparator = "@"
+
+func (ms *memStore) Get(key string) (runtime.Storable, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	return ms.ops(ms.objects).Get(key)
+}
+
+func (ms *memStore) GetGen(key string, gen runtime.Generation) (runtime.Versioned, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	return ms.ops(ms.objects).GetGen(key, gen)
+}
+
+func (ms *memStore) List(prefix string) ([]runtime.Storable, error) {
+	ms.mutex.RLock()
+	defer ms.mutex.RUnlock()
+
+	return ms.ops(ms.objects).List(prefix)
+}
+
+func (ms *memStore) ListGenerations(key string) ([]runtime.Storable, error) {
+	return ms.List(key + memSeparator)
+}
+
+func (ms *memStore) Save(obj runtime.Storable) (bool, error) {
+	var updated bool
+	err := ms.update(false, func(ops *memOps) error {
+		var err error
+		updated, err = ops.Save(obj)
+		return err
+	})
+
+	return updated, err
+}
+
+func (ms *memStore) Update(obj runtime.Storable) (bool, error) {
+	var updated bool
+	err := ms.update(false, func(ops *memOps) error {
+		var err error
+		updated, err = ops.Update(obj)
+		return err
+	})
+
+	return updated, err
+}
+
+func (ms *memStore) Delete(key string) error {
+	return ms.update(false, func(ops *memOps) error {
+		return ops.Delete(key)
+	})
+}
+
+func (ms *memStore) DeleteGen(key string, gen runtime.Generation) error {
+	return ms.update(false, func(ops *memOps) error {
+		return ops.DeleteGen(key, gen)
+	})
+}
+
+// Batch runs a given function under write lock on a copy of all objects, which replaces the objects only if function
+// returns nil. Nobody else can read or write objects while batch is running
+func (ms *memStore) Batch(f func(ops store.Operations) error) error {
+	return ms.update(true, func(ops *memOps) error {
+		return f(ops)
+	})
+}
+
+func (ms *memStore) WithRegistry(registry *runtime.Registry) store.Generic {
+	return &memStore{registry: registry, codec: yaml.NewCodec(registry), notifier: ms.notifier, memData: ms.memData}
+}
+
+// Watch uses in-process notifications, same as BoltDB store
+func (ms *memStore) Watch(prefix string) (<-chan store.WatchEvent, func()) {
+	return ms.notifier.Watch(prefix)
+}
+
+// update runs a given function under write lock and notifies watchers about the changes once they are written. If
+// batch is requested, function is run on a copy of all objects, which replaces the objects only if function returns nil
+func (ms *memStore) update(batch bool, f func(ops *memOps) error) error {
+	err := ms.apply(batch, f)
+	if err != nil {
+		return err
+	}
+
+	// changed objects are decoded and delivered to watchers once the lock is released
+	ms.notifier.Deliver()
+
+	return nil
+}
+
+// apply runs a given function under write lock and queues the changes for watchers, so they get changes in the same
+// order as they are written
+func (ms *memStore) apply(batch bool, f func(ops *memOps) error) error {
+	ms.mutex.Lock()
+	defer ms.mutex.Unlock()
+
+	if ms.objects == nil {
+		return fmt.Errorf("in-memory store isn't opened")
+	}
+
+	objects := ms.objects
+	if batch {
+		objects = make(map[string][]byte, len(ms.objects))
+		for path, data := range ms.objects {
+			objects[path] = data
+		}
+	}
+
+	ops := ms.ops(objects)
+	err := f(ops)
+	if err != nil {
+		return err
+	}
+	ms.objects = objects
+	ms.notifier.Queue(ops.changes)
+
+	return nil
+}
+
+func (ms *memStore) ops(objects map[string][]byte) *memOps {
+	return &memOps{store: ms, objects: objects}
+}
+
+// memOps implements operations on storable objects over a given map of objects. Caller should hold the lock
+type memOps struct {
+	store   *memStore
+	objects map[string][]byte
+
+	// changes made by operations, which watchers get notified about once they are written
+	changes []store.Change
+}
+
+func (ops *memOps) Get(key string) (runtime.Storable, error) {
+	data, err := ops.getData(key + memSeparator + genStr(runtime.LastGen))
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	obj, err := ops.store.codec.DecodeOne(data)
+	if err != nil {
+		return nil, err
+	}
+	storable, ok := obj.(runtime.Storable)
+	if !ok {
+		return nil, fmt.Errorf("storable object is expected to be decoded from memory, but got: %s", obj.GetKind())
+	}
+
+	return storable, nil
+}
+
+func (ops *memOps) GetGen(key string, gen runtime.Generation) (runtime.Versioned, error) {
+	var data []byte
+	var err error
+	if gen == runtime.LastGen {
+		keys, errKeys := ops.getKeys(key + memSeparator)
+		if errKeys != nil {
+			return nil, errKeys
+		}
+		if len(keys) > 0 {
+			data, err = ops.getData(keys[len(keys)-1])
+		}
+	} else {
+		data, err = ops.getData(key + memSeparator + genStr(gen))
+	}
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	obj, err := ops.store.codec.DecodeOne(data)
+	if err != nil {
+		return nil, err
+	}
+	versioned, ok := obj.(runtime.Versioned)
+	if !ok {
+		return nil, fmt.Errorf("versioned object is expected to be decoded from memory, but got: %s", obj.GetKind())
+	}
+
+	return versioned, nil
+}
+
+func (ops *memOps) List(prefix string) ([]runtime.Storable, error) {
+	keys, err := ops.getKeys(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]runtime.Storable, 0, len(keys))
+	for _, key := range keys {
+		baseObj, err := ops.store.codec.DecodeOne(ops.objects[key])
+		if err != nil {
+			return nil, err
+		}
+		obj, ok := baseObj.(runtime.Storable)
+		if !ok {
+			return nil, fmt.Errorf("storable object is expected to be decoded from memory, but got: %s", baseObj.GetKind())
+		}
+		result = append(result, obj)
+	}
+
+	return result, nil
+}
+
+func (ops *memOps) ListGenerations(key string) ([]runtime.Storable, error) {
+	return ops.List(key + memSeparator)
+}
+
+func (ops *memOps) setNextGeneration(obj runtime.Versioned) error {
+	info := ops.store.registry.Get(obj.GetKind())
+	if !info.Versioned {
+		return fmt.Errorf("kind %s isn't versioned", obj.GetKind())
+	}
+	last, err := ops.GetGen(runtime.KeyForStorable(obj), runtime.LastGen)
+	if err != nil {
+		return err
+	}
+	var newGen runtime.Generation = 1
+	if last != nil {
+		newGen = last.GetGeneration().Next()
+	}
+	obj.SetGeneration(newGen)
+	return nil
+}
+
+func (ops *memOps) Save(obj runtime.Storable) (bool, error) {
+	return ops.save(obj, false)
+}
+
+func (ops *memOps) Update(obj runtime.Storable) (bool, error) {
+	return ops.save(obj, true)
+}
+
+func (ops *memOps) save(obj runtime.Storable, updateCurrent bool) (bool, error) {
+	info := ops.store.registry.Get(obj.GetKind())
+	if info == nil {
+		return false, fmt.Errorf("unknown kind: %s", obj.GetKind())
+	}
+
+	key := runtime.KeyForStorable(obj)
+	memPath := key
+	updated := false
+
+	if info.Versioned {
+		versionedObj, ok := obj.(runtime.Versioned)
+		if !ok {
+			return false, fmt.Errorf("versioned object doesn't implement Versioned interface: %s", obj.GetKind())
+		}
+
+		existingObj, err := ops.GetGen(key, versionedObj.GetGeneration())
+		if err != nil {
+			return false, err
+		}
+
+		deletable, ok := obj.(runtime.Deletable)
+		if ok && deletable.IsDeleted() {
+			if !info.Deletable {
+				return false, fmt.Errorf("trying mark object deleted=true that isn't explicitly marked as deletable: %s %s", info.Kind, key)
+			}
+
+			if existingObj == nil {
+				return false, fmt.Errorf("trying to make non-existing in db object with deleted=true: %s %s", info.Kind, key)
+			}
+		}
+
+		if existingObj != nil {
+			versionedObj.SetGeneration(existingObj.GetGeneration())
+			equals, equalsErr := ops.store.equals(obj, existingObj)
+			if equalsErr != nil {
+				return false, equalsErr
+			}
+			if !updateCurrent && !equals {
+				errGen := ops.setNextGeneration(versionedObj)
+				if errGen != nil {
+					return false, fmt.Errorf("error while calling setNextGeneration(%s): %s", obj, errGen)
+				}
+				updated = true
+			}
+		} else {
+			if versionedObj.GetGeneration() == runtime.LastGen {
+				versionedObj.SetGeneration(runtime.FirstGen)
+			}
+			updated = true
+		}
+
+		memPath += memSeparator + genStr(versionedObj.GetGeneration())
+	} else { // not versioned
+		memPath += memSeparator + genStr(runtime.LastGen)
+	}
+
+	if ops.objects == nil {
+		return false, fmt.Errorf("in-memory store isn't opened")
+	}
+
+	data, err := ops.store.codec.EncodeOne(obj)
+	if err != nil {
+		return false, err
+	}
+	ops.objects[memPath] = data
+	ops.changes = append(ops.changes, store.Change{Key: key, Data: data})
+
+	return updated, nil
+}
+
+func (ops *memOps) Delete(key string) error {
+	// todo support deleting version objects, same as in BoltDB store
+
+	keys, err := ops.getKeys(key + memSeparator)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		baseObj, err := ops.store.codec.DecodeOne(ops.objects[k])
+		if err != nil {
+			return err
+		}
+		_, ok := baseObj.(runtime.Versioned)
+		if ok {
+			return fmt.Errorf("deleting versioned objects isn't implmeneted")
+		}
+	}
+
+	for _, k := range keys {
+		delete(ops.objects, k)
+	}
+	if len(keys) > 0 {
+		ops.changes = append(ops.changes, store.Change{Key: key})
+	}
+
+	return nil
+}
+
+func (ops *memOps) DeleteGen(key string, gen runtime.Generation) error {
+	if gen == runtime.LastGen {
+		return fmt.Errorf("generation should be specified to delete generation of object with key: %s", key)
+	}
+
+	if ops.objects == nil {
+		return fmt.Errorf("in-memory store isn't opened")
+	}
+	delete(ops.objects, key+memSeparator+genStr(gen))
+
+	return nil
+}
+
+// getData returns encoded object stored under the given path, or nil if there is no such object
+func (ops *memOps) getData(path string) ([]byte, error) {
+	if ops.objects == nil {
+		return nil, fmt.Errorf("in-memory store isn't opened")
+	}
+	return ops.objects[path], nil
+}
+
+// getKeys returns sorted list of paths of all objects starting with the given prefix
+func (ops *memOps) getKeys(prefix string) ([]string, error) {
+	if ops.objects == nil {
+		return nil, fmt.Errorf("in-memory store isn't opened")
+	}
+
+	result := []string{}
+	for key := range ops.objects {
+		if strings.HasPrefix(key, prefix) {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+func (ms *memStore) equals(o1 runtime.Object, o2 runtime.Object) (bool, error) {
+	o1bytes, err := ms.codec.EncodeOne(o1)
+	if err != nil {
+		return false, err
+	}
+
+	o2bytes, err := ms.codec.EncodeOne(o2)
+	if err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(o1bytes, o2bytes), nil
+}
+
+// genStr returns generation padded to the fixed width, so paths of generations are sorted the same way as
+// generations themselves
+func genStr(gen runtime.Generation) string {
+	return fmt.Sprintf("%20d", gen)
+}
@@ -0,0 +1,20 @@
+package mem
+
+import (
+	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/generic/conformance"
+	"testing"
+)
+
+func TestMemStoreConformance(t *testing.T) {
+	conformance.RunTests(t, func(t *testing.T, registry *runtime.Registry) store.Generic {
+		s := NewGenericStore(registry)
+		err := s.Open(config.DB{Connection: Scheme})
+		if err != nil {
+			t.Fatalf("Unable to open in-memory store: %s", err)
+		}
+		return s
+	})
+}
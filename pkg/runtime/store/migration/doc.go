@@ -0,0 +1,4 @@
+// Package migration implements migrations of the objects stored in DB between schema versions. Objects are stored
+// encoded, so once their Go types change in a backward incompatible way, existing objects can't be decoded anymore.
+// Migrations transform stored objects in their raw form into the latest schema version on server start.
+package migration
@@ -0,0 +1,276 @@
+package migration
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/election"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/codec/yaml"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/Aptomi/aptomi/pkg/version"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Migration transforms stored objects from the previous schema version into its version
+type Migration struct {
+	// Version is the schema version, which objects are migrated into
+	Version int
+
+	// Description describes what's being changed
+	Description string
+
+	// Migrate transforms a single object and returns true if it's been changed. It's called for every stored object
+	// (including all generations of versioned objects), so it should skip objects of kinds it doesn't change. All
+	// stored objects are passed as well, so migration could use data of the other objects, but it should change only
+	// the given one. It should be idempotent, as interrupted migration is run again from the start. Nil means no objects
+	// need to be changed
+	Migrate func(obj *Object, all []*Object) (bool, error)
+}
+
+// All is the list of all migrations ordered by version. New migration should be added with the next version every time
+// Go types of the stored objects change in a way, which breaks decoding of the existing objects, or stored objects
+// need data, which hasn't been recorded for them before
+var All = []*Migration{
+	{
+		Version:     1,
+		Description: "Record schema version for objects stored before schema versioning",
+	},
+	{
+		Version:     2,
+		Description: "Record parameters containing generated secrets for component instances in actual state",
+		Migrate:     recordSecretParams,
+	},
+}
+
+// Result represents result of migrating objects to the latest schema version
+type Result struct {
+	// FromVersion is the schema version of objects before migration
+	FromVersion int
+
+	// ToVersion is the schema version of objects after migration
+	ToVersion int
+
+	// Applied is the list of migrations applied (or to be applied in dry-run mode)
+	Applied []*Migration
+
+	// ObjectsChanged is the number of objects changed by migrations
+	ObjectsChanged int
+
+	// Backup is the path to the backup file written before migration
+	Backup string
+}
+
+// Run migrates objects stored in a given store to the latest schema version using given migrations. Backup of all
+// objects is written into backup directory before any changes are made. Empty DB just gets the latest schema version
+// recorded. Objects are migrated in a single batch, which is committed only if schema version hasn't been changed in
+// the meantime, so servers sharing the same DB don't migrate it twice. In dry-run mode migrations are run to find out
+// which objects would be changed, but DB isn't changed and backup isn't written
+func Run(db store.Generic, migrations []*Migration, backupDir string, dryRun bool) (*Result, error) {
+	for idx, migration := range migrations {
+		if migration.Version != idx+1 {
+			return nil, fmt.Errorf("migration #%d has version %d, while migrations should have consecutive versions starting from 1", idx, migration.Version)
+		}
+	}
+	latest := len(migrations)
+
+	// objects are migrated in their raw form, as they may not be decoded into the current Go types
+	raw := db.WithRegistry(newRegistry())
+	objs, schema, err := load(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := schemaVersion(schema, objs, latest)
+	if err != nil {
+		return nil, err
+	}
+	result := &Result{FromVersion: current, ToVersion: latest, Applied: migrations[current:]}
+	if current == latest && schema != nil {
+		return result, nil
+	}
+
+	if dryRun {
+		changed, migrateErr := migrate(objs, result.Applied)
+		if migrateErr != nil {
+			return nil, migrateErr
+		}
+		result.ObjectsChanged = len(changed)
+		return result, nil
+	}
+
+	// backup is written before objects get changed by migrations
+	if len(objs) > 0 {
+		result.Backup, err = backup(objs, schema, current, backupDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = raw.Batch(func(ops store.Operations) error {
+		// objects are loaded again, so the batch fails if they get changed by someone else before it's committed
+		batchObjs, batchSchema, loadErr := load(ops)
+		if loadErr != nil {
+			return loadErr
+		}
+		batchCurrent, versionErr := schemaVersion(batchSchema, batchObjs, latest)
+		if versionErr != nil {
+			return versionErr
+		}
+		if batchCurrent == latest && batchSchema != nil {
+			// DB has been migrated by someone else in the meantime
+			result.FromVersion, result.Applied = latest, nil
+			return nil
+		}
+		if batchCurrent != current || (batchSchema == nil) != (schema == nil) {
+			return fmt.Errorf("schema version has been changed from %d to %d by someone else while migrating", current, batchCurrent)
+		}
+
+		changed, migrateErr := migrate(batchObjs, result.Applied)
+		if migrateErr != nil {
+			return migrateErr
+		}
+		result.ObjectsChanged = len(changed)
+		for _, obj := range changed {
+			_, saveErr := ops.Update(obj)
+			if saveErr != nil {
+				return fmt.Errorf("error while saving migrated %s: %s", runtime.KeyForStorable(obj), saveErr)
+			}
+		}
+
+		// schema version is recorded in the same batch, so objects never get migrated twice
+		_, saveErr := ops.Save(store.NewSchemaVersion(latest, time.Now()))
+		if saveErr != nil {
+			return fmt.Errorf("error while saving schema version: %s", saveErr)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// migrate runs given migrations on given objects and returns the list of changed objects
+func migrate(objs []*Object, migrations []*Migration) ([]*Object, error) {
+	changed := make(map[*Object]bool)
+	for _, migration := range migrations {
+		if migration.Migrate == nil {
+			continue
+		}
+		for _, obj := range objs {
+			objChanged, err := migration.Migrate(obj, objs)
+			if err != nil {
+				return nil, fmt.Errorf("error while migrating %s to schema version %d: %s", runtime.KeyForStorable(obj), migration.Version, err)
+			}
+			if objChanged {
+				changed[obj] = true
+			}
+		}
+	}
+
+	result := []*Object{}
+	for _, obj := range objs {
+		if changed[obj] {
+			result = append(result, obj)
+		}
+	}
+	return result, nil
+}
+
+// load returns all stored objects except leases and schema version, along with the schema version object. It's nil
+// for DB created before schema versioning
+func load(ops store.Operations) ([]*Object, *Object, error) {
+	storables, err := ops.List("")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while listing objects: %s", err)
+	}
+
+	var objs []*Object
+	for _, storable := range storables {
+		obj, ok := storable.(*Object)
+		if !ok {
+			return nil, nil, fmt.Errorf("raw object expected to be loaded from DB, but got: %s", storable.GetKind())
+		}
+		if obj.GetKind() != election.LeaseObject.Kind && obj.GetKind() != store.SchemaVersionObject.Kind {
+			objs = append(objs, obj)
+		}
+	}
+
+	// schema version is read by its key, so batch fails if it gets recorded by someone else in the meantime
+	storable, err := ops.Get(store.SchemaVersionKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while getting schema version: %s", err)
+	}
+	if storable == nil {
+		return objs, nil, nil
+	}
+	schema, ok := storable.(*Object)
+	if !ok {
+		return nil, nil, fmt.Errorf("raw object expected to be loaded from DB, but got: %s", storable.GetKind())
+	}
+
+	return objs, schema, nil
+}
+
+// schemaVersion returns schema version recorded in schema version object. DB created before schema versioning has
+// zero schema version, unless it's empty, then it has the latest one
+func schemaVersion(schema *Object, objs []*Object, latest int) (int, error) {
+	if schema == nil {
+		if len(objs) <= 0 {
+			return latest, nil
+		}
+		return 0, nil
+	}
+
+	version, ok := schema.Data["version"].(int)
+	if !ok {
+		return 0, fmt.Errorf("schema version isn't a number: %v", schema.Data["version"])
+	}
+	if version > latest {
+		return 0, fmt.Errorf("schema version %d of DB is newer than the latest supported schema version %d", version, latest)
+	}
+	return version, nil
+}
+
+// backup writes all objects into the backup file in the backup directory, in the same format as DB dump
+func backup(objs []*Object, schema *Object, current int, backupDir string) (string, error) {
+	if len(backupDir) <= 0 {
+		return "", fmt.Errorf("backup directory should be specified to migrate DB")
+	}
+	err := os.MkdirAll(backupDir, 0700)
+	if err != nil {
+		return "", fmt.Errorf("error while creating backup directory: %s", err)
+	}
+
+	now := time.Now()
+	header := &store.BackupHeader{
+		TypeKind:      store.BackupHeaderObject.GetTypeKind(),
+		FormatVersion: store.BackupFormatVersion,
+		AptomiVersion: version.GetBuildInfo().GitVersion,
+		CreatedAt:     now,
+	}
+	backupObjs := []runtime.Object{header}
+	if schema != nil {
+		backupObjs = append(backupObjs, schema)
+	}
+	for _, obj := range objs {
+		backupObjs = append(backupObjs, obj)
+	}
+	header.Objects = len(backupObjs) - 1
+
+	data, err := yaml.NewCodec(newRegistry()).EncodeMany(backupObjs)
+	if err != nil {
+		return "", fmt.Errorf("error while encoding backup: %s", err)
+	}
+
+	path := filepath.Join(backupDir, fmt.Sprintf("db-schema-v%d-%s.yaml", current, now.Format("20060102-150405")))
+	err = ioutil.WriteFile(path, data, 0600)
+	if err != nil {
+		return "", fmt.Errorf("error while writing backup: %s", err)
+	}
+
+	return path, nil
+}
@@ -0,0 +1,107 @@
+package migration
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"gopkg.in/yaml.v2"
+)
+
+// Object is a stored object in its raw form, as it's been decoded from DB without converting it into the Go type of
+// its kind. Migrations change Data of the objects, while keys and generations of the objects are kept as is
+type Object struct {
+	// Data is the raw object data
+	Data map[interface{}]interface{}
+
+	info  *runtime.Info
+	typed runtime.Storable
+}
+
+// newRegistry returns registry, which has all storable kinds decoded into raw objects
+func newRegistry() *runtime.Registry {
+	registry := runtime.NewRegistry()
+	for _, info := range store.Objects {
+		kindInfo := info
+		registry.Append(&runtime.Info{
+			Kind:        kindInfo.Kind,
+			Storable:    kindInfo.Storable,
+			Versioned:   kindInfo.Versioned,
+			Deletable:   kindInfo.Deletable,
+			Constructor: func() runtime.Object { return &Object{info: kindInfo} },
+		})
+	}
+	return registry
+}
+
+// UnmarshalYAML decodes raw object data. Key and generation of the object are taken from the object decoded into the
+// current Go type of its kind, ignoring fields which can't be decoded into it anymore
+func (obj *Object) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	err := unmarshal(&obj.Data)
+	if err != nil {
+		return err
+	}
+
+	typed := obj.info.New()
+	err = unmarshal(typed)
+	if _, typeErr := err.(*yaml.TypeError); err != nil && !typeErr {
+		return err
+	}
+
+	storable, ok := typed.(runtime.Storable)
+	if !ok {
+		return fmt.Errorf("kind %s isn't storable", obj.info.Kind)
+	}
+	obj.typed = storable
+
+	return nil
+}
+
+// MarshalYAML encodes raw object data
+func (obj *Object) MarshalYAML() (interface{}, error) {
+	return obj.Data, nil
+}
+
+// GetKind returns object kind
+func (obj *Object) GetKind() runtime.Kind {
+	return obj.info.Kind
+}
+
+// GetNamespace returns object namespace
+func (obj *Object) GetNamespace() string {
+	return obj.typed.GetNamespace()
+}
+
+// GetName returns object name
+func (obj *Object) GetName() string {
+	return obj.typed.GetName()
+}
+
+// GetGeneration returns object generation, or LastGen if object isn't versioned
+func (obj *Object) GetGeneration() runtime.Generation {
+	if versioned, ok := obj.typed.(runtime.Versioned); ok {
+		return versioned.GetGeneration()
+	}
+	return runtime.LastGen
+}
+
+// SetGeneration sets object generation, it's only used by the store to keep generation of the object as is
+func (obj *Object) SetGeneration(gen runtime.Generation) {
+	if versioned, ok := obj.typed.(runtime.Versioned); ok {
+		versioned.SetGeneration(gen)
+	}
+}
+
+// IsDeleted returns true if object is marked as deleted
+func (obj *Object) IsDeleted() bool {
+	if deletable, ok := obj.typed.(runtime.Deletable); ok {
+		return deletable.IsDeleted()
+	}
+	return false
+}
+
+// SetDeleted marks object as deleted, it's only needed for the object to be handled by the store as deletable
+func (obj *Object) SetDeleted(deleted bool) {
+	if deletable, ok := obj.typed.(runtime.Deletable); ok {
+		deletable.SetDeleted(deleted)
+	}
+}
@@ -0,0 +1,81 @@
+package migration
+
+import (
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/external/secrets"
+	"sort"
+	"strings"
+)
+
+// recordSecretParams records paths to code and discovery parameters, which contain generated secrets, for component
+// instances in actual state. They are calculated by policy resolver, but component instances saved before that have
+// none, so their parameters containing secrets would be logged as is once the instances get updated or destroyed
+func recordSecretParams(obj *Object, all []*Object) (bool, error) {
+	if obj.GetKind() != resolve.ComponentInstanceObject.Kind {
+		return false, nil
+	}
+	codeParams, _ := obj.Data["secretcodeparams"].([]interface{})
+	discoveryParams, _ := obj.Data["secretdiscoveryparams"].([]interface{})
+	if len(codeParams) > 0 || len(discoveryParams) > 0 {
+		return false, nil
+	}
+
+	// secrets of all instances are checked, same as policy resolver does, as they could be passed via discovery
+	values := []string{}
+	for _, other := range all {
+		if other.GetKind() != secrets.GeneratedSecretsObject.Kind {
+			continue
+		}
+		instanceSecrets, _ := other.Data["secrets"].(map[interface{}]interface{})
+		for _, value := range instanceSecrets {
+			if str, ok := value.(string); ok && len(str) > 0 {
+				values = append(values, str)
+			}
+		}
+	}
+	if len(values) == 0 {
+		return false, nil
+	}
+
+	containsSecret := func(str string) bool {
+		for _, value := range values {
+			if strings.Contains(str, value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	changed := false
+	for field, paramsField := range map[string]string{"secretcodeparams": "calculatedcodeparams", "secretdiscoveryparams": "calculateddiscovery"} {
+		paths := []string{}
+		findRawStringPaths(obj.Data[paramsField], "", containsSecret, &paths)
+		if len(paths) > 0 {
+			sort.Strings(paths)
+			obj.Data[field] = paths
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
+
+// findRawStringPaths finds paths ('key1.key2.key3') to all string values, which match a given function, in raw
+// parameters, same as NestedParameterMap.FindStringPaths does
+func findRawStringPaths(node interface{}, path string, match func(string) bool, result *[]string) {
+	params, ok := node.(map[interface{}]interface{})
+	if !ok {
+		return
+	}
+	for key, value := range params {
+		keyPath, _ := key.(string)
+		if len(path) > 0 {
+			keyPath = path + "." + keyPath
+		}
+		if str, ok := value.(string); ok && match(str) {
+			*result = append(*result, keyPath)
+		} else {
+			findRawStringPaths(value, keyPath, match, result)
+		}
+	}
+}
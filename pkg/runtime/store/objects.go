@@ -1,12 +1,14 @@
 package store
 
 import (
+	"github.com/Aptomi/aptomi/pkg/election"
 	"github.com/Aptomi/aptomi/pkg/engine"
+	"github.com/Aptomi/aptomi/pkg/external/secrets"
 	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/runtime"
 )
 
 var (
 	// Objects represents list of all storable objects
-	Objects = runtime.AppendAll(engine.Objects, lang.PolicyObjects)
+	Objects = runtime.AppendAll(engine.Objects, lang.PolicyObjects, []*runtime.Info{secrets.GeneratedSecretsObject, election.LeaseObject, SchemaVersionObject})
 )
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	"time"
+)
+
+// SchemaVersionObject is an informational data structure with Kind and Constructor for SchemaVersion
+var SchemaVersionObject = &runtime.Info{
+	Kind:        "schema-version",
+	Storable:    true,
+	Versioned:   false,
+	Constructor: func() runtime.Object { return &SchemaVersion{} },
+}
+
+// SchemaVersionKey is the key of the object, which holds schema version of the store
+var SchemaVersionKey = runtime.KeyFromParts(runtime.SystemNS, SchemaVersionObject.Kind, runtime.EmptyName)
+
+// SchemaVersion represents version of the schema of objects stored in DB. It's recorded in DB, so stored objects could
+// be migrated to the latest schema version on server start, once Go types of the objects change
+type SchemaVersion struct {
+	runtime.TypeKind `yaml:",inline"`
+
+	// Version is the schema version of the stored objects
+	Version int
+
+	// MigratedAt is the time when objects have been migrated to the schema version
+	MigratedAt time.Time
+}
+
+// NewSchemaVersion creates a new schema version object
+func NewSchemaVersion(version int, migratedAt time.Time) *SchemaVersion {
+	return &SchemaVersion{
+		TypeKind:   SchemaVersionObject.GetTypeKind(),
+		Version:    version,
+		MigratedAt: migratedAt,
+	}
+}
+
+// GetNamespace returns an object namespace. It's a system namespace for schema version
+func (schema *SchemaVersion) GetNamespace() string {
+	return runtime.SystemNS
+}
+
+// GetName returns object name
+func (schema *SchemaVersion) GetName() string {
+	return runtime.EmptyName
+}
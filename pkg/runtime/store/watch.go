@@ -0,0 +1,156 @@
+package store
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	log "github.com/Sirupsen/logrus"
+	"strings"
+	"sync"
+)
+
+// WatchBufferSize is a number of events buffered for every watcher. Watcher, which doesn't keep up with changes and
+// gets its buffer filled, is stopped and its channel is closed, so it should start watching again and reload objects
+const WatchBufferSize = 1024
+
+// WatchEvent represents a change of stored object
+type WatchEvent struct {
+	// Key is a key of the changed object
+	Key string
+
+	// Object is the changed object as it has been written, or nil if it has been deleted. It's shared by all watchers
+	// of the change, so it should not be modified
+	Object runtime.Storable
+}
+
+// Change represents a single write to DB, which watchers get notified about once it's committed
+type Change struct {
+	// Key is a key of the changed object
+	Key string
+
+	// Data is the encoded object as it has been written, or nil if it has been deleted
+	Data []byte
+}
+
+// Notifier delivers in-process notifications about committed changes to the watchers of key prefixes. It's used by
+// the stores, which don't have their own way to watch changes. Changes are queued by the store while it holds its write
+// lock, so they are queued in the same order as they are committed, and get delivered after the lock is released
+type Notifier struct {
+	codec runtime.Codec
+
+	// queueMutex protects queue of changes, which haven't been delivered yet
+	queueMutex sync.Mutex
+	queue      []Change
+
+	// mutex protects watchers and makes sure changes are delivered one by one in the order they have been queued
+	mutex    sync.Mutex
+	watchers map[*watcher]bool
+}
+
+type watcher struct {
+	prefix string
+	events chan WatchEvent
+}
+
+// NewNotifier creates a new Notifier, which decodes changed objects using a given codec
+func NewNotifier(codec runtime.Codec) *Notifier {
+	return &Notifier{
+		codec:    codec,
+		watchers: make(map[*watcher]bool),
+	}
+}
+
+// Watch returns a channel with events about changes of objects with keys starting with a given prefix, and a function
+// to stop watching, which closes the channel
+func (n *Notifier) Watch(prefix string) (<-chan WatchEvent, func()) {
+	w := &watcher{prefix: prefix, events: make(chan WatchEvent, WatchBufferSize)}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.watchers[w] = true
+
+	return w.events, func() {
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+		n.stop(w)
+	}
+}
+
+// Queue queues given committed changes to be delivered to the watchers. It should be called while store holds its
+// write lock, so changes get delivered in the same order as they are committed
+func (n *Notifier) Queue(changes []Change) {
+	if len(changes) <= 0 {
+		return
+	}
+
+	n.queueMutex.Lock()
+	defer n.queueMutex.Unlock()
+	n.queue = append(n.queue, changes...)
+}
+
+// Deliver sends events about all queued changes to the watchers. It should be called once store releases its write
+// lock, so decoding of changed objects doesn't block writes. Every changed object gets decoded once and shared by all
+// watchers of the change
+func (n *Notifier) Deliver() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.queueMutex.Lock()
+	changes := n.queue
+	n.queue = nil
+	n.queueMutex.Unlock()
+
+	for _, change := range changes {
+		var watchers []*watcher
+		for w := range n.watchers {
+			if strings.HasPrefix(change.Key, w.prefix) {
+				watchers = append(watchers, w)
+			}
+		}
+		if len(watchers) <= 0 {
+			continue
+		}
+
+		event, err := n.decode(change)
+		for _, w := range watchers {
+			if err != nil {
+				log.Warnf("Stopping watch of %s: %s", w.prefix, err)
+				n.stop(w)
+				continue
+			}
+
+			select {
+			case w.events <- event:
+			default:
+				log.Warnf("Stopping watch of %s as it doesn't keep up with changes", w.prefix)
+				n.stop(w)
+			}
+		}
+	}
+}
+
+func (n *Notifier) decode(change Change) (WatchEvent, error) {
+	event := WatchEvent{Key: change.Key}
+	if change.Data == nil {
+		return event, nil
+	}
+
+	obj, err := n.codec.DecodeOne(change.Data)
+	if err != nil {
+		return event, fmt.Errorf("error while decoding changed object %s: %s", change.Key, err)
+	}
+	storable, ok := obj.(runtime.Storable)
+	if !ok {
+		return event, fmt.Errorf("storable object is expected to be decoded, but got: %s", obj.GetKind())
+	}
+	event.Object = storable
+
+	return event, nil
+}
+
+// stop removes watcher and closes its channel. Caller should hold the lock
+func (n *Notifier) stop(w *watcher) {
+	if n.watchers[w] {
+		delete(n.watchers, w)
+		close(w.events)
+	}
+}
@@ -1,6 +1,12 @@
 package server
 
-import "fmt"
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"os"
+	"os/signal"
+	"syscall"
+)
 
 type job struct {
 	name     string
@@ -27,7 +33,20 @@ func (server *Server) runInBackground(name string, infinite bool, f func()) {
 	go p.start()
 }
 
+// wait waits for background jobs to fail or for the server to be stopped by a signal. In the latter case shutdown
+// channel gets closed and server waits for the jobs, which clean up after themselves (e.g. leader election)
 func (server *Server) wait() {
-	err := <-server.backgroundErrors
-	panic(err)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-server.backgroundErrors:
+		panic(err)
+	case sig := <-signals:
+		log.Infof("Received signal %s, stopping server", sig)
+	}
+
+	close(server.shutdown)
+	server.shutdownJobs.Wait()
 }
@@ -0,0 +1,43 @@
+package server
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+func (server *Server) startCompaction() {
+	// Start DB compaction job
+	if server.cfg.Retention.Interval > 0 {
+		server.runInBackground("DB Compaction", true, func() {
+			panic(server.compactionLoop())
+		})
+	}
+}
+
+func (server *Server) compactionLoop() error {
+	for {
+		// only the leader compacts DB, so servers don't race on removing the same data
+		if server.isLeader() {
+			server.compact()
+		}
+
+		time.Sleep(server.cfg.Retention.Interval)
+	}
+}
+
+func (server *Server) compact() {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("Error while compacting DB (panic): %s", r)
+		}
+	}()
+
+	result, err := server.store.Compact(server.cfg.Retention, time.Now())
+	if err != nil {
+		log.Errorf("Error while compacting DB: %s", err)
+		return
+	}
+
+	log.Infof("DB compacted: %d revisions trimmed, %d revisions, %d policy generations and %d object generations removed, %d bytes of encoded data removed",
+		result.RevisionsTrimmed, result.RevisionsRemoved, result.PolicyGenerationsRemoved, result.ObjectGenerationsRemoved, result.RemovedDataBytes)
+}
@@ -4,11 +4,18 @@ import (
 	"fmt"
 	"github.com/Aptomi/aptomi/pkg/engine"
 	"github.com/Aptomi/aptomi/pkg/engine/apply"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action"
+	"github.com/Aptomi/aptomi/pkg/engine/apply/action/component"
 	"github.com/Aptomi/aptomi/pkg/engine/diff"
+	"github.com/Aptomi/aptomi/pkg/engine/progress"
 	"github.com/Aptomi/aptomi/pkg/engine/resolve"
+	"github.com/Aptomi/aptomi/pkg/engine/rollout"
 	"github.com/Aptomi/aptomi/pkg/event"
+	"github.com/Aptomi/aptomi/pkg/lang"
 	"github.com/Aptomi/aptomi/pkg/runtime"
+	"github.com/Aptomi/aptomi/pkg/util"
 	log "github.com/Sirupsen/logrus"
+	"reflect"
 	"time"
 )
 
@@ -18,9 +25,23 @@ func logError(err interface{}) {
 
 func (server *Server) enforceLoop() error {
 	for {
-		err := server.enforce()
-		if err != nil {
-			logError(err)
+		// only the leader enforces policy, the rest of the servers just wait to take over
+		if server.isLeader() {
+			err := server.enforce()
+			if err != nil {
+				logError(err)
+			}
+		} else {
+			log.Debugf("Not enforcing policy, as this server isn't the leader (leader: %s)", server.getLeader())
+		}
+
+		// if component outputs changed, resolve policy again right away to update components which consume them
+		server.enforceMutex.Lock()
+		outputsChanged := server.outputsChanged
+		server.outputsChanged = false
+		server.enforceMutex.Unlock()
+		if outputsChanged {
+			continue
 		}
 
 		// sleep for a specified time or wait until policy has changed, whichever comes first
@@ -35,7 +56,20 @@ func (server *Server) enforceLoop() error {
 	}
 }
 
+// enforcement holds everything needed to enforce a policy: current revision, desired policy, desired and actual states
+type enforcement struct {
+	currRevision     *engine.Revision
+	desiredPolicy    *lang.Policy
+	desiredPolicyGen runtime.Generation
+	desiredState     *resolve.PolicyResolution
+	actualState      *resolve.PolicyResolution
+	resolveLog       *event.Log
+}
+
 func (server *Server) enforce() error {
+	server.enforceMutex.Lock()
+	defer server.enforceMutex.Unlock()
+
 	server.enforcementIdx++
 
 	defer func() {
@@ -44,10 +78,101 @@ func (server *Server) enforce() error {
 		}
 	}()
 
+	data, err := server.resolve()
+	if err != nil {
+		return err
+	}
+
+	stateDiff := diff.NewPolicyResolutionDiff(data.desiredState, data.actualState)
+
+	// defer updates of service instances, which haven't been reached by staged rollouts yet
+	var prevRollouts map[string]*engine.RolloutProgress
+	if data.currRevision != nil {
+		prevRollouts = data.currRevision.Rollouts
+	}
+	rolloutPlanner := rollout.NewPlanner(data.desiredPolicy, data.desiredPolicyGen, data.desiredState, data.actualState, prevRollouts, time.Now())
+	actions, err := rolloutPlanner.Filter(stateDiff.Actions)
+	if err != nil {
+		return fmt.Errorf("error while planning rollout: %s", err)
+	}
+
+	nextRevision, err := server.store.NewRevision(data.desiredPolicyGen)
+	if err != nil {
+		return fmt.Errorf("unable to get next revision: %s", err)
+	}
+	nextRevision.ResolveLog = data.resolveLog.AsAPIEvents()
+	nextRevision.Rollouts = rolloutPlanner.Progress()
+
+	// policy changed while no actions needed to achieve desired state
+	currRevision := data.currRevision
+	if len(actions) <= 0 && currRevision != nil && currRevision.Policy == nextRevision.Policy {
+		// rollouts may be waiting for soak period or approval, record their progress in the current revision
+		if !reflect.DeepEqual(currRevision.Rollouts, nextRevision.Rollouts) {
+			currRevision.Rollouts = nextRevision.Rollouts
+			err = server.store.UpdateRevision(currRevision)
+			if err != nil {
+				return fmt.Errorf("error while saving rollout progress: %s", err)
+			}
+		}
+		log.Infof("(enforce-%d) No changes, policy gen %d", server.enforcementIdx, data.desiredPolicyGen)
+		return nil
+	}
+	log.Infof("(enforce-%d) New revision %d, policy gen %d, %d actions need to be applied", server.enforcementIdx, nextRevision.GetGeneration(), data.desiredPolicyGen, len(actions))
+
+	_, err = server.applyRevision(data, nextRevision, actions, rolloutPlanner)
+	return err
+}
+
+// enforceTargeted applies only the actions, which affect component instances matched by a given selector, in a
+// dedicated revision. The rest of the pending changes are left to the regular enforcement loop. Staged rollouts still
+// apply, so targeted enforcement doesn't update service instances, which haven't been reached by rollouts yet
+func (server *Server) enforceTargeted(selector *diff.Selector) (*engine.Revision, error) {
+	server.enforceMutex.Lock()
+	defer server.enforceMutex.Unlock()
+
+	if !server.isLeader() {
+		return nil, fmt.Errorf("this server isn't the leader, enforcement should be requested from the leader: %s", server.getLeader())
+	}
+
+	server.enforcementIdx++
+
+	data, err := server.resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	stateDiff := diff.NewPolicyResolutionDiff(data.desiredState, data.actualState)
+
+	// defer updates of service instances, which haven't been reached by staged rollouts yet
+	var prevRollouts map[string]*engine.RolloutProgress
+	if data.currRevision != nil {
+		prevRollouts = data.currRevision.Rollouts
+	}
+	rolloutPlanner := rollout.NewPlanner(data.desiredPolicy, data.desiredPolicyGen, data.desiredState, data.actualState, prevRollouts, time.Now())
+	actions, err := rolloutPlanner.Filter(stateDiff.FilterActions(selector))
+	if err != nil {
+		return nil, fmt.Errorf("error while planning rollout: %s", err)
+	}
+
+	nextRevision, err := server.store.NewRevision(data.desiredPolicyGen)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get next revision: %s", err)
+	}
+	nextRevision.ResolveLog = data.resolveLog.AsAPIEvents()
+	nextRevision.Rollouts = rolloutPlanner.Progress()
+
+	log.Infof("(enforce-%d) New targeted revision %d, policy gen %d, %d out of %d actions need to be applied", server.enforcementIdx, nextRevision.GetGeneration(), data.desiredPolicyGen, len(actions), len(stateDiff.Actions))
+
+	return server.applyRevision(data, nextRevision, actions, rolloutPlanner)
+}
+
+// resolve loads desired policy and actual state from the store and resolves policy. Resolution results get cached
+// and reused, until either policy or external data change
+func (server *Server) resolve() (*enforcement, error) {
 	// todo think about initial state when there is no revision at all
 	currRevision, err := server.store.GetRevision(runtime.LastGen)
 	if err != nil {
-		return fmt.Errorf("unable to get curr revision: %s", err)
+		return nil, fmt.Errorf("unable to get curr revision: %s", err)
 	}
 
 	// Mark last Revision as failed if it wasn't completed
@@ -61,49 +186,92 @@ func (server *Server) enforce() error {
 		log.Infof("(enforce-%d) Current revision that is in progress was reset to error state", server.enforcementIdx)
 	}
 
-	desiredPolicy, desiredPolicyGen, err := server.store.GetPolicy(runtime.LastGen)
+	desiredPolicyData, err := server.store.GetPolicyData(runtime.LastGen)
 	if err != nil {
-		return fmt.Errorf("error while getting desiredPolicy: %s", err)
+		return nil, fmt.Errorf("error while getting desiredPolicy data: %s", err)
 	}
 
 	// if policy is not found, it means it somehow was not initialized correctly. let's return error
-	if desiredPolicy == nil {
-		return fmt.Errorf("desiredPolicy is nil, does not exist in the store")
+	if desiredPolicyData == nil {
+		return nil, fmt.Errorf("desiredPolicy is nil, does not exist in the store")
+	}
+
+	desiredPolicy, desiredPolicyGen, err := server.store.GetPolicy(desiredPolicyData.GetGeneration())
+	if err != nil {
+		return nil, fmt.Errorf("error while getting desiredPolicy: %s", err)
 	}
 
 	actualState, err := server.store.GetActualState()
 	if err != nil {
-		return fmt.Errorf("error while getting actual state: %s", err)
+		return nil, fmt.Errorf("error while getting actual state: %s", err)
+	}
+
+	// retrieve outputs, which were not available during the previous runs. Cached resolution results can't be used
+	// anymore, if they have changed
+	if server.pollPendingOutputs(desiredPolicy, actualState) {
+		server.resolutionCache.Invalidate()
 	}
 
+	// let loaders detect changes in users and secrets, as they don't get called when cached resolution is used
+	server.externalData.Refresh()
+
 	resolveLog := event.NewLog(fmt.Sprintf("enforce-%d-resolve", server.enforcementIdx), true)
-	resolver := resolve.NewPolicyResolver(desiredPolicy, server.externalData, resolveLog)
-	desiredState, err := resolver.ResolveAllDependencies()
-	if err != nil {
-		server.saveErrRevision(currRevision, desiredPolicyGen, resolveLog)
+	cacheKey := resolve.NewResolutionCacheKey(desiredPolicyGen, server.externalData, time.Now())
+	desiredState := server.resolutionCache.Get(cacheKey)
+	if desiredState != nil {
+		resolveLog.WithFields(event.Fields{}).Infof("Policy gen %d and external data haven't changed, using cached policy resolution", desiredPolicyGen)
+	} else {
+		desiredState, err = server.resolver.ResolveAllDependencies(desiredPolicy, desiredPolicyData.Objects, server.externalData, actualState, resolveLog)
+		if err != nil {
+			server.saveErrRevision(currRevision, desiredPolicyGen, resolveLog)
 
-		return fmt.Errorf("cannot resolve desiredPolicy: %s", err)
+			return nil, fmt.Errorf("cannot resolve desiredPolicy: %s", err)
+		}
+		server.resolutionCache.Put(cacheKey, desiredState)
 	}
 
-	stateDiff := diff.NewPolicyResolutionDiff(desiredState, actualState)
+	return &enforcement{
+		currRevision:     currRevision,
+		desiredPolicy:    desiredPolicy,
+		desiredPolicyGen: desiredPolicyGen,
+		desiredState:     desiredState,
+		actualState:      actualState,
+		resolveLog:       resolveLog,
+	}, nil
+}
 
-	nextRevision, err := server.store.NewRevision(desiredPolicyGen)
-	if err != nil {
-		return fmt.Errorf("unable to get next revision: %s", err)
+// pollPendingOutputs retrieves outputs of deployed component instances, which were not available when they got created
+// or updated (e.g. load balancer address provisioned asynchronously by the cloud provider). Nothing gets changed in
+// the cloud, so it's done outside of revisions. It returns true if outputs have changed
+func (server *Server) pollPendingOutputs(desiredPolicy *lang.Policy, actualState *resolve.PolicyResolution) bool {
+	actions := []action.Base{}
+	for _, key := range util.GetSortedStringKeys(actualState.ComponentInstanceMap) {
+		if actualState.ComponentInstanceMap[key].OutputsPending {
+			actions = append(actions, component.NewOutputsAction(key))
+		}
+	}
+	if len(actions) <= 0 {
+		return false
 	}
-	nextRevision.ResolveLog = resolveLog.AsAPIEvents()
 
-	// policy changed while no actions needed to achieve desired state
-	if len(stateDiff.Actions) <= 0 && currRevision != nil && currRevision.Policy == nextRevision.Policy {
-		log.Infof("(enforce-%d) No changes, policy gen %d", server.enforcementIdx, desiredPolicyGen)
-		return nil
+	// outputs action only works with actual state, so it's passed as desired state as well
+	outputsLog := event.NewLog(fmt.Sprintf("enforce-%d-outputs", server.enforcementIdx), true)
+	applier := apply.NewEngineApply(desiredPolicy, actualState, actualState, server.store.GetActualStateUpdater(), server.externalData, server.pluginRegistryFactory(), actions, outputsLog, progress.NewNoop())
+	_, err := applier.Apply()
+	if err != nil {
+		log.Warnf("(enforce-%d) Error while retrieving pending outputs of component instances: %s", server.enforcementIdx, err)
 	}
-	log.Infof("(enforce-%d) New revision %d, policy gen %d, %d actions need to be applied", server.enforcementIdx, nextRevision.GetGeneration(), desiredPolicyGen, len(stateDiff.Actions))
 
+	return applier.OutputsChanged()
+}
+
+// applyRevision saves a given revision and applies actions in it. If rollout planner is specified, it gets to record
+// the results of applied actions in rollout progress
+func (server *Server) applyRevision(data *enforcement, nextRevision *engine.Revision, actions []action.Base, rolloutPlanner *rollout.Planner) (*engine.Revision, error) {
 	// Save revision
-	err = server.store.SaveRevision(nextRevision)
+	err := server.store.SaveRevision(nextRevision)
 	if err != nil {
-		return fmt.Errorf("error while saving new revision: %s", err)
+		return nil, fmt.Errorf("error while saving new revision: %s", err)
 	}
 
 	if server.cfg.Enforcer.Noop {
@@ -114,28 +282,39 @@ func (server *Server) enforce() error {
 
 	pluginRegistry := server.pluginRegistryFactory()
 	applyLog := event.NewLog(fmt.Sprintf("enforce-%d-apply", server.enforcementIdx), true)
-	applier := apply.NewEngineApply(desiredPolicy, desiredState, actualState, server.store.GetActualStateUpdater(), server.externalData, pluginRegistry, stateDiff.Actions, applyLog, server.store.GetRevisionProgressUpdater(nextRevision))
-	_, err = applier.Apply()
+	applier := apply.NewEngineApply(data.desiredPolicy, data.desiredState, data.actualState, server.store.GetActualStateUpdater(), server.externalData, pluginRegistry, actions, applyLog, server.store.GetRevisionProgressUpdater(nextRevision, applyLog))
+	actualState, err := applier.Apply()
+	if rolloutPlanner != nil {
+		rolloutPlanner.RecordResults(actualState)
+	}
+	if applier.OutputsChanged() {
+		// cached resolution results were calculated with old outputs and can't be used anymore
+		server.outputsChanged = true
+		server.resolutionCache.Invalidate()
+	}
 
 	// reload revision to have progress data saved into it
 	nextRevision, saveErr := server.store.GetRevision(runtime.LastGen)
 	if saveErr != nil {
-		return fmt.Errorf("error while reloading last revision to have progress loaded: %s", saveErr)
+		return nil, fmt.Errorf("error while reloading last revision to have progress loaded: %s", saveErr)
 	}
 	nextRevision.ApplyLog = applyLog.AsAPIEvents()
+	if rolloutPlanner != nil {
+		nextRevision.Rollouts = rolloutPlanner.Progress()
+	}
 
 	// save apply log
 	saveErr = server.store.UpdateRevision(nextRevision)
 	if saveErr != nil {
-		return fmt.Errorf("error while saving new revision with apply log: %s", saveErr)
+		return nil, fmt.Errorf("error while saving new revision with apply log: %s", saveErr)
 	}
 
 	if err != nil {
-		return fmt.Errorf("error while applying new revision: %s", err)
+		return nextRevision, fmt.Errorf("error while applying new revision: %s", err)
 	}
-	log.Infof("(enforce-%d) New revision %d successfully applied, %d component instances", server.enforcementIdx, nextRevision.GetGeneration(), len(desiredState.GetComponentProcessingOrder()))
+	log.Infof("(enforce-%d) New revision %d successfully applied, %d component instances", server.enforcementIdx, nextRevision.GetGeneration(), len(data.desiredState.GetComponentProcessingOrder()))
 
-	return nil
+	return nextRevision, nil
 }
 
 func (server *Server) saveErrRevision(currRevision *engine.Revision, desiredPolicyGen runtime.Generation, resolveLog *event.Log) {
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/lang"
+	"github.com/Aptomi/aptomi/pkg/runtime"
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+// systemUser is the name under which Aptomi server performs policy changes on its own
+const systemUser = "aptomi"
+
+func (server *Server) startDependencyExpiry() {
+	// Start dependency expiry job
+	if server.cfg.DependencyExpiry.Interval > 0 {
+		server.runInBackground("Dependency Expiry", true, func() {
+			panic(server.expiryLoop())
+		})
+	}
+}
+
+func (server *Server) expiryLoop() error {
+	// warned holds the expiry time for which a warning was already reported (dependency key -> expiry)
+	warned := make(map[string]time.Time)
+	for {
+		// only the leader removes expired dependencies, so servers don't race on policy changes
+		if server.isLeader() {
+			err := server.expireDependencies(warned)
+			if err != nil {
+				log.Errorf("Error while removing expired dependencies: %s", err)
+			}
+		}
+
+		time.Sleep(server.cfg.DependencyExpiry.Interval)
+	}
+}
+
+func (server *Server) expireDependencies(warned map[string]time.Time) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %s", r)
+		}
+	}()
+
+	policy, _, err := server.store.GetPolicy(runtime.LastGen)
+	if err != nil {
+		return fmt.Errorf("error while getting policy: %s", err)
+	}
+	if policy == nil {
+		return nil
+	}
+
+	now := time.Now()
+	expired := make([]lang.Base, 0)
+	for _, obj := range policy.GetObjectsByKind(lang.DependencyObject.Kind) {
+		dependency := obj.(*lang.Dependency)
+		expiry, ok := dependency.GetExpiry()
+		if !ok {
+			continue
+		}
+
+		key := runtime.KeyForStorable(dependency)
+		if dependency.IsExpired(now) {
+			log.Infof("Dependency %s (user '%s') expired at %s and will be removed from the policy", key, dependency.User, expiry)
+			// dependency gets marked as deleted by the store, so it's copied to keep the cached policy unchanged
+			expired = append(expired, dependency.MakeCopy())
+			delete(warned, key)
+		} else if expiry.Sub(now) <= server.cfg.DependencyExpiry.Warning && !warned[key].Equal(expiry) {
+			log.Warnf("Dependency %s (user '%s') will expire at %s, use 'aptomictl dependency extend' to renew it", key, dependency.User, expiry)
+			warned[key] = expiry
+		}
+	}
+
+	if len(expired) <= 0 {
+		return nil
+	}
+
+	changed, policyData, err := server.store.DeleteFromPolicy(expired, systemUser)
+	if err != nil {
+		return fmt.Errorf("error while deleting expired dependencies from policy: %s", err)
+	}
+
+	if changed {
+		log.Infof("Removed %d expired dependencies, policy gen %d", len(expired), policyData.GetGeneration())
+
+		// signal to the channel that policy has changed, that will trigger the enforcement right away
+		if !server.cfg.Enforcer.Disabled {
+			server.policyChanged <- true
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/election"
+	log "github.com/Sirupsen/logrus"
+	"time"
+)
+
+// enforcerLockName is the name of the lock, which is held by the server running the enforcer
+const enforcerLockName = "enforcer"
+
+// defaultLeaderTTL is used when leader election is enabled, but TTL isn't specified
+const defaultLeaderTTL = 15 * time.Second
+
+func (server *Server) startLeaderElection() {
+	// Start leader election job, so only one of the servers sharing the same DB runs the enforcer
+	if server.cfg.LeaderElection.Enabled {
+		id := server.cfg.LeaderElection.ID
+		if len(id) <= 0 {
+			id = election.DefaultID()
+		}
+		ttl := server.cfg.LeaderElection.TTL
+		if ttl <= 0 {
+			ttl = defaultLeaderTTL
+		}
+		server.elector = election.NewElector(server.store.GetLeaderLock(enforcerLockName), id, ttl)
+
+		// try to become the leader right away, so the enforcer doesn't have to wait for the next enforcement run
+		_, err := server.elector.Elect()
+		if err != nil {
+			log.Warnf("Error during leader election: %s", err)
+		}
+
+		// elector resigns once server is stopping, so another server could become the leader right away
+		server.shutdownJobs.Add(1)
+		server.runInBackground("Leader Election", false, func() {
+			defer server.shutdownJobs.Done()
+			server.elector.Run(server.shutdown)
+		})
+	}
+}
+
+// isLeader returns true if this server should run the enforcer. It's always the case if leader election is disabled
+func (server *Server) isLeader() bool {
+	return server.elector == nil || server.elector.IsLeader()
+}
+
+// getLeader returns identifier of the current leader for logging and error messages
+func (server *Server) getLeader() string {
+	if server.elector == nil {
+		return "this server"
+	}
+	leader, err := server.elector.Leader()
+	if err != nil {
+		return fmt.Sprintf("unknown (%s)", err)
+	}
+	if len(leader) <= 0 {
+		return "none"
+	}
+	return leader
+}
@@ -0,0 +1,28 @@
+package server
+
+import (
+	"fmt"
+	"github.com/Aptomi/aptomi/pkg/runtime/store"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/migration"
+	log "github.com/Sirupsen/logrus"
+)
+
+// migrateStore migrates stored objects to the latest schema version, so they could be decoded by the store. It's
+// done right after the store gets opened, before it's used by anything else
+func (server *Server) migrateStore(db store.Generic) {
+	result, err := migration.Run(db, migration.All, server.cfg.Migration.BackupDir, false)
+	if err != nil {
+		panic(fmt.Sprintf("error while migrating DB: %s", err))
+	}
+
+	if len(result.Applied) <= 0 {
+		log.Infof("DB schema version: %d", result.ToVersion)
+		return
+	}
+
+	log.Infof("DB backup written before migration: %s", result.Backup)
+	for _, applied := range result.Applied {
+		log.Infof("DB migrated to schema version %d: %s", applied.Version, applied.Description)
+	}
+	log.Infof("DB migrated from schema version %d to %d (objects changed: %d)", result.FromVersion, result.ToVersion, result.ObjectsChanged)
+}
@@ -5,6 +5,8 @@ import (
 	"github.com/Aptomi/aptomi/pkg/api"
 	"github.com/Aptomi/aptomi/pkg/api/middleware"
 	"github.com/Aptomi/aptomi/pkg/config"
+	"github.com/Aptomi/aptomi/pkg/election"
+	"github.com/Aptomi/aptomi/pkg/engine/resolve"
 	"github.com/Aptomi/aptomi/pkg/external"
 	"github.com/Aptomi/aptomi/pkg/external/secrets"
 	"github.com/Aptomi/aptomi/pkg/external/users"
@@ -17,21 +19,31 @@ import (
 	"github.com/Aptomi/aptomi/pkg/runtime"
 	"github.com/Aptomi/aptomi/pkg/runtime/store"
 	"github.com/Aptomi/aptomi/pkg/runtime/store/core"
-	"github.com/Aptomi/aptomi/pkg/runtime/store/generic/bolt"
+	"github.com/Aptomi/aptomi/pkg/runtime/store/generic"
 	"github.com/Aptomi/aptomi/pkg/server/ui"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gorilla/handlers"
 	"github.com/julienschmidt/httprouter"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 )
 
+// resolutionCacheSize is the number of policy resolution results kept in memory
+const resolutionCacheSize = 10
+
 // Server is Aptomi server. It serves UI front-end, API calls, as well as does policy resolution & continuous state enforcement
 type Server struct {
 	cfg              *config.Server
 	backgroundErrors chan string
 
+	// shutdown is closed once server is stopping, so background jobs could clean up after themselves
+	shutdown chan struct{}
+
+	// shutdownJobs are background jobs, which server waits for to clean up before it stops
+	shutdownJobs sync.WaitGroup
+
 	externalData          *external.Data
 	store                 store.Core
 	pluginRegistryFactory plugin.RegistryFactory
@@ -40,6 +52,21 @@ type Server struct {
 
 	policyChanged  chan bool
 	enforcementIdx uint
+
+	// enforceMutex makes sure that regular and targeted enforcement don't run at the same time
+	enforceMutex sync.Mutex
+
+	// resolver keeps resolution results between enforcement runs, so only affected dependencies get resolved again
+	resolver *resolve.IncrementalPolicyResolver
+
+	// resolutionCache holds resolution results for recent policy generations, it's shared by the enforcer and the API
+	resolutionCache *resolve.ResolutionCache
+
+	// elector takes part in leader election, if it's enabled. Only the leader runs the enforcer and the dependency expiry
+	elector *election.Elector
+
+	// outputsChanged is set by the enforcer when component outputs changed and dependents need to be updated right away
+	outputsChanged bool
 }
 
 // NewServer creates a new Aptomi Server
@@ -47,7 +74,10 @@ func NewServer(cfg *config.Server) *Server {
 	s := &Server{
 		cfg:              cfg,
 		backgroundErrors: make(chan string),
+		shutdown:         make(chan struct{}),
 		policyChanged:    make(chan bool),
+		resolver:         resolve.NewIncrementalPolicyResolver(),
+		resolutionCache:  resolve.NewResolutionCache(resolutionCacheSize),
 	}
 
 	return s
@@ -63,11 +93,14 @@ func (server *Server) Start() {
 	// See if policy initialization needs to happen on the first run
 	server.initPolicyOnFirstRun()
 
-	// Start API, UI and Enforcer
+	// Start Leader Election, API, UI, Enforcer, Dependency Expiry and DB Compaction
+	server.startLeaderElection()
 	server.startHTTPServer()
 	server.startEnforcer()
+	server.startDependencyExpiry()
+	server.startCompaction()
 
-	// Wait for jobs to complete (it essentially hangs forever)
+	// Wait for jobs to complete (it essentially hangs forever, until server is stopped)
 	server.wait()
 }
 
@@ -98,16 +131,19 @@ func (server *Server) initExternalData() {
 	server.externalData = external.NewData(
 		users.NewUserLoaderMultipleSources(userLoaders),
 		secrets.NewSecretLoaderFromDir(server.cfg.SecretsDir),
+		server.store.GetGeneratedSecretStore(),
 	)
 }
 
 func (server *Server) initStore() {
 	registry := runtime.NewRegistry().Append(store.Objects...)
-	b := bolt.NewGenericStore(registry)
-	err := b.Open(server.cfg.DB)
+	b, err := generic.NewStore(registry, server.cfg.DB)
 	if err != nil {
 		panic(fmt.Sprintf("Can't open object store: %s", err))
 	}
+
+	// stored objects are migrated before anything else gets them from the store
+	server.migrateStore(b)
 	server.store = core.NewStore(b)
 }
 
@@ -161,7 +197,7 @@ func (server *Server) startHTTPServer() {
 		log.Warnf("The auth.secret not specified in config, using insecure default one")
 	}
 
-	api.Serve(router, server.store, server.externalData, server.pluginRegistryFactory, server.cfg.Auth.Secret, server.policyChanged)
+	api.Serve(router, server.store, server.externalData, server.resolutionCache, server.pluginRegistryFactory, server.cfg.Auth.Secret, server.policyChanged, server.enforceTargeted)
 	server.serveUI(router)
 
 	var handler http.Handler = router
@@ -172,11 +208,11 @@ func (server *Server) startHTTPServer() {
 	// todo(slukjanov): add configurable handlers.ProxyHeaders to f behind the nginx or any other proxy
 	// todo(slukjanov): add compression handler and compress by default in client
 
+	// write timeout isn't set, as event streams (e.g. revision watch) keep writing into the response until they are done
 	server.httpServer = &http.Server{
-		Handler:      handler,
-		Addr:         server.cfg.API.ListenAddr(),
-		WriteTimeout: 5 * time.Second,
-		ReadTimeout:  30 * time.Second,
+		Handler:     handler,
+		Addr:        server.cfg.API.ListenAddr(),
+		ReadTimeout: 30 * time.Second,
 	}
 
 	// Start HTTP server
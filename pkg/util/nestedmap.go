@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 )
 
@@ -70,6 +71,22 @@ func (src NestedParameterMap) MakeCopy() NestedParameterMap {
 	return result
 }
 
+// MakeDeepCopy makes a deep copy of parameter structure, including all nested maps
+func (src NestedParameterMap) MakeDeepCopy() NestedParameterMap {
+	if src == nil {
+		return nil
+	}
+	result := NestedParameterMap{}
+	for k, v := range src {
+		if nestedMap, ok := v.(NestedParameterMap); ok {
+			result[k] = nestedMap.MakeDeepCopy()
+		} else {
+			result[k] = v
+		}
+	}
+	return result
+}
+
 // GetNestedMap returns nested parameter map by key
 func (src NestedParameterMap) GetNestedMap(key string) NestedParameterMap {
 	return src[key].(NestedParameterMap)
@@ -114,6 +131,59 @@ func (src NestedParameterMap) GetString(key string, defaultValue string) (string
 	return str, nil
 }
 
+// FindStringPaths returns a sorted list of paths ('key1.key2.key3') to all string values, which match a given function
+func (src NestedParameterMap) FindStringPaths(match func(string) bool) []string {
+	result := []string{}
+	findStringPaths(src, "", match, &result)
+	sort.Strings(result)
+	return result
+}
+
+func findStringPaths(node NestedParameterMap, path string, match func(string) bool, result *[]string) {
+	for key, value := range node {
+		keyPath := key
+		if len(path) > 0 {
+			keyPath = path + "." + key
+		}
+		if str, ok := value.(string); ok && match(str) {
+			*result = append(*result, keyPath)
+		} else if nestedMap, ok := value.(NestedParameterMap); ok {
+			findStringPaths(nestedMap, keyPath, match, result)
+		}
+	}
+}
+
+// Redact returns a copy of parameter structure, where values located by given paths ('key1.key2.key3') are replaced
+// with a given string. Parameter structure itself doesn't get modified
+func (src NestedParameterMap) Redact(paths []string, replacement string) NestedParameterMap {
+	if len(paths) == 0 {
+		return src
+	}
+	redact := make(map[string]bool)
+	for _, path := range paths {
+		redact[path] = true
+	}
+	return redactPaths(src, "", redact, replacement)
+}
+
+func redactPaths(node NestedParameterMap, path string, redact map[string]bool, replacement string) NestedParameterMap {
+	result := NestedParameterMap{}
+	for key, value := range node {
+		keyPath := key
+		if len(path) > 0 {
+			keyPath = path + "." + key
+		}
+		if redact[keyPath] {
+			result[key] = replacement
+		} else if nestedMap, ok := value.(NestedParameterMap); ok {
+			result[key] = redactPaths(nestedMap, keyPath, redact, replacement)
+		} else {
+			result[key] = value
+		}
+	}
+	return result
+}
+
 const (
 	includeMacrosPrefix = "@include "
 )
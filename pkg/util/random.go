@@ -1,6 +1,8 @@
 package util
 
 import (
+	crand "crypto/rand"
+	"encoding/binary"
 	"math/rand"
 )
 
@@ -19,3 +21,27 @@ func RandomID(rand *rand.Rand, length int) string {
 	}
 	return string(b)
 }
+
+// RandomSecret generates a random alphanumerical string, which starts with a letter. Unlike RandomID, it always uses
+// a cryptographically secure source of randomness, so it can be used to generate passwords and other secrets
+func RandomSecret(length int) string {
+	return RandomID(rand.New(cryptoSource{}), length)
+}
+
+// cryptoSource is a source of random numbers for math/rand, which is backed by crypto/rand
+type cryptoSource struct{}
+
+func (s cryptoSource) Seed(seed int64) {}
+
+func (s cryptoSource) Int63() int64 {
+	return int64(s.Uint64() & ^uint64(1<<63))
+}
+
+func (s cryptoSource) Uint64() uint64 {
+	var v uint64
+	err := binary.Read(crand.Reader, binary.BigEndian, &v)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
@@ -0,0 +1,31 @@
+package sync
+
+import (
+	"sync"
+)
+
+// Notifier is a helper to keep a list of listener functions and call all of them when something has changed
+type Notifier struct {
+	m         sync.Mutex
+	listeners []func()
+}
+
+// Subscribe adds a listener function, which will be called on every Notify call
+func (notifier *Notifier) Subscribe(listener func()) {
+	notifier.m.Lock()
+	defer notifier.m.Unlock()
+
+	notifier.listeners = append(notifier.listeners, listener)
+}
+
+// Notify calls all subscribed listener functions
+func (notifier *Notifier) Notify() {
+	notifier.m.Lock()
+	listeners := make([]func(), len(notifier.listeners))
+	copy(listeners, notifier.listeners)
+	notifier.m.Unlock()
+
+	for _, listener := range listeners {
+		listener()
+	}
+}
@@ -0,0 +1,22 @@
+package sync
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNotifier(t *testing.T) {
+	notifier := &Notifier{}
+
+	// no listeners
+	notifier.Notify()
+
+	calls := 0
+	notifier.Subscribe(func() { calls++ })
+	notifier.Subscribe(func() { calls += 10 })
+	notifier.Notify()
+	assert.Equal(t, 11, calls, "All listeners should be called")
+
+	notifier.Notify()
+	assert.Equal(t, 22, calls, "All listeners should be called again")
+}
@@ -19,7 +19,7 @@ func TestVisualizationDiagram(t *testing.T) {
 
 	// unit test policy resolved revision
 	eventLog := event.NewLog("test-resolve", false)
-	resolver := resolve.NewPolicyResolver(b.Policy(), b.External(), eventLog)
+	resolver := resolve.NewPolicyResolver(b.Policy(), b.External(), nil, eventLog)
 	resolutionNew, err := resolver.ResolveAllDependencies()
 	if !assert.NoError(t, err, "Policy should be resolved without errors") {
 		t.FailNow()
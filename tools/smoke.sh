@@ -131,7 +131,7 @@ function check_policy_version() {
     check_policy $1 .Metadata.Generation
 }
 
-WAIT_FLAGS="--wait --wait-attempts 20"
+WAIT_FLAGS="--wait --wait-timeout 40s"
 
 # apply full policy (w/o Carol)
 check_policy_version 1